@@ -0,0 +1,254 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	APIKeyScopeSiteRead      = "site:read"
+	APIKeyScopeSiteWrite     = "site:write"
+	APIKeyScopeUsersRead     = "users:read"
+	APIKeyScopeUsersWrite    = "users:write"
+	APIKeyScopeProjectsRead  = "projects:read"
+	APIKeyScopeProjectsWrite = "projects:write"
+	APIKeyScopeFilesRead     = "files:read"
+	APIKeyScopeFilesWrite    = "files:write"
+	APIKeyScopeReportsRead   = "reports:read"
+	APIKeyScopeNotesRead     = "notes:read"
+	APIKeyScopeNotesWrite    = "notes:write"
+	APIKeyScopeAuditRead     = "audit:read"
+
+	apiKeyPrefix        = "kak_"
+	apiKeyNameMaxLength = 128
+)
+
+var (
+	errAPIKeyNotFound = errors.New("api key not found")
+	errAPIKeyBadData  = errors.New("invalid api key")
+)
+
+// apiKeyScopes are the valid scopes
+var apiKeyScopes = map[string]bool{
+	APIKeyScopeSiteRead:      true,
+	APIKeyScopeSiteWrite:     true,
+	APIKeyScopeUsersRead:     true,
+	APIKeyScopeUsersWrite:    true,
+	APIKeyScopeProjectsRead:  true,
+	APIKeyScopeProjectsWrite: true,
+	APIKeyScopeFilesRead:     true,
+	APIKeyScopeFilesWrite:    true,
+	APIKeyScopeReportsRead:   true,
+	APIKeyScopeNotesRead:     true,
+	APIKeyScopeNotesWrite:    true,
+	APIKeyScopeAuditRead:     true,
+}
+
+// apiKeyScopeResources maps the first part of an admin or researcher path to the resource in the scope, so
+// /admin/modules/{moduleID} needs projects:read or projects:write
+var apiKeyScopeResources = map[string]string{
+	"site":     "site",
+	"users":    "users",
+	"erasures": "users",
+	"projects": "projects",
+	"modules":  "projects",
+	"blocks":   "projects",
+	"files":    "files",
+	"reports":  "reports",
+	"notes":    "notes",
+	"audit":    "audit",
+}
+
+// APIKey is a long lived key an admin can use for scripts instead of logging in. The key acts as the user that created
+// it, limited to its scopes. Only a hash of the key is stored
+type APIKey struct {
+	ID         int64    `json:"id" db:"id"`
+	UserID     int64    `json:"userId" db:"userId"`
+	Name       string   `json:"name" db:"name"`
+	Prefix     string   `json:"prefix" db:"prefix"` // the start of the key so it can be recognized later
+	KeyHash    string   `json:"-" db:"keyHash"`
+	ScopesDB   string   `json:"-" db:"scopes"`
+	Scopes     []string `json:"scopes" db:"-"`
+	CreatedOn  string   `json:"createdOn" db:"createdOn"`
+	LastUsedOn string   `json:"lastUsedOn" db:"lastUsedOn"`
+	Key        string   `json:"key,omitempty"` // only returned when created
+}
+
+// CreateAPIKey generates and saves a new key; the plain key is set on the input and is never available again
+func CreateAPIKey(input *APIKey) error {
+	if input.Name == "" || len(input.Name) > apiKeyNameMaxLength {
+		return fmt.Errorf("%w: name must be between 1 and %d characters", errAPIKeyBadData, apiKeyNameMaxLength)
+	}
+	if len(input.Scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", errAPIKeyBadData)
+	}
+	for _, scope := range input.Scopes {
+		if !apiKeyScopes[scope] {
+			return fmt.Errorf("%w: unknown scope %s", errAPIKeyBadData, scope)
+		}
+	}
+	key, err := generateAPIKey()
+	if err != nil {
+		return err
+	}
+	input.KeyHash = hashAPIKey(key)
+	input.Prefix = key[0 : len(apiKeyPrefix)+8]
+	input.processForDB()
+	defer input.processForAPI()
+	res, err := config.DBConnection.NamedExec(`INSERT INTO ApiKeys (userId, name, prefix, keyHash, scopes, createdOn, lastUsedOn)
+	VALUES
+	(:userId, :name, :prefix, :keyHash, :scopes, :createdOn, :lastUsedOn)`, input)
+	if err != nil {
+		return err
+	}
+	input.ID, _ = res.LastInsertId()
+	input.Key = key
+	return nil
+}
+
+// GetAPIKeysForUser gets the keys for a user, without the keys themselves
+func GetAPIKeysForUser(userID int64) ([]APIKey, error) {
+	keys := []APIKey{}
+	err := config.DBConnection.Select(&keys, `SELECT * FROM ApiKeys WHERE userId = ? ORDER BY createdOn DESC`, userID)
+	for i := range keys {
+		keys[i].processForAPI()
+	}
+	return keys, err
+}
+
+// GetAPIKeyForUser gets a single key for the user
+func GetAPIKeyForUser(userID, apiKeyID int64) (*APIKey, error) {
+	apiKey := &APIKey{}
+	defer apiKey.processForAPI()
+	err := config.DBConnection.Get(apiKey, `SELECT * FROM ApiKeys WHERE userId = ? AND id = ?`, userID, apiKeyID)
+	return apiKey, err
+}
+
+// DeleteAPIKey revokes a key
+func DeleteAPIKey(apiKeyID int64) error {
+	_, err := config.DBConnection.Exec(`DELETE FROM ApiKeys WHERE id = ?`, apiKeyID)
+	return err
+}
+
+// DeleteAPIKeysForUser revokes all of the keys for a user
+func DeleteAPIKeysForUser(userID int64) error {
+	_, err := config.DBConnection.Exec(`DELETE FROM ApiKeys WHERE userId = ?`, userID)
+	return err
+}
+
+// getUserForAPIKey looks up the key and builds the same user the access token would have, with the key's scopes. The
+// user's current role and status are used, so demoting or disabling the user also limits their keys
+func getUserForAPIKey(key string) (jwtUser, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return jwtUser{}, errAPIKeyNotFound
+	}
+	apiKey := &APIKey{}
+	err := config.DBConnection.Get(apiKey, `SELECT * FROM ApiKeys WHERE keyHash = ?`, hashAPIKey(key))
+	if err != nil {
+		return jwtUser{}, errAPIKeyNotFound
+	}
+	apiKey.processForAPI()
+	user, err := GetUserByID(apiKey.UserID)
+	if err != nil {
+		return jwtUser{}, err
+	}
+	err = userCanAuthenticate(user)
+	if err != nil {
+		return jwtUser{}, err
+	}
+	config.DBConnection.Exec(`UPDATE ApiKeys SET lastUsedOn = ? WHERE id = ?`, time.Now().Format(timeFormatDB), apiKey.ID)
+
+	keyUser := newJWTUser(user, 0)
+	keyUser.APIKeyID = apiKey.ID
+	keyUser.Scopes = apiKey.Scopes
+	return keyUser, nil
+}
+
+// getAPIKeyScopeForRequest works out the scope needed for an admin or researcher route from the path and the method;
+// reads need resource:read and anything else needs resource:write. Other routes return an empty scope and cannot be
+// used with a key
+func getAPIKeyScopeForRequest(r *http.Request) string {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || (parts[0] != "admin" && parts[0] != "researcher") {
+		return ""
+	}
+	resource, found := apiKeyScopeResources[parts[1]]
+	if !found {
+		return ""
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return resource + ":read"
+	}
+	return resource + ":write"
+}
+
+// apiKeyHasScope checks if the scopes include the required scope
+func apiKeyHasScope(scopes []string, required string) bool {
+	if required == "" {
+		return false
+	}
+	for _, scope := range scopes {
+		if scope == required {
+			return true
+		}
+	}
+	return false
+}
+
+// generateAPIKey creates a new random key with the kak_ prefix so it is easy to spot in logs and secret scanners
+func generateAPIKey() (string, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(b), nil
+}
+
+// hashAPIKey hashes the key for storage; since the keys are long and random, a plain sha256 is enough
+func hashAPIKey(key string) string {
+	hashed := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hashed[:])
+}
+
+//
+// processors
+//
+
+func (input *APIKey) processForDB() {
+	now := time.Now().Format(timeFormatDB)
+	if input.CreatedOn == "" {
+		input.CreatedOn = now
+	} else {
+		input.CreatedOn, _ = parseTimeToTimeFormat(input.CreatedOn, timeFormatDB)
+	}
+	if input.LastUsedOn == "" {
+		input.LastUsedOn = now
+	} else {
+		input.LastUsedOn, _ = parseTimeToTimeFormat(input.LastUsedOn, timeFormatDB)
+	}
+	scopes := append([]string{}, input.Scopes...)
+	sort.Strings(scopes)
+	input.ScopesDB = strings.Join(scopes, ",")
+}
+
+func (input *APIKey) processForAPI() {
+	input.CreatedOn, _ = parseTimeToTimeFormat(input.CreatedOn, timeFormatAPI)
+	input.LastUsedOn, _ = parseTimeToTimeFormat(input.LastUsedOn, timeFormatAPI)
+	input.Scopes = []string{}
+	if input.ScopesDB != "" {
+		input.Scopes = strings.Split(input.ScopesDB, ",")
+	}
+}
+
+// Bind binds the data for the HTTP
+func (data *APIKey) Bind(r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyScopes(t *testing.T) {
+	tests := map[string]string{
+		"GET /admin/reports/projects/1/status":         APIKeyScopeReportsRead,
+		"GET /admin/projects/1/modules/2/blocks/3":     APIKeyScopeProjectsRead,
+		"PATCH /admin/modules/2":                       APIKeyScopeProjectsWrite,
+		"POST /admin/files":                            APIKeyScopeFilesWrite,
+		"GET /admin/files/1/download":                  APIKeyScopeFilesRead,
+		"DELETE /admin/users/1/sessions":               APIKeyScopeUsersWrite,
+		"GET /researcher/projects/1/consent/responses": APIKeyScopeProjectsRead,
+		"GET /me":                   "",
+		"POST /me/apikeys":          "",
+		"GET /participant/projects": "",
+		"GET /admin/unknown":        "",
+	}
+	for route, expected := range tests {
+		parts := strings.Split(route, " ")
+		r, _ := http.NewRequest(parts[0], parts[1], nil)
+		assert.Equal(t, expected, getAPIKeyScopeForRequest(r), route)
+	}
+
+	assert.True(t, apiKeyHasScope([]string{APIKeyScopeReportsRead, APIKeyScopeFilesRead}, APIKeyScopeFilesRead))
+	assert.False(t, apiKeyHasScope([]string{APIKeyScopeReportsRead}, APIKeyScopeFilesRead))
+	assert.False(t, apiKeyHasScope([]string{APIKeyScopeReportsRead}, ""))
+
+	key, err := generateAPIKey()
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(key, apiKeyPrefix))
+	assert.Equal(t, 64, len(hashAPIKey(key)))
+}
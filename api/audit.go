@@ -0,0 +1,511 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+)
+
+const (
+	AuditActionRead   = "read"
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+
+	auditEventsDefaultCount = 100
+	auditEventsMaxCount     = 1000
+
+	// auditRequestBodyMaxBytes is the most of a JSON request body kept as the change when a route doesn't record one
+	auditRequestBodyMaxBytes = 64 * 1024
+
+	// auditLockTimeoutSeconds is how long to wait for another request to finish adding to the site's chain
+	auditLockTimeoutSeconds = 10
+)
+
+// auditSensitiveReadPaths are the parts of a path that mark a read as touching participant data, so who looked at it
+// is recorded. Every other read is left out to keep the log useful
+var auditSensitiveReadPaths = []string{
+	"/users",
+	"/consent/responses",
+	"/submissions",
+	"/reports/",
+	"/erasures",
+	"/sessions",
+	"/export",
+	"/audit",
+}
+
+// AuditEvent records an administrative change or a read of participant data on a site. Each event's hash covers its
+// fields and the hash of the site's previous event, so editing or removing an event breaks the chain after it. The
+// actor, API key, and IP are personal data that erasure clears, so the hash covers ActorRef, a keyed hash of them,
+// instead; the chain still verifies after an erasure, and ActorRef is checked against them until then
+type AuditEvent struct {
+	ID           int64                  `json:"id" db:"id"`
+	SiteID       int64                  `json:"siteId" db:"siteId"`
+	ActorID      int64                  `json:"actorId" db:"actorId"`
+	APIKeyID     int64                  `json:"apiKeyId" db:"apiKeyId"`
+	ActorRef     string                 `json:"actorRef" db:"actorRef"`
+	Action       string                 `json:"action" db:"action"`
+	Method       string                 `json:"method" db:"method"`
+	Route        string                 `json:"route" db:"route"`
+	Path         string                 `json:"path" db:"path"`
+	TargetType   string                 `json:"targetType" db:"targetType"`
+	TargetID     int64                  `json:"targetId" db:"targetId"`
+	ChangesDB    string                 `json:"-" db:"changes"`
+	Changes      map[string]AuditChange `json:"changes" db:"-"`
+	IP           string                 `json:"ip" db:"ip"`
+	RequestID    string                 `json:"requestId" db:"requestId"`
+	Status       int                    `json:"status" db:"status"`
+	OccurredOn   string                 `json:"occurredOn" db:"occurredOn"`
+	PreviousHash string                 `json:"previousHash" db:"previousHash"`
+	EventHash    string                 `json:"eventHash" db:"eventHash"`
+}
+
+// AuditChange is a field's value before and after the action; one is nil when the record was created or removed
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditEventFilter limits the events returned; blank or zero fields are ignored
+type AuditEventFilter struct {
+	ActorID    int64
+	Action     string
+	TargetType string
+	TargetID   int64
+	Route      string
+	From       string
+	To         string
+	Count      int64
+	Offset     int64
+}
+
+// AuditChainVerification is the result of checking a site's hash chain
+type AuditChainVerification struct {
+	Valid          string `json:"valid"`
+	EventsChecked  int64  `json:"eventsChecked"`
+	FirstInvalidID int64  `json:"firstInvalidId,omitempty"`
+}
+
+// auditRecord is what a route can add to its audit event; the middleware puts a pointer in the context
+type auditRecord struct {
+	Before interface{}
+	After  interface{}
+}
+
+// appContextAudit is the key for the request's audit record
+const appContextAudit key = "audit"
+
+// setAuditChange records the state of what the route changed, before and after, for its audit event. Either can be
+// nil, such as when a record is created or removed. It does nothing outside of an audited route
+func setAuditChange(r *http.Request, before, after interface{}) {
+	record, ok := r.Context().Value(appContextAudit).(*auditRecord)
+	if !ok || record == nil {
+		return
+	}
+	record.Before = before
+	record.After = after
+}
+
+// getAuditActionForMethod maps the method to the action
+func getAuditActionForMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return AuditActionRead
+	case http.MethodPost:
+		return AuditActionCreate
+	case http.MethodDelete:
+		return AuditActionDelete
+	}
+	return AuditActionUpdate
+}
+
+// shouldAuditRequest is true for every change and for reads of participant data
+func shouldAuditRequest(method, path string) bool {
+	if method == http.MethodOptions {
+		return false
+	}
+	if getAuditActionForMethod(method) != AuditActionRead {
+		return true
+	}
+	for _, sensitive := range auditSensitiveReadPaths {
+		if strings.Contains(path, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditMiddleware saves an audit event for each audited request once the route is done, including requests that
+// failed. It goes after the permission checks, so the actor is known
+func auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !shouldAuditRequest(r.Method, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		record := &auditRecord{}
+		if !isAuditRead(r) {
+			// routes that don't record their own change still keep what was asked for
+			record.After = readAuditRequestBody(r)
+		}
+		wrapped := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ctx := context.WithValue(r.Context(), appContextAudit, record)
+		next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+		event := newAuditEventForRequest(r, wrapped.Status(), record)
+		err := CreateAuditEvent(event)
+		if err != nil {
+			Log(LogLevelError, "audit_event_not_saved", err.Error(), &LogOptions{
+				Context: r.Context(),
+				ExtraData: map[string]interface{}{
+					"route":  event.Route,
+					"status": event.Status,
+				},
+			})
+		}
+	})
+}
+
+func isAuditRead(r *http.Request) bool {
+	return getAuditActionForMethod(r.Method) == AuditActionRead
+}
+
+// readAuditRequestBody reads a JSON body and puts it back for the route. Uploads and large bodies are not kept
+func readAuditRequestBody(r *http.Request) interface{} {
+	if r.Body == nil || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, auditRequestBodyMaxBytes+1))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil || len(body) > auditRequestBodyMaxBytes {
+		return nil
+	}
+	var decoded interface{}
+	if json.Unmarshal(body, &decoded) != nil {
+		return nil
+	}
+	return decoded
+}
+
+// newAuditEventForRequest builds the event from the request once the route is done. The target is the last id in the
+// route, so /admin/projects/{projectID}/users/{userID} targets the user
+func newAuditEventForRequest(r *http.Request, status int, record *auditRecord) *AuditEvent {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	event := &AuditEvent{
+		SiteID:    getSiteIDFromHTTPContext(r),
+		Action:    getAuditActionForMethod(r.Method),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		IP:        getIPFromRequest(r),
+		RequestID: middleware.GetReqID(r.Context()),
+		Status:    status,
+	}
+	user, err := getUserFromHTTPContext(r)
+	if err == nil {
+		event.ActorID = user.ID
+		event.APIKeyID = user.APIKeyID
+	}
+	routeContext := chi.RouteContext(r.Context())
+	if routeContext != nil {
+		event.Route = routeContext.RoutePattern()
+		for i := len(routeContext.URLParams.Keys) - 1; i >= 0; i-- {
+			name := routeContext.URLParams.Keys[i]
+			if !strings.HasSuffix(name, "ID") {
+				continue
+			}
+			id, err := strconv.ParseInt(routeContext.URLParams.Values[i], 10, 64)
+			if err == nil {
+				event.TargetType = strings.TrimSuffix(name, "ID")
+				event.TargetID = id
+			}
+			break
+		}
+	}
+	if event.Route == "" {
+		event.Route = event.Path
+	}
+	if event.TargetType == "" {
+		// a list or a create, so the target is the first part of the path, such as users
+		parts := strings.Split(strings.Trim(event.Route, "/"), "/")
+		if len(parts) > 1 {
+			event.TargetType = parts[1]
+		}
+	}
+	event.Changes = diffAuditValues(record.Before, record.After)
+	return event
+}
+
+// diffAuditValues compares the fields of the before and after values and keeps the ones that differ. Values are
+// compared through their JSON form and then redacted, so a changed password or name is noted without being kept
+func diffAuditValues(before, after interface{}) map[string]AuditChange {
+	changes := map[string]AuditChange{}
+	beforeFields := getAuditFields(before)
+	afterFields := getAuditFields(after)
+	for field, value := range beforeFields {
+		if !reflect.DeepEqual(value, afterFields[field]) {
+			changes[field] = AuditChange{
+				Before: redactLogValue(field, value),
+				After:  redactLogValue(field, afterFields[field]),
+			}
+		}
+	}
+	for field, value := range afterFields {
+		if _, ok := beforeFields[field]; !ok && value != nil {
+			changes[field] = AuditChange{
+				After: redactLogValue(field, value),
+			}
+		}
+	}
+	return changes
+}
+
+// getAuditFields flattens a value to its top level fields; values that aren't objects are kept as "value"
+func getAuditFields(value interface{}) map[string]interface{} {
+	if value == nil {
+		return map[string]interface{}{}
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	var decoded interface{}
+	json.Unmarshal(encoded, &decoded)
+	if fields, ok := decoded.(map[string]interface{}); ok {
+		return fields
+	}
+	if decoded == nil {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"value": decoded,
+	}
+}
+
+// CreateAuditEvent saves the event at the end of its site's chain. The site's last event is locked while the new one
+// is added, so two events can't claim the same previous hash
+func CreateAuditEvent(input *AuditEvent) error {
+	input.processForDB()
+	defer input.processForAPI()
+
+	// the last event is locked while the new one is added, but when the site has none there is no row to lock, so
+	// appends are serialized with a named lock for the site. The lock belongs to the connection, so one is held from
+	// the pool for the transaction
+	ctx := context.Background()
+	conn, err := config.DBConnection.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	lockName := getAuditLockName(input.SiteID)
+	locked := sql.NullInt64{}
+	err = conn.GetContext(ctx, &locked, "SELECT GET_LOCK(?, ?)", lockName, auditLockTimeoutSeconds)
+	if err != nil {
+		return err
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return errors.New("timed out waiting to add to the audit chain")
+	}
+	defer conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", lockName)
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	previousHash := ""
+	err = tx.Get(&previousHash, `SELECT eventHash FROM AuditEvents WHERE siteId = ? ORDER BY id DESC LIMIT 1 FOR UPDATE`, input.SiteID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		return err
+	}
+	input.PreviousHash = previousHash
+	input.ActorRef = input.actorRef()
+	input.EventHash = input.hash()
+	res, err := tx.NamedExec(`INSERT INTO AuditEvents (siteId, actorId, apiKeyId, actorRef, action, method, route, path, targetType, targetId, changes, ip, requestId, status, occurredOn, previousHash, eventHash)
+	VALUES
+	(:siteId, :actorId, :apiKeyId, :actorRef, :action, :method, :route, :path, :targetType, :targetId, :changes, :ip, :requestId, :status, :occurredOn, :previousHash, :eventHash)`, input)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	input.ID, _ = res.LastInsertId()
+	return tx.Commit()
+}
+
+// GetAuditEvents gets the site's events that match the filter, newest first
+func GetAuditEvents(siteID int64, filter *AuditEventFilter) ([]AuditEvent, error) {
+	events := []AuditEvent{}
+	where := []string{"siteId = ?"}
+	args := []interface{}{siteID}
+	if filter.ActorID != 0 {
+		where = append(where, "actorId = ?")
+		args = append(args, filter.ActorID)
+	}
+	if filter.Action != "" {
+		where = append(where, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.TargetType != "" {
+		where = append(where, "targetType = ?")
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != 0 {
+		where = append(where, "targetId = ?")
+		args = append(args, filter.TargetID)
+	}
+	if filter.Route != "" {
+		where = append(where, "route = ?")
+		args = append(args, filter.Route)
+	}
+	if filter.From != "" {
+		from, err := parseTimeToTimeFormat(filter.From, timeFormatDB)
+		if err != nil {
+			return events, err
+		}
+		where = append(where, "occurredOn >= ?")
+		args = append(args, from)
+	}
+	if filter.To != "" {
+		to, err := parseTimeToTimeFormat(filter.To, timeFormatDB)
+		if err != nil {
+			return events, err
+		}
+		where = append(where, "occurredOn <= ?")
+		args = append(args, to)
+	}
+	if filter.Count <= 0 || filter.Count > auditEventsMaxCount {
+		filter.Count = auditEventsDefaultCount
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	args = append(args, filter.Count, filter.Offset)
+	err := config.DBConnection.Select(&events, fmt.Sprintf(`SELECT * FROM AuditEvents WHERE %s ORDER BY id DESC LIMIT ? OFFSET ?`, strings.Join(where, " AND ")), args...)
+	for i := range events {
+		events[i].processForAPI()
+	}
+	return events, err
+}
+
+// VerifyAuditChain recomputes every hash for the site, oldest first, and reports the first event that doesn't match
+// its fields or the event before it
+func VerifyAuditChain(siteID int64) (*AuditChainVerification, error) {
+	result := &AuditChainVerification{
+		Valid: Yes,
+	}
+	previousHash := ""
+	lastID := int64(0)
+	for {
+		events := []AuditEvent{}
+		err := config.DBConnection.Select(&events, `SELECT * FROM AuditEvents WHERE siteId = ? AND id > ? ORDER BY id LIMIT 500`, siteID, lastID)
+		if err != nil {
+			return result, err
+		}
+		if len(events) == 0 {
+			return result, nil
+		}
+		for i := range events {
+			result.EventsChecked++
+			if events[i].PreviousHash != previousHash || events[i].hash() != events[i].EventHash || !events[i].actorRefMatches() {
+				result.Valid = No
+				result.FirstInvalidID = events[i].ID
+				return result, nil
+			}
+			previousHash = events[i].EventHash
+			lastID = events[i].ID
+		}
+	}
+}
+
+// hash covers every stored field but the erasable actor fields, which are covered by the actor ref, and the previous
+// hash; the time is always hashed in the DB format. It is an HMAC with KESPLORA_API_AUDIT_KEY, so without the key
+// someone who can write to the DB can't recompute the chain; if the key is blank, it only catches accidental edits
+func (input *AuditEvent) hash() string {
+	occurredOn, _ := parseTimeToTimeFormat(input.OccurredOn, timeFormatDB)
+	return auditHMAC(
+		input.PreviousHash,
+		strconv.FormatInt(input.SiteID, 10),
+		input.ActorRef,
+		input.Action,
+		input.Method,
+		input.Route,
+		input.Path,
+		input.TargetType,
+		strconv.FormatInt(input.TargetID, 10),
+		input.ChangesDB,
+		input.RequestID,
+		strconv.Itoa(input.Status),
+		occurredOn,
+	)
+}
+
+// actorRef is the keyed hash of who made the request, kept so the chain survives the actor being erased
+func (input *AuditEvent) actorRef() string {
+	return auditHMAC(
+		strconv.FormatInt(input.SiteID, 10),
+		strconv.FormatInt(input.ActorID, 10),
+		strconv.FormatInt(input.APIKeyID, 10),
+		input.IP,
+	)
+}
+
+// actorRefMatches checks the actor fields haven't been changed. Once erased they are all blank and can't be checked,
+// which is what erasure is for
+func (input *AuditEvent) actorRefMatches() bool {
+	if input.ActorID == 0 && input.APIKeyID == 0 && input.IP == "" {
+		return true
+	}
+	return hmac.Equal([]byte(input.actorRef()), []byte(input.ActorRef))
+}
+
+func auditHMAC(values ...string) string {
+	mac := hmac.New(sha256.New, []byte(config.AuditKey))
+	mac.Write([]byte(strings.Join(values, "|")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func getAuditLockName(siteID int64) string {
+	return fmt.Sprintf("kesplora_audit_%d", siteID)
+}
+
+//
+// processors
+//
+
+func (input *AuditEvent) processForDB() {
+	if input.OccurredOn == "" {
+		input.OccurredOn = time.Now().Format(timeFormatDB)
+	} else {
+		input.OccurredOn, _ = parseTimeToTimeFormat(input.OccurredOn, timeFormatDB)
+	}
+	if input.Changes == nil {
+		input.Changes = map[string]AuditChange{}
+	}
+	changes, _ := json.Marshal(input.Changes)
+	input.ChangesDB = string(changes)
+}
+
+func (input *AuditEvent) processForAPI() {
+	input.OccurredOn, _ = parseTimeToTimeFormat(input.OccurredOn, timeFormatAPI)
+	input.Changes = map[string]AuditChange{}
+	if input.ChangesDB != "" {
+		json.Unmarshal([]byte(input.ChangesDB), &input.Changes)
+	}
+}
@@ -9,6 +9,7 @@ import (
 // Block is a block of content, which has the details filled out in linked tables
 type Block struct {
 	ID           int64       `json:"id" db:"id"`
+	SiteID       int64       `json:"siteId" db:"siteId"`
 	Name         string      `json:"name" db:"name"`
 	Summary      string      `json:"summary" db:"summary"`
 	BlockType    string      `json:"blockType" db:"blockType"`
@@ -53,7 +54,7 @@ func isValidBlockType(search string) bool {
 func CreateBlock(input *Block) error {
 	input.processForDB()
 	defer input.processForAPI()
-	res, err := config.DBConnection.NamedExec(`INSERT INTO Blocks SET name = :name, summary = :summary, blockType = :blockType, allowReset = :allowReset`, input)
+	res, err := config.DBConnection.NamedExec(`INSERT INTO Blocks SET siteId = :siteId, name = :name, summary = :summary, blockType = :blockType, allowReset = :allowReset`, input)
 	if err != nil {
 		return err
 	}
@@ -62,28 +63,29 @@ func CreateBlock(input *Block) error {
 }
 
 // GetBlocksForSite gets the blocks for the site, usually used in admin views for linking and setting up flows
-func GetBlocksForSite() ([]Block, error) {
+func GetBlocksForSite(siteID int64) ([]Block, error) {
 	blocks := []Block{}
 	err := config.DBConnection.Select(&blocks, `SELECT b.*, COUNT(bmf.moduleId) AS foundInFlows FROM
 	Blocks b
 	LEFT JOIN BlockModuleFlows bmf ON bmf.blockId = b.id 
+	WHERE b.siteId = ?
 	GROUP BY b.id, b.name, b.summary, b.blockType
-	ORDER BY b.name`)
+	ORDER BY b.name`, siteID)
 	for i := range blocks {
 		blocks[i].processForAPI()
 	}
 	return blocks, err
 }
 
-// GetBlockByID gets a single block by id
-func GetBlockByID(blockID int64) (*Block, error) {
+// GetBlockByID gets a single block on the site by id
+func GetBlockByID(siteID, blockID int64) (*Block, error) {
 	block := &Block{}
 	defer block.processForAPI()
 	err := config.DBConnection.Get(block, `SELECT b.*, COUNT(bmf.moduleId) AS foundInFlows FROM
 	Blocks b
 	LEFT JOIN BlockModuleFlows bmf ON bmf.blockId = b.id 
-	WHERE b.id = ?
-	GROUP BY b.id, b.name, b.summary, b.blockType`, blockID)
+	WHERE b.id = ? AND b.siteId = ?
+	GROUP BY b.id, b.name, b.summary, b.blockType`, blockID, siteID)
 	return block, err
 }
 
@@ -96,7 +96,7 @@ type BlockFormQestionResponseInput struct {
 func SaveBlockForm(input *BlockForm) error {
 	input.processForDB()
 	defer input.processForAPI()
-	_, err := config.DBConnection.NamedExec(`INSERT INTO BlockForm SET blockId = :blockId, formType = :formType ON DUPLICATE KEY UPDATE formType = :formType`, input)
+	_, err := config.DBConnection.NamedExec(`INSERT INTO BlockForm SET blockId = :blockId, formType = :formType, allowResubmit = :allowResubmit ON DUPLICATE KEY UPDATE formType = :formType, allowResubmit = :allowResubmit`, input)
 	return err
 }
 
@@ -442,6 +442,9 @@ func (input *BlockForm) processForDB() {
 	if input.FormType == "" {
 		input.FormType = BlockFormTypeSurvey
 	}
+	if input.AllowResubmit != Yes {
+		input.AllowResubmit = No
+	}
 }
 
 func (input *BlockForm) processForAPI() {
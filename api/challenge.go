@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	ChallengeProviderNone      = "none"
+	ChallengeProviderHCaptcha  = "hcaptcha"
+	ChallengeProviderTurnstile = "turnstile"
+	ChallengeProviderLocalPass = "local_pass"
+	ChallengeProviderLocalFail = "local_fail"
+)
+
+var (
+	errChallengeFailed = errors.New("challenge failed")
+)
+
+// ChallengeVerifier is the interface any challenge backend must satisfy to check the token a client got from
+// solving a challenge, such as a captcha
+type ChallengeVerifier interface {
+	Verify(token, remoteIP string) error
+}
+
+// setupChallengeVerifiers configures the available verifiers from the environment. A provider is only available if
+// its secret is set. The local fakes are never set up here, since they would turn the challenge off; setupTesting adds
+// them for the tests
+func setupChallengeVerifiers() map[string]ChallengeVerifier {
+	verifiers := map[string]ChallengeVerifier{}
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+	hcaptchaSecret := envHelper("KESPLORA_API_CHALLENGE_HCAPTCHA_SECRET", "")
+	if hcaptchaSecret != "" {
+		verifiers[ChallengeProviderHCaptcha] = &challengeVerifierHCaptcha{
+			Secret:    hcaptchaSecret,
+			VerifyURL: envHelper("KESPLORA_API_CHALLENGE_HCAPTCHA_URL", "https://api.hcaptcha.com/siteverify"),
+			client:    client,
+		}
+	}
+	turnstileSecret := envHelper("KESPLORA_API_CHALLENGE_TURNSTILE_SECRET", "")
+	if turnstileSecret != "" {
+		verifiers[ChallengeProviderTurnstile] = &challengeVerifierTurnstile{
+			Secret:    turnstileSecret,
+			VerifyURL: envHelper("KESPLORA_API_CHALLENGE_TURNSTILE_URL", "https://challenges.cloudflare.com/turnstile/v0/siteverify"),
+			client:    client,
+		}
+	}
+	return verifiers
+}
+
+// isValidChallengeProvider checks if the provider can be used; none is always valid
+func isValidChallengeProvider(provider string) bool {
+	if provider == ChallengeProviderNone {
+		return true
+	}
+	_, found := config.ChallengeVerifiers[provider]
+	return found
+}
+
+// verifyChallenge checks the token with the provider. A blank provider or none always passes. If the provider isn't
+// configured, the check fails rather than letting everything through
+func verifyChallenge(provider, token, remoteIP string) error {
+	if provider == "" || provider == ChallengeProviderNone {
+		return nil
+	}
+	verifier, found := config.ChallengeVerifiers[provider]
+	if !found {
+		return fmt.Errorf("challenge provider %s is not configured", provider)
+	}
+	if token == "" {
+		return errChallengeFailed
+	}
+	return verifier.Verify(token, remoteIP)
+}
+
+//
+// hcaptcha
+//
+
+// challengeVerifierHCaptcha verifies tokens with the hCaptcha siteverify API
+type challengeVerifierHCaptcha struct {
+	Secret    string
+	VerifyURL string
+
+	client *http.Client
+}
+
+// Verify checks the token with hCaptcha
+func (v *challengeVerifierHCaptcha) Verify(token, remoteIP string) error {
+	return verifyChallengeWithSiteverify(v.client, v.VerifyURL, v.Secret, token, remoteIP)
+}
+
+//
+// turnstile
+//
+
+// challengeVerifierTurnstile verifies tokens with the Cloudflare Turnstile siteverify API
+type challengeVerifierTurnstile struct {
+	Secret    string
+	VerifyURL string
+
+	client *http.Client
+}
+
+// Verify checks the token with Turnstile
+func (v *challengeVerifierTurnstile) Verify(token, remoteIP string) error {
+	return verifyChallengeWithSiteverify(v.client, v.VerifyURL, v.Secret, token, remoteIP)
+}
+
+// verifyChallengeWithSiteverify posts the token to a siteverify endpoint. hCaptcha and Turnstile take the same form
+// and send back the same response, so they share this
+func verifyChallengeWithSiteverify(client *http.Client, verifyURL, secret, token, remoteIP string) error {
+	form := url.Values{}
+	form.Set("secret", secret)
+	form.Set("response", token)
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Post(verifyURL, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("siteverify returned %d", res.StatusCode)
+	}
+	result := struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}{}
+	err = json.NewDecoder(res.Body).Decode(&result)
+	if err != nil {
+		return err
+	}
+	if !result.Success {
+		return fmt.Errorf("%w: %s", errChallengeFailed, strings.Join(result.ErrorCodes, ", "))
+	}
+	return nil
+}
+
+//
+// local
+//
+
+// challengeVerifierLocal always passes or always fails any token, for tests
+type challengeVerifierLocal struct {
+	Pass bool
+}
+
+// Verify passes or fails based on the configuration
+func (v *challengeVerifierLocal) Verify(token, remoteIP string) error {
+	if v.Pass {
+		return nil
+	}
+	return errChallengeFailed
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChallengeVerifiersSiteverify(t *testing.T) {
+	received := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		received["secret"] = r.PostForm.Get("secret")
+		received["remoteip"] = r.PostForm.Get("remoteip")
+		if r.PostForm.Get("response") == "solved" {
+			w.Write([]byte(`{"success": true}`))
+			return
+		}
+		w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+	}))
+	defer server.Close()
+
+	verifiers := []ChallengeVerifier{
+		&challengeVerifierHCaptcha{Secret: "hcaptcha-secret", VerifyURL: server.URL},
+		&challengeVerifierTurnstile{Secret: "turnstile-secret", VerifyURL: server.URL},
+	}
+	for _, verifier := range verifiers {
+		err := verifier.Verify("solved", "203.0.113.9")
+		assert.Nil(t, err)
+		assert.Equal(t, "203.0.113.9", received["remoteip"])
+		err = verifier.Verify("guessed", "203.0.113.9")
+		assert.True(t, errors.Is(err, errChallengeFailed))
+	}
+	assert.Equal(t, "turnstile-secret", received["secret"])
+
+	assert.Nil(t, (&challengeVerifierLocal{Pass: true}).Verify("anything", ""))
+	assert.NotNil(t, (&challengeVerifierLocal{Pass: false}).Verify("anything", ""))
+}
+
+func TestChallengeVerifiersWithoutFakes(t *testing.T) {
+	// the fakes would turn the challenge off, so the environment can never set them up, even when it defaults to test
+	t.Setenv("KESPLORA_API_CHALLENGE_HCAPTCHA_SECRET", "")
+	t.Setenv("KESPLORA_API_CHALLENGE_TURNSTILE_SECRET", "")
+	verifiers := setupChallengeVerifiers()
+	assert.NotContains(t, verifiers, ChallengeProviderLocalPass)
+	assert.NotContains(t, verifiers, ChallengeProviderLocalFail)
+}
+
+func TestChallengeOnPublicSignup(t *testing.T) {
+	setupTesting()
+	require.Nil(t, verifyChallenge(ChallengeProviderNone, "", ""))
+	require.NotNil(t, verifyChallenge(ChallengeProviderLocalPass, "", ""))
+	require.NotNil(t, verifyChallenge("unconfigured", "token", ""))
+
+	site, err := GetSite()
+	require.Nil(t, err)
+	originalProvider := site.ChallengeProvider
+	site.ChallengeProvider = ChallengeProviderLocalFail
+	err = UpdateSite(site)
+	require.Nil(t, err)
+	defer func() {
+		site.ChallengeProvider = originalProvider
+		UpdateSite(site)
+	}()
+
+	project := &Project{
+		Status: ProjectStatusActive,
+	}
+	err = createTestProject(project)
+	require.Nil(t, err)
+	defer DeleteProject(project.ID)
+
+	b := new(bytes.Buffer)
+	encoder := json.NewEncoder(b)
+	encoder.Encode(map[string]string{
+		"challengeToken": "token",
+	})
+	code, res, err := testEndpoint(http.MethodPost, fmt.Sprintf("/projects/%d/consent/responses", project.ID), b, routeAllCreateConsentResponse, "")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, code, res)
+	assert.Contains(t, res.String(), api_error_challenge_failed)
+
+	// projects can opt out, such as for in-person studies, so the request gets past the challenge
+	project.RequireChallenge = No
+	err = UpdateProject(project)
+	require.Nil(t, err)
+	encoder.Encode(map[string]string{
+		"challengeToken": "token",
+	})
+	code, res, err = testEndpoint(http.MethodPost, fmt.Sprintf("/projects/%d/consent/responses", project.ID), b, routeAllCreateConsentResponse, "")
+	assert.Nil(t, err)
+	assert.NotContains(t, res.String(), api_error_challenge_failed, code)
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	ProjectCollaboratorRoleOwner   = "owner"   // can do everything an editor can, plus manage collaborators and delete participant data
+	ProjectCollaboratorRoleEditor  = "editor"  // can change the project, consent form, and flow
+	ProjectCollaboratorRoleAnalyst = "analyst" // can see participants, consent responses, submissions, and reports
+	ProjectCollaboratorRoleViewer  = "viewer"  // can see the project and flow
+)
+
+// projectCollaboratorRoleRanks orders the roles so a role can be compared against a minimum
+var projectCollaboratorRoleRanks = map[string]int{
+	ProjectCollaboratorRoleViewer:  1,
+	ProjectCollaboratorRoleAnalyst: 2,
+	ProjectCollaboratorRoleEditor:  3,
+	ProjectCollaboratorRoleOwner:   4,
+}
+
+// ProjectCollaborator links a researcher (a user with the `user` system role) to a project with a role. Admins do not need
+// to be collaborators, as they can see everything on the site
+type ProjectCollaborator struct {
+	ProjectID int64  `json:"projectId" db:"projectId"`
+	UserID    int64  `json:"userId" db:"userId"`
+	Role      string `json:"role" db:"role"`
+	CreatedOn string `json:"createdOn" db:"createdOn"`
+
+	// these are joined in for display
+	FirstName string `json:"firstName" db:"firstName"`
+	LastName  string `json:"lastName" db:"lastName"`
+	Email     string `json:"email" db:"email"`
+}
+
+// SaveProjectCollaborator creates or updates the collaborator's role on a project
+func SaveProjectCollaborator(input *ProjectCollaborator) error {
+	input.processForDB()
+	defer input.processForAPI()
+	_, err := config.DBConnection.NamedExec(`INSERT INTO ProjectCollaborators (projectId, userId, role, createdOn)
+	VALUES
+	(:projectId, :userId, :role, :createdOn)
+	ON DUPLICATE KEY UPDATE
+	role = :role`, input)
+	return err
+}
+
+// GetProjectCollaborator gets a single collaborator on a project
+func GetProjectCollaborator(projectID, userID int64) (*ProjectCollaborator, error) {
+	collaborator := &ProjectCollaborator{}
+	defer collaborator.processForAPI()
+	err := config.DBConnection.Get(collaborator, `SELECT c.*, u.firstName, u.lastName, u.email
+	FROM ProjectCollaborators c
+	INNER JOIN Users u ON u.id = c.userId
+	WHERE c.projectId = ? AND c.userId = ?`, projectID, userID)
+	return collaborator, err
+}
+
+// GetProjectCollaborators gets all of the collaborators on a project
+func GetProjectCollaborators(projectID int64) ([]ProjectCollaborator, error) {
+	collaborators := []ProjectCollaborator{}
+	err := config.DBConnection.Select(&collaborators, `SELECT c.*, u.firstName, u.lastName, u.email
+	FROM ProjectCollaborators c
+	INNER JOIN Users u ON u.id = c.userId
+	WHERE c.projectId = ?
+	ORDER BY u.lastName, u.firstName`, projectID)
+	for i := range collaborators {
+		collaborators[i].processForAPI()
+	}
+	return collaborators, err
+}
+
+// GetProjectsForCollaborator gets all of the projects a user collaborates on, along with their role
+func GetProjectsForCollaborator(userID int64) ([]Project, error) {
+	projects := []Project{}
+	err := config.DBConnection.Select(&projects, `SELECT p.*, c.role AS collaboratorRole,
+	(SELECT COUNT(*) FROM ProjectUserLinks l WHERE l.projectId = p.id) AS participantCount
+	FROM Projects p
+	INNER JOIN ProjectCollaborators c ON c.projectId = p.id
+	WHERE c.userId = ?
+	ORDER BY p.name`, userID)
+	for i := range projects {
+		projects[i].processForAPI()
+	}
+	return projects, err
+}
+
+// DeleteProjectCollaborator removes a collaborator from a project
+func DeleteProjectCollaborator(projectID, userID int64) error {
+	_, err := config.DBConnection.Exec(`DELETE FROM ProjectCollaborators WHERE projectId = ? AND userId = ?`, projectID, userID)
+	return err
+}
+
+// DeleteProjectCollaboratorsForProject removes all collaborators from a project
+func DeleteProjectCollaboratorsForProject(projectID int64) error {
+	_, err := config.DBConnection.Exec(`DELETE FROM ProjectCollaborators WHERE projectId = ?`, projectID)
+	return err
+}
+
+// DeleteProjectCollaboratorsForUser removes a user from every project they collaborate on
+func DeleteProjectCollaboratorsForUser(userID int64) error {
+	_, err := config.DBConnection.Exec(`DELETE FROM ProjectCollaborators WHERE userId = ?`, userID)
+	return err
+}
+
+// isValidProjectCollaboratorRole checks if the role is known
+func isValidProjectCollaboratorRole(role string) bool {
+	_, found := projectCollaboratorRoleRanks[role]
+	return found
+}
+
+// projectCollaboratorRoleAtLeast checks if the role meets the minimum role
+func projectCollaboratorRoleAtLeast(role, minimum string) bool {
+	rank, found := projectCollaboratorRoleRanks[role]
+	if !found {
+		return false
+	}
+	return rank >= projectCollaboratorRoleRanks[minimum]
+}
+
+//
+// processors
+//
+
+func (input *ProjectCollaborator) processForDB() {
+	if input.Role == "" {
+		input.Role = ProjectCollaboratorRoleViewer
+	}
+	if input.CreatedOn == "" {
+		input.CreatedOn = time.Now().Format(timeFormatDB)
+	} else {
+		input.CreatedOn, _ = parseTimeToTimeFormat(input.CreatedOn, timeFormatDB)
+	}
+}
+
+func (input *ProjectCollaborator) processForAPI() {
+	input.CreatedOn, _ = parseTimeToTimeFormat(input.CreatedOn, timeFormatAPI)
+}
+
+// Bind binds the data for the HTTP
+func (data *ProjectCollaborator) Bind(r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectCollaboratorRoles(t *testing.T) {
+	assert.True(t, projectCollaboratorRoleAtLeast(ProjectCollaboratorRoleOwner, ProjectCollaboratorRoleViewer))
+	assert.True(t, projectCollaboratorRoleAtLeast(ProjectCollaboratorRoleEditor, ProjectCollaboratorRoleAnalyst))
+	assert.True(t, projectCollaboratorRoleAtLeast(ProjectCollaboratorRoleAnalyst, ProjectCollaboratorRoleAnalyst))
+	assert.False(t, projectCollaboratorRoleAtLeast(ProjectCollaboratorRoleViewer, ProjectCollaboratorRoleAnalyst))
+	assert.False(t, projectCollaboratorRoleAtLeast(ProjectCollaboratorRoleEditor, ProjectCollaboratorRoleOwner))
+	assert.False(t, projectCollaboratorRoleAtLeast("", ProjectCollaboratorRoleViewer))
+	assert.False(t, projectCollaboratorRoleAtLeast("boss", ProjectCollaboratorRoleViewer))
+
+	assert.True(t, isValidProjectCollaboratorRole(ProjectCollaboratorRoleViewer))
+	assert.False(t, isValidProjectCollaboratorRole("boss"))
+}
@@ -0,0 +1,350 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// command is an administrative subcommand of the binary, for operators to manage a site without raw SQL
+type command struct {
+	Usage       string
+	Description string
+	Run         func(args []string, out io.Writer) error
+}
+
+var commands = map[string]command{
+	"migrate": {
+		Usage:       "migrate up|down|status [--path DIRECTORY]",
+		Description: "apply, undo, or list the schema migrations",
+		Run:         commandMigrate,
+	},
+	"create-admin": {
+		Usage:       "create-admin --email EMAIL [--password PASSWORD] [--first NAME] [--last NAME] [--site ID]",
+		Description: "create an active admin; a password is generated if one isn't given",
+		Run:         commandCreateAdmin,
+	},
+	"reset-password": {
+		Usage:       "reset-password --login EMAIL_OR_CODE [--password PASSWORD] [--site ID]",
+		Description: "set a user's password, unlock them, and log them out everywhere; a password is generated if one isn't given",
+		Run:         commandResetPassword,
+	},
+	"reissue-setup-code": {
+		Usage:       "reissue-setup-code [--domain DOMAIN]",
+		Description: "generate a new code for POST /setup; with a domain, the code sets up one more site on it",
+		Run:         commandReissueSetupCode,
+	},
+	"export-project": {
+		Usage:       "export-project --project ID [--output FILE] [--site ID]",
+		Description: "write a project's consent form, modules, and blocks as JSON",
+		Run:         commandExportProject,
+	},
+	"import-project": {
+		Usage:       "import-project --input FILE [--site ID]",
+		Description: "create a new pending project from an exported project",
+		Run:         commandImportProject,
+	},
+	"purge-expired-tokens": {
+		Usage:       "purge-expired-tokens",
+		Description: "delete expired tokens and sessions",
+		Run:         commandPurgeExpiredTokens,
+	},
+}
+
+// RunCommand runs one of the administrative subcommands. SetupConfig must be called first
+func RunCommand(name string, args []string, out io.Writer) error {
+	found, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %s\n\n%s", name, CommandUsage())
+	}
+	return found.Run(args, out)
+}
+
+// CommandUsage lists the subcommands
+func CommandUsage() string {
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := []string{
+		"usage: kesplora-api [command]",
+		"",
+		"  serve",
+		"        start the API (the default)",
+	}
+	for _, name := range names {
+		lines = append(lines, "  "+commands[name].Usage, "        "+commands[name].Description)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// getSiteForCommand gets the site a command acts on; 0 is the default site
+func getSiteForCommand(siteID int64) (*Site, error) {
+	if siteID == 0 {
+		return GetSite()
+	}
+	return GetSiteByID(siteID)
+}
+
+func commandMigrate(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("migrate needs one of up, down, or status")
+	}
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	path := flags.String("path", config.MigrationsPath, "the directory with the migrations; the built in migrations if not set")
+	err := flags.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := MigrateUp(*path)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied %d %s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+		return err
+	case "down":
+		migration, err := MigrateDown(*path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "undid %d %s\n", migration.Version, migration.Name)
+		return nil
+	case "status":
+		migrations, err := GetMigrationStatus(*path)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			status := "pending"
+			if migration.Applied {
+				status = "applied"
+			}
+			fmt.Fprintf(out, "%-8s %d %s\n", status, migration.Version, migration.Name)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate action %s", args[0])
+}
+
+func commandCreateAdmin(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	email := flags.String("email", "", "the admin's email")
+	password := flags.String("password", "", "the admin's password")
+	firstName := flags.String("first", "Site", "the admin's first name")
+	lastName := flags.String("last", "Admin", "the admin's last name")
+	siteID := flags.Int64("site", 0, "the site id; the default site if not set")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(*email, "@") {
+		return errors.New("an --email is required")
+	}
+	site, err := getSiteForCommand(*siteID)
+	if err != nil {
+		return err
+	}
+	_, err = GetUserByEmail(site.ID, *email)
+	if err == nil {
+		return fmt.Errorf("%s already has an account on %s", *email, site.Name)
+	}
+
+	generated := *password == ""
+	if generated {
+		*password = randomString(24)
+	}
+	user := &User{
+		SiteID:        site.ID,
+		Email:         *email,
+		EmailVerified: Yes,
+		FirstName:     *firstName,
+		LastName:      *lastName,
+		Password:      *password,
+		Status:        UserStatusActive,
+		SystemRole:    UserSystemRoleAdmin,
+	}
+	err = CreateUser(user)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "created admin %d (%s) on %s\n", user.ID, user.Email, site.Name)
+	if generated {
+		fmt.Fprintf(out, "password: %s\n", *password)
+	}
+	return nil
+}
+
+func commandResetPassword(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	login := flags.String("login", "", "the user's email or participant code")
+	password := flags.String("password", "", "the new password")
+	siteID := flags.Int64("site", 0, "the site id; the default site if not set")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *login == "" {
+		return errors.New("a --login is required")
+	}
+	site, err := getSiteForCommand(*siteID)
+	if err != nil {
+		return err
+	}
+	user, err := getUserByLogin(site.ID, *login)
+	if err != nil {
+		return fmt.Errorf("no user with the login %s on %s", *login, site.Name)
+	}
+
+	generated := *password == ""
+	if generated {
+		*password = randomString(24)
+	}
+	user.Password = *password
+	if user.Status == UserStatusLocked {
+		user.Status = UserStatusActive
+	}
+	err = UpdateUser(user)
+	if err != nil {
+		return err
+	}
+	err = deleteTokenForUser(user.ID, tokenTypePasswordReset)
+	if err != nil {
+		return err
+	}
+	err = LogOutUser(user.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "reset the password for user %d and logged them out\n", user.ID)
+	if generated {
+		fmt.Fprintf(out, "password: %s\n", *password)
+	}
+	return nil
+}
+
+func commandReissueSetupCode(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("reissue-setup-code", flag.ContinueOnError)
+	domain := flags.String("domain", "", "the domain of another site to set up")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *domain != "" {
+		site, err := GetSiteByDomain(*domain)
+		if err == nil && site.Status == SiteStatusActive {
+			return fmt.Errorf("site %d is already set up on %s", site.ID, site.Domain)
+		}
+		code, err := IssueSiteDomainSetupCode(*domain)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "site code for %s: %s\n", normalizeSiteDomain(*domain), code)
+		return nil
+	}
+	if config.SiteCode != "" {
+		return errors.New("KESPLORA_API_SITE_CODE is set, so that code is used instead")
+	}
+	code, err := ReissueSiteSetupCode()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "site code: %s\n", code)
+	return nil
+}
+
+func commandExportProject(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("export-project", flag.ContinueOnError)
+	projectID := flags.Int64("project", 0, "the project id")
+	output := flags.String("output", "", "the file to write to; stdout if not set")
+	siteID := flags.Int64("site", 0, "the site id; the default site if not set")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *projectID == 0 {
+		return errors.New("a --project is required")
+	}
+	site, err := getSiteForCommand(*siteID)
+	if err != nil {
+		return err
+	}
+	bundle, err := ExportProject(site.ID, *projectID)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	}
+	err = os.WriteFile(*output, data, 0o644)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "exported project %d to %s\n", *projectID, *output)
+	return nil
+}
+
+func commandImportProject(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("import-project", flag.ContinueOnError)
+	input := flags.String("input", "", "the exported project file")
+	siteID := flags.Int64("site", 0, "the site id; the default site if not set")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *input == "" {
+		return errors.New("an --input is required")
+	}
+	data, err := os.ReadFile(*input)
+	if err != nil {
+		return err
+	}
+	bundle := &ProjectBundle{}
+	err = json.Unmarshal(data, bundle)
+	if err != nil {
+		return err
+	}
+	site, err := getSiteForCommand(*siteID)
+	if err != nil {
+		return err
+	}
+	project, err := ImportProject(site.ID, bundle)
+	if err != nil {
+		if project != nil && project.ID != 0 {
+			return fmt.Errorf("project %d was partly imported: %w", project.ID, err)
+		}
+		return err
+	}
+	fmt.Fprintf(out, "imported %s as pending project %d on %s\n", project.Name, project.ID, site.Name)
+	return nil
+}
+
+func commandPurgeExpiredTokens(args []string, out io.Writer) error {
+	now := time.Now().Format(timeFormatDB)
+	err := deleteTokensTheExpireBefore(now)
+	if err != nil {
+		return err
+	}
+	err = deleteSessionsThatExpireBefore(now)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "purged expired tokens and sessions")
+	return nil
+}
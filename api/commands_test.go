@@ -0,0 +1,54 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandsForUsers(t *testing.T) {
+	setupTesting()
+	out := &bytes.Buffer{}
+
+	err := RunCommand("not-a-command", []string{}, out)
+	assert.NotNil(t, err)
+
+	email := fmt.Sprintf("cli_%s@kesplora.com", randomString(8))
+	err = RunCommand("create-admin", []string{"--email", email, "--password", "a str0ng P@ssword"}, out)
+	require.Nil(t, err)
+	admin, err := GetUserByEmail(getTestSiteID(), email)
+	require.Nil(t, err)
+	defer DeleteUser(admin.ID)
+	assert.Equal(t, UserSystemRoleAdmin, admin.SystemRole)
+	assert.Equal(t, UserStatusActive, admin.Status)
+
+	// the same email can't be added twice
+	err = RunCommand("create-admin", []string{"--email", email}, out)
+	assert.NotNil(t, err)
+
+	admin.Status = UserStatusLocked
+	err = UpdateUser(admin)
+	require.Nil(t, err)
+	out.Reset()
+	err = RunCommand("reset-password", []string{"--login", email}, out)
+	require.Nil(t, err)
+	assert.Contains(t, out.String(), "password: ")
+	admin, err = GetUserByID(admin.ID)
+	require.Nil(t, err)
+	assert.Equal(t, UserStatusActive, admin.Status)
+	_, err = AttemptLoginForUser(getTestSiteID(), email, "a str0ng P@ssword")
+	assert.NotNil(t, err)
+
+	if config.SiteCode == "" {
+		out.Reset()
+		err = RunCommand("reissue-setup-code", []string{}, out)
+		require.Nil(t, err)
+		assert.Contains(t, out.String(), getSiteSetupCode())
+	}
+
+	err = RunCommand("purge-expired-tokens", []string{}, out)
+	assert.Nil(t, err)
+}
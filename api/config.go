@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,7 +24,6 @@ import (
 	"github.com/go-chi/render"
 	"github.com/go-redis/redis"
 	"github.com/jmoiron/sqlx"
-	log "github.com/sirupsen/logrus"
 )
 
 var config *apiConfig = nil
@@ -37,15 +39,43 @@ type apiConfig struct {
 	Environment      string
 	APIPort          string
 	LogLevelOutput   string
+	Logger           *slog.Logger
 	RootAPIDomain    string
 	JWTSigningString string
-	SiteCode         string // needed if the site is pending and a new install
-	APILevel         string // one of all, admin, participant; used to mount routes
+	JWTKeys          *jwtKeyring // asymmetric signing and verification keys; optional
+	SiteCode         string      // needed if the site is pending and a new install, or to set up another site
+	SiteStrictHosts  bool        // if true, requests from a host that does not match a site's domain are rejected
+	APILevel         string      // one of all, admin, participant; used to mount routes
+	ClientAddress    string      // the root address of the client app, used for building links in messages
+
+	CORSAllowedOrigins []string     // overrides every site's allowed origins if set
+	TrustedProxies     []*net.IPNet // overrides every site's trusted proxies if set
+
+	LoginLockoutThreshold int // failed logins before an account is locked; 0 disables locking
+
+	MigrationsPath string // a directory to read migrations from instead of the ones built in; blank uses the built in
+	MigrateOnStart bool   // if true, pending migrations are applied when the server starts
+
+	ShutdownDrain   time.Duration // how long the server reports as not ready, while still serving, before it stops
+	ShutdownTimeout time.Duration // how long in-flight requests have to finish when the server is stopped
+	MetricsPort     string        // if set, /metrics is served on this port instead of the API port
+
+	ValidateRequests bool // if true, JSON bodies are checked against the OpenAPI spec before reaching the routes
+
+	RateLimits map[string]rateLimitRule // the request limits for each route group; a missing group isn't limited
+
+	AuditKey string // the HMAC key for the audit chain; if blank, the chain only catches accidental edits
 
 	DBConnection *sqlx.DB
 	CacheClient  *redis.Client
 	AWSS3Client  *s3.Client
 	AWSS3Bucket  string
+	Mailer       Mailer
+	OIDC         *oidcProvider // single sign-on for researchers; nil if not configured
+
+	ChallengeVerifiers     map[string]ChallengeVerifier // the configured challenge providers, by name
+	ChallengeSetupProvider string                       // the challenge provider used when setting up a site
+	ChallengeSetupSiteKey  string                       // the public key the client needs to show the setup challenge
 }
 
 // SetupConfig is a call to configure the basic required configuration options for the API
@@ -61,28 +91,51 @@ func SetupConfig() *apiConfig {
 	config.APIPort = envHelper("KESPLORA_API_PORT", "8080")
 	config.RootAPIDomain = envHelper("KESPLORA_DOMAIN", "localhost")
 	config.JWTSigningString = envHelper("KESPLORA_JWT_SIGNING", "")
+	config.JWTKeys = setupJWTKeys()
 	config.APILevel = envHelper("KESPLORA_API_LEVEL", "all")
+	config.SiteCode = envHelper("KESPLORA_API_SITE_CODE", "")
+	config.SiteStrictHosts = envHelper("KESPLORA_API_SITE_STRICT_HOSTS", No) == Yes
+	config.ClientAddress = strings.TrimSuffix(envHelper("KESPLORA_CLIENT_ADDRESS", "http://localhost"), "/")
+	config.CORSAllowedOrigins = []string{}
+	for _, origin := range strings.Split(envHelper("KESPLORA_API_CORS_ORIGINS", ""), ",") {
+		origin = normalizeOrigin(origin)
+		if origin != "" {
+			config.CORSAllowedOrigins = append(config.CORSAllowedOrigins, origin)
+		}
+	}
+	trustedProxies, err := parseTrustedProxies(strings.Split(envHelper("KESPLORA_API_TRUSTED_PROXIES", ""), ","))
+	if err != nil {
+		panic(fmt.Sprintf("could not parse KESPLORA_API_TRUSTED_PROXIES: %v", err))
+	}
+	config.TrustedProxies = trustedProxies
+	lockoutThreshold, err := strconv.Atoi(envHelper("KESPLORA_API_LOGIN_LOCKOUT_THRESHOLD", "10"))
+	if err != nil || lockoutThreshold < 0 {
+		lockoutThreshold = 10
+	}
+	config.LoginLockoutThreshold = lockoutThreshold
+	config.MigrationsPath = envHelper("KESPLORA_API_MIGRATIONS_PATH", "")
+	config.MigrateOnStart = envHelper("KESPLORA_API_MIGRATE_ON_START", No) == Yes
+	shutdownSeconds, err := strconv.Atoi(envHelper("KESPLORA_API_SHUTDOWN_TIMEOUT", "30"))
+	if err != nil || shutdownSeconds < 0 {
+		shutdownSeconds = 30
+	}
+	config.ShutdownTimeout = time.Duration(shutdownSeconds) * time.Second
+	drainSeconds, err := strconv.Atoi(envHelper("KESPLORA_API_SHUTDOWN_DRAIN", "5"))
+	if err != nil || drainSeconds < 0 {
+		drainSeconds = 5
+	}
+	config.ShutdownDrain = time.Duration(drainSeconds) * time.Second
+	config.MetricsPort = envHelper("KESPLORA_API_METRICS_PORT", "")
+	config.ValidateRequests = envHelper("KESPLORA_API_VALIDATE_REQUESTS", No) == Yes
+	rateLimits, err := setupRateLimits(envHelper("KESPLORA_API_RATE_LIMITS", ""))
+	if err != nil {
+		panic(fmt.Sprintf("could not parse KESPLORA_API_RATE_LIMITS: %v", err))
+	}
+	config.RateLimits = rateLimits
+	config.AuditKey = envHelper("KESPLORA_API_AUDIT_KEY", "")
 
 	config.LogLevelOutput = strings.ToUpper(envHelper("KESPLORA_LOG_LEVEL", "WARN"))
-	log.SetFormatter((&log.JSONFormatter{}))
-	switch config.LogLevelOutput {
-	case LogLevelTrace:
-		log.SetLevel(log.TraceLevel)
-	case LogLevelDebug:
-		log.SetLevel(log.DebugLevel)
-	case LogLevelInfo:
-		log.SetLevel(log.InfoLevel)
-	case LogLevelWarn:
-		log.SetLevel(log.WarnLevel)
-	case LogLevelError:
-		log.SetLevel(log.ErrorLevel)
-	case LogLevelFatal:
-		log.SetLevel(log.FatalLevel)
-	case LogLevelPanic:
-		log.SetLevel(log.PanicLevel)
-	default:
-		log.SetLevel(log.WarnLevel)
-	}
+	config.Logger = setupDefaultLogger(config.LogLevelOutput)
 
 	// now we ensure we can connect to the DB
 	dbConnectionString := envHelper("KESPLORA_API_DB_CONNECTION", "root:password@tcp(localhost:3306)/Kesplora")
@@ -137,7 +190,6 @@ func SetupConfig() *apiConfig {
 			}
 		}
 	}
-	config.CacheClient.FlushAll().Result()
 
 	// S3
 	s3Access := envHelper("KESPLORA_API_S3_ACCESS", "")
@@ -158,6 +210,21 @@ func SetupConfig() *apiConfig {
 		}
 	}
 
+	// outbound messages
+	mailer, err := setupMailer(config.Environment)
+	if err != nil {
+		panic(fmt.Sprintf("could not set up the mailer: %v", err))
+	}
+	config.Mailer = mailer
+
+	// single sign-on
+	config.OIDC = setupOIDC()
+
+	// challenges for unauthenticated routes that create things
+	config.ChallengeVerifiers = setupChallengeVerifiers()
+	config.ChallengeSetupProvider = strings.ToLower(envHelper("KESPLORA_API_CHALLENGE_SETUP", ChallengeProviderNone))
+	config.ChallengeSetupSiteKey = envHelper("KESPLORA_API_CHALLENGE_SETUP_SITE_KEY", "")
+
 	return config
 }
 
@@ -173,11 +240,33 @@ func SetupAPI() *chi.Mux {
 	// configure our middlewares here
 	r.Use(middleware.StripSlashes)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP) // TODO: make this optional
+	r.Use(metricsMiddleware)
+	r.Use(accessLogMiddleware)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(120 * time.Second))
 	r.Use(render.SetContentType(render.ContentTypeJSON))
 
+	// site middleware; the site is resolved from the host so one install can serve several sites
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isHealthPath(r.URL.Path) {
+				// health checks are sent by load balancers and do their own site check
+				next.ServeHTTP(w, r)
+				return
+			}
+			site, err := getSiteForRequest(r)
+			if err != nil {
+				site = nil // routes that need a site will send the error
+			}
+			if fields := getRequestLogFields(r.Context()); fields != nil && site != nil {
+				fields.SiteID = site.ID
+			}
+			ctx := context.WithValue(r.Context(), appContextSite, site)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	r.Use(trustedRealIP)
+
 	// access token middleware
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -199,7 +288,14 @@ func SetupAPI() *chi.Mux {
 			if !found {
 				// check the header
 				access := r.Header.Get("Authorization")
-				if strings.HasPrefix(access, "Bearer") {
+				if strings.HasPrefix(access, "ApiKey ") {
+					// scripts can use a key instead of logging in; the scopes are checked in checkRoutePermissions
+					user, err = getUserForAPIKey(strings.TrimSpace(strings.TrimPrefix(access, "ApiKey ")))
+					if err == nil && user.ID != 0 {
+						found = true
+					}
+					access = ""
+				} else if strings.HasPrefix(access, "Bearer") {
 					parts := strings.Split(access, " ")
 					if len(parts) > 0 {
 						access = parts[1]
@@ -213,6 +309,18 @@ func SetupAPI() *chi.Mux {
 				}
 			}
 
+			if found && isSessionRevoked(user.SessionID) {
+				// the session was logged out or revoked, so the access token is no longer honored
+				found = false
+				user = jwtUser{}
+			}
+
+			if found && user.SiteID != getSiteIDFromHTTPContext(r) {
+				// users belong to a single site, so a token from one site can't be used on another
+				found = false
+				user = jwtUser{}
+			}
+
 			if found {
 				// check if expired
 				expiresAt, _ := time.Parse("2006-01-02T15:04:05Z", user.Expires)
@@ -221,6 +329,10 @@ func SetupAPI() *chi.Mux {
 				}
 			}
 
+			if fields := getRequestLogFields(r.Context()); fields != nil && found {
+				fields.UserID = user.ID
+			}
+
 			ctx := context.WithValue(r.Context(), appContextKeyFound, found)
 			ctx = context.WithValue(ctx, appContextKeyUser, user)
 			ctx = context.WithValue(ctx, appContextKeyExpired, expired)
@@ -229,15 +341,17 @@ func SetupAPI() *chi.Mux {
 	})
 
 	cors := cors.New(cors.Options{
-		AllowOriginFunc: func(r *http.Request, origin string) bool {
-			return true // TODO: we probably want to let the setup set this in the config
-		},
+		AllowOriginFunc:  isOriginAllowed,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-TOKEN", "RANGE", "ACCEPT-RANGE", "Access-Conrol-Allow-Origin"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	})
 	r.Use(cors.Handler)
+	r.Use(rejectUnknownOrigins)
+	if config.ValidateRequests {
+		r.Use(requestValidationMiddleware)
+	}
 
 	// set up a Not Implemented handler just as a placeholder
 	notImplementedRoute := func(w http.ResponseWriter, r *http.Request) {
@@ -247,26 +361,52 @@ func SetupAPI() *chi.Mux {
 	// set up the routes applicable to everyone
 	// We don't mirror these in case we wanted duplicated routes (for example /site vs /participant/site vs /admin/site, which could all return different info)
 	r.Get("/", routeApiStatusReady)
+	r.Get("/health/live", routeApiStatusLive)
+	r.Get("/health/ready", routeApiStatusHealthReady)
+	if config.MetricsPort == "" {
+		// otherwise the metrics are only on their own listener
+		r.Get("/metrics", routeMetrics)
+	}
+	r.Get("/.well-known/jwks.json", routeAllGetJWKS)
+	r.Get("/openapi.json", routeOpenAPISpec)
 
 	// sites and unauthed admin routes for setup
 	r.Get("/site", routeAllGetSite)
 	r.Get("/setup", routeAllGetSiteConfiguration)
 
 	// this one is unique as it is un-authed, but mainly for admins
-	r.Post("/setup", routeAllConfigureSite)
+	r.With(rateLimitMiddleware(rateLimitGroupSetup)).Post("/setup", routeAllConfigureSite)
 
 	// some project and consent routes are available to everyone
 	r.Get("/projects", routeAllGetProjects)
 	r.Get("/projects/{projectID}", routeAllGetProject)
 	r.Get("/projects/{projectID}/consent", routeAllGetConsentForm)
-	r.Post("/projects/{projectID}/consent/responses", routeAllCreateConsentResponse)
-
-	// users
-	r.Post("/login", routeAllUserLogin)
+	r.With(rateLimitMiddleware(rateLimitGroupConsent)).Post("/projects/{projectID}/consent/responses", routeAllCreateConsentResponse)
+
+	// users; the routes that don't need a login are limited by IP
+	authLimited := r.With(rateLimitMiddleware(rateLimitGroupAuth))
+	authLimited.Post("/login", routeAllUserLogin)
+	authLimited.Post("/login/mfa", routeAllUserLoginMFA)
+	authLimited.Get("/login/oidc", routeAllStartOIDCLogin)
+	authLimited.Post("/login/oidc/callback", routeAllCompleteOIDCLogin)
 	r.Post("/logout", routeAllUserLogout)
 	r.Get("/me", routeAllGetUserProfile)
 	r.Patch("/me", routeAllUpdateUserProfile)
-	r.Post("/me/refresh", routeAllUserRefreshAccess)
+	authLimited.Post("/me/refresh", routeAllUserRefreshAccess)
+	r.Get("/me/sessions", routeAllGetUserSessions)
+	r.Delete("/me/sessions/{sessionID}", routeAllDeleteUserSession)
+	r.Post("/me/mfa", routeAllStartMFAEnrollment)
+	r.Post("/me/mfa/confirm", routeAllConfirmMFAEnrollment)
+	r.Post("/me/mfa/recovery", routeAllRegenerateMFARecoveryCodes)
+	r.Delete("/me/mfa", routeAllDisableMFA)
+	r.Get("/me/apikeys", routeAllGetAPIKeys)
+	r.Post("/me/apikeys", routeAllCreateAPIKey)
+	r.Delete("/me/apikeys/{apiKeyID}", routeAllDeleteAPIKey)
+	authLimited.Post("/password/reset", routeAllRequestPasswordReset)
+	authLimited.Post("/password/reset/confirm", routeAllConfirmPasswordReset)
+	authLimited.Post("/verify/confirm", routeAllConfirmEmailVerification)
+	authLimited.Post("/verify/resend", routeAllResendEmailVerification)
+	authLimited.Post("/invitation/accept", routeAllAcceptInvitation)
 
 	//
 	// Admin Routes
@@ -277,6 +417,7 @@ func SetupAPI() *chi.Mux {
 	// anyway
 	if config.APILevel == "all" || config.APILevel == "admin" {
 		r.Route("/admin", func(r chi.Router) {
+			r.Use(rateLimitMiddleware(rateLimitGroupAPI))
 			r.Use(func(next http.Handler) http.Handler {
 				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					results := checkRoutePermissions(w, r, &routePermissionsCheckOptions{
@@ -293,18 +434,41 @@ func SetupAPI() *chi.Mux {
 					next.ServeHTTP(w, r.WithContext(ctx))
 				})
 			})
+			r.Use(auditMiddleware)
 
 			// site
 			r.Patch("/site", routeAdminUpdateSite)
+			r.Get("/site/emails", routeAdminGetEmailTemplates)
+			r.Get("/site/emails/{templateName}", routeAdminGetEmailTemplate)
+			r.Put("/site/emails/{templateName}", routeAdminSaveEmailTemplate)
+			r.Delete("/site/emails/{templateName}", routeAdminDeleteEmailTemplate)
 
 			// users
 			r.Get("/users", routeAdminGetUsersOnPlatform)
+			r.Post("/users", routeAdminInviteUser)
 			r.Get("/users/{userID}", routeAdminGetUserOnPlatform)
+			r.Patch("/users/{userID}", routeAdminUpdateUser)
+			r.Delete("/users/{userID}", routeAdminEraseUser)
+			r.Get("/users/{userID}/export", routeAdminExportUser)
+			r.Post("/users/{userID}/invitation", routeAdminResendUserInvitation)
+			r.Post("/users/{userID}/password/reset", routeAdminForceUserPasswordReset)
+			r.Get("/users/{userID}/sessions", routeAdminGetUserSessions)
+			r.Delete("/users/{userID}/sessions", routeAdminRevokeUserSessions)
+			r.Delete("/users/{userID}/mfa", routeAdminResetUserMFA)
+			r.Post("/users/{userID}/unlock", routeAdminUnlockUser)
 			r.Get("/users/{userID}/projects", routeAdminGetProjectsForUser)
 			r.Get("/users/{userID}/projects/{projectID}", routeAdminGetProjectForUser)
 			r.Post("/users/{userID}/projects/{projectID}", routeAdminLinkUserAndProject) // used for overriding, but should be careful due to consent flows
 			r.Delete("/users/{userID}/projects/{projectID}", routeAdminUnlinkUserAndProject)
 
+			// erasures
+			r.Get("/erasures", routeAdminGetErasureReceipts)
+			r.Get("/erasures/{receiptID}", routeAdminGetErasureReceipt)
+
+			// audit
+			r.Get("/audit", routeAdminGetAuditEvents)
+			r.Get("/audit/verify", routeAdminVerifyAuditEvents)
+
 			// projects
 			r.Post("/projects", routeAdminCreateProject)
 			r.Get("/projects", routeAdminGetProjects)
@@ -322,6 +486,14 @@ func SetupAPI() *chi.Mux {
 			r.Get("/projects/{projectID}/users", routeAdminGetUsersOnProject)
 			r.Post("/projects/{projectID}/users/{userID}", routeAdminLinkUserAndProject) // used for overriding, but should be careful due to consent flows
 			r.Delete("/projects/{projectID}/users/{userID}", routeAdminUnlinkUserAndProject)
+			r.Delete("/projects/{projectID}/users/{userID}/data", routeAdminEraseUserFromProject)
+			r.Post("/projects/{projectID}/reminders", routeAdminSendProjectReminders)
+			r.Post("/projects/{projectID}/participants/batch", routeAdminCreateParticipantBatch)
+
+			// project / collaborators
+			r.Get("/projects/{projectID}/collaborators", routeAdminGetProjectCollaborators)
+			r.Put("/projects/{projectID}/collaborators/{userID}", routeAdminSaveProjectCollaborator)
+			r.Delete("/projects/{projectID}/collaborators/{userID}", routeAdminDeleteProjectCollaborator)
 
 			// modules, which includes flows
 			r.Post("/modules", routeAdminCreateModule)
@@ -364,7 +536,7 @@ func SetupAPI() *chi.Mux {
 			r.Delete("/files/{fileID}", routeAdminDeleteFile)
 			r.Patch("/files/{fileID}", routeUpdateFileMetadata)
 			r.Get("/files/{fileID}", routeAdminGetFileMetaData)
-			r.Get("/files/{fileID}/download", routeAdminDownloadFile)
+			r.With(rateLimitMiddleware(rateLimitGroupDownloads)).Get("/files/{fileID}/download", routeAdminDownloadFile)
 
 			// notes; NOTE: these are duplicated to allow participants and admins to journal as needed with same routes
 			r.Get("/notes", routeAllGetMyNotes)
@@ -384,8 +556,83 @@ func SetupAPI() *chi.Mux {
 		})
 	}
 
+	//
+	// Researcher Routes
+	//
+
+	// researchers are users with the `user` system role; they only see the projects they collaborate on, and what
+	// they can do depends on their role on the project. These mostly mirror the admin routes and share handlers
+	if config.APILevel == "all" || config.APILevel == "admin" {
+		r.Route("/researcher", func(r chi.Router) {
+			r.Use(rateLimitMiddleware(rateLimitGroupAPI))
+			r.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					results := checkRoutePermissions(w, r, &routePermissionsCheckOptions{
+						ShouldSendError: true,
+					})
+					if !results.IsValid {
+						return
+					}
+					if results.User.SystemRole == UserSystemRoleParticipant {
+						sendAPIError(w, api_error_auth_must_collaborator, errors.New("participants cannot be researchers"), map[string]string{})
+						return
+					}
+					next.ServeHTTP(w, r)
+				})
+			})
+			r.Use(auditMiddleware)
+
+			viewer := researcherProjectAccess(ProjectCollaboratorRoleViewer, true)
+			analyst := researcherProjectAccess(ProjectCollaboratorRoleAnalyst, true)
+			editor := researcherProjectAccess(ProjectCollaboratorRoleEditor, true)
+			owner := researcherProjectAccess(ProjectCollaboratorRoleOwner, true)
+
+			// projects
+			r.Get("/projects", routeResearcherGetProjects)
+			r.With(viewer).Get("/projects/{projectID}", routeAdminGetProject)
+			r.With(editor).Patch("/projects/{projectID}", routeAdminUpdateProject)
+
+			// project consent forms
+			r.With(editor).Post("/projects/{projectID}/consent", routeAdminSaveConsentForm)
+			r.With(editor).Delete("/projects/{projectID}/consent", routeAdminDeleteConsentForm)
+			r.With(analyst).Get("/projects/{projectID}/consent/responses", routeAdminGetConsentResponses)
+			r.With(analyst).Get("/projects/{projectID}/consent/responses/{responseID}", routeAdminGetConsentResponse)
+			r.With(owner).Delete("/projects/{projectID}/consent/responses/{responseID}", routeAdminDeleteConsentResponse)
+
+			// project / users
+			r.With(analyst).Get("/projects/{projectID}/users", routeAdminGetUsersOnProject)
+			r.With(owner).Delete("/projects/{projectID}/users/{userID}/data", routeAdminEraseUserFromProject)
+			r.With(owner).Post("/projects/{projectID}/participants/batch", routeAdminCreateParticipantBatch)
+
+			// project / collaborators
+			r.With(viewer).Get("/projects/{projectID}/collaborators", routeAdminGetProjectCollaborators)
+			r.With(owner).Put("/projects/{projectID}/collaborators/{userID}", routeAdminSaveProjectCollaborator)
+			r.With(owner).Delete("/projects/{projectID}/collaborators/{userID}", routeAdminDeleteProjectCollaborator)
+
+			// project / module links
+			r.With(viewer).Get("/projects/{projectID}/flow", routeAdminGetModulesOnProject)
+			r.With(researcherProjectAccess(ProjectCollaboratorRoleEditor, false)).Put("/projects/{projectID}/modules/{moduleID}/order/{order}", routeAdminLinkModuleAndProject)
+			r.With(editor).Delete("/projects/{projectID}/modules/{moduleID}", routeAdminUnlinkModuleAndProject)
+
+			// submissions
+			r.With(analyst).Get("/projects/{projectID}/modules/{moduleID}/blocks/{blockID}/users/{userID}/submissions", routeAdminGetUserSubmissions)
+			r.With(owner).Delete("/projects/{projectID}/modules/{moduleID}/blocks/{blockID}/users/{userID}/submissions", routeAdminDeleteUserSubmissions)
+			r.With(analyst).Get("/projects/{projectID}/modules/{moduleID}/blocks/{blockID}/users/{userID}/submissions/{submissionID}", routeAdminGetUserSubmission)
+			r.With(owner).Delete("/projects/{projectID}/modules/{moduleID}/blocks/{blockID}/users/{userID}/submissions/{submissionID}", routeAdminDeleteUserSubmission)
+
+			// reports
+			r.With(analyst).Get("/reports/projects/{projectID}/status", routeAdminReportGetCountOfUsersOnProjectByStatus)
+			r.With(analyst).Get("/reports/projects/{projectID}/lastUpdatedOn", routeAdminReportGetCountOfLastUpdatedForProject)
+			r.With(analyst).Get("/reports/projects/{projectID}/flow/status", routeAdminReportGetCountOfStatusForProject)
+			r.With(analyst).Get("/reports/projects/{projectID}/flow/submissions", routeAdminReportGetSubmissionCountForProject)
+			r.With(analyst).Get("/reports/projects/{projectID}/flow/modules/{moduleID}/blocks/{blockID}/submissions", routeAdminReportGetProjectSubmissionResponses)
+			r.With(analyst).Get("/reports/projects/{projectID}/flow/modules/{moduleID}/blocks/{blockID}/submissions/export", routeAdminReportExportProjectSubmissionResponses)
+		})
+	}
+
 	if config.APILevel == "all" || config.APILevel == "participant" {
 		r.Route("/participant", func(r chi.Router) {
+			r.Use(rateLimitMiddleware(rateLimitGroupAPI))
 			r.Use(func(next http.Handler) http.Handler {
 				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					results := checkRoutePermissions(w, r, &routePermissionsCheckOptions{
@@ -403,6 +650,10 @@ func SetupAPI() *chi.Mux {
 				})
 			})
 
+			// account
+			r.Delete("/account", routeParticipantEraseAccount)
+			r.Get("/export", routeParticipantExport)
+
 			// projects
 			r.Get("/projects", routeParticipantGetProjects)
 			r.Delete("/projects/{projectID}", routeParticipantUnlinkUserAndProject)
@@ -427,7 +678,7 @@ func SetupAPI() *chi.Mux {
 
 			// files
 			r.Get("/files/{fileID}", routeParticipantGetFileMetaData)
-			r.Get("/files/{fileID}/download", routeParticipantDownloadFile)
+			r.With(rateLimitMiddleware(rateLimitGroupDownloads)).Get("/files/{fileID}/download", routeParticipantDownloadFile)
 
 			// notes; NOTE: these are duplicated to allow participants and admins to journal as needed with same routes
 			r.Get("/notes", routeAllGetMyNotes)
@@ -452,11 +703,19 @@ func envHelper(key, defaultValue string) string {
 func CheckConfiguration() {
 	// this should check the db, make sure things are good to go
 	// since the DB would have nuked before here, check if there's any users or site info
+	// only the cached sites are cleared; revoked sessions, login throttles, and rate limits have to outlive a restart
+	err := clearAllSiteCaches()
+	if err != nil {
+		fmt.Printf("\ncould not clear the site cache: %+v\n", err)
+	}
+
 	site, err := GetSite()
-	if err != nil || site.Status == "pending" {
+	if (err != nil || site.Status == "pending") && config.SiteCode == "" {
 		// if not, show a code that allows a user to initiate the site
-		code := randomString(32)
-		config.SiteCode = code
+		code, err := ReissueSiteSetupCode()
+		if err != nil {
+			fmt.Printf("\ncould not save the site code: %+v\n", err)
+		}
 		fmt.Println("")
 		fmt.Printf("-------------------------------------------------------------------\n")
 		fmt.Printf("-- Your site is not configured, see the output below             --\n")
@@ -469,7 +728,7 @@ func CheckConfiguration() {
 		fmt.Printf("-------------------------------------------------------------------\n")
 	}
 
-	if config.JWTSigningString == "" {
+	if config.JWTSigningString == "" && !config.JWTKeys.hasKeys() {
 		// probably a bad day, but we won't block it; we will want to output it, especially in multi-host installs
 		config.JWTSigningString = randomString(32)
 		// to avoid issues with things like terminal prompts, replace !
@@ -486,9 +745,24 @@ func CheckConfiguration() {
 
 }
 
+// testingCacheFlushed makes sure the cache is only flushed once per test run
+var testingCacheFlushed = false
+
 func setupTesting() {
 	SetupConfig()
+	if !testingCacheFlushed {
+		config.CacheClient.FlushAll().Result()
+		testingCacheFlushed = true
+	}
+	// the suites log in and call the same routes far faster than a person would, so nothing is limited; the rate
+	// limit tests set their own rules
+	config.RateLimits = map[string]rateLimitRule{}
+	config.ChallengeVerifiers[ChallengeProviderLocalPass] = &challengeVerifierLocal{Pass: true}
+	config.ChallengeVerifiers[ChallengeProviderLocalFail] = &challengeVerifierLocal{Pass: false}
 	SetupAPI()
+	if config.JWTSigningString == "" && !config.JWTKeys.hasKeys() {
+		config.JWTSigningString = randomString(32)
+	}
 	_, err := GetSite()
 	if err != nil {
 		err = createTestSite(&Site{
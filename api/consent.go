@@ -28,7 +28,8 @@ type ConsentResponse struct {
 	ParticipantProvidedContactInformation string `json:"participantProvidedContactInformation" db:"participantProvidedContactInformation"`
 	ParticipantID                         int64  `json:"participantId" db:"participantId"` // will be 0 if the project specifies to not link them
 
-	ProjectCode string `json:"projectCode,omitempty"` // used for signup when the project needs a code
+	ProjectCode    string `json:"projectCode,omitempty"`    // used for signup when the project needs a code
+	ChallengeToken string `json:"challengeToken,omitempty"` // used for signup when the site has a challenge
 
 	// these are used when the project must be anonymous, so a new account is created during consent
 	// and tied to a participant code
@@ -98,6 +99,7 @@ func CreateConsentResponse(input *ConsentResponse) error {
 		return err
 	}
 	input.ID, _ = res.LastInsertId()
+	metricConsentResponses.Inc()
 	return nil
 }
 
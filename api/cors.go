@@ -0,0 +1,77 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// normalizeOrigin reduces an origin to the lower case scheme and host, with the port if one was given. Anything that
+// isn't a valid origin becomes empty, except for the * wildcard
+func normalizeOrigin(origin string) string {
+	origin = strings.ToLower(strings.TrimSpace(origin))
+	if origin == "*" {
+		return origin
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return ""
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+// getAllowedOriginsForSite gets the origins allowed to make credentialed requests to the site. The environment
+// overrides the site's list if it is set
+func getAllowedOriginsForSite(site *Site) []string {
+	if len(config.CORSAllowedOrigins) > 0 {
+		return config.CORSAllowedOrigins
+	}
+	if site == nil {
+		return []string{}
+	}
+	return site.AllowedOrigins
+}
+
+// isOriginAllowed checks the origin against the allowed origins for the request's site. The site's own client app and
+// the API itself are always allowed, and * allows any origin. Another site's client is not, so one tenant's client
+// can't make credentialed calls to another's API
+func isOriginAllowed(r *http.Request, origin string) bool {
+	origin = normalizeOrigin(origin)
+	if origin == "" || origin == "*" {
+		return false
+	}
+	parsed, _ := url.Parse(origin)
+	if parsed != nil && strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+	site, err := GetSiteFromContext(r.Context())
+	if err != nil {
+		return false
+	}
+	if address, err := getSiteClientAddress(site); err == nil && origin == normalizeOrigin(address) {
+		return true
+	}
+	for _, allowed := range getAllowedOriginsForSite(site) {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectUnknownOrigins stops requests from origins that aren't allowed if they carry a cookie or authorization. The
+// browser would hide the response anyway, but the request would still have been acted on
+func rejectUnknownOrigins(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		credentialed := r.Header.Get("Cookie") != "" || r.Header.Get("Authorization") != ""
+		if origin != "" && credentialed && !isOriginAllowed(r, origin) {
+			sendAPIError(w, api_error_cors_origin_not_allowed, errors.New("origin not allowed"), map[string]string{
+				"origin": origin,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeOrigin(t *testing.T) {
+	assert.Equal(t, "https://study.kesplora.com", normalizeOrigin(" HTTPS://Study.Kesplora.com/ "))
+	assert.Equal(t, "http://localhost:3000", normalizeOrigin("http://localhost:3000"))
+	assert.Equal(t, "*", normalizeOrigin("*"))
+	assert.Equal(t, "", normalizeOrigin("study.kesplora.com"))
+	assert.Equal(t, "", normalizeOrigin("null"))
+}
+
+func TestCORSOriginsFromSite(t *testing.T) {
+	setupTesting()
+	site, err := GetSite()
+	require.Nil(t, err)
+	originalOrigins := site.AllowedOrigins
+	defer func() {
+		site.AllowedOrigins = originalOrigins
+		UpdateSite(site)
+	}()
+
+	user := &User{}
+	err = createTestUser(user)
+	require.Nil(t, err)
+	defer DeleteUser(user.ID)
+
+	request := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Authorization", "Bearer "+user.Access)
+		rr := httptest.NewRecorder()
+		SetupAPI().ServeHTTP(rr, req)
+		return rr
+	}
+
+	res := request("https://partner.kesplora.com")
+	assert.Equal(t, http.StatusForbidden, res.Code, res.Body.String())
+	res = request(config.ClientAddress)
+	assert.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	assert.Equal(t, config.ClientAddress, res.Header().Get("Access-Control-Allow-Origin"))
+
+	// the change applies on the next request
+	site.AllowedOrigins = []string{"https://Partner.kesplora.com/"}
+	err = UpdateSite(site)
+	require.Nil(t, err)
+	res = request("https://partner.kesplora.com")
+	assert.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	assert.Equal(t, "https://partner.kesplora.com", res.Header().Get("Access-Control-Allow-Origin"))
+	res = request("https://other.kesplora.com")
+	assert.Equal(t, http.StatusForbidden, res.Code, res.Body.String())
+
+	// another site's client is only allowed on that site, and the default site's client is only allowed on it
+	portal := &Site{
+		ShortName:   "portal",
+		Name:        "Portal",
+		Description: "Another department",
+		Domain:      "cors-portal.kesplora.com",
+		Status:      SiteStatusActive,
+	}
+	err = CreateSite(portal)
+	require.Nil(t, err)
+	defer DeleteSiteByID(portal.ID)
+	res = request("https://cors-portal.kesplora.com")
+	assert.Equal(t, http.StatusForbidden, res.Code, res.Body.String())
+
+	portalUser := &User{
+		SiteID: portal.ID,
+	}
+	err = createTestUser(portalUser)
+	require.Nil(t, err)
+	defer DeleteUser(portalUser.ID)
+	portalRequest := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Host = portal.Domain
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Authorization", "Bearer "+portalUser.Access)
+		rr := httptest.NewRecorder()
+		SetupAPI().ServeHTTP(rr, req)
+		return rr
+	}
+	res = portalRequest("https://cors-portal.kesplora.com")
+	assert.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	res = portalRequest(config.ClientAddress)
+	assert.Equal(t, http.StatusForbidden, res.Code, res.Body.String())
+}
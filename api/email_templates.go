@@ -0,0 +1,282 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	texttemplate "text/template"
+	"time"
+)
+
+const (
+	EmailTemplatePasswordReset     = "password_reset"
+	EmailTemplateEmailVerification = "email_verification"
+	EmailTemplateInvitation        = "invitation"
+	EmailTemplateReminder          = "reminder"
+)
+
+// EmailTemplate is a named template used to build outbound messages. The subject and text body use text/template and the
+// html body uses html/template. Sites can override the defaults; an override is stored per site and template name
+type EmailTemplate struct {
+	SiteID       int64  `json:"siteId" db:"siteId"`
+	TemplateName string `json:"templateName" db:"templateName"`
+	Subject      string `json:"subject" db:"subject"`
+	TextBody     string `json:"textBody" db:"textBody"`
+	HTMLBody     string `json:"htmlBody" db:"htmlBody"`
+	UpdatedOn    string `json:"updatedOn" db:"updatedOn"`
+	Customized   string `json:"customized"` // yes if the site has overridden the default
+}
+
+// EmailTemplateData is the data available to every template, such as {{.Site.Name}}, {{.User.FirstName}}, or {{.Link}}. Not every
+// field is meaningful for every template; for example, Project is only populated for reminders
+type EmailTemplateData struct {
+	Site             *Site
+	User             *User
+	Project          *Project
+	Link             string
+	ExpiresInMinutes int
+	Message          string // an optional message from the sender, such as in a reminder
+}
+
+// defaultEmailTemplates are used when a site has not overridden a template
+var defaultEmailTemplates = map[string]EmailTemplate{
+	EmailTemplatePasswordReset: {
+		TemplateName: EmailTemplatePasswordReset,
+		Subject:      `Reset your {{.Site.Name}} password`,
+		TextBody: `A password reset was requested for your {{.Site.Name}} account.
+
+To choose a new password, visit the following link within {{.ExpiresInMinutes}} minutes:
+
+{{.Link}}
+
+If you did not request a reset, you can ignore this message.`,
+		HTMLBody: `<p>A password reset was requested for your {{.Site.Name}} account.</p>
+<p>To choose a new password, <a href="{{.Link}}">click here</a> within {{.ExpiresInMinutes}} minutes.</p>
+<p>If you did not request a reset, you can ignore this message.</p>`,
+	},
+	EmailTemplateEmailVerification: {
+		TemplateName: EmailTemplateEmailVerification,
+		Subject:      `Verify your email for {{.Site.Name}}`,
+		TextBody: `Hi {{.User.FirstName}},
+
+Please verify your email address by visiting the following link within {{.ExpiresInMinutes}} minutes:
+
+{{.Link}}`,
+		HTMLBody: `<p>Hi {{.User.FirstName}},</p>
+<p>Please verify your email address by <a href="{{.Link}}">clicking here</a> within {{.ExpiresInMinutes}} minutes.</p>`,
+	},
+	EmailTemplateInvitation: {
+		TemplateName: EmailTemplateInvitation,
+		Subject:      `You have been invited to {{.Site.Name}}`,
+		TextBody: `Hi {{.User.FirstName}},
+
+You have been invited to join {{.Site.Name}}. To accept the invitation and choose a password, visit the following link within {{.ExpiresInMinutes}} minutes:
+
+{{.Link}}
+{{if .Message}}
+{{.Message}}
+{{end}}`,
+		HTMLBody: `<p>Hi {{.User.FirstName}},</p>
+<p>You have been invited to join {{.Site.Name}}. To accept the invitation and choose a password, <a href="{{.Link}}">click here</a> within {{.ExpiresInMinutes}} minutes.</p>
+{{if .Message}}<p>{{.Message}}</p>{{end}}`,
+	},
+	EmailTemplateReminder: {
+		TemplateName: EmailTemplateReminder,
+		Subject:      `A reminder about {{.Project.Name}}`,
+		TextBody: `Hi {{.User.FirstName}},
+
+This is a reminder to continue your participation in {{.Project.Name}} on {{.Site.Name}}.
+{{if .Message}}
+{{.Message}}
+{{end}}
+{{.Link}}`,
+		HTMLBody: `<p>Hi {{.User.FirstName}},</p>
+<p>This is a reminder to continue your participation in {{.Project.Name}} on {{.Site.Name}}.</p>
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+<p><a href="{{.Link}}">Continue</a></p>`,
+	},
+}
+
+// GetEmailTemplateForSite gets the site's override for the template or the default if there isn't one
+func GetEmailTemplateForSite(siteID int64, templateName string) (*EmailTemplate, error) {
+	def, found := defaultEmailTemplates[templateName]
+	if !found {
+		return nil, fmt.Errorf("unknown template %s", templateName)
+	}
+	template := &EmailTemplate{}
+	err := config.DBConnection.Get(template, `SELECT * FROM SiteEmailTemplates WHERE siteId = ? AND templateName = ?`, siteID, templateName)
+	if err == nil {
+		template.Customized = Yes
+		template.processForAPI()
+		return template, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	def.SiteID = siteID
+	def.Customized = No
+	return &def, nil
+}
+
+// GetEmailTemplatesForSite gets all of the templates for a site, with overrides where they exist
+func GetEmailTemplatesForSite(siteID int64) ([]EmailTemplate, error) {
+	templates := []EmailTemplate{}
+	for _, name := range []string{EmailTemplatePasswordReset, EmailTemplateEmailVerification, EmailTemplateInvitation, EmailTemplateReminder} {
+		template, err := GetEmailTemplateForSite(siteID, name)
+		if err != nil {
+			return templates, err
+		}
+		templates = append(templates, *template)
+	}
+	return templates, nil
+}
+
+// SaveEmailTemplateForSite validates and saves an override for a template
+func SaveEmailTemplateForSite(input *EmailTemplate) error {
+	if _, found := defaultEmailTemplates[input.TemplateName]; !found {
+		return fmt.Errorf("unknown template %s", input.TemplateName)
+	}
+	// make sure it actually renders before saving, so a typo doesn't break every email
+	_, err := renderEmailTemplate(input, sampleEmailTemplateData())
+	if err != nil {
+		return err
+	}
+	input.processForDB()
+	defer input.processForAPI()
+	_, err = config.DBConnection.NamedExec(`INSERT INTO SiteEmailTemplates (siteId, templateName, subject, textBody, htmlBody, updatedOn)
+	VALUES
+	(:siteId, :templateName, :subject, :textBody, :htmlBody, :updatedOn)
+	ON DUPLICATE KEY UPDATE
+	subject = :subject,
+	textBody = :textBody,
+	htmlBody = :htmlBody,
+	updatedOn = :updatedOn`, input)
+	if err == nil {
+		input.Customized = Yes
+	}
+	return err
+}
+
+// DeleteEmailTemplateForSite removes the override, so the default is used again
+func DeleteEmailTemplateForSite(siteID int64, templateName string) error {
+	_, err := config.DBConnection.Exec(`DELETE FROM SiteEmailTemplates WHERE siteId = ? AND templateName = ?`, siteID, templateName)
+	return err
+}
+
+// renderEmailTemplate executes the template with the data and returns the message without a recipient
+func renderEmailTemplate(template *EmailTemplate, data *EmailTemplateData) (*MailMessage, error) {
+	message := &MailMessage{
+		Template: template.TemplateName,
+	}
+	buf := &bytes.Buffer{}
+
+	subject, err := texttemplate.New("subject").Parse(template.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if err = subject.Execute(buf, data); err != nil {
+		return nil, err
+	}
+	message.Subject = buf.String()
+
+	buf.Reset()
+	text, err := texttemplate.New("text").Parse(template.TextBody)
+	if err != nil {
+		return nil, err
+	}
+	if err = text.Execute(buf, data); err != nil {
+		return nil, err
+	}
+	message.Text = buf.String()
+
+	if template.HTMLBody != "" {
+		buf.Reset()
+		html, err := htmltemplate.New("html").Parse(template.HTMLBody)
+		if err != nil {
+			return nil, err
+		}
+		if err = html.Execute(buf, data); err != nil {
+			return nil, err
+		}
+		message.HTML = buf.String()
+	}
+	return message, nil
+}
+
+// sendTemplatedMail renders the site's version of the template and sends it to the recipient. The site is filled in
+// from the user or project if it is not provided, and empty values are used for any other missing data so templates can
+// safely reference them
+func sendTemplatedMail(to, templateName string, data *EmailTemplateData) error {
+	if data == nil {
+		data = &EmailTemplateData{}
+	}
+	if data.Site == nil {
+		site, err := GetSite()
+		if data.User != nil && data.User.SiteID != 0 {
+			site, err = GetSiteByID(data.User.SiteID)
+		} else if data.Project != nil && data.Project.SiteID != 0 {
+			site, err = GetSiteByID(data.Project.SiteID)
+		}
+		if err != nil {
+			return err
+		}
+		data.Site = site
+	}
+	if data.User == nil {
+		data.User = &User{}
+	}
+	if data.Project == nil {
+		data.Project = &Project{}
+	}
+	template, err := GetEmailTemplateForSite(data.Site.ID, templateName)
+	if err != nil {
+		return err
+	}
+	message, err := renderEmailTemplate(template, data)
+	if err != nil {
+		return err
+	}
+	message.To = to
+	return sendMail(message)
+}
+
+// sampleEmailTemplateData is used to validate templates before they are saved
+func sampleEmailTemplateData() *EmailTemplateData {
+	return &EmailTemplateData{
+		Site: &Site{
+			Name:      "Kesplora",
+			ShortName: "kesplora",
+		},
+		User: &User{
+			FirstName: "Participant",
+			LastName:  "Participant",
+			Email:     "participant@kesplora.com",
+		},
+		Project: &Project{
+			Name: "Project",
+		},
+		Link:             "https://kesplora.com",
+		ExpiresInMinutes: 30,
+		Message:          "Message",
+	}
+}
+
+//
+// processors
+//
+
+func (input *EmailTemplate) processForDB() {
+	input.UpdatedOn = time.Now().Format(timeFormatDB)
+}
+
+func (input *EmailTemplate) processForAPI() {
+	input.UpdatedOn, _ = parseTimeToTimeFormat(input.UpdatedOn, timeFormatAPI)
+}
+
+// Bind binds the data for the HTTP
+func (data *EmailTemplate) Bind(r *http.Request) error {
+	return nil
+}
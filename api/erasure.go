@@ -0,0 +1,256 @@
+package api
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ErasureScopeAccount = "account"
+	ErasureScopeProject = "project"
+)
+
+// ErasureReceipt records what was removed for a participant so the erasure can be shown for GDPR or IRB paperwork.
+// It never contains the participant's personal information, only ids and the number of rows per table. The hash
+// covers every field but the id, including the site, so a printed receipt can be checked against the stored one
+type ErasureReceipt struct {
+	ID          int64            `json:"id" db:"id"`
+	SiteID      int64            `json:"siteId" db:"siteId"`
+	UserID      int64            `json:"userId" db:"userId"`
+	ProjectID   int64            `json:"projectId" db:"projectId"`
+	Scope       string           `json:"scope" db:"scope"`
+	RequestedBy int64            `json:"requestedBy" db:"requestedBy"`
+	PerformedOn string           `json:"performedOn" db:"performedOn"`
+	CountsDB    string           `json:"-" db:"counts"`
+	Counts      map[string]int64 `json:"counts" db:"-"`
+	ReceiptHash string           `json:"receiptHash" db:"receiptHash"`
+	DryRun      string           `json:"dryRun" db:"-"` // yes if nothing was removed and the counts are what would be
+}
+
+// erasureStep is a table that holds data for a user. If Anonymize is set, the rows are kept for the project and the
+// link to the user is cleared instead of deleting them
+type erasureStep struct {
+	Table     string
+	Where     string
+	Args      []interface{}
+	Anonymize string
+}
+
+// EraseUser removes everything tied to the user in one transaction. With a projectID, only the user's data in that
+// project is removed and the account is kept; otherwise the account itself and everything connected to it is removed.
+// With dryRun, nothing is changed and the receipt has the counts that would be removed. A receipt is saved for every
+// real erasure
+func EraseUser(userID, projectID, requestedBy int64, dryRun bool) (*ErasureReceipt, error) {
+	return eraseUser(userID, projectID, requestedBy, dryRun, false)
+}
+
+// eraseUser does the erasure. A cleanup is for removing test and rolled back accounts, so no receipt is saved and the
+// account does not have to exist or pass the last admin check
+func eraseUser(userID, projectID, requestedBy int64, dryRun, cleanup bool) (*ErasureReceipt, error) {
+	receipt := &ErasureReceipt{
+		UserID:      userID,
+		ProjectID:   projectID,
+		Scope:       ErasureScopeProject,
+		RequestedBy: requestedBy,
+		Counts:      map[string]int64{},
+		DryRun:      No,
+	}
+	if projectID == 0 {
+		receipt.Scope = ErasureScopeAccount
+	}
+	if dryRun {
+		receipt.DryRun = Yes
+	}
+
+	user, err := GetUserByID(userID)
+	if err != nil {
+		if !cleanup || !errors.Is(err, sql.ErrNoRows) {
+			return receipt, err
+		}
+		user = &User{ID: userID}
+	}
+	receipt.SiteID = user.SiteID
+	if receipt.Scope == ErasureScopeAccount && !cleanup {
+		err = checkUserIsNotLastAdmin(user, "", UserStatusDisabled)
+		if err != nil {
+			return receipt, err
+		}
+	}
+
+	tx, err := config.DBConnection.Beginx()
+	if err != nil {
+		return receipt, err
+	}
+	defer tx.Rollback()
+
+	// the sessions are removed in the transaction, so the ids are needed to mark them revoked once it is committed
+	sessionIDs := []int64{}
+	if receipt.Scope == ErasureScopeAccount {
+		err = tx.Select(&sessionIDs, `SELECT id FROM Sessions WHERE userId = ?`, userID)
+		if err != nil {
+			return receipt, err
+		}
+	}
+
+	for _, step := range getErasureSteps(userID, projectID) {
+		count := int64(0)
+		err = tx.Get(&count, fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, step.Table, step.Where), step.Args...)
+		if err != nil {
+			return receipt, err
+		}
+		receipt.Counts[step.Table] = count
+		if dryRun || count == 0 {
+			continue
+		}
+		query := fmt.Sprintf(`DELETE FROM %s WHERE %s`, step.Table, step.Where)
+		if step.Anonymize != "" {
+			query = fmt.Sprintf(`UPDATE %s SET %s WHERE %s`, step.Table, step.Anonymize, step.Where)
+		}
+		_, err = tx.Exec(query, step.Args...)
+		if err != nil {
+			return receipt, err
+		}
+	}
+
+	receipt.processForDB()
+	if dryRun {
+		receipt.processForAPI()
+		return receipt, nil
+	}
+	if !cleanup {
+		res, err := tx.NamedExec(`INSERT INTO ErasureReceipts (siteId, userId, projectId, scope, requestedBy, performedOn, counts, receiptHash)
+		VALUES
+		(:siteId, :userId, :projectId, :scope, :requestedBy, :performedOn, :counts, :receiptHash)`, receipt)
+		if err != nil {
+			return receipt, err
+		}
+		receipt.ID, _ = res.LastInsertId()
+	}
+	err = tx.Commit()
+	if err != nil {
+		return receipt, err
+	}
+	receipt.processForAPI()
+
+	if receipt.Scope == ErasureScopeAccount {
+		clearCacheForErasedUser(user, sessionIDs)
+	}
+	Log(LogLevelInfo, "user_erased", "user data erased", &LogOptions{
+		ExtraData: map[string]interface{}{
+			"userId":      userID,
+			"projectId":   projectID,
+			"requestedBy": requestedBy,
+			"receiptId":   receipt.ID,
+		},
+	})
+	return receipt, nil
+}
+
+// getErasureSteps lists every table with rows for the user, in the order they can be removed. This MUST be updated as
+// new user-connected tables are added
+func getErasureSteps(userID, projectID int64) []erasureStep {
+	if projectID != 0 {
+		// blocks can be reused across projects, so the submissions are matched through the project's flow
+		projectSubmissions := `userId = ? AND blockId IN
+		(SELECT bmf.blockId FROM BlockModuleFlows bmf, Flows f WHERE bmf.moduleId = f.moduleId AND f.projectId = ?)`
+		return []erasureStep{
+			{Table: "BlockFormSubmissionResponses", Where: "submissionId IN (SELECT id FROM BlockFormSubmissions WHERE " + projectSubmissions + ")", Args: []interface{}{userID, projectID}},
+			{Table: "BlockFormSubmissions", Where: projectSubmissions, Args: []interface{}{userID, projectID}},
+			{Table: "BlockUserStatus", Where: "userId = ? AND projectId = ?", Args: []interface{}{userID, projectID}},
+			{Table: "Notes", Where: "userId = ? AND projectId = ?", Args: []interface{}{userID, projectID}},
+			{Table: "ConsentResponses", Where: "participantId = ? AND projectId = ?", Args: []interface{}{userID, projectID}},
+			{Table: "ProjectUserLinks", Where: "userId = ? AND projectId = ?", Args: []interface{}{userID, projectID}},
+		}
+	}
+	return []erasureStep{
+		{Table: "BlockFormSubmissionResponses", Where: "submissionId IN (SELECT id FROM BlockFormSubmissions WHERE userId = ?)", Args: []interface{}{userID}},
+		{Table: "BlockFormSubmissions", Where: "userId = ?", Args: []interface{}{userID}},
+		{Table: "BlockUserStatus", Where: "userId = ?", Args: []interface{}{userID}},
+		{Table: "Notes", Where: "userId = ?", Args: []interface{}{userID}},
+		{Table: "ConsentResponses", Where: "participantId = ?", Args: []interface{}{userID}},
+		{Table: "ProjectUserLinks", Where: "userId = ?", Args: []interface{}{userID}},
+		{Table: "ProjectCollaborators", Where: "userId = ?", Args: []interface{}{userID}},
+		// files belong to the site once uploaded, so they are kept without the uploader
+		{Table: "Files", Where: "uploadedBy = ?", Args: []interface{}{userID}, Anonymize: "uploadedBy = 0"},
+		// the audit log has to stay whole, so the events are kept without who made them; the chain covers a keyed
+		// hash of the actor instead, so it still verifies
+		{Table: "AuditEvents", Where: "actorId = ?", Args: []interface{}{userID}, Anonymize: "actorId = 0, apiKeyId = 0, ip = ''"},
+		{Table: "ApiKeys", Where: "userId = ?", Args: []interface{}{userID}},
+		{Table: "UserRecoveryCodes", Where: "userId = ?", Args: []interface{}{userID}},
+		{Table: "Tokens", Where: "userId = ?", Args: []interface{}{userID}},
+		{Table: "Sessions", Where: "userId = ?", Args: []interface{}{userID}},
+		{Table: "Users", Where: "id = ?", Args: []interface{}{userID}},
+	}
+}
+
+// clearCacheForErasedUser revokes the removed sessions so their access tokens stop working and forgets anything else
+// cached for the user
+func clearCacheForErasedUser(user *User, sessionIDs []int64) {
+	for _, sessionID := range sessionIDs {
+		config.CacheClient.Set(getSessionRevokedCacheKey(sessionID), "1", tokenExpiresMinutesAccess*time.Minute)
+	}
+	if user.Email != "" {
+		clearFailedLoginAttempts(user.SiteID, user.Email)
+	}
+	if user.ParticipantCode != "" {
+		clearFailedLoginAttempts(user.SiteID, user.ParticipantCode)
+	}
+	config.CacheClient.Del(getMFAChallengeAttemptsCacheKey(user.ID), getVerificationResendCacheKey(user.ID))
+}
+
+// GetErasureReceipts gets the saved receipts for the site, newest first
+func GetErasureReceipts(siteID int64) ([]ErasureReceipt, error) {
+	receipts := []ErasureReceipt{}
+	err := config.DBConnection.Select(&receipts, `SELECT * FROM ErasureReceipts WHERE siteId = ? ORDER BY performedOn DESC, id DESC`, siteID)
+	for i := range receipts {
+		receipts[i].processForAPI()
+	}
+	return receipts, err
+}
+
+// GetErasureReceiptByID gets a single receipt on the site
+func GetErasureReceiptByID(siteID, receiptID int64) (*ErasureReceipt, error) {
+	receipt := &ErasureReceipt{}
+	defer receipt.processForAPI()
+	err := config.DBConnection.Get(receipt, `SELECT * FROM ErasureReceipts WHERE id = ? AND siteId = ?`, receiptID, siteID)
+	return receipt, err
+}
+
+// hash creates the receipt hash from its fields; the counts are marshaled from a map, so the keys are sorted. The
+// 202610161040 migration computes the same hash in SQL, so keep them in step
+func (input *ErasureReceipt) hash() string {
+	performedOn, _ := parseTimeToTimeFormat(input.PerformedOn, timeFormatDB)
+	hashed := sha256.Sum256([]byte(fmt.Sprintf("%d|%d|%d|%s|%d|%s|%s", input.SiteID, input.UserID, input.ProjectID, input.Scope, input.RequestedBy, performedOn, input.CountsDB)))
+	return hex.EncodeToString(hashed[:])
+}
+
+//
+// processors
+//
+
+func (input *ErasureReceipt) processForDB() {
+	if input.PerformedOn == "" {
+		input.PerformedOn = time.Now().Format(timeFormatDB)
+	} else {
+		input.PerformedOn, _ = parseTimeToTimeFormat(input.PerformedOn, timeFormatDB)
+	}
+	counts, _ := json.Marshal(input.Counts)
+	input.CountsDB = string(counts)
+	input.ReceiptHash = input.hash()
+}
+
+func (input *ErasureReceipt) processForAPI() {
+	input.PerformedOn, _ = parseTimeToTimeFormat(input.PerformedOn, timeFormatAPI)
+	if input.CountsDB != "" {
+		input.Counts = map[string]int64{}
+		json.Unmarshal([]byte(input.CountsDB), &input.Counts)
+	}
+	if input.DryRun == "" {
+		input.DryRun = No
+	}
+}
@@ -23,47 +23,100 @@ const (
 	api_error_not_implemented = "api_error_not_implemented"
 
 	// general
-	api_error_invalid_path = "api_error_invalid_path"
+	api_error_invalid_path        = "api_error_invalid_path"
+	api_error_request_invalid     = "api_error_request_invalid"
+	api_error_openapi_unavailable = "api_error_openapi_unavailable"
+	api_error_rate_limited        = "api_error_rate_limited"
 
 	// auth
-	api_error_auth_missing          = "api_error_auth_missing"
-	api_error_auth_expired          = "api_error_auth_expired"
-	api_error_auth_save             = "api_error_auth_save"
-	api_error_auth_malformed        = "api_error_auth_malformed"
-	api_error_auth_must_admin       = "api_error_auth_must_admin"
-	api_error_auth_must_participant = "api_error_auth_must_participant"
-	api_error_auth_must_user        = "api_error_auth_must_user"
+	api_error_auth_missing           = "api_error_auth_missing"
+	api_error_auth_expired           = "api_error_auth_expired"
+	api_error_auth_save              = "api_error_auth_save"
+	api_error_auth_malformed         = "api_error_auth_malformed"
+	api_error_auth_reused            = "api_error_auth_reused"
+	api_error_auth_must_admin        = "api_error_auth_must_admin"
+	api_error_auth_must_participant  = "api_error_auth_must_participant"
+	api_error_auth_must_user         = "api_error_auth_must_user"
+	api_error_auth_must_collaborator = "api_error_auth_must_collaborator"
+	api_error_auth_mfa_required      = "api_error_auth_mfa_required"
+	api_error_auth_scope             = "api_error_auth_scope"
+	api_error_auth_cannot_sign       = "api_error_auth_cannot_sign"
 
 	// config
 	api_error_config_missing_data = "api_error_config_missing_data"
 	api_error_config_invalid_code = "api_error_config_invalid_code"
 
 	// sites
-	api_error_site_not_active = "api_error_site_not_active"
-	api_error_site_get_error  = "api_error_site_get_error"
-	api_error_site_save       = "api_error_site_save"
+	api_error_site_not_active         = "api_error_site_not_active"
+	api_error_site_get_error          = "api_error_site_get_error"
+	api_error_site_save               = "api_error_site_save"
+	api_error_site_domain_taken       = "api_error_site_domain_taken"
+	api_error_site_invalid_proxies    = "api_error_site_invalid_proxies"
+	api_error_site_invalid_challenge  = "api_error_site_invalid_challenge"
+	api_error_challenge_failed        = "api_error_challenge_failed"
+	api_error_cors_origin_not_allowed = "api_error_cors_origin_not_allowed"
 
 	// user errors
-	api_error_users_site       = "api_error_users_site"
-	api_error_users_project    = "api_error_users_project"
-	api_error_user_not_found   = "api_error_user_not_found"
-	api_error_user_general     = "api_error_user_general"
-	api_error_user_cannot_save = "api_error_cannot_save"
-	api_error_user_bad_data    = "api_error_user_bad_data"
-	api_error_user_bad_login   = "api_error_user_bad_login"
-	api_error_user_bad_logout  = "api_error_user_bad_logout"
+	api_error_users_site               = "api_error_users_site"
+	api_error_users_project            = "api_error_users_project"
+	api_error_user_not_found           = "api_error_user_not_found"
+	api_error_user_general             = "api_error_user_general"
+	api_error_user_cannot_save         = "api_error_cannot_save"
+	api_error_user_bad_data            = "api_error_user_bad_data"
+	api_error_user_bad_login           = "api_error_user_bad_login"
+	api_error_user_bad_logout          = "api_error_user_bad_logout"
+	api_error_user_bad_reset           = "api_error_user_bad_reset"
+	api_error_user_bad_verify          = "api_error_user_bad_verify"
+	api_error_user_not_verified        = "api_error_user_not_verified"
+	api_error_user_verify_throttled    = "api_error_user_verify_throttled"
+	api_error_user_sessions            = "api_error_user_sessions"
+	api_error_user_session_not_found   = "api_error_user_session_not_found"
+	api_error_user_session_revoke      = "api_error_user_session_revoke"
+	api_error_user_mfa_bad_code        = "api_error_user_mfa_bad_code"
+	api_error_user_mfa_already_enabled = "api_error_user_mfa_already_enabled"
+	api_error_user_mfa_not_enabled     = "api_error_user_mfa_not_enabled"
+	api_error_user_mfa_cannot_disable  = "api_error_user_mfa_cannot_disable"
+	api_error_user_mfa_save            = "api_error_user_mfa_save"
+	api_error_user_login_throttled     = "api_error_user_login_throttled"
+	api_error_user_unlock              = "api_error_user_unlock"
+	api_error_user_oidc_not_configured = "api_error_user_oidc_not_configured"
+	api_error_user_oidc_bad_state      = "api_error_user_oidc_bad_state"
+	api_error_user_oidc_failed         = "api_error_user_oidc_failed"
+	api_error_user_oidc_no_account     = "api_error_user_oidc_no_account"
+	api_error_user_email_taken         = "api_error_user_email_taken"
+	api_error_user_invitation          = "api_error_user_invitation"
+	api_error_user_invitation_accepted = "api_error_user_invitation_accepted"
+	api_error_user_bad_invitation      = "api_error_user_bad_invitation"
+	api_error_user_last_admin          = "api_error_user_last_admin"
+	api_error_user_no_email            = "api_error_user_no_email"
+	api_error_user_force_reset         = "api_error_user_force_reset"
+	api_error_user_erasure             = "api_error_user_erasure"
+	api_error_user_erasure_not_found   = "api_error_user_erasure_not_found"
+	api_error_user_export              = "api_error_user_export"
+
+	// api key errors
+	api_error_api_key_bad_data  = "api_error_api_key_bad_data"
+	api_error_api_key_not_found = "api_error_api_key_not_found"
+	api_error_api_key_save      = "api_error_api_key_save"
+	api_error_api_key_delete    = "api_error_api_key_delete"
 
 	// project errors
-	api_error_project_missing_data       = "api_error_project_missing_data"
-	api_error_project_save               = "api_error_project_save"
-	api_error_project_no_projects_found  = "api_error_project_no_projects_found"
-	api_error_project_not_found          = "api_error_project_not_found"
-	api_error_project_link               = "api_error_project_link"
-	api_error_project_unlink             = "api_error_project_unlink"
-	api_error_project_signup_unavailable = "api_error_project_signup_unavailable"
-	api_error_project_for_user           = "api_error_projects_for_user"
-	api_error_project_user_not_in        = "api_error_projects_user_not_in"
-	api_error_project_misconfiguration   = "api_error_project_misconfiguration"
+	api_error_project_missing_data           = "api_error_project_missing_data"
+	api_error_project_save                   = "api_error_project_save"
+	api_error_project_no_projects_found      = "api_error_project_no_projects_found"
+	api_error_project_not_found              = "api_error_project_not_found"
+	api_error_project_link                   = "api_error_project_link"
+	api_error_project_unlink                 = "api_error_project_unlink"
+	api_error_project_signup_unavailable     = "api_error_project_signup_unavailable"
+	api_error_project_for_user               = "api_error_projects_for_user"
+	api_error_project_user_not_in            = "api_error_projects_user_not_in"
+	api_error_project_misconfiguration       = "api_error_project_misconfiguration"
+	api_error_project_collaborator_bad_data  = "api_error_project_collaborator_bad_data"
+	api_error_project_collaborator_not_found = "api_error_project_collaborator_not_found"
+	api_error_project_collaborator_save      = "api_error_project_collaborator_save"
+	api_error_project_batch_bad_data         = "api_error_project_batch_bad_data"
+	api_error_project_batch_max_reached      = "api_error_project_batch_max_reached"
+	api_error_project_batch_save             = "api_error_project_batch_save"
 
 	// consent form errors
 	api_error_consent_save                         = "api_error_consent_save"
@@ -120,6 +173,11 @@ const (
 	api_error_file_delete_meta          = "api_error_file_delete_meta"
 	api_error_file_update_meta          = "api_error_file_update_meta"
 
+	// email errors
+	api_error_email_template_not_found = "api_error_email_template_not_found"
+	api_error_email_template_invalid   = "api_error_email_template_invalid"
+	api_error_email_template_delete    = "api_error_email_template_delete"
+
 	// notes errors
 	api_error_notes_not_found = "api_error_notes_not_found"
 	api_error_notes_delete    = "api_error_notes_delete"
@@ -127,6 +185,10 @@ const (
 
 	// reports errors
 	api_error_reports_get = "api_error_reports_get"
+
+	// audit errors
+	api_error_audit_bad_query = "api_error_audit_bad_query"
+	api_error_audit_fetch     = "api_error_audit_fetch"
 )
 
 // apiErrors is a mapping of keys to data
@@ -140,6 +202,18 @@ var apiErrors = map[string]apiError{
 		Code:    http.StatusBadRequest,
 		Message: "invalid path",
 	},
+	api_error_request_invalid: {
+		Code:    http.StatusBadRequest,
+		Message: "the request body does not match the API specification; see the data for the fields",
+	},
+	api_error_openapi_unavailable: {
+		Code:    http.StatusInternalServerError,
+		Message: "could not build the API specification",
+	},
+	api_error_rate_limited: {
+		Code:    http.StatusTooManyRequests,
+		Message: "too many requests; wait until retryAfter seconds have passed",
+	},
 
 	// auth
 	api_error_auth_missing: {
@@ -154,6 +228,10 @@ var apiErrors = map[string]apiError{
 		Code:    http.StatusUnauthorized,
 		Message: "authorization malformed",
 	},
+	api_error_auth_reused: {
+		Code:    http.StatusUnauthorized,
+		Message: "refresh token was already used, so the session has been revoked",
+	},
 	api_error_auth_save: {
 		Code:    http.StatusUnauthorized,
 		Message: "authorization could not be saved",
@@ -170,6 +248,22 @@ var apiErrors = map[string]apiError{
 		Code:    http.StatusForbidden,
 		Message: "must be a user",
 	},
+	api_error_auth_must_collaborator: {
+		Code:    http.StatusForbidden,
+		Message: "must be a collaborator on the project with a sufficient role",
+	},
+	api_error_auth_mfa_required: {
+		Code:    http.StatusForbidden,
+		Message: "two-factor authentication must be enabled before using admin access",
+	},
+	api_error_auth_scope: {
+		Code:    http.StatusForbidden,
+		Message: "the API key does not have the scope needed for this route",
+	},
+	api_error_auth_cannot_sign: {
+		Code:    http.StatusServiceUnavailable,
+		Message: "this host cannot issue tokens; log in through a host with the signing key",
+	},
 
 	// config
 	api_error_config_missing_data: {
@@ -194,6 +288,26 @@ var apiErrors = map[string]apiError{
 		Code:    http.StatusBadRequest,
 		Message: "site cannot be updated",
 	},
+	api_error_site_domain_taken: {
+		Code:    http.StatusConflict,
+		Message: "that domain is already used by another site",
+	},
+	api_error_site_invalid_proxies: {
+		Code:    http.StatusBadRequest,
+		Message: "trusted proxies must be IP addresses or CIDRs",
+	},
+	api_error_site_invalid_challenge: {
+		Code:    http.StatusBadRequest,
+		Message: "that challenge provider is not configured",
+	},
+	api_error_challenge_failed: {
+		Code:    http.StatusForbidden,
+		Message: "the challenge could not be verified",
+	},
+	api_error_cors_origin_not_allowed: {
+		Code:    http.StatusForbidden,
+		Message: "requests with credentials are not allowed from that origin",
+	},
 
 	// user
 	api_error_users_site: {
@@ -228,6 +342,136 @@ var apiErrors = map[string]apiError{
 		Code:    http.StatusBadRequest,
 		Message: "user logout failed",
 	},
+	api_error_user_bad_reset: {
+		Code:    http.StatusForbidden,
+		Message: "password reset token is invalid or expired",
+	},
+	api_error_user_bad_verify: {
+		Code:    http.StatusForbidden,
+		Message: "email verification token is invalid or expired",
+	},
+	api_error_user_not_verified: {
+		Code:    http.StatusForbidden,
+		Message: "email address must be verified before logging in",
+	},
+	api_error_user_verify_throttled: {
+		Code:    http.StatusTooManyRequests,
+		Message: "a verification email was sent recently; please wait before requesting another",
+	},
+	api_error_user_sessions: {
+		Code:    http.StatusBadRequest,
+		Message: "could not fetch sessions",
+	},
+	api_error_user_session_not_found: {
+		Code:    http.StatusNotFound,
+		Message: "session not found",
+	},
+	api_error_user_session_revoke: {
+		Code:    http.StatusBadRequest,
+		Message: "could not revoke the session",
+	},
+	api_error_user_mfa_bad_code: {
+		Code:    http.StatusForbidden,
+		Message: "two-factor code is invalid",
+	},
+	api_error_user_mfa_already_enabled: {
+		Code:    http.StatusBadRequest,
+		Message: "two-factor authentication is already enabled",
+	},
+	api_error_user_mfa_not_enabled: {
+		Code:    http.StatusBadRequest,
+		Message: "two-factor authentication is not enabled",
+	},
+	api_error_user_mfa_cannot_disable: {
+		Code:    http.StatusForbidden,
+		Message: "the site requires two-factor authentication for admins",
+	},
+	api_error_user_mfa_save: {
+		Code:    http.StatusBadRequest,
+		Message: "could not update two-factor authentication",
+	},
+	api_error_user_login_throttled: {
+		Code:    http.StatusTooManyRequests,
+		Message: "too many failed login attempts; wait until retryAfter seconds have passed",
+	},
+	api_error_user_unlock: {
+		Code:    http.StatusBadRequest,
+		Message: "could not unlock the user",
+	},
+	api_error_user_oidc_not_configured: {
+		Code:    http.StatusNotFound,
+		Message: "single sign-on is not configured for this site",
+	},
+	api_error_user_oidc_bad_state: {
+		Code:    http.StatusBadRequest,
+		Message: "the single sign-on state is invalid or expired; start the login again",
+	},
+	api_error_user_oidc_failed: {
+		Code:    http.StatusUnauthorized,
+		Message: "could not verify the login with the identity provider",
+	},
+	api_error_user_oidc_no_account: {
+		Code:    http.StatusForbidden,
+		Message: "no account exists for that email; contact the site admin",
+	},
+	api_error_user_email_taken: {
+		Code:    http.StatusConflict,
+		Message: "a user with that email already exists",
+	},
+	api_error_user_invitation: {
+		Code:    http.StatusBadRequest,
+		Message: "could not send the invitation",
+	},
+	api_error_user_invitation_accepted: {
+		Code:    http.StatusConflict,
+		Message: "the user has already accepted their invitation",
+	},
+	api_error_user_bad_invitation: {
+		Code:    http.StatusForbidden,
+		Message: "invitation is invalid or expired",
+	},
+	api_error_user_last_admin: {
+		Code:    http.StatusConflict,
+		Message: "the site must keep at least one active admin",
+	},
+	api_error_user_no_email: {
+		Code:    http.StatusBadRequest,
+		Message: "the user does not have an email address",
+	},
+	api_error_user_force_reset: {
+		Code:    http.StatusBadRequest,
+		Message: "could not reset the user's password",
+	},
+	api_error_user_erasure: {
+		Code:    http.StatusInternalServerError,
+		Message: "could not erase the user's data; nothing was removed",
+	},
+	api_error_user_erasure_not_found: {
+		Code:    http.StatusNotFound,
+		Message: "erasure receipt not found",
+	},
+	api_error_user_export: {
+		Code:    http.StatusInternalServerError,
+		Message: "could not export the user's data",
+	},
+
+	// api keys
+	api_error_api_key_bad_data: {
+		Code:    http.StatusBadRequest,
+		Message: "API keys need a name and at least one valid scope",
+	},
+	api_error_api_key_not_found: {
+		Code:    http.StatusNotFound,
+		Message: "API key not found",
+	},
+	api_error_api_key_save: {
+		Code:    http.StatusBadRequest,
+		Message: "could not save the API key",
+	},
+	api_error_api_key_delete: {
+		Code:    http.StatusBadRequest,
+		Message: "could not delete the API key",
+	},
 
 	// projects
 	api_error_project_missing_data: {
@@ -270,6 +514,30 @@ var apiErrors = map[string]apiError{
 		Code:    http.StatusBadRequest,
 		Message: "the passed in data results in a misconfiguration or is otherwise incorrect",
 	},
+	api_error_project_collaborator_bad_data: {
+		Code:    http.StatusBadRequest,
+		Message: "collaborators must be researchers with a role of owner, editor, analyst, or viewer",
+	},
+	api_error_project_collaborator_not_found: {
+		Code:    http.StatusNotFound,
+		Message: "collaborator not found",
+	},
+	api_error_project_collaborator_save: {
+		Code:    http.StatusBadRequest,
+		Message: "could not save the collaborator",
+	},
+	api_error_project_batch_bad_data: {
+		Code:    http.StatusBadRequest,
+		Message: "count must be between 1 and 500",
+	},
+	api_error_project_batch_max_reached: {
+		Code:    http.StatusBadRequest,
+		Message: "the batch would go over the project's maximum participants",
+	},
+	api_error_project_batch_save: {
+		Code:    http.StatusBadRequest,
+		Message: "could not create the participants; none were created",
+	},
 
 	// consent and responses
 	api_error_consent_save: {
@@ -462,6 +730,20 @@ var apiErrors = map[string]apiError{
 		Message: "could not update the file metadata",
 	},
 
+	// emails
+	api_error_email_template_not_found: {
+		Code:    http.StatusNotFound,
+		Message: "email template not found",
+	},
+	api_error_email_template_invalid: {
+		Code:    http.StatusBadRequest,
+		Message: "email template could not be parsed or rendered",
+	},
+	api_error_email_template_delete: {
+		Code:    http.StatusBadRequest,
+		Message: "email template could not be reset",
+	},
+
 	// notes
 	api_error_notes_not_found: {
 		Code:    http.StatusNotFound,
@@ -481,4 +763,14 @@ var apiErrors = map[string]apiError{
 		Code:    http.StatusBadRequest,
 		Message: "could not fetch that report",
 	},
+
+	// audit
+	api_error_audit_bad_query: {
+		Code:    http.StatusBadRequest,
+		Message: "invalid audit filter; from and to must be dates or timestamps and ids must be numbers",
+	},
+	api_error_audit_fetch: {
+		Code:    http.StatusInternalServerError,
+		Message: "could not fetch the audit log",
+	},
 }
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ParticipantExport is everything stored for a user, for when a participant asks for a copy of their data
+type ParticipantExport struct {
+	ExportedOn       string                     `json:"exportedOn"`
+	User             *User                      `json:"user"`
+	ConsentResponses []ConsentResponse          `json:"consentResponses"`
+	Projects         []ParticipantExportProject `json:"projects"`
+	Progress         []ParticipantExportStatus  `json:"progress"`
+	Submissions      []BlockFormSubmission      `json:"submissions"`
+	Notes            []Note                     `json:"notes"`
+
+	// the flattened submission responses with the question and option text, for the CSV
+	responses []participantExportResponse
+}
+
+// ParticipantExportProject is a project the user is linked to and their status in it
+type ParticipantExportProject struct {
+	ProjectID         int64  `json:"projectId" db:"projectId"`
+	ProjectName       string `json:"projectName" db:"projectName"`
+	ParticipantStatus string `json:"participantStatus" db:"participantStatus"`
+}
+
+// ParticipantExportStatus is the user's status on a block, with the names so it can be read without the flow
+type ParticipantExportStatus struct {
+	ProjectID     int64  `json:"projectId" db:"projectId"`
+	ProjectName   string `json:"projectName" db:"projectName"`
+	ModuleID      int64  `json:"moduleId" db:"moduleId"`
+	ModuleName    string `json:"moduleName" db:"moduleName"`
+	BlockID       int64  `json:"blockId" db:"blockId"`
+	BlockName     string `json:"blockName" db:"blockName"`
+	UserStatus    string `json:"userStatus" db:"userStatus"`
+	LastUpdatedOn string `json:"lastUpdatedOn" db:"lastUpdatedOn"`
+}
+
+type participantExportResponse struct {
+	SubmissionID int64  `db:"submissionId"`
+	BlockID      int64  `db:"blockId"`
+	BlockName    string `db:"blockName"`
+	SubmittedOn  string `db:"submittedOn"`
+	Results      string `db:"results"`
+	QuestionText string `db:"questionText"`
+	QuestionType string `db:"questionType"`
+	OptionText   string `db:"optionText"`
+	TextResponse string `db:"textResponse"`
+	IsCorrect    string `db:"isCorrect"`
+}
+
+// GetParticipantExport gathers everything stored for the user. It is all loaded before anything is written so a
+// failed query does not leave a partial download
+func GetParticipantExport(userID int64) (*ParticipantExport, error) {
+	export := &ParticipantExport{
+		ExportedOn:       time.Now().Format(timeFormatAPI),
+		ConsentResponses: []ConsentResponse{},
+		Projects:         []ParticipantExportProject{},
+		Progress:         []ParticipantExportStatus{},
+		Submissions:      []BlockFormSubmission{},
+		Notes:            []Note{},
+		responses:        []participantExportResponse{},
+	}
+	user, err := GetUserByID(userID)
+	if err != nil {
+		return export, err
+	}
+	export.User = user
+
+	err = config.DBConnection.Select(&export.ConsentResponses, `SELECT * FROM ConsentResponses WHERE participantId = ? ORDER BY submittedOn`, userID)
+	if err != nil {
+		return export, err
+	}
+	for i := range export.ConsentResponses {
+		export.ConsentResponses[i].processForAPI()
+	}
+
+	err = config.DBConnection.Select(&export.Projects, `SELECT l.projectId, IFNULL(p.name, '') AS projectName, l.status AS participantStatus
+	FROM ProjectUserLinks l
+	LEFT JOIN Projects p ON l.projectId = p.id
+	WHERE l.userId = ? ORDER BY l.projectId`, userID)
+	if err != nil {
+		return export, err
+	}
+
+	err = config.DBConnection.Select(&export.Progress, `SELECT s.projectId, IFNULL(p.name, '') AS projectName, s.moduleId, IFNULL(m.name, '') AS moduleName,
+	s.blockId, IFNULL(b.name, '') AS blockName, s.status AS userStatus, s.lastUpdatedOn
+	FROM BlockUserStatus s
+	LEFT JOIN Projects p ON s.projectId = p.id
+	LEFT JOIN Modules m ON s.moduleId = m.id
+	LEFT JOIN Blocks b ON s.blockId = b.id
+	WHERE s.userId = ? ORDER BY s.projectId, s.lastUpdatedOn`, userID)
+	if err != nil {
+		return export, err
+	}
+	for i := range export.Progress {
+		export.Progress[i].LastUpdatedOn, _ = parseTimeToTimeFormat(export.Progress[i].LastUpdatedOn, timeFormatAPI)
+	}
+
+	err = config.DBConnection.Select(&export.Submissions, `SELECT * FROM BlockFormSubmissions WHERE userId = ? ORDER BY submittedOn`, userID)
+	if err != nil {
+		return export, err
+	}
+	for i := range export.Submissions {
+		export.Submissions[i].processForAPI()
+		export.Submissions[i].Responses, err = GetBlockFormSubmissionResponsesForSubmission(export.Submissions[i].ID)
+		if err != nil {
+			return export, err
+		}
+	}
+	err = config.DBConnection.Select(&export.responses, `SELECT s.id AS submissionId, s.blockId, IFNULL(b.name, '') AS blockName, s.submittedOn,
+	IFNULL(s.results, '') AS results, IFNULL(q.question, '') AS questionText, IFNULL(q.questionType, '') AS questionType,
+	IFNULL(o.optionText, '') AS optionText, r.textResponse, IFNULL(r.isCorrect, '') AS isCorrect
+	FROM BlockFormSubmissions s
+	INNER JOIN BlockFormSubmissionResponses r ON r.submissionId = s.id
+	LEFT JOIN Blocks b ON s.blockId = b.id
+	LEFT JOIN BlockFormQuestions q ON r.questionId = q.id
+	LEFT JOIN BlockFormQuestionOptions o ON r.optionId = o.id
+	WHERE s.userId = ? ORDER BY s.submittedOn, s.id, q.formOrder`, userID)
+	if err != nil {
+		return export, err
+	}
+	for i := range export.responses {
+		export.responses[i].SubmittedOn, _ = parseTimeToTimeFormat(export.responses[i].SubmittedOn, timeFormatAPI)
+	}
+
+	export.Notes, err = GetAllNotesForUser(userID, "all", &NoteSelectOptions{})
+	return export, err
+}
+
+// WriteParticipantExport streams the export as a zip with a JSON file of everything and a CSV for each kind of data
+func WriteParticipantExport(w io.Writer, export *ParticipantExport) error {
+	archive := zip.NewWriter(w)
+
+	writer, err := archive.Create("export.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(export)
+	if err != nil {
+		return err
+	}
+
+	user := export.User
+	err = writeParticipantExportCSV(archive, "profile.csv", []string{"Field", "Value"}, [][]string{
+		{"User ID", fmt.Sprintf("%d", user.ID)},
+		{"Title", user.Title},
+		{"First Name", user.FirstName},
+		{"Last Name", user.LastName},
+		{"Pronouns", user.Pronouns},
+		{"Email", user.Email},
+		{"Email Verified", user.EmailVerified},
+		{"Date of Birth", user.DateOfBirth},
+		{"Participant Code", user.ParticipantCode},
+		{"Status", user.Status},
+		{"System Role", user.SystemRole},
+		{"Created On", user.CreatedOn},
+		{"Last Login On", user.LastLoginOn},
+	})
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{}
+	for _, response := range export.ConsentResponses {
+		rows = append(rows, []string{fmt.Sprintf("%d", response.ProjectID), response.SubmittedOn, response.ConsentStatus, response.ParticipantProvidedFirstName,
+			response.ParticipantProvidedLastName, response.ParticipantProvidedContactInformation, response.ParticipantComments})
+	}
+	err = writeParticipantExportCSV(archive, "consent_responses.csv", []string{"Project ID", "Submitted On", "Consent Status", "First Name", "Last Name", "Contact Information", "Comments"}, rows)
+	if err != nil {
+		return err
+	}
+
+	rows = [][]string{}
+	for _, project := range export.Projects {
+		rows = append(rows, []string{fmt.Sprintf("%d", project.ProjectID), project.ProjectName, project.ParticipantStatus})
+	}
+	err = writeParticipantExportCSV(archive, "projects.csv", []string{"Project ID", "Project", "Status"}, rows)
+	if err != nil {
+		return err
+	}
+
+	rows = [][]string{}
+	for _, status := range export.Progress {
+		rows = append(rows, []string{status.ProjectName, status.ModuleName, status.BlockName, status.UserStatus, status.LastUpdatedOn})
+	}
+	err = writeParticipantExportCSV(archive, "progress.csv", []string{"Project", "Module", "Block", "Status", "Last Updated On"}, rows)
+	if err != nil {
+		return err
+	}
+
+	rows = [][]string{}
+	for _, response := range export.responses {
+		answer := response.OptionText
+		if answer == "" {
+			answer = response.TextResponse
+		}
+		rows = append(rows, []string{fmt.Sprintf("%d", response.SubmissionID), response.BlockName, response.SubmittedOn, response.Results,
+			response.QuestionText, response.QuestionType, answer, response.IsCorrect})
+	}
+	err = writeParticipantExportCSV(archive, "submissions.csv", []string{"Submission ID", "Block", "Submitted On", "Results", "Question", "Question Type", "Answer", "Correct"}, rows)
+	if err != nil {
+		return err
+	}
+
+	rows = [][]string{}
+	for _, note := range export.Notes {
+		rows = append(rows, []string{note.CreatedOn, note.NoteType, note.ProjectName, note.ModuleName, note.BlockName, note.Visibility, note.Title, note.Body})
+	}
+	err = writeParticipantExportCSV(archive, "notes.csv", []string{"Created On", "Type", "Project", "Module", "Block", "Visibility", "Title", "Body"}, rows)
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func writeParticipantExportCSV(archive *zip.Writer, name string, header []string, rows [][]string) error {
+	writer, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	csvWriter := csv.NewWriter(writer)
+	err = csvWriter.Write(header)
+	if err != nil {
+		return err
+	}
+	err = csvWriter.WriteAll(rows)
+	if err != nil {
+		return err
+	}
+	return csvWriter.Error()
+}
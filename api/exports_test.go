@@ -0,0 +1,146 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteParticipantExport(t *testing.T) {
+	export := &ParticipantExport{
+		ExportedOn: "2026-10-16T09:00:00Z",
+		User: &User{
+			ID:        42,
+			FirstName: "Export",
+			LastName:  "Participant",
+		},
+		ConsentResponses: []ConsentResponse{},
+		Projects: []ParticipantExportProject{
+			{ProjectID: 7, ProjectName: "Sleep Study", ParticipantStatus: ProjectUserLinkStatusStarted},
+		},
+		Progress:    []ParticipantExportStatus{},
+		Submissions: []BlockFormSubmission{},
+		Notes: []Note{
+			{UserID: 42, NoteType: NoteTypeJournal, Title: "Day 1", Body: "Slept poorly, woke up at 3, \"again\""},
+		},
+		responses: []participantExportResponse{
+			{SubmissionID: 1, BlockName: "Intake", QuestionText: "How many hours?", QuestionType: BlockFormQuestionTypeSingle, OptionText: "5-6"},
+			{SubmissionID: 1, BlockName: "Intake", QuestionText: "Anything else?", QuestionType: BlockFormQuestionTypeLong, TextResponse: "No"},
+		},
+	}
+	b := new(bytes.Buffer)
+	err := WriteParticipantExport(b, export)
+	require.Nil(t, err)
+
+	files := testReadZip(t, b.Bytes())
+	for _, name := range []string{"export.json", "profile.csv", "consent_responses.csv", "projects.csv", "progress.csv", "submissions.csv", "notes.csv"} {
+		assert.Contains(t, files, name)
+	}
+
+	parsed := map[string]interface{}{}
+	err = json.Unmarshal(files["export.json"], &parsed)
+	require.Nil(t, err)
+	assert.Equal(t, float64(42), parsed["user"].(map[string]interface{})["id"])
+
+	projects := testReadCSV(t, files["projects.csv"])
+	require.Equal(t, 2, len(projects))
+	assert.Equal(t, []string{"7", "Sleep Study", ProjectUserLinkStatusStarted}, projects[1])
+
+	// the answer is the option text or the text response, whichever was given
+	submissions := testReadCSV(t, files["submissions.csv"])
+	require.Equal(t, 3, len(submissions))
+	assert.Equal(t, "5-6", submissions[1][6])
+	assert.Equal(t, "No", submissions[2][6])
+
+	notes := testReadCSV(t, files["notes.csv"])
+	require.Equal(t, 2, len(notes))
+	assert.Equal(t, export.Notes[0].Body, notes[1][7])
+}
+
+func TestParticipantExportRoutes(t *testing.T) {
+	setupTesting()
+
+	admin := &User{
+		SystemRole: UserSystemRoleAdmin,
+	}
+	err := createTestUser(admin)
+	require.Nil(t, err)
+	defer DeleteUser(admin.ID)
+
+	participant := &User{
+		SystemRole: UserSystemRoleParticipant,
+	}
+	err = createTestUser(participant)
+	require.Nil(t, err)
+	defer DeleteUser(participant.ID)
+
+	project := &Project{}
+	err = createTestProject(project)
+	require.Nil(t, err)
+	defer DeleteProject(project.ID)
+	err = LinkUserAndProject(participant.ID, project.ID)
+	require.Nil(t, err)
+	err = CreateNote(&Note{
+		UserID:   participant.ID,
+		NoteType: NoteTypeJournal,
+		Title:    "Exported",
+	})
+	require.Nil(t, err)
+
+	code, res, err := testEndpoint(http.MethodGet, "/participant/export", nil, routeParticipantExport, participant.Access)
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+	files := testReadZip(t, res.Bytes())
+	export := &ParticipantExport{}
+	err = json.Unmarshal(files["export.json"], export)
+	require.Nil(t, err)
+	assert.Equal(t, participant.ID, export.User.ID)
+	assert.Equal(t, "", export.User.Password)
+	require.Equal(t, 1, len(export.Projects))
+	assert.Equal(t, project.ID, export.Projects[0].ProjectID)
+	require.Equal(t, 1, len(export.Notes))
+	assert.Equal(t, "Exported", export.Notes[0].Title)
+
+	// only admins can export someone else
+	endpoint := fmt.Sprintf("/admin/users/%d/export", participant.ID)
+	code, res, err = testEndpoint(http.MethodGet, endpoint, nil, routeAdminExportUser, participant.Access)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, code, res)
+	code, res, err = testEndpoint(http.MethodGet, endpoint, nil, routeAdminExportUser, admin.Access)
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+	assert.Contains(t, testReadZip(t, res.Bytes()), "notes.csv")
+
+	code, res, err = testEndpoint(http.MethodGet, "/admin/users/-1/export", nil, routeAdminExportUser, admin.Access)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, code, res)
+}
+
+func testReadZip(t *testing.T, data []byte) map[string][]byte {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.Nil(t, err)
+	files := map[string][]byte{}
+	for _, file := range reader.File {
+		opened, err := file.Open()
+		require.Nil(t, err)
+		contents, err := io.ReadAll(opened)
+		require.Nil(t, err)
+		opened.Close()
+		files[file.Name] = contents
+	}
+	return files
+}
+
+func testReadCSV(t *testing.T, data []byte) [][]string {
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	require.Nil(t, err)
+	return rows
+}
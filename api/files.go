@@ -23,6 +23,7 @@ const (
 // File is a DB entry for a file that is hosted somewhere
 type File struct {
 	ID             int64  `json:"id" db:"id"`
+	SiteID         int64  `json:"siteId" db:"siteId"`
 	RemoteKey      string `json:"remoteKey" db:"remoteKey"`
 	Display        string `json:"display" db:"display"`
 	Description    string `json:"description" db:"description"`
@@ -39,6 +40,7 @@ func CreateFileInDB(input *File) error {
 	input.processForDB()
 	defer input.processForAPI()
 	res, err := config.DBConnection.NamedExec(`INSERT INTO Files SET
+		siteId = :siteId,
 		remoteKey = :remoteKey,
 		display = :display,
 		description = :description,
@@ -89,16 +91,16 @@ func DeleteFileFromDB(id int64) error {
 	return err
 }
 
-// GetFileFromDB gets a file's metadata from the DB
-func GetFileFromDB(id int64) (*File, error) {
+// GetFileFromDB gets a file's metadata on the site from the DB
+func GetFileFromDB(siteID, id int64) (*File, error) {
 	file := &File{}
 	defer file.processForAPI()
-	err := config.DBConnection.Get(file, `SELECT * FROM Files WHERE id = ?`, id)
+	err := config.DBConnection.Get(file, `SELECT * FROM Files WHERE id = ? AND siteId = ?`, id, siteID)
 	return file, err
 }
 
 // GetFilesFromDB gets a list of files from the DB; since this can be pretty large, we add sort and offset
-func GetFilesFromDB(sortBy, sortDir string, count, offset int64) ([]File, error) {
+func GetFilesFromDB(siteID int64, sortBy, sortDir string, count, offset int64) ([]File, error) {
 	files := []File{}
 
 	// we are going to sprintf the sort and use an allowed list so it is safe
@@ -117,8 +119,8 @@ func GetFilesFromDB(sortBy, sortDir string, count, offset int64) ([]File, error)
 		sortBy = "uploadedOn"
 	}
 
-	query := fmt.Sprintf(`SELECT * FROM Files ORDER BY %s %s LIMIT ? OFFSET ?`, sortBy, sortDir)
-	err := config.DBConnection.Select(&files, query, count, offset)
+	query := fmt.Sprintf(`SELECT * FROM Files WHERE siteId = ? ORDER BY %s %s LIMIT ? OFFSET ?`, sortBy, sortDir)
+	err := config.DBConnection.Select(&files, query, siteID, count, offset)
 	for i := range files {
 		files[i].processForAPI()
 	}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	HealthCheckStatusOK      = "ok"
+	HealthCheckStatusFailed  = "failed"
+	HealthCheckStatusSkipped = "skipped"
+)
+
+// healthCheckTimeout is how long each readiness check gets before it is considered failed
+const healthCheckTimeout = 2 * time.Second
+
+// shuttingDown is set once a shutdown starts, so the instance reports as not ready while it drains
+var shuttingDown atomic.Bool
+
+// HealthCheck is the result of checking one dependency for readiness
+type HealthCheck struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DurationMS int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// healthChecker checks one dependency; returning errHealthCheckSkipped marks it as not configured
+type healthChecker func(ctx context.Context, r *http.Request) error
+
+var errHealthCheckSkipped = errors.New("not configured")
+
+var healthCheckers = []struct {
+	Name  string
+	Check healthChecker
+}{
+	{Name: "database", Check: checkDatabaseHealth},
+	{Name: "cache", Check: checkCacheHealth},
+	{Name: "fileStorage", Check: checkFileStorageHealth},
+	{Name: "site", Check: checkSiteHealth},
+}
+
+// runHealthChecks runs every check at once, each with its own timeout, and returns whether they all passed
+func runHealthChecks(r *http.Request) (bool, []HealthCheck) {
+	results := make([]HealthCheck, len(healthCheckers))
+	wg := sync.WaitGroup{}
+	for i := range healthCheckers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = runHealthCheck(r, healthCheckers[i].Name, healthCheckers[i].Check)
+		}(i)
+	}
+	wg.Wait()
+
+	ready := true
+	for i := range results {
+		if results[i].Status == HealthCheckStatusFailed {
+			ready = false
+		}
+	}
+	return ready, results
+}
+
+// runHealthCheck runs a single check, giving up once the timeout passes even if the client does not honor the context
+func runHealthCheck(r *http.Request, name string, check healthChecker) HealthCheck {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+	started := time.Now()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx, r)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", healthCheckTimeout)
+	}
+
+	result := HealthCheck{
+		Name:       name,
+		Status:     HealthCheckStatusOK,
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+	if errors.Is(err, errHealthCheckSkipped) {
+		result.Status = HealthCheckStatusSkipped
+	} else if err != nil {
+		result.Status = HealthCheckStatusFailed
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func checkDatabaseHealth(ctx context.Context, r *http.Request) error {
+	if config.DBConnection == nil {
+		return errors.New("no connection")
+	}
+	return config.DBConnection.PingContext(ctx)
+}
+
+func checkCacheHealth(ctx context.Context, r *http.Request) error {
+	if config.CacheClient == nil {
+		return errors.New("no connection")
+	}
+	return config.CacheClient.WithContext(ctx).Ping().Err()
+}
+
+func checkFileStorageHealth(ctx context.Context, r *http.Request) error {
+	if config.AWSS3Client == nil {
+		return errHealthCheckSkipped
+	}
+	_, err := config.AWSS3Client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(config.AWSS3Bucket),
+	})
+	return err
+}
+
+// checkSiteHealth makes sure the host resolves to a site that is not disabled; a pending site is ready so it can be set up
+func checkSiteHealth(ctx context.Context, r *http.Request) error {
+	site, err := getSiteForRequest(r)
+	if err != nil {
+		return err
+	}
+	if site.Status == SiteStatusDisabled {
+		return errors.New("the site is disabled")
+	}
+	return nil
+}
+
+// isHealthPath is true for the health routes, which are called by load balancers and skip the site lookup
+func isHealthPath(path string) bool {
+	return path == "/health/live" || path == "/health/ready"
+}
+
+// Shutdown stops the servers gracefully. The instance reports as not ready and keeps serving for the drain, so load
+// balancers see /health/ready fail and stop sending it requests before the listeners close. In-flight requests are
+// then given until the timeout to finish, and the DB and cache connections are closed
+func Shutdown(drain, timeout time.Duration, servers ...*http.Server) error {
+	shuttingDown.Store(true)
+	time.Sleep(drain)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var err error
+	for _, server := range servers {
+		serverErr := server.Shutdown(ctx)
+		if err == nil {
+			err = serverErr
+		}
+	}
+
+	if config.DBConnection != nil {
+		dbErr := config.DBConnection.Close()
+		if err == nil {
+			err = dbErr
+		}
+	}
+	if config.CacheClient != nil {
+		cacheErr := config.CacheClient.Close()
+		if err == nil {
+			err = cacheErr
+		}
+	}
+	return err
+}
@@ -11,6 +11,8 @@ import (
 	"net/http/httptest"
 	"strconv"
 	"strings"
+
+	"github.com/go-chi/chi"
 )
 
 // avoid collisions with other keys that may enter the context
@@ -41,6 +43,13 @@ type routePermissionsCheckOptions struct {
 	MustBeParticipant bool
 	MustBeUser        int64 // the user id to compare against
 	ShouldSendError   bool
+
+	// if set, the user must be an admin or a collaborator on the project with at least this role
+	MinimumProjectRole string
+	ProjectID          int64
+
+	// if set, requests authenticated with an API key need this scope; otherwise it is worked out from the path
+	RequiredScope string
 }
 
 type routePermissionsCheckResults struct {
@@ -51,6 +60,8 @@ type routePermissionsCheckResults struct {
 	IsValid    bool
 	IsAdmin    bool
 	User       *jwtUser
+
+	ProjectRole string // admins are treated as owners
 }
 
 // sendAPIJSONData sends a JSON object for a successful API call
@@ -86,8 +97,13 @@ func sendAPIError(w http.ResponseWriter, key string, systemError error, data int
 	w.WriteHeader(apiErrorData.Code)
 	w.Write(response)
 
-	// log it
-	Log(LogLevelError, "http_error", fmt.Sprintf("%s := %v", key, systemError.Error()), &LogOptions{
+	// log it; client errors are expected, so only server errors are logged as errors
+	level := LogLevelInfo
+	if apiErrorData.Code >= http.StatusInternalServerError {
+		level = LogLevelError
+	}
+	Log(level, "http_error", fmt.Sprintf("%s := %v", key, systemError.Error()), &LogOptions{
+		Context: getLogContextFromWriter(w),
 		ExtraData: map[string]interface{}{
 			"data":  data,
 			"error": systemError.Error(),
@@ -99,7 +115,7 @@ func sendAPIError(w http.ResponseWriter, key string, systemError error, data int
 func checkRoutePermissions(w http.ResponseWriter, r *http.Request, options *routePermissionsCheckOptions) *routePermissionsCheckResults {
 	results := &routePermissionsCheckResults{}
 	// first, check if the site is active
-	site, err := GetSite()
+	site, err := GetSiteFromContext(r.Context())
 	if err != nil {
 		results.SiteActive = false
 		results.SiteStatus = "error"
@@ -142,6 +158,23 @@ func checkRoutePermissions(w http.ResponseWriter, r *http.Request, options *rout
 
 	results.User = &user
 
+	// api keys can only be used on routes their scopes allow
+	if user.APIKeyID != 0 {
+		requiredScope := options.RequiredScope
+		if requiredScope == "" {
+			requiredScope = getAPIKeyScopeForRequest(r)
+		}
+		if !apiKeyHasScope(user.Scopes, requiredScope) {
+			results.IsValid = false
+			if options.ShouldSendError {
+				sendAPIError(w, api_error_auth_scope, errors.New("error"), map[string]string{
+					"requiredScope": requiredScope,
+				})
+			}
+			return results
+		}
+	}
+
 	// check if an admin
 	if options.MustBeAdmin && user.SystemRole != UserSystemRoleAdmin {
 		results.IsValid = false
@@ -152,6 +185,18 @@ func checkRoutePermissions(w http.ResponseWriter, r *http.Request, options *rout
 	}
 	results.IsAdmin = user.SystemRole == UserSystemRoleAdmin
 
+	// admins on sites that require two-factor authentication must enroll before using their admin access
+	if results.IsAdmin && (options.MustBeAdmin || options.MinimumProjectRole != "") && site != nil && site.RequireAdminMFA == Yes {
+		dbUser, err := GetUserByID(user.ID)
+		if err != nil || userMustEnrollMFA(site, dbUser) {
+			results.IsValid = false
+			if options.ShouldSendError {
+				sendAPIError(w, api_error_auth_mfa_required, errors.New("error"), map[string]string{})
+			}
+			return results
+		}
+	}
+
 	// check if a participant
 	if options.MustBeParticipant && user.SystemRole != UserSystemRoleParticipant {
 		results.IsValid = false
@@ -161,6 +206,27 @@ func checkRoutePermissions(w http.ResponseWriter, r *http.Request, options *rout
 		return results
 	}
 
+	// check the collaborator role on the project
+	if options.MinimumProjectRole != "" {
+		if results.IsAdmin {
+			results.ProjectRole = ProjectCollaboratorRoleOwner
+		} else if user.SystemRole == UserSystemRoleUser {
+			collaborator, err := GetProjectCollaborator(options.ProjectID, user.ID)
+			if err == nil {
+				results.ProjectRole = collaborator.Role
+			}
+		}
+		if !projectCollaboratorRoleAtLeast(results.ProjectRole, options.MinimumProjectRole) {
+			results.IsValid = false
+			if options.ShouldSendError {
+				sendAPIError(w, api_error_auth_must_collaborator, errors.New("error"), map[string]string{
+					"minimumRole": options.MinimumProjectRole,
+				})
+			}
+			return results
+		}
+	}
+
 	// check the user id
 	if options.MustBeUser != 0 && options.MustBeUser != user.ID {
 		results.IsValid = false
@@ -186,6 +252,66 @@ func getUserFromHTTPContext(r *http.Request) (*jwtUser, error) {
 	return &user, nil
 }
 
+// getSiteIDFromHTTPContext is a helper to get the id of the site the request was made to; if the host
+// did not resolve to a site, 0 is returned
+// getSiteFromHTTPContext gets the request's site, or an empty site if the host didn't resolve to one
+func getSiteFromHTTPContext(r *http.Request) *Site {
+	site, err := GetSiteFromContext(r.Context())
+	if err != nil || site == nil {
+		return &Site{}
+	}
+	return site
+}
+
+func getSiteIDFromHTTPContext(r *http.Request) int64 {
+	site, err := GetSiteFromContext(r.Context())
+	if err != nil || site == nil {
+		return 0
+	}
+	return site.ID
+}
+
+// checkPathIsOnSite makes sure any project, module, block, or user in the path belongs to the request's site, so an
+// admin of one site can't reach into another site's data by id. If something doesn't, the not found error is sent and
+// false is returned. Malformed ids are left for the route to handle
+func checkPathIsOnSite(w http.ResponseWriter, r *http.Request) bool {
+	siteID := getSiteIDFromHTTPContext(r)
+	checks := []struct {
+		param    string
+		errorKey string
+		find     func(id int64) error
+	}{
+		{"projectID", api_error_project_not_found, func(id int64) error {
+			_, err := GetProjectByID(siteID, id)
+			return err
+		}},
+		{"moduleID", api_error_module_not_found, func(id int64) error {
+			_, err := GetModuleByID(siteID, id)
+			return err
+		}},
+		{"blockID", api_error_block_not_found, func(id int64) error {
+			_, err := GetBlockByID(siteID, id)
+			return err
+		}},
+		{"userID", api_error_user_not_found, func(id int64) error {
+			_, err := GetSiteUserByID(siteID, id)
+			return err
+		}},
+	}
+	for _, check := range checks {
+		id, err := strconv.ParseInt(chi.URLParam(r, check.param), 10, 64)
+		if err != nil {
+			continue
+		}
+		err = check.find(id)
+		if err != nil {
+			sendAPIError(w, check.errorKey, err, map[string]string{})
+			return false
+		}
+	}
+	return true
+}
+
 // testEndpoint calls a route in the API for testing purposes
 func testEndpoint(method string, endpoint string, data io.Reader, handler http.HandlerFunc, accessToken string) (code int, body *bytes.Buffer, err error) {
 	req, err := http.NewRequest(method, endpoint, data)
@@ -201,6 +327,21 @@ func testEndpoint(method string, endpoint string, data io.Reader, handler http.H
 	return rr.Code, rr.Body, nil
 }
 
+// testEndpointWithAPIKey calls a route in the API for testing purposes, authenticating with an API key instead of an access token
+func testEndpointWithAPIKey(method string, endpoint string, data io.Reader, apiKey string) (code int, body *bytes.Buffer, err error) {
+	req, err := http.NewRequest(method, endpoint, data)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	req.Header.Add("Content-Type", "application/json; charset=utf-8")
+	req.Header.Add("Authorization", "ApiKey "+apiKey)
+	rr := httptest.NewRecorder()
+	chi := SetupAPI()
+	chi.ServeHTTP(rr, req)
+	return rr.Code, rr.Body, nil
+}
+
 func testEndpointUpload(endpoint string, fileName string, data io.Reader, handler http.HandlerFunc, accessToken string) (code int, body *bytes.Buffer, err error) {
 	b := &bytes.Buffer{}
 	writer := multipart.NewWriter(b)
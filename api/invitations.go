@@ -0,0 +1,124 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+var (
+	errInvitationBadData       = errors.New("invitations need a valid email and a system role of user or admin")
+	errInvitationEmailTaken    = errors.New("a user with that email already exists")
+	errInvitationNotPending    = errors.New("the user has already accepted their invitation")
+	errInvitationInvalidToken  = errors.New("invitation is invalid or expired")
+	errInvitationPasswordBlank = errors.New("a password is required")
+)
+
+// InviteUser creates a pending account on the site for the email and sends them a link to choose a password. Only
+// researchers and admins are invited this way; participants join through a project's consent form
+func InviteUser(site *Site, input *User, message string) error {
+	input.SiteID = site.ID
+	input.Email = strings.TrimSpace(input.Email)
+	if _, err := mail.ParseAddress(input.Email); err != nil || input.Email == "" {
+		return errInvitationBadData
+	}
+	if input.SystemRole == "" {
+		input.SystemRole = UserSystemRoleUser
+	}
+	if input.SystemRole != UserSystemRoleUser && input.SystemRole != UserSystemRoleAdmin {
+		return errInvitationBadData
+	}
+	taken, err := isUserEmailTaken(input.SiteID, input.Email)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errInvitationEmailTaken
+	}
+
+	// the account cannot be logged into until the invitation is accepted, since no one knows the password
+	password, err := randomSecureString(32)
+	if err != nil {
+		return err
+	}
+	input.ID = 0
+	input.Password = password
+	input.Status = UserStatusPending
+	input.EmailVerified = No
+	input.MFAEnabled = No
+	input.ParticipantCode = ""
+	err = CreateUser(input)
+	if err != nil {
+		return err
+	}
+	return SendInvitationForUser(site, input, message)
+}
+
+// SendInvitationForUser issues a new invitation token, replacing any earlier one, and emails the link for the site's
+// client
+func SendInvitationForUser(site *Site, user *User, message string) error {
+	if user.Status != UserStatusPending || user.EmailVerified == Yes {
+		return errInvitationNotPending
+	}
+	address, err := getSiteClientAddress(site)
+	if err != nil {
+		return err
+	}
+	token, err := generateToken(user, tokenTypeInvitation)
+	if err != nil {
+		return err
+	}
+	err = saveTokenForUser(token)
+	if err != nil {
+		return err
+	}
+	return sendTemplatedMail(user.Email, EmailTemplateInvitation, &EmailTemplateData{
+		Site:             site,
+		User:             user,
+		Link:             fmt.Sprintf("%s/invitation/accept?token=%s", address, token.Token),
+		ExpiresInMinutes: tokenExpiresMinutesInvitation,
+		Message:          message,
+	})
+}
+
+// AcceptInvitation consumes the invitation token, sets the password, and activates the account. Since the link was
+// sent to the email, the email is also verified
+func AcceptInvitation(tokenValue, password string) (*User, error) {
+	if password == "" {
+		return nil, errInvitationPasswordBlank
+	}
+	token, err := getTokenByValue(tokenTypeInvitation, tokenValue)
+	if err != nil {
+		return nil, errInvitationInvalidToken
+	}
+	expires, err := parseTime(token.ExpiresOn)
+	if err != nil {
+		return nil, err
+	}
+	if expires.Before(time.Now()) {
+		deleteTokenForUser(token.UserID, tokenTypeInvitation)
+		return nil, errInvitationInvalidToken
+	}
+
+	user, err := GetUserByID(token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	// an admin may have disabled the account after inviting them
+	if user.Status != UserStatusPending {
+		deleteTokenForUser(user.ID, tokenTypeInvitation)
+		return nil, errInvitationInvalidToken
+	}
+	user.Password = password
+	user.Status = UserStatusActive
+	user.EmailVerified = Yes
+	err = UpdateUser(user)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	err = deleteTokenForUser(user.ID, tokenTypeInvitation)
+	return user, err
+}
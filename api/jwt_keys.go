@@ -0,0 +1,269 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+var (
+	errJWTCannotSign  = errors.New("this host does not have a key to sign tokens")
+	errJWTUnknownKey  = errors.New("token was signed with an unknown key")
+	errJWTKeyNotValid = errors.New("key must be an Ed25519 or RSA key in PEM format")
+)
+
+// signingMethodEdDSA adds Ed25519 signatures, which the jwt library we use does not include
+type signingMethodEdDSA struct{}
+
+var jwtSigningMethodEdDSA = &signingMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod(jwtSigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return jwtSigningMethodEdDSA
+	})
+}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
+
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+// jwtKey is a public key that can verify tokens and, on hosts that issue tokens, the private key that signs them. The
+// ID is the RFC 7638 thumbprint and is sent as the kid header so verifiers know which key to use
+type jwtKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Public  crypto.PublicKey
+	Private crypto.PrivateKey
+}
+
+// jwtKeyring holds the key used to sign new tokens, if this host has one, and every key that is accepted when
+// verifying. Keeping old public keys in the ring lets tokens signed before a rotation keep working until they expire
+type jwtKeyring struct {
+	Signing      *jwtKey
+	Verification map[string]*jwtKey
+}
+
+// JWKS is the JSON Web Key Set served so other hosts and services can verify tokens
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK is a single public key in the set
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// setupJWTKeys loads the signing key and any extra verification keys from the environment. Both are optional; without
+// them, the shared KESPLORA_JWT_SIGNING secret is used
+func setupJWTKeys() *jwtKeyring {
+	keyring := &jwtKeyring{
+		Verification: map[string]*jwtKey{},
+	}
+	privatePath := strings.TrimSpace(envHelper("KESPLORA_JWT_PRIVATE_KEY", ""))
+	if privatePath != "" {
+		key, err := loadJWTKeyFromFile(privatePath)
+		if err != nil {
+			panic(fmt.Sprintf("could not load KESPLORA_JWT_PRIVATE_KEY: %v", err))
+		}
+		if key.Private == nil {
+			panic("KESPLORA_JWT_PRIVATE_KEY must be a private key")
+		}
+		keyring.Signing = key
+		keyring.Verification[key.ID] = key
+	}
+	for _, publicPath := range strings.Split(envHelper("KESPLORA_JWT_PUBLIC_KEYS", ""), ",") {
+		publicPath = strings.TrimSpace(publicPath)
+		if publicPath == "" {
+			continue
+		}
+		key, err := loadJWTKeyFromFile(publicPath)
+		if err != nil {
+			panic(fmt.Sprintf("could not load %s from KESPLORA_JWT_PUBLIC_KEYS: %v", publicPath, err))
+		}
+		// only the public half is needed to verify
+		key.Private = nil
+		if _, found := keyring.Verification[key.ID]; !found {
+			keyring.Verification[key.ID] = key
+		}
+	}
+	return keyring
+}
+
+// canSignJWT checks if this host can issue access tokens; hosts that only have public keys cannot
+func canSignJWT() bool {
+	return (config.JWTKeys != nil && config.JWTKeys.Signing != nil) || config.JWTSigningString != ""
+}
+
+// hasKeys checks if any asymmetric keys are configured
+func (keyring *jwtKeyring) hasKeys() bool {
+	return keyring != nil && len(keyring.Verification) > 0
+}
+
+// getVerificationKey finds the key for the token and makes sure the token's algorithm matches the key, so a token
+// cannot claim a different algorithm than the key was made for
+func (keyring *jwtKeyring) getVerificationKey(token *jwt.Token) (interface{}, error) {
+	if keyring == nil {
+		return nil, errJWTUnknownKey
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, found := keyring.Verification[kid]
+	if !found {
+		return nil, errJWTUnknownKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errJWTUnknownKey
+	}
+	return key.Public, nil
+}
+
+// getJWKS builds the public key set, sorted by id so the output is stable
+func (keyring *jwtKeyring) getJWKS() *JWKS {
+	jwks := &JWKS{
+		Keys: []JWK{},
+	}
+	if keyring == nil {
+		return jwks
+	}
+	for _, key := range keyring.Verification {
+		jwks.Keys = append(jwks.Keys, key.toJWK())
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID
+	})
+	return jwks
+}
+
+func (key *jwtKey) toJWK() JWK {
+	jwk := JWK{
+		KeyID:     key.ID,
+		Use:       "sig",
+		Algorithm: key.Method.Alg(),
+	}
+	switch public := key.Public.(type) {
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	}
+	return jwk
+}
+
+// loadJWTKeyFromFile reads a PEM encoded Ed25519 or RSA key; private keys also include their public key
+func loadJWTKeyFromFile(path string) (*jwtKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseJWTKey(data)
+}
+
+// parseJWTKey parses a PEM encoded key. Ed25519 keys sign with EdDSA and RSA keys sign with RS256
+func parseJWTKey(data []byte) (*jwtKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errJWTKeyNotValid
+	}
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, errJWTKeyNotValid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newJWTKey(parsed)
+}
+
+// newJWTKey wraps a parsed key with its method and id
+func newJWTKey(parsed interface{}) (*jwtKey, error) {
+	key := &jwtKey{}
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		key.Private = k
+		key.Public = k.Public()
+		key.Method = jwtSigningMethodEdDSA
+	case ed25519.PublicKey:
+		key.Public = k
+		key.Method = jwtSigningMethodEdDSA
+	case *rsa.PrivateKey:
+		key.Private = k
+		key.Public = &k.PublicKey
+		key.Method = jwt.SigningMethodRS256
+	case *rsa.PublicKey:
+		key.Public = k
+		key.Method = jwt.SigningMethodRS256
+	default:
+		return nil, errJWTKeyNotValid
+	}
+	key.ID = getJWKThumbprint(key.toJWK())
+	return key, nil
+}
+
+// getJWKThumbprint is the RFC 7638 thumbprint; only the required members are hashed, in lexical order
+func getJWKThumbprint(jwk JWK) string {
+	var members map[string]string
+	if jwk.KeyType == "RSA" {
+		members = map[string]string{"e": jwk.E, "kty": jwk.KeyType, "n": jwk.N}
+	} else {
+		members = map[string]string{"crv": jwk.Curve, "kty": jwk.KeyType, "x": jwk.X}
+	}
+	// encoding/json sorts map keys, which gives the required order
+	encoded, _ := json.Marshal(members)
+	hashed := sha256.Sum256(encoded)
+	return base64.RawURLEncoding.EncodeToString(hashed[:])
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTKeyRotation(t *testing.T) {
+	originalConfig := config
+	config = &apiConfig{}
+	defer func() {
+		config = originalConfig
+	}()
+
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	edKey, err := newJWTKey(edPrivate)
+	require.Nil(t, err)
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	rsaKey, err := newJWTKey(rsaPrivate)
+	require.Nil(t, err)
+	assert.NotEqual(t, edKey.ID, rsaKey.ID)
+
+	user := &User{
+		ID:         1,
+		FirstName:  "Test",
+		SystemRole: UserSystemRoleAdmin,
+	}
+
+	// sign with the old RSA key
+	config.JWTKeys = &jwtKeyring{
+		Signing: rsaKey,
+		Verification: map[string]*jwtKey{
+			rsaKey.ID: rsaKey,
+		},
+	}
+	oldToken, _, err := generateJWT(user, 2)
+	require.Nil(t, err)
+	parsed, err := parseJWT(oldToken)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), parsed.ID)
+	assert.Equal(t, int64(2), parsed.SessionID)
+
+	// rotate to the new Ed25519 key but keep the old public key for verifying
+	config.JWTKeys = &jwtKeyring{
+		Signing: edKey,
+		Verification: map[string]*jwtKey{
+			edKey.ID:  edKey,
+			rsaKey.ID: {ID: rsaKey.ID, Method: rsaKey.Method, Public: rsaKey.Public},
+		},
+	}
+	newToken, _, err := generateJWT(user, 3)
+	require.Nil(t, err)
+	token, _ := jwt.Parse(newToken, nil)
+	assert.Equal(t, edKey.ID, token.Header["kid"])
+	assert.Equal(t, "EdDSA", token.Header["alg"])
+	_, err = parseJWT(newToken)
+	assert.Nil(t, err)
+	_, err = parseJWT(oldToken)
+	assert.Nil(t, err)
+
+	jwks := config.JWTKeys.getJWKS()
+	assert.Equal(t, 2, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.KeyType == "OKP" {
+			assert.Equal(t, edKey.ID, jwk.KeyID)
+			assert.Equal(t, "Ed25519", jwk.Curve)
+		} else {
+			assert.Equal(t, rsaKey.ID, jwk.KeyID)
+			assert.Equal(t, "RS256", jwk.Algorithm)
+			assert.Equal(t, "AQAB", jwk.E)
+		}
+	}
+
+	// once the old key is dropped, its tokens stop working
+	delete(config.JWTKeys.Verification, rsaKey.ID)
+	_, err = parseJWT(oldToken)
+	assert.NotNil(t, err)
+
+	// a host with only the public key can verify but not sign
+	config.JWTKeys = &jwtKeyring{
+		Verification: map[string]*jwtKey{
+			edKey.ID: {ID: edKey.ID, Method: edKey.Method, Public: edKey.Public},
+		},
+	}
+	assert.False(t, canSignJWT())
+	_, err = parseJWT(newToken)
+	assert.Nil(t, err)
+	_, _, err = generateJWT(user, 4)
+	assert.ErrorIs(t, err, errJWTCannotSign)
+
+	// and it does not accept tokens signed with a shared secret it doesn't have
+	hsToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user": newJWTUser(user, 0)}).SignedString([]byte(""))
+	require.Nil(t, err)
+	_, err = parseJWT(hsToken)
+	assert.NotNil(t, err)
+}
+
+func TestJWTKeyParsing(t *testing.T) {
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(edPrivate)
+	require.Nil(t, err)
+	privateKey, err := parseJWTKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	require.Nil(t, err)
+	assert.NotNil(t, privateKey.Private)
+
+	publicDER, err := x509.MarshalPKIXPublicKey(edPublic)
+	require.Nil(t, err)
+	publicKey, err := parseJWTKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	require.Nil(t, err)
+	assert.Nil(t, publicKey.Private)
+	assert.Equal(t, privateKey.ID, publicKey.ID)
+
+	_, err = parseJWTKey([]byte("not a key"))
+	assert.NotNil(t, err)
+
+	// the RFC 7638 example key has a known thumbprint
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", getJWKThumbprint(JWK{
+		KeyType: "RSA",
+		E:       "AQAB",
+		N:       "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	}))
+}
@@ -1,14 +1,19 @@
 package api
 
 import (
-	"fmt"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
 )
 
-// Note: Once structured logging is confirmed in Go, we will want to consider what that looks like and
-// maybe remove logrus
-
 const (
 	LogLevelTrace = "TRACE"
 	LogLevelDebug = "DEBUG"
@@ -19,6 +24,43 @@ const (
 	LogLevelPanic = "PANIC"
 )
 
+// slog only has four levels, so the others are spaced around them the same way
+var logLevels = map[string]slog.Level{
+	LogLevelTrace: slog.LevelDebug - 4,
+	LogLevelDebug: slog.LevelDebug,
+	LogLevelInfo:  slog.LevelInfo,
+	LogLevelWarn:  slog.LevelWarn,
+	LogLevelError: slog.LevelError,
+	LogLevelFatal: slog.LevelError + 4,
+	LogLevelPanic: slog.LevelError + 8,
+}
+
+// logRedacted replaces the value of any field that may hold a secret or a participant's personal information
+const logRedacted = "[redacted]"
+
+// logSensitiveFields are matched against field names with the case and any _ or - removed. A field is redacted if its
+// name contains one of them
+var logSensitiveFields = []string{
+	"password",
+	"token",
+	"secret",
+	"authorization",
+	"cookie",
+	"apikey",
+	"access",
+	"refresh",
+	"recoverycode",
+	"mfacode",
+	"email",
+	"firstname",
+	"lastname",
+	"dateofbirth",
+	"participantcode",
+	"participantprovided",
+	"contactinformation",
+	"phone",
+}
+
 // LogOptions are optional options and fields for logging
 type LogOptions struct {
 	ExtraData map[string]interface{}
@@ -26,49 +68,244 @@ type LogOptions struct {
 	// the two can be helpful when things are tough to debug, but shouldn't be required
 	CallingFile string
 	CallingFunc string
+
+	// if set to a request's context, the request id, site, user, and route are added
+	Context context.Context
+}
+
+// requestLogFields are the fields that tie a log line to the request it came from. The middleware fill them in as
+// they learn them, so a pointer is kept in the context
+type requestLogFields struct {
+	RequestID string
+	SiteID    int64
+	UserID    int64
+	route     *chi.Context
 }
 
-// Log sends a log to output
+// appContextLogFields is the key for the request's log fields
+const appContextLogFields key = "logFields"
+
+// setupLogger builds the JSON logger for the level name, which defaults to WARN
+func setupLogger(levelName string, out io.Writer) *slog.Logger {
+	level, ok := logLevels[strings.ToUpper(levelName)]
+	if !ok {
+		level = slog.LevelWarn
+	}
+	return slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) == 0 && attr.Key == slog.LevelKey {
+				// show our names for the extra levels rather than DEBUG-4 and so on
+				attrLevel, _ := attr.Value.Any().(slog.Level)
+				for name, value := range logLevels {
+					if value == attrLevel {
+						return slog.String(slog.LevelKey, name)
+					}
+				}
+			}
+			return attr
+		},
+	}))
+}
+
+// getLogger gets the configured logger, falling back to the default before the config is set up
+func getLogger() *slog.Logger {
+	if config == nil || config.Logger == nil {
+		return slog.Default()
+	}
+	return config.Logger
+}
+
+// Log sends a log to output at the level given, with the extra data redacted. FATAL and PANIC are only severities;
+// logging at them does not exit or panic
 func Log(level string, key, message string, options *LogOptions) {
-	log.SetFormatter((&log.JSONFormatter{}))
 	if message == "" {
 		message = key
 	}
-	log.WithFields(log.Fields{
-		"key":     key,
-		"message": message,
-	})
+	slogLevel, ok := logLevels[level]
+	if !ok {
+		slogLevel = slog.LevelWarn
+	}
+	logger := getLogger()
+	ctx := context.Background()
+	if options != nil && options.Context != nil {
+		ctx = options.Context
+	}
+	if !logger.Enabled(ctx, slogLevel) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("key", key),
+	}
 	if options != nil {
-		for k, v := range options.ExtraData {
-			log.WithField(k, v)
+		if fields := getRequestLogFields(ctx); fields != nil {
+			attrs = append(attrs, fields.attrs()...)
 		}
 		if options.CallingFile != "" {
-			log.WithField("file", options.CallingFile)
+			attrs = append(attrs, slog.String("file", options.CallingFile))
 		}
 		if options.CallingFunc != "" {
-			log.WithField("func", options.CallingFunc)
+			attrs = append(attrs, slog.String("func", options.CallingFunc))
+		}
+		for k, v := range options.ExtraData {
+			attrs = append(attrs, slog.Any(k, redactLogValue(k, v)))
 		}
 	}
-	logOut := fmt.Sprintf("%s - %s", key, message)
-	switch config.LogLevelOutput {
-	case LogLevelTrace:
-		log.Trace(logOut)
-	case LogLevelDebug:
-		log.Debug(logOut)
-	case LogLevelInfo:
-		log.Info(logOut)
-	case LogLevelWarn:
-		log.Warn(logOut)
-	case LogLevelError:
-		log.Error(logOut)
-	case LogLevelFatal:
-		log.Fatal(logOut)
-	case LogLevelPanic:
-		log.Panic(logOut)
-	default:
-		log.Warn(logOut)
-	}
+	logger.LogAttrs(ctx, slogLevel, message, attrs...)
 
 	// TODO: if we ever integrate with an external logger, if the key is a test key,
 	// bail out before
 }
+
+// isSensitiveLogField is true if the field name looks like it holds a secret or personal information
+func isSensitiveLogField(name string) bool {
+	name = strings.ToLower(name)
+	name = strings.ReplaceAll(name, "_", "")
+	name = strings.ReplaceAll(name, "-", "")
+	for _, sensitive := range logSensitiveFields {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactLogValue redacts the value if its name is sensitive. Maps, slices, and structs are walked through their JSON
+// form so nested fields, such as a user in a request's input, are redacted too
+func redactLogValue(name string, value interface{}) interface{} {
+	if isSensitiveLogField(name) {
+		return logRedacted
+	}
+	switch typed := value.(type) {
+	case nil, string, bool, int, int64, float64:
+		return typed
+	case error:
+		return typed.Error()
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(typed))
+		for k, v := range typed {
+			redacted[k] = redactLogValue(k, v)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(typed))
+		for i := range typed {
+			redacted[i] = redactLogValue("", typed[i])
+		}
+		return redacted
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return logRedacted
+	}
+	var decoded interface{}
+	err = json.Unmarshal(encoded, &decoded)
+	if err != nil {
+		return logRedacted
+	}
+	switch decoded.(type) {
+	case map[string]interface{}, []interface{}:
+		return redactLogValue("", decoded)
+	}
+	return decoded
+}
+
+// getRequestLogFields gets the request's log fields from the context, if there are any
+func getRequestLogFields(ctx context.Context) *requestLogFields {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(appContextLogFields).(*requestLogFields)
+	return fields
+}
+
+// attrs gets the fields that are known so far
+func (fields *requestLogFields) attrs() []slog.Attr {
+	attrs := []slog.Attr{}
+	if fields.RequestID != "" {
+		attrs = append(attrs, slog.String("requestId", fields.RequestID))
+	}
+	if fields.SiteID != 0 {
+		attrs = append(attrs, slog.Int64("siteId", fields.SiteID))
+	}
+	if fields.UserID != 0 {
+		attrs = append(attrs, slog.Int64("userId", fields.UserID))
+	}
+	if fields.route != nil && fields.route.RoutePattern() != "" {
+		attrs = append(attrs, slog.String("route", fields.route.RoutePattern()))
+	}
+	return attrs
+}
+
+// logResponseWriter keeps the request's context with the writer, so helpers that only get the writer, such as
+// sendAPIError, can still log which request they were for
+type logResponseWriter struct {
+	middleware.WrapResponseWriter
+	ctx context.Context
+}
+
+// getLogContextFromWriter gets the request's context from the writer if it came through the access log middleware,
+// looking through any writers that later middleware wrapped it in
+func getLogContextFromWriter(w http.ResponseWriter) context.Context {
+	for w != nil {
+		if wrapped, ok := w.(*logResponseWriter); ok {
+			return wrapped.ctx
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		w = unwrapper.Unwrap()
+	}
+	return nil
+}
+
+// accessLogMiddleware adds the log fields to the request, returns the request id in a header, and logs each request
+// once it is done. Only the path is logged, since query strings can carry tokens. Server errors are logged at ERROR and
+// everything else at INFO
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		fields := &requestLogFields{
+			RequestID: middleware.GetReqID(r.Context()),
+			route:     chi.RouteContext(r.Context()),
+		}
+		if fields.RequestID != "" {
+			// so a client can quote it when reporting a problem
+			w.Header().Set(middleware.RequestIDHeader, fields.RequestID)
+		}
+		ctx := context.WithValue(r.Context(), appContextLogFields, fields)
+		wrapped := &logResponseWriter{
+			WrapResponseWriter: middleware.NewWrapResponseWriter(w, r.ProtoMajor),
+			ctx:                ctx,
+		}
+		next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+		status := wrapped.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := LogLevelInfo
+		if status >= http.StatusInternalServerError {
+			level = LogLevelError
+		}
+		Log(level, "http_request", r.Method+" "+r.URL.Path, &LogOptions{
+			Context: ctx,
+			ExtraData: map[string]interface{}{
+				"method":     r.Method,
+				"path":       r.URL.Path,
+				"status":     status,
+				"bytes":      wrapped.BytesWritten(),
+				"durationMs": time.Since(started).Milliseconds(),
+			},
+		})
+	})
+}
+
+// setupDefaultLogger makes the configured logger the default, so anything using the log package also writes JSON
+func setupDefaultLogger(levelName string) *slog.Logger {
+	logger := setupLogger(levelName, os.Stdout)
+	slog.SetDefault(logger)
+	return logger
+}
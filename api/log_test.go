@@ -1,7 +1,19 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLogging(t *testing.T) {
@@ -32,3 +44,110 @@ func TestLogging(t *testing.T) {
 	Log(LogLevelPanic, "test", "panic level", options)
 	Log("unknown", "test", "unknown, so warn level", options)
 }
+
+func TestLogOutput(t *testing.T) {
+	out := &bytes.Buffer{}
+	previous := config
+	config = &apiConfig{
+		Logger: setupLogger(LogLevelInfo, out),
+	}
+	defer func() {
+		config = previous
+	}()
+
+	// the level comes from the argument, so debug lines are dropped at INFO
+	Log(LogLevelDebug, "test_debug", "not shown", nil)
+	assert.Equal(t, "", out.String())
+
+	ctx := context.WithValue(context.Background(), appContextLogFields, &requestLogFields{
+		RequestID: "abc-1",
+		SiteID:    2,
+		UserID:    3,
+	})
+	Log(LogLevelFatal, "test_fatal", "shown", &LogOptions{
+		Context:     ctx,
+		CallingFile: "log_test.go",
+		CallingFunc: "TestLogOutput",
+		ExtraData: map[string]interface{}{
+			"projectId": 4,
+			"password":  "hunter2",
+		},
+	})
+	line := map[string]interface{}{}
+	require.Nil(t, json.Unmarshal(out.Bytes(), &line))
+	assert.Equal(t, LogLevelFatal, line["level"])
+	assert.Equal(t, "shown", line["msg"])
+	assert.Equal(t, "test_fatal", line["key"])
+	assert.Equal(t, "abc-1", line["requestId"])
+	assert.Equal(t, float64(2), line["siteId"])
+	assert.Equal(t, float64(3), line["userId"])
+	assert.Equal(t, "log_test.go", line["file"])
+	assert.Equal(t, "TestLogOutput", line["func"])
+	assert.Equal(t, float64(4), line["projectId"])
+	assert.Equal(t, logRedacted, line["password"])
+}
+
+func TestLogRedaction(t *testing.T) {
+	redacted := redactLogValue("input", map[string]interface{}{
+		"projectId": 1,
+		"user": &User{
+			ID:              2,
+			FirstName:       "Test",
+			Email:           "test@kesplora.com",
+			Password:        "hunter2",
+			ParticipantCode: "1234",
+		},
+		"refresh_token": "abc",
+		"items":         []interface{}{map[string]interface{}{"Email": "x@y.z"}},
+	}).(map[string]interface{})
+
+	assert.Equal(t, 1, redacted["projectId"])
+	assert.Equal(t, logRedacted, redacted["refresh_token"])
+	user := redacted["user"].(map[string]interface{})
+	assert.Equal(t, float64(2), user["id"])
+	assert.Equal(t, logRedacted, user["firstName"])
+	assert.Equal(t, logRedacted, user["email"])
+	assert.Equal(t, logRedacted, user["participantCode"])
+	assert.Equal(t, logRedacted, redacted["items"].([]interface{})[0].(map[string]interface{})["Email"])
+	assert.Equal(t, "oops", redactLogValue("error", errors.New("oops")))
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	out := &bytes.Buffer{}
+	previous := config
+	config = &apiConfig{
+		Logger: setupLogger(LogLevelInfo, out),
+	}
+	defer func() {
+		config = previous
+	}()
+
+	router := chi.NewRouter()
+	router.Use(middleware.RequestID)
+	router.Use(accessLogMiddleware)
+	router.Get("/things/{thingID}", func(w http.ResponseWriter, r *http.Request) {
+		getRequestLogFields(r.Context()).UserID = 7
+		sendAPIError(w, api_error_not_implemented, errors.New("not yet"), nil)
+	})
+	req, err := http.NewRequest(http.MethodGet, "/things/5?token=secret", nil)
+	require.Nil(t, err)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Equal(t, 2, len(lines))
+	apiError := map[string]interface{}{}
+	require.Nil(t, json.Unmarshal([]byte(lines[0]), &apiError))
+	access := map[string]interface{}{}
+	require.Nil(t, json.Unmarshal([]byte(lines[1]), &access))
+
+	assert.Equal(t, "http_error", apiError["key"])
+	assert.Equal(t, "http_request", access["key"])
+	assert.NotEqual(t, "", access["requestId"])
+	assert.Equal(t, access["requestId"], apiError["requestId"])
+	assert.Equal(t, access["requestId"], recorder.Header().Get(middleware.RequestIDHeader))
+	assert.Equal(t, float64(7), access["userId"])
+	assert.Equal(t, "/things/{thingID}", access["route"])
+	assert.Equal(t, "/things/5", access["path"])
+	assert.NotContains(t, out.String(), "secret")
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	loginFreeAttemptsPerLogin = 3  // failures allowed for a login before backing off
+	loginFreeAttemptsPerIP    = 20 // higher since many participants may share an address, such as in a classroom
+	loginBackoffMaxSeconds    = 60 * 15
+	loginFailureWindowMinutes = 60 * 24 // failures are forgotten after this long without another one
+
+	loginThrottleTypeLogin = "login"
+	loginThrottleTypeIP    = "ip"
+)
+
+// getLoginRetryAfter checks if the login on the site or the IP is currently backing off and returns how long until
+// another attempt is allowed, or 0 if it can be attempted now
+func getLoginRetryAfter(siteID int64, login, ip string) time.Duration {
+	retryAfter := time.Duration(0)
+	for _, key := range []string{
+		getLoginBlockedCacheKey(loginThrottleTypeLogin, getSiteLogin(siteID, login)),
+		getLoginBlockedCacheKey(loginThrottleTypeIP, ip),
+	} {
+		ttl, err := config.CacheClient.TTL(key).Result()
+		if err == nil && ttl > retryAfter {
+			retryAfter = ttl
+		}
+	}
+	return retryAfter
+}
+
+// recordFailedLoginAttempt tracks a failure for the login on the site and the IP, blocking further attempts with an
+// exponential backoff once the free attempts are used. If the failures for the login reach the configured threshold, the
+// account is locked. The returned duration is how long until another attempt is allowed
+func recordFailedLoginAttempt(siteID int64, login, ip string) time.Duration {
+	retryAfter := time.Duration(0)
+
+	loginFailures := incrementLoginFailures(loginThrottleTypeLogin, getSiteLogin(siteID, login))
+	backoff := getLoginBackoff(loginFailures, loginFreeAttemptsPerLogin)
+	if backoff > 0 {
+		config.CacheClient.Set(getLoginBlockedCacheKey(loginThrottleTypeLogin, getSiteLogin(siteID, login)), "1", backoff)
+		retryAfter = backoff
+	}
+
+	if ip != "" {
+		ipFailures := incrementLoginFailures(loginThrottleTypeIP, ip)
+		backoff = getLoginBackoff(ipFailures, loginFreeAttemptsPerIP)
+		if backoff > 0 {
+			config.CacheClient.Set(getLoginBlockedCacheKey(loginThrottleTypeIP, ip), "1", backoff)
+			if backoff > retryAfter {
+				retryAfter = backoff
+			}
+		}
+	}
+
+	if config.LoginLockoutThreshold > 0 && loginFailures >= int64(config.LoginLockoutThreshold) {
+		err := lockUserByLogin(siteID, login)
+		if err != nil {
+			Log(LogLevelError, "login_lock_error", err.Error(), &LogOptions{})
+		}
+	}
+	return retryAfter
+}
+
+// clearFailedLoginAttempts forgets the failures for a login after a successful login or an unlock. The IP failures are
+// left alone so an attacker cannot reset them by logging into an account they control
+func clearFailedLoginAttempts(siteID int64, login string) {
+	login = getSiteLogin(siteID, login)
+	config.CacheClient.Del(getLoginFailuresCacheKey(loginThrottleTypeLogin, login), getLoginBlockedCacheKey(loginThrottleTypeLogin, login))
+}
+
+// getUserLogin gets the login the failures for a user are tracked under when the login they typed isn't known, such
+// as for two-factor codes
+func getUserLogin(user *User) string {
+	if user.Email != "" {
+		return user.Email
+	}
+	return user.ParticipantCode
+}
+
+// lockUserByLogin moves an active account to locked so it can no longer log in until an admin unlocks it or the
+// user resets their password
+func lockUserByLogin(siteID int64, login string) error {
+	user, err := getUserByLogin(siteID, strings.TrimSpace(login))
+	if err != nil {
+		return nil // nothing to lock; the failures are still tracked so the response is the same
+	}
+	_, err = config.DBConnection.Exec(`UPDATE Users SET status = ? WHERE id = ? AND status = ?`, UserStatusLocked, user.ID, UserStatusActive)
+	if err != nil {
+		return err
+	}
+	Log(LogLevelWarn, "login_locked", "account locked after too many failed logins", &LogOptions{
+		ExtraData: map[string]interface{}{
+			"userId": user.ID,
+		},
+	})
+	return nil
+}
+
+// UnlockUser moves a locked user back to active and clears their failed login attempts
+func UnlockUser(user *User) error {
+	_, err := config.DBConnection.Exec(`UPDATE Users SET status = ? WHERE id = ? AND status = ?`, UserStatusActive, user.ID, UserStatusLocked)
+	if err != nil {
+		return err
+	}
+	if user.Status == UserStatusLocked {
+		user.Status = UserStatusActive
+	}
+	if user.Email != "" {
+		clearFailedLoginAttempts(user.SiteID, user.Email)
+	}
+	if user.ParticipantCode != "" {
+		clearFailedLoginAttempts(user.SiteID, user.ParticipantCode)
+	}
+	return nil
+}
+
+func incrementLoginFailures(throttleType, value string) int64 {
+	key := getLoginFailuresCacheKey(throttleType, value)
+	failures, err := config.CacheClient.Incr(key).Result()
+	if err != nil {
+		return 0
+	}
+	config.CacheClient.Expire(key, loginFailureWindowMinutes*time.Minute)
+	return failures
+}
+
+// getLoginBackoff returns how long to block after the number of failures; the first free attempts are not blocked, then the
+// wait doubles with each failure starting at one second, up to the max
+func getLoginBackoff(failures int64, freeAttempts int64) time.Duration {
+	if failures <= freeAttempts {
+		return 0
+	}
+	exponent := float64(failures - freeAttempts - 1)
+	seconds := math.Min(math.Pow(2, exponent), loginBackoffMaxSeconds)
+	return time.Duration(seconds) * time.Second
+}
+
+// getSiteLogin prefixes the login with the site, since the same email or code can be used on different sites
+func getSiteLogin(siteID int64, login string) string {
+	return fmt.Sprintf("%d_%s", siteID, strings.TrimSpace(login))
+}
+
+func getLoginFailuresCacheKey(throttleType, value string) string {
+	return fmt.Sprintf("login_failures_%s_%s", throttleType, strings.ToLower(strings.TrimSpace(value)))
+}
+
+func getLoginBlockedCacheKey(throttleType, value string) string {
+	return fmt.Sprintf("login_blocked_%s_%s", throttleType, strings.ToLower(strings.TrimSpace(value)))
+}
@@ -0,0 +1,18 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginBackoff(t *testing.T) {
+	assert.Equal(t, time.Duration(0), getLoginBackoff(0, 3))
+	assert.Equal(t, time.Duration(0), getLoginBackoff(3, 3))
+	assert.Equal(t, 1*time.Second, getLoginBackoff(4, 3))
+	assert.Equal(t, 2*time.Second, getLoginBackoff(5, 3))
+	assert.Equal(t, 4*time.Second, getLoginBackoff(6, 3))
+	assert.Equal(t, loginBackoffMaxSeconds*time.Second, getLoginBackoff(100, 3))
+	assert.Equal(t, getLoginFailuresCacheKey(loginThrottleTypeLogin, " Test@Kesplora.com"), getLoginFailuresCacheKey(loginThrottleTypeLogin, "test@kesplora.com"))
+}
@@ -0,0 +1,284 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	MailerDriverOutbox  = "outbox"
+	MailerDriverSMTP    = "smtp"
+	MailerDriverMailgun = "mailgun"
+)
+
+// MailMessage is a single outbound message to a user
+type MailMessage struct {
+	To       string `json:"to"`
+	Subject  string `json:"subject"`
+	Text     string `json:"text"`
+	HTML     string `json:"html"`
+	Template string `json:"template,omitempty"` // the name of the template used to generate the message, if any
+}
+
+// Mailer is the interface any delivery backend must satisfy to send messages to users
+type Mailer interface {
+	Send(message *MailMessage) error
+}
+
+// setupMailer configures the Mailer from the environment. In test and dev, if no driver is set or the selected one is
+// missing its configuration, the outbox is used instead so nothing is lost. Anywhere else that is an error, since the
+// outbox would keep every reset and invitation link on the host instead of sending it
+func setupMailer(environment string) (Mailer, error) {
+	driver := strings.ToLower(envHelper("KESPLORA_API_MAIL_DRIVER", ""))
+	from := envHelper("KESPLORA_API_MAIL_FROM", "Kesplora <no-reply@localhost>")
+	outbox := &mailerOutbox{
+		Directory: envHelper("KESPLORA_API_MAIL_OUTBOX", filepath.Join(os.TempDir(), "kesplora_outbox")),
+	}
+	fallback := func(problem string) (Mailer, error) {
+		if environment != "test" && environment != "dev" {
+			return nil, errors.New(problem)
+		}
+		fmt.Printf("\n%s; using the outbox at %s\n", problem, outbox.Directory)
+		return outbox, nil
+	}
+
+	switch driver {
+	case MailerDriverOutbox:
+		return outbox, nil
+	case MailerDriverSMTP:
+		m := &mailerSMTP{
+			From:     from,
+			Host:     envHelper("KESPLORA_API_MAIL_SMTP_HOST", ""),
+			Port:     envHelper("KESPLORA_API_MAIL_SMTP_PORT", "587"),
+			Username: envHelper("KESPLORA_API_MAIL_SMTP_USERNAME", ""),
+			Password: envHelper("KESPLORA_API_MAIL_SMTP_PASSWORD", ""),
+		}
+		if m.Host != "" {
+			return m, nil
+		}
+		return fallback("KESPLORA_API_MAIL_SMTP_HOST is required for the smtp mailer")
+	case MailerDriverMailgun:
+		m := &mailerMailgun{
+			From:    from,
+			Domain:  envHelper("KESPLORA_API_MAIL_MAILGUN_DOMAIN", ""),
+			APIKey:  envHelper("KESPLORA_API_MAIL_MAILGUN_KEY", ""),
+			APIBase: strings.TrimSuffix(envHelper("KESPLORA_API_MAIL_MAILGUN_API_BASE", "https://api.mailgun.net/v3"), "/"),
+			client: &http.Client{
+				Timeout: 10 * time.Second,
+			},
+		}
+		if m.Domain != "" && m.APIKey != "" {
+			return m, nil
+		}
+		return fallback("KESPLORA_API_MAIL_MAILGUN_DOMAIN and KESPLORA_API_MAIL_MAILGUN_KEY are required for the mailgun mailer")
+	case "":
+		return fallback("KESPLORA_API_MAIL_DRIVER is not set")
+	}
+	return fallback(fmt.Sprintf("unknown KESPLORA_API_MAIL_DRIVER %s", driver))
+}
+
+// sendMail sends the message through the configured Mailer
+func sendMail(message *MailMessage) error {
+	if config.Mailer == nil {
+		return errors.New("no mailer configured")
+	}
+	if message.To == "" {
+		return errors.New("message has no recipient")
+	}
+	return config.Mailer.Send(message)
+}
+
+//
+// outbox
+//
+
+// mailerOutbox writes each message as a JSON file to a directory instead of delivering it. This is what should be used
+// locally and in tests. The messages hold reset and invitation links, so only the API's user can read them
+type mailerOutbox struct {
+	Directory string
+}
+
+// Send writes the message to the outbox directory
+func (m *mailerOutbox) Send(message *MailMessage) error {
+	err := os.MkdirAll(m.Directory, 0o700)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(message, "", "  ")
+	if err != nil {
+		return err
+	}
+	// the recipient is kept in the name to make it easier to find a message when looking at the directory
+	recipient := strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, message.To)
+	name := fmt.Sprintf("%d_%s.json", time.Now().UnixNano(), recipient)
+	return os.WriteFile(filepath.Join(m.Directory, name), data, 0o600)
+}
+
+// Messages reads all of the messages in the outbox, oldest first
+func (m *mailerOutbox) Messages() ([]MailMessage, error) {
+	messages := []MailMessage{}
+	entries, err := os.ReadDir(m.Directory)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return messages, nil
+		}
+		return messages, err
+	}
+	names := []string{}
+	for i := range entries {
+		if !entries[i].IsDir() && strings.HasSuffix(entries[i].Name(), ".json") {
+			names = append(names, entries[i].Name())
+		}
+	}
+	sort.Strings(names)
+	for i := range names {
+		data, err := os.ReadFile(filepath.Join(m.Directory, names[i]))
+		if err != nil {
+			return messages, err
+		}
+		message := MailMessage{}
+		err = json.Unmarshal(data, &message)
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+//
+// smtp
+//
+
+// mailerSMTP delivers messages through an SMTP server. STARTTLS is used if the server supports it
+type mailerSMTP struct {
+	From     string
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+// Send sends the message as a multipart/alternative email
+func (m *mailerSMTP) Send(message *MailMessage) error {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return err
+	}
+	body, err := buildMIMEMessage(m.From, message)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(fmt.Sprintf("%s:%s", m.Host, m.Port), auth, from.Address, []string{message.To}, body)
+}
+
+// buildMIMEMessage builds the raw email with both the text and HTML parts
+func buildMIMEMessage(from string, message *MailMessage) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	parts := multipart.NewWriter(buf)
+	headers := []string{
+		fmt.Sprintf("From: %s", from),
+		fmt.Sprintf("To: %s", message.To),
+		fmt.Sprintf("Subject: %s", mime.QEncoding.Encode("utf-8", message.Subject)),
+		fmt.Sprintf("Date: %s", time.Now().UTC().Format(time.RFC1123Z)),
+		"MIME-Version: 1.0",
+		fmt.Sprintf("Content-Type: multipart/alternative; boundary=%s", parts.Boundary()),
+	}
+	buf.WriteString(strings.Join(headers, "\r\n"))
+	buf.WriteString("\r\n\r\n")
+
+	bodies := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain", message.Text},
+		{"text/html", message.HTML},
+	}
+	for _, b := range bodies {
+		if b.content == "" {
+			continue
+		}
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {fmt.Sprintf("%s; charset=utf-8", b.contentType)},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		_, err = part.Write([]byte(b.content))
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := parts.Close()
+	return buf.Bytes(), err
+}
+
+//
+// mailgun
+//
+
+// mailerMailgun delivers messages through the Mailgun HTTP API
+type mailerMailgun struct {
+	From    string
+	Domain  string
+	APIKey  string
+	APIBase string // the EU region uses a different base
+
+	client *http.Client
+}
+
+// Send posts the message to Mailgun
+func (m *mailerMailgun) Send(message *MailMessage) error {
+	form := url.Values{}
+	form.Set("from", m.From)
+	form.Set("to", message.To)
+	form.Set("subject", message.Subject)
+	form.Set("text", message.Text)
+	if message.HTML != "" {
+		form.Set("html", message.HTML)
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/%s/messages", m.APIBase, m.Domain), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("api", m.APIKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := m.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("mailgun returned status %d", res.StatusCode)
+	}
+	return nil
+}
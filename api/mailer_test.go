@@ -0,0 +1,173 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testOutboxMessages is a helper to read the outbox in tests
+func testOutboxMessages(m *mailerOutbox) []MailMessage {
+	messages, _ := m.Messages()
+	return messages
+}
+
+func TestMailerOutbox(t *testing.T) {
+	mailer := &mailerOutbox{
+		Directory: t.TempDir(),
+	}
+	assert.Equal(t, 0, len(testOutboxMessages(mailer)))
+
+	err := mailer.Send(&MailMessage{
+		To:      "first@kesplora.com",
+		Subject: "First",
+		Text:    "first",
+	})
+	assert.Nil(t, err)
+	err = mailer.Send(&MailMessage{
+		To:      "second@kesplora.com",
+		Subject: "Second",
+		Text:    "second",
+	})
+	assert.Nil(t, err)
+
+	messages, err := mailer.Messages()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, "first@kesplora.com", messages[0].To)
+	assert.Equal(t, "Second", messages[1].Subject)
+
+	// the messages hold links with tokens, so only the owner can read them
+	entries, err := os.ReadDir(mailer.Directory)
+	require.Nil(t, err)
+	info, err := entries[0].Info()
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestSetupMailer(t *testing.T) {
+	t.Setenv("KESPLORA_API_MAIL_OUTBOX", t.TempDir())
+
+	// without a driver, the outbox is only used in test and dev
+	t.Setenv("KESPLORA_API_MAIL_DRIVER", "")
+	mailer, err := setupMailer("dev")
+	require.Nil(t, err)
+	assert.IsType(t, &mailerOutbox{}, mailer)
+	_, err = setupMailer("production")
+	assert.NotNil(t, err)
+
+	// a driver missing its configuration doesn't fall back in production either
+	t.Setenv("KESPLORA_API_MAIL_DRIVER", MailerDriverSMTP)
+	t.Setenv("KESPLORA_API_MAIL_SMTP_HOST", "")
+	_, err = setupMailer("production")
+	assert.NotNil(t, err)
+	t.Setenv("KESPLORA_API_MAIL_SMTP_HOST", "smtp.kesplora.com")
+	mailer, err = setupMailer("production")
+	require.Nil(t, err)
+	assert.IsType(t, &mailerSMTP{}, mailer)
+
+	// choosing the outbox is allowed anywhere
+	t.Setenv("KESPLORA_API_MAIL_DRIVER", MailerDriverOutbox)
+	mailer, err = setupMailer("production")
+	require.Nil(t, err)
+	assert.IsType(t, &mailerOutbox{}, mailer)
+}
+
+func TestMailerMailgun(t *testing.T) {
+	received := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		r.ParseForm()
+		received["path"] = r.URL.Path
+		received["user"] = user
+		received["pass"] = pass
+		received["to"] = r.PostForm.Get("to")
+		received["subject"] = r.PostForm.Get("subject")
+		if r.PostForm.Get("to") == "fail@kesplora.com" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	mailer := &mailerMailgun{
+		From:    "Kesplora <no-reply@kesplora.com>",
+		Domain:  "mg.kesplora.com",
+		APIKey:  "key",
+		APIBase: server.URL,
+	}
+	err := mailer.Send(&MailMessage{
+		To:      "participant@kesplora.com",
+		Subject: "Hello",
+		Text:    "hello",
+		HTML:    "<p>hello</p>",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "/mg.kesplora.com/messages", received["path"])
+	assert.Equal(t, "api", received["user"])
+	assert.Equal(t, "key", received["pass"])
+	assert.Equal(t, "participant@kesplora.com", received["to"])
+	assert.Equal(t, "Hello", received["subject"])
+
+	err = mailer.Send(&MailMessage{
+		To:      "fail@kesplora.com",
+		Subject: "Hello",
+		Text:    "hello",
+	})
+	assert.NotNil(t, err)
+}
+
+func TestMailerBuildMIMEMessage(t *testing.T) {
+	raw, err := buildMIMEMessage("Kesplora <no-reply@kesplora.com>", &MailMessage{
+		To:      "participant@kesplora.com",
+		Subject: "Hello",
+		Text:    "plain body",
+		HTML:    "<p>html body</p>",
+	})
+	assert.Nil(t, err)
+	message := string(raw)
+	assert.True(t, strings.Contains(message, "To: participant@kesplora.com\r\n"))
+	assert.True(t, strings.Contains(message, "Content-Type: multipart/alternative; boundary="))
+	assert.True(t, strings.Contains(message, "plain body"))
+	assert.True(t, strings.Contains(message, "<p>html body</p>"))
+}
+
+func TestEmailTemplatesRender(t *testing.T) {
+	data := sampleEmailTemplateData()
+	data.Link = "https://kesplora.com/reset?token=abc"
+	for name := range defaultEmailTemplates {
+		template := defaultEmailTemplates[name]
+		message, err := renderEmailTemplate(&template, data)
+		assert.Nil(t, err, name)
+		assert.Equal(t, name, message.Template)
+		assert.NotEqual(t, "", message.Subject, name)
+		assert.True(t, strings.Contains(message.Text, data.Link), name)
+	}
+
+	// html is escaped, text is not
+	template := &EmailTemplate{
+		TemplateName: EmailTemplateReminder,
+		Subject:      "{{.Project.Name}}",
+		TextBody:     "{{.Message}}",
+		HTMLBody:     "<p>{{.Message}}</p>",
+	}
+	data.Message = "<b>hi</b>"
+	message, err := renderEmailTemplate(template, data)
+	assert.Nil(t, err)
+	assert.Equal(t, "<b>hi</b>", message.Text)
+	assert.Equal(t, "<p>&lt;b&gt;hi&lt;/b&gt;</p>", message.HTML)
+
+	// bad templates fail
+	template.TextBody = "{{.NotAField}}"
+	_, err = renderEmailTemplate(template, data)
+	assert.NotNil(t, err)
+	template.TextBody = "{{.Message"
+	_, err = renderEmailTemplate(template, data)
+	assert.NotNil(t, err)
+}
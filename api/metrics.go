@@ -0,0 +1,292 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+)
+
+// metricsLatencyBuckets are the upper bounds, in seconds, of the request latency histogram
+var metricsLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// metricCounter is a Prometheus counter with labels. The values are keyed by the label values joined with a separator
+// that can't be in a label
+type metricCounter struct {
+	Name   string
+	Help   string
+	Labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// metricHistogram is a Prometheus histogram with labels
+type metricHistogram struct {
+	Name    string
+	Help    string
+	Labels  []string
+	Buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*metricHistogramValue
+}
+
+type metricHistogramValue struct {
+	counts []uint64 // one for each bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+const metricLabelSeparator = "\xff"
+
+const (
+	metricRouteUnmatched = "unmatched"
+
+	metricLoginResultSuccess     = "success"
+	metricLoginResultFailure     = "failure"
+	metricLoginResultThrottled   = "throttled"
+	metricLoginResultMFARequired = "mfa_required"
+)
+
+var (
+	metricHTTPRequests = newMetricCounter("kesplora_http_requests_total", "The number of HTTP requests handled, by route and status", "method", "route", "status")
+	metricHTTPDuration = newMetricHistogram("kesplora_http_request_duration_seconds", "How long HTTP requests took, by route and status", metricsLatencyBuckets, "method", "route", "status")
+
+	metricLogins           = newMetricCounter("kesplora_logins_total", "The number of login attempts, by result", "result")
+	metricConsentResponses = newMetricCounter("kesplora_consent_responses_created_total", "The number of consent responses created")
+	metricFormSubmissions  = newMetricCounter("kesplora_form_submissions_saved_total", "The number of form submissions saved")
+	metricFileUploads      = newMetricCounter("kesplora_file_uploads_total", "The number of files uploaded")
+	metricFileDownloads    = newMetricCounter("kesplora_file_downloads_total", "The number of files downloaded")
+	metricRateLimited      = newMetricCounter("kesplora_rate_limited_total", "The number of requests rejected for going over a rate limit, by route group", "group")
+
+	metricCounters   = []*metricCounter{metricHTTPRequests, metricLogins, metricConsentResponses, metricFormSubmissions, metricFileUploads, metricFileDownloads, metricRateLimited}
+	metricHistograms = []*metricHistogram{metricHTTPDuration}
+)
+
+func newMetricCounter(name, help string, labels ...string) *metricCounter {
+	return &metricCounter{
+		Name:   name,
+		Help:   help,
+		Labels: labels,
+		values: map[string]float64{},
+	}
+}
+
+func newMetricHistogram(name, help string, buckets []float64, labels ...string) *metricHistogram {
+	return &metricHistogram{
+		Name:    name,
+		Help:    help,
+		Labels:  labels,
+		Buckets: buckets,
+		values:  map[string]*metricHistogramValue{},
+	}
+}
+
+// Inc adds one to the counter for the label values, which must be in the same order as the labels
+func (counter *metricCounter) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+// Add adds to the counter for the label values
+func (counter *metricCounter) Add(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, metricLabelSeparator)
+	counter.mu.Lock()
+	counter.values[key] += value
+	counter.mu.Unlock()
+}
+
+// Get gets the current value for the label values
+func (counter *metricCounter) Get(labelValues ...string) float64 {
+	key := strings.Join(labelValues, metricLabelSeparator)
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	return counter.values[key]
+}
+
+// Observe records a value, such as a duration in seconds, for the label values
+func (histogram *metricHistogram) Observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, metricLabelSeparator)
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+	found, ok := histogram.values[key]
+	if !ok {
+		found = &metricHistogramValue{
+			counts: make([]uint64, len(histogram.Buckets)),
+		}
+		histogram.values[key] = found
+	}
+	for i := range histogram.Buckets {
+		if value <= histogram.Buckets[i] {
+			found.counts[i]++
+			break
+		}
+	}
+	found.count++
+	found.sum += value
+}
+
+// write writes the counter in the Prometheus text format
+func (counter *metricCounter) write(out io.Writer) {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	writeMetricHeader(out, counter.Name, counter.Help, "counter")
+	if len(counter.Labels) == 0 {
+		// counters without labels are always shown, even before anything happens
+		fmt.Fprintf(out, "%s %s\n", counter.Name, formatMetricValue(counter.values[""]))
+		return
+	}
+	for _, key := range sortedMetricKeys(counter.values) {
+		fmt.Fprintf(out, "%s%s %s\n", counter.Name, formatMetricLabels(counter.Labels, key, "", ""), formatMetricValue(counter.values[key]))
+	}
+}
+
+// write writes the histogram in the Prometheus text format, with cumulative buckets
+func (histogram *metricHistogram) write(out io.Writer) {
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+	writeMetricHeader(out, histogram.Name, histogram.Help, "histogram")
+	for _, key := range sortedMetricKeys(histogram.values) {
+		value := histogram.values[key]
+		cumulative := uint64(0)
+		for i, bound := range histogram.Buckets {
+			cumulative += value.counts[i]
+			fmt.Fprintf(out, "%s_bucket%s %d\n", histogram.Name, formatMetricLabels(histogram.Labels, key, "le", formatMetricValue(bound)), cumulative)
+		}
+		fmt.Fprintf(out, "%s_bucket%s %d\n", histogram.Name, formatMetricLabels(histogram.Labels, key, "le", "+Inf"), value.count)
+		fmt.Fprintf(out, "%s_sum%s %s\n", histogram.Name, formatMetricLabels(histogram.Labels, key, "", ""), formatMetricValue(value.sum))
+		fmt.Fprintf(out, "%s_count%s %d\n", histogram.Name, formatMetricLabels(histogram.Labels, key, "", ""), value.count)
+	}
+}
+
+func writeMetricHeader(out io.Writer, name, help, metricType string) {
+	fmt.Fprintf(out, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(out, "# TYPE %s %s\n", name, metricType)
+}
+
+// writeMetricGauge writes a single gauge or counter that is read from somewhere else, such as a connection pool
+func writeMetricGauge(out io.Writer, name, help, metricType string, value float64) {
+	writeMetricHeader(out, name, help, metricType)
+	fmt.Fprintf(out, "%s %s\n", name, formatMetricValue(value))
+}
+
+func sortedMetricKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatMetricLabels builds the {name="value"} part, with an optional extra label such as le for buckets
+func formatMetricLabels(labels []string, key string, extraName, extraValue string) string {
+	pairs := []string{}
+	if len(labels) > 0 {
+		values := strings.Split(key, metricLabelSeparator)
+		for i := range labels {
+			value := ""
+			if i < len(values) {
+				value = values[i]
+			}
+			pairs = append(pairs, fmt.Sprintf("%s=%s", labels[i], escapeMetricLabelValue(value)))
+		}
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", extraName, escapeMetricLabelValue(extraValue)))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeMetricLabelValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+func formatMetricValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// writeMetrics writes every metric, including the current DB and cache pool stats
+func writeMetrics(out io.Writer) {
+	for _, counter := range metricCounters {
+		counter.write(out)
+	}
+	for _, histogram := range metricHistograms {
+		histogram.write(out)
+	}
+
+	if config.DBConnection != nil {
+		stats := config.DBConnection.Stats()
+		writeMetricGauge(out, "kesplora_db_max_open_connections", "The most connections the DB pool will open", "gauge", float64(stats.MaxOpenConnections))
+		writeMetricGauge(out, "kesplora_db_open_connections", "The connections open in the DB pool", "gauge", float64(stats.OpenConnections))
+		writeMetricGauge(out, "kesplora_db_in_use_connections", "The DB connections in use", "gauge", float64(stats.InUse))
+		writeMetricGauge(out, "kesplora_db_idle_connections", "The idle DB connections", "gauge", float64(stats.Idle))
+		writeMetricGauge(out, "kesplora_db_wait_count_total", "The number of times a query waited for a DB connection", "counter", float64(stats.WaitCount))
+		writeMetricGauge(out, "kesplora_db_wait_duration_seconds_total", "The total time spent waiting for a DB connection", "counter", stats.WaitDuration.Seconds())
+		writeMetricGauge(out, "kesplora_db_max_idle_closed_total", "The DB connections closed because the idle pool was full", "counter", float64(stats.MaxIdleClosed))
+		writeMetricGauge(out, "kesplora_db_max_lifetime_closed_total", "The DB connections closed because they reached their max lifetime", "counter", float64(stats.MaxLifetimeClosed))
+	}
+	if config.CacheClient != nil {
+		stats := config.CacheClient.PoolStats()
+		writeMetricGauge(out, "kesplora_cache_hits_total", "The number of times a free cache connection was found in the pool", "counter", float64(stats.Hits))
+		writeMetricGauge(out, "kesplora_cache_misses_total", "The number of times a free cache connection was not found in the pool", "counter", float64(stats.Misses))
+		writeMetricGauge(out, "kesplora_cache_timeouts_total", "The number of times waiting for a cache connection timed out", "counter", float64(stats.Timeouts))
+		writeMetricGauge(out, "kesplora_cache_total_connections", "The connections in the cache pool", "gauge", float64(stats.TotalConns))
+		writeMetricGauge(out, "kesplora_cache_idle_connections", "The idle connections in the cache pool", "gauge", float64(stats.IdleConns))
+		writeMetricGauge(out, "kesplora_cache_stale_connections_total", "The stale cache connections removed from the pool", "counter", float64(stats.StaleConns))
+	}
+}
+
+// metricsMiddleware counts and times each request by its route pattern, rather than the path, so ids in the path
+// don't create a new series for every record
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		wrapped := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(wrapped, r)
+
+		route := metricRouteUnmatched
+		routeContext := chi.RouteContext(r.Context())
+		if routeContext != nil && routeContext.RoutePattern() != "" {
+			route = routeContext.RoutePattern()
+		}
+		status := wrapped.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		statusLabel := strconv.Itoa(status)
+		metricHTTPRequests.Inc(r.Method, route, statusLabel)
+		metricHTTPDuration.Observe(time.Since(started).Seconds(), r.Method, route, statusLabel)
+	})
+}
+
+// routeMetrics serves the metrics in the Prometheus text format
+func routeMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	writeMetrics(w)
+}
+
+// SetupMetricsAPI builds the handler for a separate metrics listener when KESPLORA_API_METRICS_PORT is set
+func SetupMetricsAPI() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", routeMetrics)
+	return mux
+}
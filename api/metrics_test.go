@@ -0,0 +1,81 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricCounterAndHistogramFormat(t *testing.T) {
+	counter := newMetricCounter("test_total", "A test counter", "route", "status")
+	counter.Inc("/users/{userID}", "200")
+	counter.Inc("/users/{userID}", "200")
+	counter.Add(3, `/a"b`, "500")
+	assert.Equal(t, float64(2), counter.Get("/users/{userID}", "200"))
+
+	out := &bytes.Buffer{}
+	counter.write(out)
+	assert.Equal(t, `# HELP test_total A test counter
+# TYPE test_total counter
+test_total{route="/a\"b",status="500"} 3
+test_total{route="/users/{userID}",status="200"} 2
+`, out.String())
+
+	// counters without labels are written even when they are zero
+	out.Reset()
+	newMetricCounter("empty_total", "Nothing yet").write(out)
+	assert.Contains(t, out.String(), "empty_total 0\n")
+
+	histogram := newMetricHistogram("test_seconds", "A test histogram", []float64{0.1, 1}, "route")
+	histogram.Observe(0.05, "/")
+	histogram.Observe(0.5, "/")
+	histogram.Observe(5, "/")
+	out.Reset()
+	histogram.write(out)
+	assert.Equal(t, `# HELP test_seconds A test histogram
+# TYPE test_seconds histogram
+test_seconds_bucket{route="/",le="0.1"} 1
+test_seconds_bucket{route="/",le="1"} 2
+test_seconds_bucket{route="/",le="+Inf"} 3
+test_seconds_sum{route="/"} 5.55
+test_seconds_count{route="/"} 3
+`, out.String())
+}
+
+func TestMetricsMiddlewareUsesRoutePattern(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(metricsMiddleware)
+	router.Get("/metrics-test/{thingID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	before := metricHTTPRequests.Get(http.MethodGet, "/metrics-test/{thingID}", "418")
+	for _, path := range []string{"/metrics-test/1", "/metrics-test/2"} {
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		require.Nil(t, err)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	assert.Equal(t, before+2, metricHTTPRequests.Get(http.MethodGet, "/metrics-test/{thingID}", "418"))
+
+	// paths that don't match a route are grouped together
+	before = metricHTTPRequests.Get(http.MethodGet, metricRouteUnmatched, "404")
+	req, err := http.NewRequest(http.MethodGet, "/not/a/route", nil)
+	require.Nil(t, err)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, before+1, metricHTTPRequests.Get(http.MethodGet, metricRouteUnmatched, "404"))
+}
+
+func TestMetricsRoute(t *testing.T) {
+	setupTesting()
+	code, res, err := testEndpoint(http.MethodGet, "/metrics", nil, routeMetrics, "")
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, res.String(), "# TYPE kesplora_logins_total counter")
+	assert.Contains(t, res.String(), "kesplora_db_open_connections ")
+	assert.Contains(t, res.String(), "kesplora_cache_total_connections ")
+}
@@ -0,0 +1,345 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	mfaTOTPDigits        = 6
+	mfaTOTPPeriodSeconds = 30
+	mfaTOTPSkewSteps     = 1 // allow one step on either side for clock drift
+	mfaRecoveryCodeCount = 10
+	mfaChallengeAttempts = 5
+	mfaAttemptsMinutes   = 15 // bad codes for a user are counted across challenges for this long
+)
+
+var (
+	errMFAAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	errMFANotEnabled     = errors.New("two-factor authentication not enabled")
+	errMFANotStarted     = errors.New("two-factor enrollment has not been started")
+	errMFABadCode        = errors.New("two-factor code is invalid")
+	errMFAChallenge      = errors.New("two-factor challenge is invalid or expired")
+)
+
+// MFAEnrollment is returned when a user starts enrolling in two-factor authentication. The URI can be shown as a
+// QR code for authenticator apps and the secret can be typed in manually
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// MFARecoveryCode is a one-time code that can be used in place of a TOTP code if the device is lost. Only the hash is stored
+type MFARecoveryCode struct {
+	UserID    int64  `json:"userId" db:"userId"`
+	CodeHash  string `json:"-" db:"codeHash"`
+	CreatedOn string `json:"createdOn" db:"createdOn"`
+}
+
+// MFAChallenge is returned from the login when the password was correct but a second factor is still needed
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfaRequired"`
+	MFAToken    string `json:"mfaToken"`
+	Expires     string `json:"expires"`
+}
+
+// StartMFAEnrollmentForUser generates a new secret for the user. It is not enforced until confirmed with a code
+func StartMFAEnrollmentForUser(user *User) (*MFAEnrollment, error) {
+	if user.MFAEnabled == Yes {
+		return nil, errMFAAlreadyEnabled
+	}
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	_, err = config.DBConnection.Exec(`UPDATE Users SET mfaSecret = ? WHERE id = ?`, secret, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := "Kesplora"
+	site, err := GetSiteByID(user.SiteID)
+	if err == nil && site.Name != "" {
+		issuer = site.Name
+	}
+	account := user.Email
+	if account == "" {
+		account = user.ParticipantCode
+	}
+	return &MFAEnrollment{
+		Secret: secret,
+		URI:    getTOTPURI(issuer, account, secret),
+	}, nil
+}
+
+// ConfirmMFAEnrollmentForUser checks the code against the pending secret, enables two-factor authentication, and
+// returns the recovery codes. This is the only time the plain recovery codes are available
+func ConfirmMFAEnrollmentForUser(user *User, code string) ([]string, error) {
+	if user.MFAEnabled == Yes {
+		return nil, errMFAAlreadyEnabled
+	}
+	secret, err := getMFASecretForUser(user.ID)
+	if err != nil || secret == "" {
+		return nil, errMFANotStarted
+	}
+	if !validateTOTPCodeForUser(user.ID, secret, code) {
+		return nil, errMFABadCode
+	}
+	_, err = config.DBConnection.Exec(`UPDATE Users SET mfaEnabled = ? WHERE id = ?`, Yes, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	user.MFAEnabled = Yes
+	return GenerateMFARecoveryCodesForUser(user.ID)
+}
+
+// DisableMFAForUser turns off two-factor authentication, removing the secret and any recovery codes
+func DisableMFAForUser(userID int64) error {
+	_, err := config.DBConnection.Exec(`UPDATE Users SET mfaEnabled = ?, mfaSecret = '' WHERE id = ?`, No, userID)
+	if err != nil {
+		return err
+	}
+	_, err = config.DBConnection.Exec(`DELETE FROM UserRecoveryCodes WHERE userId = ?`, userID)
+	return err
+}
+
+// GenerateMFARecoveryCodesForUser replaces any existing recovery codes with a new set
+func GenerateMFARecoveryCodesForUser(userID int64) ([]string, error) {
+	_, err := config.DBConnection.Exec(`DELETE FROM UserRecoveryCodes WHERE userId = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	codes := []string{}
+	for i := 0; i < mfaRecoveryCodeCount; i++ {
+		code, err := generateMFARecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		input := &MFARecoveryCode{
+			UserID:   userID,
+			CodeHash: hashMFARecoveryCode(code),
+		}
+		input.processForDB()
+		_, err = config.DBConnection.NamedExec(`INSERT INTO UserRecoveryCodes (userId, codeHash, createdOn)
+		VALUES
+		(:userId, :codeHash, :createdOn)`, input)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// ValidateMFACodeForUser checks a TOTP code or, if that fails, a recovery code. Recovery codes are consumed on use
+func ValidateMFACodeForUser(user *User, code string) error {
+	if user.MFAEnabled != Yes {
+		return errMFANotEnabled
+	}
+	secret, err := getMFASecretForUser(user.ID)
+	if err != nil {
+		return err
+	}
+	if validateTOTPCodeForUser(user.ID, secret, code) {
+		return nil
+	}
+	res, err := config.DBConnection.Exec(`DELETE FROM UserRecoveryCodes WHERE userId = ? AND codeHash = ?`, user.ID, hashMFARecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if deleted, _ := res.RowsAffected(); deleted == 1 {
+		return nil
+	}
+	return errMFABadCode
+}
+
+// CreateMFAChallengeForUser issues the short lived token that must be sent back with a code to finish logging in
+func CreateMFAChallengeForUser(user *User) (*MFAChallenge, error) {
+	token, err := generateToken(user, tokenTypeMFA)
+	if err != nil {
+		return nil, err
+	}
+	err = saveTokenForUser(token)
+	if err != nil {
+		return nil, err
+	}
+	return &MFAChallenge{
+		MFARequired: true,
+		MFAToken:    token.Token,
+		Expires:     token.ExpiresOn,
+	}, nil
+}
+
+// CompleteMFAChallenge checks the code for the challenge token and, if it matches, consumes the token and returns the
+// user so the login can finish. Bad codes are counted for the user rather than the challenge, so logging in again
+// doesn't give more guesses; once there are too many, challenges are refused until the count expires. On a bad code
+// the user is still returned so the failure can be recorded against their login
+func CompleteMFAChallenge(tokenValue, code string) (*User, error) {
+	token, err := getTokenByValue(tokenTypeMFA, tokenValue)
+	if err != nil {
+		return nil, errMFAChallenge
+	}
+	expires, err := parseTime(token.ExpiresOn)
+	if err != nil || expires.Before(time.Now()) {
+		deleteTokenForUser(token.UserID, tokenTypeMFA)
+		return nil, errMFAChallenge
+	}
+	user, err := GetUserByID(token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	key := getMFAChallengeAttemptsCacheKey(user.ID)
+	attempts, _ := config.CacheClient.Get(key).Int64()
+	if attempts >= mfaChallengeAttempts {
+		deleteTokenForUser(user.ID, tokenTypeMFA)
+		return nil, errMFAChallenge
+	}
+	err = ValidateMFACodeForUser(user, code)
+	if err != nil {
+		attempts, _ = config.CacheClient.Incr(key).Result()
+		if attempts == 1 {
+			config.CacheClient.Expire(key, mfaAttemptsMinutes*time.Minute)
+		}
+		if attempts >= mfaChallengeAttempts {
+			deleteTokenForUser(user.ID, tokenTypeMFA)
+		}
+		return user, err
+	}
+	config.CacheClient.Del(key)
+	err = deleteTokenForUser(user.ID, tokenTypeMFA)
+	return user, err
+}
+
+// userMustEnrollMFA checks if the site requires two-factor authentication for the user but they have not enrolled yet
+func userMustEnrollMFA(site *Site, user *User) bool {
+	return site != nil && site.RequireAdminMFA == Yes && user.SystemRole == UserSystemRoleAdmin && user.MFAEnabled != Yes
+}
+
+func getMFASecretForUser(userID int64) (string, error) {
+	secret := ""
+	err := config.DBConnection.Get(&secret, `SELECT mfaSecret FROM Users WHERE id = ?`, userID)
+	return secret, err
+}
+
+// validateTOTPCodeForUser checks the code and makes sure the same code cannot be replayed while it is still valid
+func validateTOTPCodeForUser(userID int64, secret, code string) bool {
+	counter, valid := validateTOTPCode(secret, code, time.Now())
+	if !valid {
+		return false
+	}
+	set, err := config.CacheClient.SetNX(getMFAUsedCacheKey(userID, counter), "1", (2*mfaTOTPSkewSteps+1)*mfaTOTPPeriodSeconds*time.Second).Result()
+	return err == nil && set
+}
+
+// generateTOTPSecret creates a new random 160 bit secret, base32 encoded as authenticator apps expect
+func generateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
+
+// generateTOTPCode generates the RFC 6238 code for the secret at the given counter, which is the number of periods since the epoch
+func generateTOTPCode(secret string, counter uint64) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// dynamic truncation from RFC 4226
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < mfaTOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", mfaTOTPDigits, value%mod), nil
+}
+
+// validateTOTPCode checks the code against the window around the time and returns the counter that matched
+func validateTOTPCode(secret, code string, at time.Time) (uint64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if secret == "" || len(code) != mfaTOTPDigits {
+		return 0, false
+	}
+	current := uint64(at.Unix() / mfaTOTPPeriodSeconds)
+	for step := -mfaTOTPSkewSteps; step <= mfaTOTPSkewSteps; step++ {
+		counter := uint64(int64(current) + int64(step))
+		expected, err := generateTOTPCode(secret, counter)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// getTOTPURI builds the otpauth URI used for QR codes
+func getTOTPURI(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", mfaTOTPDigits))
+	params.Set("period", fmt.Sprintf("%d", mfaTOTPPeriodSeconds))
+	label := url.PathEscape(issuer + ":" + account)
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, params.Encode())
+}
+
+// generateMFARecoveryCode creates a code in the form xxxxx-xxxxx that is easy to read and type
+func generateMFARecoveryCode() (string, error) {
+	b := make([]byte, 5)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	encoded := hex.EncodeToString(b)
+	return encoded[0:5] + "-" + encoded[5:10], nil
+}
+
+// hashMFARecoveryCode normalizes and hashes a recovery code; the codes are random so a plain sha256 is enough
+func hashMFARecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	hashed := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(hashed[:])
+}
+
+func getMFAUsedCacheKey(userID int64, counter uint64) string {
+	return fmt.Sprintf("mfa_used_%d_%d", userID, counter)
+}
+
+func getMFAChallengeAttemptsCacheKey(userID int64) string {
+	return fmt.Sprintf("mfa_attempts_%d", userID)
+}
+
+//
+// processors
+//
+
+func (input *MFARecoveryCode) processForDB() {
+	if input.CreatedOn == "" {
+		input.CreatedOn = time.Now().Format(timeFormatDB)
+	} else {
+		input.CreatedOn, _ = parseTimeToTimeFormat(input.CreatedOn, timeFormatDB)
+	}
+}
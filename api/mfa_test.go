@@ -0,0 +1,55 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTPCodes(t *testing.T) {
+	// the SHA1 vectors from RFC 6238, truncated to six digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for at, expected := range vectors {
+		code, err := generateTOTPCode(secret, uint64(at/mfaTOTPPeriodSeconds))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, code)
+
+		_, valid := validateTOTPCode(secret, expected, time.Unix(at, 0))
+		assert.True(t, valid)
+		// one step of drift is allowed, but not two
+		_, valid = validateTOTPCode(secret, expected, time.Unix(at+mfaTOTPPeriodSeconds, 0))
+		assert.True(t, valid)
+		_, valid = validateTOTPCode(secret, expected, time.Unix(at+3*mfaTOTPPeriodSeconds, 0))
+		assert.False(t, valid)
+	}
+
+	_, valid := validateTOTPCode(secret, "", time.Unix(59, 0))
+	assert.False(t, valid)
+	_, valid = validateTOTPCode("", "287082", time.Unix(59, 0))
+	assert.False(t, valid)
+
+	generated, err := generateTOTPSecret()
+	assert.Nil(t, err)
+	assert.Equal(t, 32, len(generated))
+	uri := getTOTPURI("Kesplora Site", "admin@kesplora.com", generated)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Kesplora%20Site:admin@kesplora.com?"))
+	assert.True(t, strings.Contains(uri, "secret="+generated))
+}
+
+func TestMFARecoveryCodes(t *testing.T) {
+	code, err := generateMFARecoveryCode()
+	assert.Nil(t, err)
+	assert.Equal(t, 11, len(code))
+	assert.Equal(t, hashMFARecoveryCode(code), hashMFARecoveryCode(" "+strings.ToUpper(code)+" "))
+	other, err := generateMFARecoveryCode()
+	assert.Nil(t, err)
+	assert.NotEqual(t, hashMFARecoveryCode(code), hashMFARecoveryCode(other))
+}
@@ -0,0 +1,373 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	schema "github.com/kevineaton/kesplora-api/sql"
+)
+
+// Migration is a single versioned change to the schema. The files are named {version}_{name}.up.sql, with an
+// optional matching .down.sql to undo it
+type Migration struct {
+	Version  int64  `json:"version"`
+	Name     string `json:"name"`
+	UpPath   string `json:"-"`
+	DownPath string `json:"-"`
+	Applied  bool   `json:"applied"`
+}
+
+// the version table matches the one used by the migrate tool, so installs that used it can switch without changes
+const migrationsTableCreate = "CREATE TABLE IF NOT EXISTS `schema_migrations` (`version` bigint(20) NOT NULL, `dirty` tinyint(1) NOT NULL, PRIMARY KEY (`version`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+// migrationsLockName is the MySQL named lock held while migrating, so several instances starting at once don't race
+const migrationsLockName = "kesplora_schema_migrations"
+
+// migrationsLockTimeout is how long to wait for another instance to finish migrating
+const migrationsLockTimeout = 5 * time.Minute
+
+// getMigrationsFS gets the migrations from the directory, or the ones built into the binary if it is blank
+func getMigrationsFS(directory string) fs.FS {
+	if directory == "" {
+		return schema.Migrations
+	}
+	return os.DirFS(directory)
+}
+
+// readMigrations reads the migrations, oldest first
+func readMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	found := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		direction := ""
+		if strings.HasSuffix(name, ".up.sql") {
+			direction = "up"
+		} else if strings.HasSuffix(name, ".down.sql") {
+			direction = "down"
+		} else {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimSuffix(name, "."+direction+".sql"), "_", 2)
+		version, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s does not start with a version", name)
+		}
+		migration, ok := found[version]
+		if !ok {
+			migration = &Migration{
+				Version: version,
+			}
+			if len(parts) > 1 {
+				migration.Name = parts[1]
+			}
+			found[version] = migration
+		}
+		if direction == "up" {
+			if migration.UpPath != "" {
+				return nil, fmt.Errorf("more than one migration has version %d", version)
+			}
+			migration.UpPath = name
+		} else {
+			migration.DownPath = name
+		}
+	}
+
+	migrations := []Migration{}
+	for _, migration := range found {
+		if migration.UpPath == "" {
+			return nil, fmt.Errorf("migration %d has a down file but no up file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// splitSQLStatements splits a migration into statements so they can be run one at a time without needing
+// multiStatements on the connection. Statements end with a ; at the end of a line, and -- comment lines are dropped
+func splitSQLStatements(content string) []string {
+	statements := []string{}
+	current := strings.Builder{}
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if strings.TrimSpace(current.String()) != "" {
+		statements = append(statements, strings.TrimSpace(current.String()))
+	}
+	return statements
+}
+
+// getSchemaVersion gets the version the schema is at; 0 means nothing has been applied
+func getSchemaVersion() (version int64, dirty bool, err error) {
+	_, err = config.DBConnection.Exec(migrationsTableCreate)
+	if err != nil {
+		return 0, false, err
+	}
+	row := struct {
+		Version int64 `db:"version"`
+		Dirty   bool  `db:"dirty"`
+	}{}
+	err = config.DBConnection.Get(&row, "SELECT `version`, `dirty` FROM `schema_migrations` LIMIT 1")
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return row.Version, row.Dirty, err
+}
+
+// setSchemaVersion records the version; only one row is ever kept
+func setSchemaVersion(version int64, dirty bool) error {
+	_, err := config.DBConnection.Exec("DELETE FROM `schema_migrations`")
+	if err != nil || version == 0 {
+		return err
+	}
+	_, err = config.DBConnection.Exec("INSERT INTO `schema_migrations` (`version`, `dirty`) VALUES (?, ?)", version, dirty)
+	return err
+}
+
+// applyMigrationFile runs each statement in the file. MySQL commits schema changes as it goes, so a failure part way
+// leaves the version dirty to be fixed by hand
+func applyMigrationFile(fsys fs.FS, path string) error {
+	content, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return err
+	}
+	for _, statement := range splitSQLStatements(string(content)) {
+		_, err = config.DBConnection.Exec(statement)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// withMigrationsLock runs the function while holding the migrations lock. MySQL named locks belong to a connection, so
+// one is held open from the pool until the function returns
+func withMigrationsLock(run func() error) error {
+	ctx := context.Background()
+	conn, err := config.DBConnection.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	locked := sql.NullInt64{}
+	err = conn.GetContext(ctx, &locked, "SELECT GET_LOCK(?, ?)", migrationsLockName, int(migrationsLockTimeout.Seconds()))
+	if err != nil {
+		return err
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return errors.New("timed out waiting for another instance to finish migrating")
+	}
+	defer conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", migrationsLockName)
+	return run()
+}
+
+// checkSchemaNotInitialized makes sure a schema with no recorded version is empty, so the initial migration is never
+// run over tables that were created by hand or by an older install
+func checkSchemaNotInitialized() error {
+	count := 0
+	err := config.DBConnection.Get(&count, "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = 'Site'")
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("the schema has tables but no recorded version; insert the version it is at into schema_migrations before migrating")
+	}
+	return nil
+}
+
+// GetMigrationStatus gets every migration and whether it has been applied; a blank directory uses the built in migrations
+func GetMigrationStatus(directory string) ([]Migration, error) {
+	migrations, err := readMigrations(getMigrationsFS(directory))
+	if err != nil {
+		return migrations, err
+	}
+	version, _, err := getSchemaVersion()
+	if err != nil {
+		return migrations, err
+	}
+	for i := range migrations {
+		migrations[i].Applied = migrations[i].Version <= version
+	}
+	return migrations, nil
+}
+
+// MigrateUp applies every pending migration in order and returns the ones that were applied; a blank directory uses the
+// built in migrations
+func MigrateUp(directory string) ([]Migration, error) {
+	applied := []Migration{}
+	err := withMigrationsLock(func() error {
+		var err error
+		applied, err = migrateUp(getMigrationsFS(directory))
+		return err
+	})
+	return applied, err
+}
+
+func migrateUp(fsys fs.FS) ([]Migration, error) {
+	applied := []Migration{}
+	migrations, err := readMigrations(fsys)
+	if err != nil {
+		return applied, err
+	}
+	version, dirty, err := getSchemaVersion()
+	if err != nil {
+		return applied, err
+	}
+	if dirty {
+		return applied, fmt.Errorf("the schema is dirty at version %d; fix it by hand before migrating", version)
+	}
+	if version == 0 && len(migrations) > 0 {
+		err = checkSchemaNotInitialized()
+		if err != nil {
+			return applied, err
+		}
+	}
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+		err = setSchemaVersion(migration.Version, true)
+		if err != nil {
+			return applied, err
+		}
+		err = applyMigrationFile(fsys, migration.UpPath)
+		if err != nil {
+			return applied, err
+		}
+		err = setSchemaVersion(migration.Version, false)
+		if err != nil {
+			return applied, err
+		}
+		migration.Applied = true
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+// MigrateDown undoes the most recently applied migration, which must have a down file; a blank directory uses the built
+// in migrations
+func MigrateDown(directory string) (*Migration, error) {
+	var migration *Migration
+	err := withMigrationsLock(func() error {
+		var err error
+		migration, err = migrateDown(getMigrationsFS(directory))
+		return err
+	})
+	return migration, err
+}
+
+func migrateDown(fsys fs.FS) (*Migration, error) {
+	migrations, err := readMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	version, dirty, err := getSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, fmt.Errorf("the schema is dirty at version %d; fix it by hand before migrating", version)
+	}
+	if version == 0 {
+		return nil, errors.New("no migrations have been applied")
+	}
+	previous := int64(0)
+	for i := range migrations {
+		if migrations[i].Version != version {
+			if migrations[i].Version < version {
+				previous = migrations[i].Version
+			}
+			continue
+		}
+		migration := migrations[i]
+		if migration.DownPath == "" {
+			return nil, fmt.Errorf("migration %d has no down file", version)
+		}
+		err = setSchemaVersion(version, true)
+		if err != nil {
+			return nil, err
+		}
+		err = applyMigrationFile(fsys, migration.DownPath)
+		if err != nil {
+			return nil, err
+		}
+		err = setSchemaVersion(previous, false)
+		migration.Applied = false
+		return &migration, err
+	}
+	return nil, fmt.Errorf("the schema is at version %d, which is not in the migrations", version)
+}
+
+// CheckSchema is run when the server starts. If KESPLORA_API_MIGRATE_ON_START is on, pending migrations are applied
+// first. It returns an error if the schema is dirty or newer than the migrations built into the binary, since an older
+// binary may not work with it
+func CheckSchema() error {
+	if config.MigrateOnStart {
+		applied, err := MigrateUp(config.MigrationsPath)
+		for _, migration := range applied {
+			fmt.Printf("\tapplied migration %d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	migrations, err := readMigrations(getMigrationsFS(config.MigrationsPath))
+	if err != nil {
+		return err
+	}
+	version, dirty, err := getSchemaVersion()
+	if err != nil {
+		return err
+	}
+	return checkSchemaVersion(migrations, version, dirty)
+}
+
+// checkSchemaVersion compares the recorded version to the known migrations
+func checkSchemaVersion(migrations []Migration, version int64, dirty bool) error {
+	if dirty {
+		return fmt.Errorf("the schema is dirty at version %d; fix it by hand before starting", version)
+	}
+	latest := int64(0)
+	pending := 0
+	for _, migration := range migrations {
+		latest = migration.Version
+		if migration.Version > version {
+			pending++
+		}
+	}
+	if version > latest {
+		return fmt.Errorf("the schema is at version %d but this binary only knows up to %d; upgrade the binary", version, latest)
+	}
+	if pending > 0 {
+		fmt.Printf("\tthe schema has %d pending migrations; run the migrate up command or set KESPLORA_API_MIGRATE_ON_START\n", pending)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadMigrations(t *testing.T) {
+	directory := t.TempDir()
+	files := map[string]string{
+		"202201010000_second.up.sql":    "SELECT 2;",
+		"202101010000_first.up.sql":     "SELECT 1;",
+		"202101010000_first.down.sql":   "SELECT -1;",
+		"README.md":                     "not a migration",
+		"202301010000_third.up.sql.bak": "SELECT 3;",
+	}
+	for name, content := range files {
+		require.Nil(t, os.WriteFile(filepath.Join(directory, name), []byte(content), 0o644))
+	}
+	migrations, err := readMigrations(getMigrationsFS(directory))
+	require.Nil(t, err)
+	require.Equal(t, 2, len(migrations))
+	assert.Equal(t, int64(202101010000), migrations[0].Version)
+	assert.Equal(t, "first", migrations[0].Name)
+	assert.NotEqual(t, "", migrations[0].DownPath)
+	assert.Equal(t, "second", migrations[1].Name)
+	assert.Equal(t, "", migrations[1].DownPath)
+
+	require.Nil(t, os.WriteFile(filepath.Join(directory, "202401010000_orphan.down.sql"), []byte("SELECT 4;"), 0o644))
+	_, err = readMigrations(getMigrationsFS(directory))
+	assert.NotNil(t, err)
+
+	// the built in migrations should always be readable and match the files
+	migrations, err = readMigrations(getMigrationsFS(""))
+	require.Nil(t, err)
+	onDisk, err := readMigrations(getMigrationsFS("../sql"))
+	require.Nil(t, err)
+	assert.NotEqual(t, 0, len(migrations))
+	assert.Equal(t, onDisk, migrations)
+	for _, migration := range migrations {
+		content, err := fs.ReadFile(getMigrationsFS(""), migration.UpPath)
+		require.Nil(t, err)
+		assert.NotContains(t, string(content), "DROP TABLE", migration.UpPath)
+		// every migration can be undone with migrate down
+		assert.NotEqual(t, "", migration.DownPath, migration.UpPath)
+		// versions are stored in schema_migrations, so they have to be real {yyyymmddhhmm} timestamps from the start
+		_, err = time.Parse("200601021504", strconv.FormatInt(migration.Version, 10))
+		assert.Nil(t, err, migration.UpPath)
+	}
+}
+
+func TestCheckSchemaVersion(t *testing.T) {
+	migrations := []Migration{
+		{Version: 202101010000},
+		{Version: 202201010000},
+	}
+	assert.Nil(t, checkSchemaVersion(migrations, 0, false))
+	assert.Nil(t, checkSchemaVersion(migrations, 202101010000, false))
+	assert.Nil(t, checkSchemaVersion(migrations, 202201010000, false))
+	assert.NotNil(t, checkSchemaVersion(migrations, 202201010000, true))
+	assert.NotNil(t, checkSchemaVersion(migrations, 202301010000, false))
+}
+
+func TestSplitSQLStatements(t *testing.T) {
+	statements := splitSQLStatements(`-- a comment
+DROP TABLE IF EXISTS ` + "`Site`" + `;
+CREATE TABLE ` + "`Site`" + ` (
+  ` + "`id`" + ` int(11) NOT NULL
+) ENGINE=InnoDB;
+
+UPDATE Site SET name = 'a;b' WHERE id = 1;`)
+	require.Equal(t, 3, len(statements))
+	assert.Equal(t, "DROP TABLE IF EXISTS `Site`", statements[0])
+	assert.Contains(t, statements[1], "ENGINE=InnoDB")
+	assert.Equal(t, "UPDATE Site SET name = 'a;b' WHERE id = 1", statements[2])
+}
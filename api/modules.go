@@ -15,6 +15,7 @@ const (
 // Module is a module that contains Blocks and are organized into Flows for a Project
 type Module struct {
 	ID            int64  `json:"id" db:"id"`
+	SiteID        int64  `json:"siteId" db:"siteId"`
 	Name          string `json:"name" db:"name"`
 	Status        string `json:"status" db:"status"`
 	Description   string `json:"description" db:"description"`
@@ -27,6 +28,7 @@ func CreateModule(input *Module) error {
 	input.processForDB()
 	defer input.processForAPI()
 	res, err := config.DBConnection.NamedExec(`INSERT INTO Modules SET
+	siteId = :siteId,
 	name = :name,
 	status = :status,
 	description = :description`, input)
@@ -67,12 +69,12 @@ func DeleteModule(moduleID int64) error {
 	return err
 }
 
-// GetModuleByID gets a single module
-func GetModuleByID(moduleID int64) (*Module, error) {
+// GetModuleByID gets a single module on the site
+func GetModuleByID(siteID, moduleID int64) (*Module, error) {
 	mod := &Module{}
 	defer mod.processForAPI()
 	err := config.DBConnection.Get(mod, `SELECT m.*, IFNULL((SELECT COUNT(*) FROM Flows f WHERE f.moduleId = m.id GROUP BY f.projectId), 0) AS projectsCount
-	FROM Modules m WHERE m.id = ?`, moduleID)
+	FROM Modules m WHERE m.id = ? AND m.siteId = ?`, moduleID, siteID)
 	return mod, err
 }
 
@@ -92,11 +94,12 @@ func GetModulesForProject(projectID int64) ([]Module, error) {
 }
 
 // GetAllModulesForSite gets all the modules on the site, needed for the building of the flows interface
-func GetAllModulesForSite() ([]Module, error) {
+func GetAllModulesForSite(siteID int64) ([]Module, error) {
 	mods := []Module{}
 	err := config.DBConnection.Select(&mods, `SELECT m.*, IFNULL((SELECT COUNT(*) FROM Flows f WHERE f.moduleId = m.id GROUP BY f.projectId), 0) AS projectsCount
 	FROM Modules m 
-		ORDER BY m.name`)
+		WHERE m.siteId = ?
+		ORDER BY m.name`, siteID)
 	if err != nil {
 		return mods, err
 	}
@@ -138,6 +141,9 @@ func createTestModule(defaults *Module, projectID int64, moduleOrder int64) erro
 	if defaults.Status == "" {
 		defaults.Status = ModuleStatusActive
 	}
+	if defaults.SiteID == 0 {
+		defaults.SiteID = getTestSiteID()
+	}
 	err := CreateModule(defaults)
 	if err != nil {
 		return err
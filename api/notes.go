@@ -16,6 +16,7 @@ const (
 // Note represents a note that a user can enter into the system, often as a part of a training or project
 type Note struct {
 	ID         int64  `json:"id" db:"id"`
+	SiteID     int64  `json:"siteId" db:"siteId"`
 	UserID     int64  `json:"userId" db:"userId"`
 	CreatedOn  string `json:"createdOn" db:"createdOn"`
 	NoteType   string `json:"noteType" db:"noteType"`
@@ -46,6 +47,7 @@ func CreateNote(input *Note) error {
 	input.processForDB()
 	defer input.processForAPI()
 	res, err := config.DBConnection.NamedExec(`INSERT INTO Notes SET
+	siteId = :siteId,
 	userId = :userId,
 	createdOn = :createdOn,
 	noteType = :noteType,
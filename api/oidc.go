@@ -0,0 +1,541 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	oidcStateMinutes = 10
+)
+
+var (
+	errOIDCNotConfigured = errors.New("single sign-on is not configured")
+	errOIDCBadState      = errors.New("single sign-on state is invalid or expired")
+	errOIDCFailed        = errors.New("could not complete single sign-on with the identity provider")
+	errOIDCBadIDToken    = errors.New("the identity provider returned an invalid id token")
+	errOIDCNoEmail       = errors.New("the identity provider did not return a verified email")
+	errOIDCNoAccount     = errors.New("no account exists for the email and new accounts are not provisioned")
+)
+
+// oidcProvider is the configured OpenID Connect identity provider, such as a university's campus login. The discovery
+// document and the provider's signing keys are fetched when first needed and cached
+type oidcProvider struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string // if blank, each site's client is used
+	ProvisionRole string // the system role for new users; blank means only existing users can sign in
+	Scopes        []string
+
+	client    *http.Client
+	lock      sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*jwtKey
+}
+
+// oidcDiscovery is the part of the provider's discovery document that we use
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcLoginState is stored in the cache between starting the login and the callback
+type oidcLoginState struct {
+	Nonce       string `json:"nonce"`
+	Verifier    string `json:"verifier"`
+	RedirectURL string `json:"redirectUrl"` // the token exchange has to send the same one as the authorization
+}
+
+// OIDCLoginStart is returned to the client, which should keep the state and send the user to the URL
+type OIDCLoginStart struct {
+	URL     string `json:"url"`
+	State   string `json:"state"`
+	Expires string `json:"expires"`
+}
+
+// oidcIdentity is the validated identity from the ID token
+type oidcIdentity struct {
+	Subject   string
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+// setupOIDC configures the identity provider from the environment; nil is returned if single sign-on is not set up
+func setupOIDC() *oidcProvider {
+	issuer := strings.TrimSuffix(envHelper("KESPLORA_API_OIDC_ISSUER", ""), "/")
+	clientID := envHelper("KESPLORA_API_OIDC_CLIENT_ID", "")
+	if issuer == "" || clientID == "" {
+		return nil
+	}
+	provisionRole := strings.ToLower(envHelper("KESPLORA_API_OIDC_PROVISION_ROLE", UserSystemRoleUser))
+	if provisionRole != "" && provisionRole != UserSystemRoleUser && provisionRole != UserSystemRoleAdmin {
+		fmt.Printf("\nKESPLORA_API_OIDC_PROVISION_ROLE must be user, admin, or blank; new accounts will not be provisioned\n")
+		provisionRole = ""
+	}
+	return newOIDCProvider(
+		issuer,
+		clientID,
+		envHelper("KESPLORA_API_OIDC_CLIENT_SECRET", ""),
+		envHelper("KESPLORA_API_OIDC_REDIRECT_URL", ""),
+		provisionRole,
+	)
+}
+
+func newOIDCProvider(issuer, clientID, clientSecret, redirectURL, provisionRole string) *oidcProvider {
+	return &oidcProvider{
+		Issuer:        issuer,
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+		RedirectURL:   redirectURL,
+		ProvisionRole: provisionRole,
+		Scopes:        []string{"openid", "email", "profile"},
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		keys: map[string]*jwtKey{},
+	}
+}
+
+// StartOIDCLogin creates the state, nonce, and PKCE verifier for a new login on the site and returns the URL at the
+// provider to send the user to
+func StartOIDCLogin(site *Site) (*OIDCLoginStart, error) {
+	if config.OIDC == nil {
+		return nil, errOIDCNotConfigured
+	}
+	state, err := randomSecureString(32)
+	if err != nil {
+		return nil, err
+	}
+	loginState := &oidcLoginState{}
+	loginState.Nonce, err = randomSecureString(32)
+	if err != nil {
+		return nil, err
+	}
+	loginState.Verifier, err = randomSecureString(32)
+	if err != nil {
+		return nil, err
+	}
+	loginState.RedirectURL, err = config.OIDC.getRedirectURL(site)
+	if err != nil {
+		return nil, err
+	}
+	authorizationURL, err := config.OIDC.getAuthorizationURL(loginState.RedirectURL, state, loginState.Nonce, loginState.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := json.Marshal(loginState)
+	err = config.CacheClient.Set(getOIDCStateCacheKey(state), string(data), oidcStateMinutes*time.Minute).Err()
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCLoginStart{
+		URL:     authorizationURL,
+		State:   state,
+		Expires: time.Now().Add(oidcStateMinutes * time.Minute).Format(timeFormatAPI),
+	}, nil
+}
+
+// CompleteOIDCLogin exchanges the code from the callback, validates the ID token, and finds or provisions the user on
+// the site. The state can only be used once
+func CompleteOIDCLogin(siteID int64, state, code string) (*User, error) {
+	if config.OIDC == nil {
+		return nil, errOIDCNotConfigured
+	}
+	key := getOIDCStateCacheKey(state)
+	data, err := config.CacheClient.Get(key).Result()
+	if err != nil || data == "" {
+		return nil, errOIDCBadState
+	}
+	config.CacheClient.Del(key)
+	loginState := &oidcLoginState{}
+	err = json.Unmarshal([]byte(data), loginState)
+	if err != nil {
+		return nil, errOIDCBadState
+	}
+
+	rawIDToken, err := config.OIDC.exchangeCode(loginState.RedirectURL, code, loginState.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := config.OIDC.validateIDToken(rawIDToken, loginState.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	return getUserForOIDCIdentity(siteID, identity, config.OIDC.ProvisionRole)
+}
+
+// getUserForOIDCIdentity maps the verified email to an existing user or creates one with the role. Since the provider
+// verified the email, existing users are marked verified and pending users are activated
+func getUserForOIDCIdentity(siteID int64, identity *oidcIdentity, provisionRole string) (*User, error) {
+	user, err := GetUserByEmail(siteID, identity.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		if provisionRole == "" {
+			return nil, errOIDCNoAccount
+		}
+		user = &User{
+			SiteID:        siteID,
+			FirstName:     identity.FirstName,
+			LastName:      identity.LastName,
+			Email:         identity.Email,
+			EmailVerified: Yes,
+			Status:        UserStatusActive,
+			SystemRole:    provisionRole,
+		}
+		// a random password that is never shared; the user can reset it if they ever need a local login
+		user.Password, err = randomSecureString(32)
+		if err != nil {
+			return nil, err
+		}
+		err = CreateUser(user)
+		if err != nil {
+			return nil, err
+		}
+		Log(LogLevelInfo, "oidc_user_provisioned", "user provisioned from single sign-on", &LogOptions{
+			ExtraData: map[string]interface{}{
+				"userId":  user.ID,
+				"subject": identity.Subject,
+			},
+		})
+		return user, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != UserStatusActive && user.Status != UserStatusPending {
+		return nil, errUserNotActive
+	}
+	if user.EmailVerified != Yes || user.Status == UserStatusPending {
+		user.EmailVerified = Yes
+		user.Status = UserStatusActive
+		err = UpdateUser(user)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// getDiscovery fetches and caches the provider's discovery document
+func (provider *oidcProvider) getDiscovery() (*oidcDiscovery, error) {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+	if provider.discovery != nil {
+		return provider.discovery, nil
+	}
+	discovery := &oidcDiscovery{}
+	err := provider.getJSON(provider.Issuer+"/.well-known/openid-configuration", discovery)
+	if err != nil {
+		return nil, err
+	}
+	// the issuer must match exactly, or the ID tokens would not validate
+	if strings.TrimSuffix(discovery.Issuer, "/") != provider.Issuer || discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: discovery document does not match the issuer", errOIDCFailed)
+	}
+	provider.discovery = discovery
+	return discovery, nil
+}
+
+// getRedirectURL gets the client page the provider sends the user back to. Unless one is configured, it is on the
+// site's client, so each site's users come back to their own site
+func (provider *oidcProvider) getRedirectURL(site *Site) (string, error) {
+	if provider.RedirectURL != "" {
+		return provider.RedirectURL, nil
+	}
+	address, err := getSiteClientAddress(site)
+	if err != nil {
+		return "", err
+	}
+	return address + "/login/oidc/callback", nil
+}
+
+// getAuthorizationURL builds the URL at the provider using the authorization code flow with an S256 PKCE challenge
+func (provider *oidcProvider) getAuthorizationURL(redirectURL, state, nonce, verifier string) (string, error) {
+	discovery, err := provider.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	values := url.Values{}
+	values.Set("response_type", "code")
+	values.Set("client_id", provider.ClientID)
+	values.Set("redirect_uri", redirectURL)
+	values.Set("scope", strings.Join(provider.Scopes, " "))
+	values.Set("state", state)
+	values.Set("nonce", nonce)
+	values.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	values.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + values.Encode(), nil
+}
+
+// exchangeCode trades the authorization code for the provider's tokens and returns the raw ID token
+func (provider *oidcProvider) exchangeCode(redirectURL, code, verifier string) (string, error) {
+	discovery, err := provider.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+	values := url.Values{}
+	values.Set("grant_type", "authorization_code")
+	values.Set("code", code)
+	values.Set("redirect_uri", redirectURL)
+	values.Set("client_id", provider.ClientID)
+	values.Set("code_verifier", verifier)
+
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if provider.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(provider.ClientID), url.QueryEscape(provider.ClientSecret))
+	}
+	res, err := provider.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errOIDCFailed, err)
+	}
+	defer res.Body.Close()
+
+	body := struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+	json.NewDecoder(res.Body).Decode(&body)
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: token endpoint returned %d %s %s", errOIDCFailed, res.StatusCode, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("%w: no id_token in the response", errOIDCFailed)
+	}
+	return body.IDToken, nil
+}
+
+// validateIDToken checks the signature, issuer, audience, expiration, and nonce of the ID token, and that it has a
+// verified email
+func (provider *oidcProvider) validateIDToken(rawIDToken, nonce string) (*oidcIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, provider.getKeyForToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errOIDCBadIDToken, err)
+	}
+	if _, found := claims["exp"]; !found {
+		return nil, fmt.Errorf("%w: missing exp", errOIDCBadIDToken)
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != provider.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer", errOIDCBadIDToken)
+	}
+	audiences := []string{}
+	switch aud := claims["aud"].(type) {
+	case string:
+		audiences = append(audiences, aud)
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+	foundAudience := false
+	for _, aud := range audiences {
+		if aud == provider.ClientID {
+			foundAudience = true
+		}
+	}
+	if !foundAudience {
+		return nil, fmt.Errorf("%w: unexpected audience", errOIDCBadIDToken)
+	}
+	// with several audiences, the authorized party must be us
+	if azp, found := claims["azp"].(string); len(audiences) > 1 && (!found || azp != provider.ClientID) {
+		return nil, fmt.Errorf("%w: unexpected authorized party", errOIDCBadIDToken)
+	}
+	if claimNonce, _ := claims["nonce"].(string); nonce == "" || claimNonce != nonce {
+		return nil, fmt.Errorf("%w: nonce does not match", errOIDCBadIDToken)
+	}
+
+	identity := &oidcIdentity{}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Email = strings.TrimSpace(identity.Email)
+	identity.FirstName, _ = claims["given_name"].(string)
+	identity.LastName, _ = claims["family_name"].(string)
+	if identity.FirstName == "" && identity.LastName == "" {
+		name, _ := claims["name"].(string)
+		parts := strings.SplitN(strings.TrimSpace(name), " ", 2)
+		identity.FirstName = parts[0]
+		if len(parts) > 1 {
+			identity.LastName = parts[1]
+		}
+	}
+	// some providers send the flag as a string
+	emailVerified := false
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		emailVerified = verified
+	case string:
+		emailVerified = verified == "true"
+	}
+	if identity.Subject == "" || identity.Email == "" || !emailVerified {
+		return nil, errOIDCNoEmail
+	}
+	return identity, nil
+}
+
+// getKeyForToken finds the provider's key for the ID token. If the kid is unknown, the keys are fetched again once in
+// case the provider rotated them
+func (provider *oidcProvider) getKeyForToken(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := provider.getKey(kid, false)
+	if errors.Is(err, errJWTUnknownKey) {
+		key, err = provider.getKey(kid, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// only asymmetric algorithms are accepted, and the token must use the key's algorithm
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errJWTUnknownKey
+	}
+	return key.Public, nil
+}
+
+func (provider *oidcProvider) getKey(kid string, refresh bool) (*jwtKey, error) {
+	discovery, err := provider.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+	if refresh || len(provider.keys) == 0 {
+		jwks := &JWKS{}
+		err = provider.getJSON(discovery.JWKSURI, jwks)
+		if err != nil {
+			return nil, err
+		}
+		keys := map[string]*jwtKey{}
+		for _, jwk := range jwks.Keys {
+			if jwk.Use != "" && jwk.Use != "sig" {
+				continue
+			}
+			key, err := parseJWK(jwk)
+			if err == nil {
+				keys[key.ID] = key
+			}
+		}
+		provider.keys = keys
+	}
+	if key, found := provider.keys[kid]; found {
+		return key, nil
+	}
+	// providers with a single key sometimes leave off the kid
+	if kid == "" && len(provider.keys) == 1 {
+		for _, key := range provider.keys {
+			return key, nil
+		}
+	}
+	return nil, errJWTUnknownKey
+}
+
+func (provider *oidcProvider) getJSON(address string, target interface{}) error {
+	res, err := provider.client.Get(address)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errOIDCFailed, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned %d", errOIDCFailed, address, res.StatusCode)
+	}
+	err = json.NewDecoder(res.Body).Decode(target)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errOIDCFailed, err)
+	}
+	return nil
+}
+
+// parseJWK converts a public key from a provider's key set. RSA, P-256, and Ed25519 keys are supported
+func parseJWK(jwk JWK) (*jwtKey, error) {
+	key := &jwtKey{
+		ID: jwk.KeyID,
+	}
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		key.Public = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		key.Method = jwt.SigningMethodRS256
+		if jwk.Algorithm != "" {
+			key.Method = jwt.GetSigningMethod(jwk.Algorithm)
+			if _, ok := key.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, errJWTKeyNotValid
+			}
+		}
+	case "EC":
+		if jwk.Curve != "P-256" {
+			return nil, errJWTKeyNotValid
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key.Public = &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		key.Method = jwt.SigningMethodES256
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return nil, errJWTKeyNotValid
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errJWTKeyNotValid
+		}
+		key.Public = ed25519.PublicKey(x)
+		key.Method = jwtSigningMethodEdDSA
+	default:
+		return nil, errJWTKeyNotValid
+	}
+	return key, nil
+}
+
+func getOIDCStateCacheKey(state string) string {
+	return fmt.Sprintf("oidc_state_%s", state)
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	mockOIDCClientID     = "kesplora"
+	mockOIDCClientSecret = "mock_secret"
+	mockOIDCRedirectURL  = "http://localhost/login/oidc/callback"
+)
+
+// mockOIDCServer is a local identity provider for tests. It supports discovery, the authorization code flow with
+// PKCE, and serves its keys so ID tokens can be validated
+type mockOIDCServer struct {
+	Server        *httptest.Server
+	Email         string
+	EmailVerified bool
+	Audience      string // defaults to the client id
+
+	lock  sync.Mutex
+	key   *jwtKey
+	codes map[string]mockOIDCCode
+}
+
+type mockOIDCCode struct {
+	Challenge string
+	Nonce     string
+}
+
+func newMockOIDCServer(t *testing.T) *mockOIDCServer {
+	mock := &mockOIDCServer{
+		Email:         fmt.Sprintf("oidc_%d@kesplora.com", mathrand.Int63n(99999999999999)),
+		EmailVerified: true,
+		codes:         map[string]mockOIDCCode{},
+	}
+	mock.RotateKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 mock.Server.URL,
+			"authorization_endpoint": mock.Server.URL + "/authorize",
+			"token_endpoint":         mock.Server.URL + "/token",
+			"jwks_uri":               mock.Server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		mock.lock.Lock()
+		defer mock.lock.Unlock()
+		jwk := mock.key.toJWK()
+		jwk.KeyID = mock.key.ID
+		json.NewEncoder(w).Encode(JWKS{Keys: []JWK{jwk}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("client_id") != mockOIDCClientID || query.Get("redirect_uri") != mockOIDCRedirectURL || query.Get("code_challenge_method") != "S256" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		code, _ := randomSecureString(32)
+		mock.lock.Lock()
+		mock.codes[code] = mockOIDCCode{
+			Challenge: query.Get("code_challenge"),
+			Nonce:     query.Get("nonce"),
+		}
+		mock.lock.Unlock()
+		values := url.Values{}
+		values.Set("code", code)
+		values.Set("state", query.Get("state"))
+		http.Redirect(w, r, mockOIDCRedirectURL+"?"+values.Encode(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, _ := r.BasicAuth()
+		r.ParseForm()
+		mock.lock.Lock()
+		code := r.PostForm.Get("code")
+		found, ok := mock.codes[code]
+		delete(mock.codes, code)
+		mock.lock.Unlock()
+		challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if clientID != mockOIDCClientID || clientSecret != mockOIDCClientSecret || !ok || found.Challenge != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": code + "_access",
+			"token_type":   "Bearer",
+			"id_token":     mock.SignIDToken(t, found.Nonce, time.Now().Add(5*time.Minute)),
+		})
+	})
+	mock.Server = httptest.NewServer(mux)
+	t.Cleanup(mock.Server.Close)
+	return mock
+}
+
+// RotateKey replaces the provider's signing key
+func (mock *mockOIDCServer) RotateKey(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	key, err := newJWTKey(private)
+	require.Nil(t, err)
+	mock.lock.Lock()
+	mock.key = key
+	mock.lock.Unlock()
+}
+
+// SignIDToken creates an ID token for the mock's current email
+func (mock *mockOIDCServer) SignIDToken(t *testing.T, nonce string, expires time.Time) string {
+	audience := mock.Audience
+	if audience == "" {
+		audience = mockOIDCClientID
+	}
+	token := jwt.NewWithClaims(mock.key.Method, jwt.MapClaims{
+		"iss":            mock.Server.URL,
+		"sub":            "sub_" + mock.Email,
+		"aud":            []string{audience},
+		"exp":            expires.Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          mock.Email,
+		"email_verified": mock.EmailVerified,
+		"given_name":     "Campus",
+		"family_name":    "Researcher",
+	})
+	token.Header["kid"] = mock.key.ID
+	signed, err := token.SignedString(mock.key.Private)
+	require.Nil(t, err)
+	return signed
+}
+
+// Authorize follows the authorization URL as if the user logged in at the provider and returns the code and state
+// sent to the redirect URL
+func (mock *mockOIDCServer) Authorize(t *testing.T, authorizationURL string) (code string, state string) {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	res, err := client.Get(authorizationURL)
+	require.Nil(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusFound, res.StatusCode)
+	location, err := url.Parse(res.Header.Get("Location"))
+	require.Nil(t, err)
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func (mock *mockOIDCServer) Provider(provisionRole string) *oidcProvider {
+	return newOIDCProvider(mock.Server.URL, mockOIDCClientID, mockOIDCClientSecret, mockOIDCRedirectURL, provisionRole)
+}
+
+func TestOIDCProviderFlow(t *testing.T) {
+	mock := newMockOIDCServer(t)
+	provider := mock.Provider(UserSystemRoleUser)
+
+	authorizationURL, err := provider.getAuthorizationURL(provider.RedirectURL, "state1", "nonce1", "verifier1")
+	require.Nil(t, err)
+	parsed, err := url.Parse(authorizationURL)
+	require.Nil(t, err)
+	assert.Equal(t, "openid email profile", parsed.Query().Get("scope"))
+	assert.NotEqual(t, "verifier1", parsed.Query().Get("code_challenge"))
+
+	code, state := mock.Authorize(t, authorizationURL)
+	assert.Equal(t, "state1", state)
+
+	// the verifier must match the challenge
+	_, err = provider.exchangeCode(provider.RedirectURL, code, "verifier2")
+	assert.ErrorIs(t, err, errOIDCFailed)
+
+	code, _ = mock.Authorize(t, authorizationURL)
+	rawIDToken, err := provider.exchangeCode(provider.RedirectURL, code, "verifier1")
+	require.Nil(t, err)
+
+	_, err = provider.validateIDToken(rawIDToken, "nonce2")
+	assert.ErrorIs(t, err, errOIDCBadIDToken)
+	identity, err := provider.validateIDToken(rawIDToken, "nonce1")
+	require.Nil(t, err)
+	assert.Equal(t, mock.Email, identity.Email)
+	assert.Equal(t, "Campus", identity.FirstName)
+	assert.Equal(t, "Researcher", identity.LastName)
+
+	// a rotated key is picked up without restarting
+	mock.RotateKey(t)
+	_, err = provider.validateIDToken(mock.SignIDToken(t, "nonce1", time.Now().Add(time.Minute)), "nonce1")
+	assert.Nil(t, err)
+	// but the old token is no longer signed with a published key
+	_, err = provider.validateIDToken(rawIDToken, "nonce1")
+	assert.ErrorIs(t, err, errOIDCBadIDToken)
+
+	// expired
+	_, err = provider.validateIDToken(mock.SignIDToken(t, "nonce1", time.Now().Add(-1*time.Minute)), "nonce1")
+	assert.ErrorIs(t, err, errOIDCBadIDToken)
+
+	// another client's token
+	mock.Audience = "someone_else"
+	_, err = provider.validateIDToken(mock.SignIDToken(t, "nonce1", time.Now().Add(time.Minute)), "nonce1")
+	assert.ErrorIs(t, err, errOIDCBadIDToken)
+	mock.Audience = ""
+
+	// the email must be verified by the provider
+	mock.EmailVerified = false
+	_, err = provider.validateIDToken(mock.SignIDToken(t, "nonce1", time.Now().Add(time.Minute)), "nonce1")
+	assert.ErrorIs(t, err, errOIDCNoEmail)
+	mock.EmailVerified = true
+
+	// a token signed with a shared secret is not accepted, even with a known kid
+	hsToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":            mock.Server.URL,
+		"sub":            "sub",
+		"aud":            mockOIDCClientID,
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          "nonce1",
+		"email":          mock.Email,
+		"email_verified": true,
+	})
+	hsToken.Header["kid"] = mock.key.ID
+	signed, err := hsToken.SignedString([]byte(mockOIDCClientSecret))
+	require.Nil(t, err)
+	_, err = provider.validateIDToken(signed, "nonce1")
+	assert.ErrorIs(t, err, errOIDCBadIDToken)
+}
+
+func TestOIDCParseJWK(t *testing.T) {
+	_, err := parseJWK(JWK{KeyType: "oct", KeyID: "secret"})
+	assert.ErrorIs(t, err, errJWTKeyNotValid)
+	_, err = parseJWK(JWK{KeyType: "EC", Curve: "P-521"})
+	assert.ErrorIs(t, err, errJWTKeyNotValid)
+	_, err = parseJWK(JWK{KeyType: "RSA", N: "AQAB", E: "AQAB", Algorithm: "HS256"})
+	assert.ErrorIs(t, err, errJWTKeyNotValid)
+
+	key, err := parseJWK(JWK{
+		KeyType: "EC",
+		KeyID:   "ec",
+		Curve:   "P-256",
+		X:       "f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU",
+		Y:       "x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0",
+	})
+	require.Nil(t, err)
+	assert.Equal(t, "ES256", key.Method.Alg())
+}
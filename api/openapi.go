@@ -0,0 +1,747 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/go-chi/chi"
+)
+
+const (
+	openAPIVersion = "3.0.3"
+
+	// openAPIBodyMaxBytes is the largest JSON body that is validated; larger bodies are left to the route
+	openAPIBodyMaxBytes = 1024 * 1024
+)
+
+// OpenAPIDocument is the OpenAPI 3 description of the API. It is built from the router, so every route is listed, and
+// the request and response bodies come from openAPIRoutes
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema         `json:"schemas"`
+	SecuritySchemes map[string]*openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+type openAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Tags        []string                    `json:"tags"`
+	Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Schema   *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Content map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+// openAPISchema is the subset of a JSON schema the structs need
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	OneOf                []*openAPISchema          `json:"oneOf,omitempty"`
+}
+
+// openAPIRoute describes the bodies of a route, which can't be learned from the router. Routes without an entry are
+// listed with a JSON response of any shape
+type openAPIRoute struct {
+	Request     interface{} // the JSON body
+	Response    interface{} // the data in the response
+	Status      int         // the success status; 200 if not set
+	Upload      bool        // the body is a multipart form with a file
+	ContentType string      // the response is this type instead of JSON
+}
+
+// openAPIRoutes maps the route's handler name to its bodies. A handler used on several paths, such as the admin and
+// researcher copies of a route, shares the entry
+var openAPIRoutes = map[string]openAPIRoute{
+	// status
+	"routeApiStatusReady":       {Response: map[string]string{}},
+	"routeApiStatusLive":        {Response: map[string]string{}},
+	"routeApiStatusHealthReady": {Response: map[string]HealthCheck{}},
+	"routeMetrics":              {ContentType: "text/plain"},
+	"routeAllGetJWKS":           {Response: JWKS{}},
+	"routeOpenAPISpec":          {ContentType: "application/json"},
+
+	// site and setup
+	"routeAllGetSite":               {Response: Site{}},
+	"routeAllGetSiteConfiguration":  {Response: map[string]interface{}{}},
+	"routeAllConfigureSite":         {Request: siteConfigurationInput{}, Response: map[string]interface{}{}},
+	"routeAdminUpdateSite":          {Request: Site{}, Response: Site{}},
+	"routeAdminGetEmailTemplates":   {Response: []EmailTemplate{}},
+	"routeAdminGetEmailTemplate":    {Response: EmailTemplate{}},
+	"routeAdminSaveEmailTemplate":   {Request: EmailTemplate{}, Response: EmailTemplate{}},
+	"routeAdminDeleteEmailTemplate": {Response: EmailTemplate{}},
+
+	// users and accounts
+	"routeAllUserLogin":                  {Request: loginInput{}, Response: User{}},
+	"routeAllUserLoginMFA":               {Request: mfaLoginInput{}, Response: User{}},
+	"routeAllStartOIDCLogin":             {Response: OIDCLoginStart{}},
+	"routeAllCompleteOIDCLogin":          {Request: oidcCallbackInput{}, Response: User{}},
+	"routeAllUserLogout":                 {Response: map[string]bool{}},
+	"routeAllGetUserProfile":             {Response: User{}},
+	"routeAllUpdateUserProfile":          {Request: User{}, Response: User{}},
+	"routeAllUserRefreshAccess":          {Request: refreshTokenInput{}, Response: User{}},
+	"routeAllGetUserSessions":            {Response: []Session{}},
+	"routeAllDeleteUserSession":          {Response: map[string]bool{}},
+	"routeAllStartMFAEnrollment":         {Response: MFAEnrollment{}},
+	"routeAllConfirmMFAEnrollment":       {Request: mfaCodeInput{}, Response: map[string]interface{}{}},
+	"routeAllRegenerateMFARecoveryCodes": {Request: mfaCodeInput{}, Response: map[string]interface{}{}},
+	"routeAllDisableMFA":                 {Request: mfaCodeInput{}, Response: map[string]string{}},
+	"routeAllGetAPIKeys":                 {Response: []APIKey{}},
+	"routeAllCreateAPIKey":               {Request: APIKey{}, Response: APIKey{}, Status: http.StatusCreated},
+	"routeAllDeleteAPIKey":               {Response: map[string]bool{}},
+	"routeAllRequestPasswordReset":       {Request: passwordResetInput{}, Response: map[string]bool{}},
+	"routeAllConfirmPasswordReset":       {Request: passwordResetInput{}, Response: map[string]bool{}},
+	"routeAllConfirmEmailVerification":   {Request: emailVerificationInput{}, Response: User{}},
+	"routeAllResendEmailVerification":    {Request: emailVerificationInput{}, Response: map[string]bool{}},
+	"routeAllAcceptInvitation":           {Request: invitationAcceptInput{}, Response: User{}},
+	"routeAdminGetUsersOnPlatform":       {Response: []User{}},
+	"routeAdminGetUserOnPlatform":        {Response: User{}},
+	"routeAdminUpdateUser":               {Request: User{}, Response: User{}},
+	"routeAdminInviteUser":               {Request: adminInviteUserInput{}, Response: User{}, Status: http.StatusCreated},
+	"routeAdminResendUserInvitation":     {Request: adminInviteUserInput{}, Response: map[string]bool{}},
+	"routeAdminForceUserPasswordReset":   {Response: map[string]bool{}},
+	"routeAdminUnlockUser":               {Response: User{}},
+	"routeAdminResetUserMFA":             {Response: map[string]string{}},
+	"routeAdminGetUserSessions":          {Response: []Session{}},
+	"routeAdminRevokeUserSessions":       {Response: map[string]bool{}},
+	"routeAdminExportUser":               {ContentType: "application/zip"},
+	"routeAdminEraseUser":                {Response: ErasureReceipt{}},
+	"routeAdminEraseUserFromProject":     {Response: ErasureReceipt{}},
+	"routeAdminGetErasureReceipts":       {Response: []ErasureReceipt{}},
+	"routeAdminGetErasureReceipt":        {Response: ErasureReceipt{}},
+	"routeAdminGetAuditEvents":           {Response: []AuditEvent{}},
+	"routeAdminVerifyAuditEvents":        {Response: AuditChainVerification{}},
+
+	// projects
+	"routeAllGetProjects":                   {Response: []ProjectAPIReturnNonAdmin{}},
+	"routeAllGetProject":                    {Response: ProjectAPIReturnNonAdmin{}},
+	"routeAllGetConsentForm":                {Response: ConsentForm{}},
+	"routeAllCreateConsentResponse":         {Request: ConsentResponse{}, Response: ConsentResponse{}},
+	"routeAdminGetProjects":                 {Response: []Project{}},
+	"routeResearcherGetProjects":            {Response: []Project{}},
+	"routeAdminCreateProject":               {Request: Project{}, Response: Project{}, Status: http.StatusCreated},
+	"routeAdminGetProject":                  {Response: Project{}},
+	"routeAdminUpdateProject":               {Request: Project{}, Response: Project{}},
+	"routeAdminCreateParticipantBatch":      {Request: ParticipantBatchRequest{}, Response: []ParticipantBatchCredential{}, Status: http.StatusCreated},
+	"routeAdminSendProjectReminders":        {Request: projectReminderInput{}, Response: map[string]int{}},
+	"routeAdminGetProjectCollaborators":     {Response: []ProjectCollaborator{}},
+	"routeAdminSaveProjectCollaborator":     {Request: ProjectCollaborator{}, Response: ProjectCollaborator{}},
+	"routeAdminDeleteProjectCollaborator":   {Response: map[string]bool{}},
+	"routeAdminSaveConsentForm":             {Request: ConsentForm{}, Response: ConsentForm{}},
+	"routeAdminDeleteConsentForm":           {Response: map[string]bool{}},
+	"routeAdminGetConsentResponses":         {Response: []ConsentResponse{}},
+	"routeAdminGetConsentResponse":          {Response: ConsentResponse{}},
+	"routeAdminDeleteConsentResponse":       {Response: map[string]bool{}},
+	"routeAdminGetUsersOnProject":           {Response: []User{}},
+	"routeAdminGetProjectsForUser":          {Response: []Project{}},
+	"routeAdminGetProjectForUser":           {Response: []Flow{}},
+	"routeAdminLinkUserAndProject":          {Response: map[string]bool{}},
+	"routeAdminUnlinkUserAndProject":        {Response: map[string]bool{}},
+	"routeAdminLinkModuleAndProject":        {Response: map[string]bool{}},
+	"routeAdminUnlinkModuleAndProject":      {Response: map[string]bool{}},
+	"routeAdminUnlinkAllModulesFromProject": {Response: map[string]bool{}},
+
+	// modules and blocks
+	"routeAdminGetAllSiteModules":         {Response: []Module{}},
+	"routeAdminGetModulesOnProject":       {Response: []Module{}},
+	"routeAdminCreateModule":              {Request: Module{}, Response: Module{}, Status: http.StatusCreated},
+	"routeAdminGetModuleByID":             {Response: Module{}},
+	"routeAdminUpdateModule":              {Request: Module{}, Response: Module{}},
+	"routeAdminDeleteModule":              {Response: map[string]bool{}},
+	"routeAdminGetBlocksOnSite":           {Response: []Block{}},
+	"routeAdminGetBlocksForModule":        {Response: []Block{}},
+	"routeAdminCreateBlock":               {Request: Block{}, Response: Block{}, Status: http.StatusCreated},
+	"routeAdminGetBlock":                  {Response: Block{}},
+	"routeAdminUpdateBlock":               {Request: Block{}, Response: Block{}},
+	"routeAdminDeleteBlock":               {Response: map[string]bool{}},
+	"routeAdminLinkBlockAndModule":        {Response: map[string]bool{}},
+	"routeAdminUnlinkBlockAndModule":      {Response: map[string]bool{}},
+	"routeAdminUnlinkAllBlocksFromModule": {Response: map[string]bool{}},
+	"routeAdminGetUserSubmissions":        {Response: []BlockFormSubmission{}},
+	"routeAdminGetUserSubmission":         {Response: BlockFormSubmission{}},
+	"routeAdminDeleteUserSubmissions":     {Response: map[string]bool{}},
+	"routeAdminDeleteUserSubmission":      {Response: map[string]bool{}},
+
+	// files
+	"routeAdminGetFiles":        {Response: []File{}},
+	"routeAdminUploadFile":      {Upload: true, Response: File{}, Status: http.StatusCreated},
+	"routeAdminGetFileMetaData": {Response: File{}},
+	"routeUpdateFileMetadata":   {Request: File{}, Response: File{}},
+	"routeAdminReplaceFile":     {Upload: true, Response: File{}, Status: http.StatusCreated},
+	"routeAdminDownloadFile":    {ContentType: "application/octet-stream"},
+	"routeAdminDeleteFile":      {Response: map[string]bool{}},
+
+	// notes
+	"routeAllGetMyNotes":       {Response: []Note{}},
+	"routeAllCreateNote":       {Request: Note{}, Response: Note{}, Status: http.StatusCreated},
+	"routeAllGetMyNoteByID":    {Response: Note{}},
+	"routeAllUpdateNoteByID":   {Request: Note{}, Response: Note{}},
+	"routeAllDeleteMyNoteByID": {Response: map[string]bool{}},
+
+	// reports
+	"routeAdminReportGetCountOfUsersOnProjectByStatus": {Response: []ReportValueCount{}},
+	"routeAdminReportGetCountOfLastUpdatedForProject":  {Response: []ReportUserLastUpdatedAgo{}},
+	"routeAdminReportGetCountOfStatusForProject":       {Response: []ReportBlockStatusCount{}},
+	"routeAdminReportGetSubmissionCountForProject":     {Response: []ReportSubmissionCount{}},
+	"routeAdminReportGetProjectSubmissionResponses":    {Response: ReportSubmissionResponses{}},
+	"routeAdminReportExportProjectSubmissionResponses": {ContentType: "text/csv"},
+
+	// participants
+	"routeParticipantEraseAccount":          {Response: ErasureReceipt{}},
+	"routeParticipantExport":                {ContentType: "application/zip"},
+	"routeParticipantGetProjects":           {Response: []ProjectAPIReturnNonAdmin{}},
+	"routeParticipantGetProject":            {Response: ProjectAPIReturnNonAdmin{}},
+	"routeParticipantUnlinkUserAndProject":  {Response: map[string]bool{}},
+	"routeParticipantGetProjectFlow":        {Response: []Flow{}},
+	"routeParticipantGetConsentResponse":    {Response: ConsentResponse{}},
+	"routeParticipantDeleteConsentResponse": {Response: map[string]bool{}},
+	"routeParticipantGetBlock":              {Response: Block{}},
+	"routeParticipantSaveBlockStatus":       {Response: BlockUserStatus{}},
+	"routeParticipantRemoveBlockStatus":     {Response: map[string]bool{}},
+	"routeParticipantSaveFormResponse":      {Request: BlockFormQestionResponseInput{}, Response: BlockFormSubmission{}},
+	"routeParticipantGetFormSubmissions":    {Response: []BlockFormSubmission{}},
+	"routeParticipantDeleteSubmissions":     {Response: map[string]bool{}},
+	"routeParticipantDeleteSubmission":      {Response: map[string]bool{}},
+	"routeParticipantGetFileMetaData":       {Response: File{}},
+	"routeParticipantDownloadFile":          {ContentType: "application/octet-stream"},
+}
+
+// openAPIInterfaceFields lists what an interface field can hold, keyed by the struct and JSON field name
+var openAPIInterfaceFields = map[string][]interface{}{
+	"Block.content": {BlockExternal{}, BlockEmbed{}, BlockForm{}, BlockText{}, BlockFile{}},
+}
+
+// the document only changes when the routes do, so it is built once for the router
+var openAPISpecCache = struct {
+	sync.Mutex
+	router *chi.Mux
+	doc    *OpenAPIDocument
+}{}
+
+// getOpenAPISpec gets the document for the API's router
+func getOpenAPISpec() (*OpenAPIDocument, error) {
+	router := SetupAPI()
+	openAPISpecCache.Lock()
+	defer openAPISpecCache.Unlock()
+	if openAPISpecCache.router == router {
+		return openAPISpecCache.doc, nil
+	}
+	doc, err := buildOpenAPISpec(router)
+	if err != nil {
+		return nil, err
+	}
+	openAPISpecCache.router = router
+	openAPISpecCache.doc = doc
+	return doc, nil
+}
+
+// buildOpenAPISpec walks the router and describes each route
+func buildOpenAPISpec(routes chi.Routes) (*OpenAPIDocument, error) {
+	doc := &OpenAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info: openAPIInfo{
+			Title:       "Kesplora API",
+			Description: "Successful responses wrap the result in data; errors send the error key, a message, and any data about the error.",
+			Version:     apiVersion,
+		},
+		Paths: map[string]map[string]*openAPIOperation{},
+		Components: openAPIComponents{
+			Schemas: map[string]*openAPISchema{
+				"APIError": {
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"error":   {Type: "string"},
+						"message": {Type: "string"},
+						"data":    {},
+					},
+				},
+			},
+			SecuritySchemes: map[string]*openAPISecurityScheme{
+				"bearerAuth": {
+					Type:         "http",
+					Scheme:       "bearer",
+					BearerFormat: "JWT",
+				},
+				"cookieAuth": {
+					Type: "apiKey",
+					In:   "cookie",
+					Name: tokenTypeAccess,
+				},
+				"apiKeyAuth": {
+					Type:        "apiKey",
+					In:          "header",
+					Name:        "Authorization",
+					Description: "ApiKey followed by the key; only for /admin and /researcher routes",
+				},
+			},
+		},
+	}
+	operationIDs := map[string]bool{}
+	err := chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		path := getOpenAPIPath(route)
+		name := getOpenAPIHandlerName(handler)
+		operation := &openAPIOperation{
+			OperationID: getOpenAPIOperationID(operationIDs, name, method, path),
+			Tags:        []string{getOpenAPITag(path)},
+			Parameters:  getOpenAPIPathParameters(path),
+			Security:    getOpenAPISecurity(path),
+			Responses: map[string]*openAPIResponse{
+				"default": {
+					Description: "an error",
+					Content: map[string]*openAPIMediaType{
+						"application/json": {Schema: &openAPISchema{Ref: "#/components/schemas/APIError"}},
+					},
+				},
+			},
+		}
+		described, ok := openAPIRoutes[name]
+		status := http.StatusOK
+		if described.Status != 0 {
+			status = described.Status
+		}
+		response := &openAPIResponse{
+			Description: "success",
+		}
+		switch {
+		case described.ContentType == "application/json":
+			response.Content = map[string]*openAPIMediaType{
+				"application/json": {Schema: &openAPISchema{Type: "object"}},
+			}
+		case described.ContentType != "":
+			response.Content = map[string]*openAPIMediaType{
+				described.ContentType: {Schema: &openAPISchema{Type: "string", Format: "binary"}},
+			}
+		default:
+			data := &openAPISchema{}
+			if ok && described.Response != nil {
+				data = doc.schemaForType(reflect.TypeOf(described.Response))
+			}
+			response.Content = map[string]*openAPIMediaType{
+				"application/json": {Schema: &openAPISchema{
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"data": data,
+					},
+				}},
+			}
+		}
+		operation.Responses[fmt.Sprintf("%d", status)] = response
+
+		if described.Request != nil {
+			operation.RequestBody = &openAPIRequestBody{
+				Content: map[string]*openAPIMediaType{
+					"application/json": {Schema: doc.schemaForType(reflect.TypeOf(described.Request))},
+				},
+			}
+		} else if described.Upload {
+			operation.RequestBody = &openAPIRequestBody{
+				Content: map[string]*openAPIMediaType{
+					"multipart/form-data": {Schema: &openAPISchema{
+						Type: "object",
+						Properties: map[string]*openAPISchema{
+							"file": {Type: "string", Format: "binary"},
+						},
+					}},
+				},
+			}
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*openAPIOperation{}
+		}
+		doc.Paths[path][strings.ToLower(method)] = operation
+		return nil
+	})
+	return doc, err
+}
+
+// getOpenAPIPath removes the trailing slash chi leaves on the root of a sub router
+func getOpenAPIPath(route string) string {
+	route = strings.TrimSuffix(route, "/*")
+	if len(route) > 1 {
+		route = strings.TrimSuffix(route, "/")
+	}
+	if route == "" {
+		return "/"
+	}
+	return route
+}
+
+// getOpenAPIHandlerName gets the name of the route's function, such as routeAdminGetProject, looking through any
+// middleware added with With
+func getOpenAPIHandlerName(handler http.Handler) string {
+	for {
+		chain, ok := handler.(*chi.ChainHandler)
+		if !ok {
+			break
+		}
+		handler = chain.Endpoint
+	}
+	fn, ok := handler.(http.HandlerFunc)
+	if !ok {
+		return ""
+	}
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	name = name[strings.LastIndex(name, ".")+1:]
+	if strings.HasPrefix(name, "func") {
+		// a closure, such as the not implemented placeholder
+		return ""
+	}
+	return name
+}
+
+// getOpenAPIOperationID uses the handler's name, adding the first part of the path when the handler serves more than
+// one route, such as routeAdminGetProject_researcher
+func getOpenAPIOperationID(taken map[string]bool, name, method, path string) string {
+	id := name
+	if id == "" {
+		id = strings.ToLower(method) + strings.NewReplacer("/", "_", "{", "", "}", "").Replace(path)
+	}
+	if taken[id] {
+		id = id + "_" + getOpenAPITag(path)
+	}
+	for i := 2; taken[id]; i++ {
+		id = fmt.Sprintf("%s_%d", id, i)
+	}
+	taken[id] = true
+	return id
+}
+
+// getOpenAPITag groups routes by the first part of the path
+func getOpenAPITag(path string) string {
+	first := strings.Split(strings.Trim(path, "/"), "/")[0]
+	if first == "" {
+		return "status"
+	}
+	return first
+}
+
+// getOpenAPIPathParameters lists the path's parameters; ids are integers
+func getOpenAPIPathParameters(path string) []*openAPIParameter {
+	parameters := []*openAPIParameter{}
+	for _, part := range strings.Split(path, "/") {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			continue
+		}
+		name := strings.Trim(part, "{}")
+		schema := &openAPISchema{Type: "string"}
+		if strings.HasSuffix(name, "ID") {
+			schema = &openAPISchema{Type: "integer", Format: "int64"}
+		}
+		parameters = append(parameters, &openAPIParameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   schema,
+		})
+	}
+	return parameters
+}
+
+// getOpenAPISecurity gets how a route can be authenticated; routes outside of these handle a missing login themselves
+func getOpenAPISecurity(path string) []map[string][]string {
+	switch getOpenAPITag(path) {
+	case "admin", "researcher":
+		return []map[string][]string{{"bearerAuth": {}}, {"cookieAuth": {}}, {"apiKeyAuth": {}}}
+	case "participant", "me", "logout":
+		return []map[string][]string{{"bearerAuth": {}}, {"cookieAuth": {}}}
+	}
+	return nil
+}
+
+// schemaForType describes a Go type. Structs are added to the components by name and referenced
+func (doc *OpenAPIDocument) schemaForType(t reflect.Type) *openAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &openAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &openAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &openAPISchema{Type: "string", Format: "byte"}
+		}
+		return &openAPISchema{Type: "array", Items: doc.schemaForType(t.Elem())}
+	case reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: doc.schemaForType(t.Elem())}
+	case reflect.Struct:
+		name := getOpenAPISchemaName(t)
+		ref := &openAPISchema{Ref: "#/components/schemas/" + name}
+		if _, ok := doc.Components.Schemas[name]; ok {
+			return ref
+		}
+		// added before the fields so a struct that refers to itself doesn't loop
+		schema := &openAPISchema{
+			Type:       "object",
+			Properties: map[string]*openAPISchema{},
+		}
+		doc.Components.Schemas[name] = schema
+		doc.addStructProperties(schema, t)
+		return ref
+	}
+	// interfaces can hold anything
+	return &openAPISchema{}
+}
+
+// addStructProperties adds the struct's JSON fields, including those of embedded structs
+func (doc *OpenAPIDocument) addStructProperties(schema *openAPISchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				doc.addStructProperties(schema, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if options, ok := openAPIInterfaceFields[getOpenAPISchemaName(t)+"."+name]; ok {
+			oneOf := &openAPISchema{}
+			for _, option := range options {
+				oneOf.OneOf = append(oneOf.OneOf, doc.schemaForType(reflect.TypeOf(option)))
+			}
+			schema.Properties[name] = oneOf
+			continue
+		}
+		schema.Properties[name] = doc.schemaForType(field.Type)
+	}
+}
+
+// getOpenAPISchemaName uses the type's name, capitalized so inputs such as loginInput read like the other schemas
+func getOpenAPISchemaName(t reflect.Type) string {
+	name := []rune(t.Name())
+	if len(name) == 0 {
+		return "Object"
+	}
+	name[0] = unicode.ToUpper(name[0])
+	return string(name)
+}
+
+// getRequestSchema gets the schema of the request body for the method and path, if the route has one
+func (doc *OpenAPIDocument) getRequestSchema(method, route string) *openAPISchema {
+	operation := doc.Paths[getOpenAPIPath(route)][strings.ToLower(method)]
+	if operation == nil || operation.RequestBody == nil || operation.RequestBody.Content["application/json"] == nil {
+		return nil
+	}
+	return operation.RequestBody.Content["application/json"].Schema
+}
+
+// validate checks the value against the schema and adds an error for each field that doesn't match, keyed by the
+// field's path, such as responses.0.questionId
+func (doc *OpenAPIDocument) validate(schema *openAPISchema, value interface{}, path string, errs map[string]string) {
+	if schema == nil || value == nil {
+		// null is read as the zero value
+		return
+	}
+	if schema.Ref != "" {
+		doc.validate(doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")], value, path, errs)
+		return
+	}
+	if len(schema.OneOf) > 0 {
+		for _, option := range schema.OneOf {
+			optionErrs := map[string]string{}
+			doc.validate(option, value, path, optionErrs)
+			if len(optionErrs) == 0 {
+				return
+			}
+		}
+		errs[getOpenAPIErrorKey(path)] = "does not match any of the allowed shapes"
+		return
+	}
+
+	switch schema.Type {
+	case "string":
+		if _, ok := value.(string); !ok {
+			errs[getOpenAPIErrorKey(path)] = "must be a string"
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errs[getOpenAPIErrorKey(path)] = "must be true or false"
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) {
+			errs[getOpenAPIErrorKey(path)] = "must be an integer"
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			errs[getOpenAPIErrorKey(path)] = "must be a number"
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			errs[getOpenAPIErrorKey(path)] = "must be a list"
+			return
+		}
+		for i := range items {
+			doc.validate(schema.Items, items[i], joinOpenAPIPath(path, fmt.Sprintf("%d", i)), errs)
+		}
+	case "object":
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			errs[getOpenAPIErrorKey(path)] = "must be an object"
+			return
+		}
+		for name, fieldValue := range fields {
+			if schema.AdditionalProperties != nil {
+				doc.validate(schema.AdditionalProperties, fieldValue, joinOpenAPIPath(path, name), errs)
+				continue
+			}
+			if schema.Properties == nil {
+				// any object
+				continue
+			}
+			property, ok := schema.Properties[name]
+			if !ok {
+				errs[joinOpenAPIPath(path, name)] = "is not a known field"
+				continue
+			}
+			doc.validate(property, fieldValue, joinOpenAPIPath(path, name), errs)
+		}
+	}
+}
+
+func joinOpenAPIPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func getOpenAPIErrorKey(path string) string {
+	if path == "" {
+		return "body"
+	}
+	return path
+}
+
+// requestValidationMiddleware checks JSON bodies against the spec before the route binds them, so a wrong type or a
+// misspelled field is reported by field instead of being dropped. Bodies of routes without a request schema, uploads,
+// and forms are left to the route
+func requestValidationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType := r.Header.Get("Content-Type")
+		if r.Body == nil || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions ||
+			strings.HasPrefix(contentType, "multipart/") || strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		doc, err := getOpenAPISpec()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		routeContext := chi.NewRouteContext()
+		if !SetupAPI().Match(routeContext, r.Method, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		schema := doc.getRequestSchema(r.Method, routeContext.RoutePattern())
+		if schema == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, openAPIBodyMaxBytes+1))
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		if err != nil || len(body) > openAPIBodyMaxBytes || len(bytes.TrimSpace(body)) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var decoded interface{}
+		err = json.Unmarshal(body, &decoded)
+		if err != nil {
+			sendAPIError(w, api_error_request_invalid, err, map[string]string{
+				"body": "must be valid JSON",
+			})
+			return
+		}
+		errs := map[string]string{}
+		doc.validate(schema, decoded, "", errs)
+		if len(errs) > 0 {
+			fields := make([]string, 0, len(errs))
+			for field := range errs {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			sendAPIError(w, api_error_request_invalid, errors.New("invalid fields: "+strings.Join(fields, ", ")), errs)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
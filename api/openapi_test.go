@@ -0,0 +1,181 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupOpenAPITestRouter builds the full router without the DB or cache, restoring the shared router and config after
+func setupOpenAPITestRouter(t *testing.T, validate bool) *chi.Mux {
+	previousConfig := config
+	previousRouter := r
+	config = &apiConfig{
+		APILevel:         "all",
+		ValidateRequests: validate,
+		Logger:           setupLogger(LogLevelError, &bytes.Buffer{}),
+	}
+	r = nil
+	t.Cleanup(func() {
+		config = previousConfig
+		r = previousRouter
+	})
+	return SetupAPI()
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	router := setupOpenAPITestRouter(t, false)
+	doc, err := buildOpenAPISpec(router)
+	require.Nil(t, err)
+	assert.Equal(t, openAPIVersion, doc.OpenAPI)
+
+	// every route is listed, and every described handler is still routed
+	handlers := map[string]bool{}
+	routes := 0
+	err = chi.Walk(router, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		routes++
+		handlers[getOpenAPIHandlerName(handler)] = true
+		operation := doc.Paths[getOpenAPIPath(route)][map[string]string{
+			http.MethodGet:    "get",
+			http.MethodPost:   "post",
+			http.MethodPut:    "put",
+			http.MethodPatch:  "patch",
+			http.MethodDelete: "delete",
+		}[method]]
+		assert.NotNil(t, operation, method+" "+route)
+		return nil
+	})
+	require.Nil(t, err)
+	for name := range openAPIRoutes {
+		assert.True(t, handlers[name], "%s is described but not routed", name)
+	}
+	operationIDs := map[string]bool{}
+	operations := 0
+	for _, methods := range doc.Paths {
+		for _, operation := range methods {
+			operations++
+			assert.False(t, operationIDs[operation.OperationID], operation.OperationID)
+			operationIDs[operation.OperationID] = true
+		}
+	}
+	assert.Equal(t, routes, operations)
+
+	// the path ids, bodies, and security come through
+	operation := doc.Paths["/admin/projects/{projectID}"]["patch"]
+	require.NotNil(t, operation)
+	assert.Equal(t, "routeAdminUpdateProject", operation.OperationID)
+	assert.Equal(t, []string{"admin"}, operation.Tags)
+	require.Equal(t, 1, len(operation.Parameters))
+	assert.Equal(t, "projectID", operation.Parameters[0].Name)
+	assert.Equal(t, "integer", operation.Parameters[0].Schema.Type)
+	assert.Equal(t, "#/components/schemas/Project", operation.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Equal(t, 3, len(operation.Security))
+	assert.Nil(t, doc.Paths["/login"]["post"].Security)
+	assert.Equal(t, "routeAdminGetProject_researcher", doc.Paths["/researcher/projects/{projectID}"]["get"].OperationID)
+	assert.NotNil(t, doc.Paths["/admin/files"]["post"].RequestBody.Content["multipart/form-data"])
+	assert.NotNil(t, doc.Paths["/admin/projects"]["post"].Responses["201"])
+
+	project := doc.Components.Schemas["Project"]
+	require.NotNil(t, project)
+	assert.Equal(t, "string", project.Properties["name"].Type)
+	assert.Equal(t, "integer", project.Properties["id"].Type)
+	assert.Equal(t, 5, len(doc.Components.Schemas["Block"].Properties["content"].OneOf))
+	assert.NotNil(t, doc.Components.Schemas["LoginInput"])
+
+	_, err = json.Marshal(doc)
+	assert.Nil(t, err)
+}
+
+func TestOpenAPIValidation(t *testing.T) {
+	router := setupOpenAPITestRouter(t, false)
+	doc, err := buildOpenAPISpec(router)
+	require.Nil(t, err)
+
+	schema := doc.getRequestSchema(http.MethodPatch, "/admin/projects/{projectID}")
+	require.NotNil(t, schema)
+	errs := map[string]string{}
+	doc.validate(schema, map[string]interface{}{
+		"name":            "Study",
+		"maxParticipants": float64(10),
+		"description":     nil,
+	}, "", errs)
+	assert.Equal(t, 0, len(errs))
+
+	doc.validate(schema, map[string]interface{}{
+		"name":            float64(1),
+		"maxParticipants": "ten",
+		"nmae":            "Study",
+	}, "", errs)
+	assert.Equal(t, "must be a string", errs["name"])
+	assert.Equal(t, "must be an integer", errs["maxParticipants"])
+	assert.Equal(t, "is not a known field", errs["nmae"])
+
+	errs = map[string]string{}
+	doc.validate(schema, []interface{}{}, "", errs)
+	assert.Equal(t, "must be an object", errs["body"])
+
+	// nested lists report the index
+	schema = doc.getRequestSchema(http.MethodPost, "/participant/projects/{projectID}/modules/{moduleID}/blocks/{blockID}/submissions")
+	require.NotNil(t, schema)
+	errs = map[string]string{}
+	doc.validate(schema, map[string]interface{}{
+		"responses": []interface{}{
+			map[string]interface{}{"questionId": "one"},
+		},
+	}, "", errs)
+	assert.Equal(t, "must be an integer", errs["responses.0.questionId"])
+}
+
+func TestOpenAPIValidationMiddleware(t *testing.T) {
+	called := false
+	setupOpenAPITestRouter(t, true)
+
+	handler := requestValidationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		assert.Equal(t, "someone@example.com", body["login"])
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// a wrong type is reported by field and never reaches the route
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(`{"login":"someone@example.com","password":12}`))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(rr, req)
+	assert.False(t, called)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	res := map[string]interface{}{}
+	json.Unmarshal(rr.Body.Bytes(), &res)
+	assert.Equal(t, api_error_request_invalid, res["error"])
+	assert.Equal(t, "must be a string", res["data"].(map[string]interface{})["password"])
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(`{"email":`))
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.False(t, called)
+
+	// a valid body is passed on whole
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(`{"login":"someone@example.com","password":"secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(rr, req)
+	assert.True(t, called)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// the spec is served as is
+	rr = httptest.NewRecorder()
+	routeOpenAPISpec(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	served := map[string]interface{}{}
+	err := json.Unmarshal(rr.Body.Bytes(), &served)
+	assert.Nil(t, err)
+	assert.Equal(t, openAPIVersion, served["openapi"])
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	participantBatchMax = 500
+
+	ParticipantBatchFormatJSON = "json"
+	ParticipantBatchFormatCSV  = "csv"
+	ParticipantBatchFormatHTML = "html"
+
+	// easy to read aloud and copy from paper; no 0/O or 1/I/L
+	participantBatchAlphabet       = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+	participantBatchCodeLength     = 8
+	participantBatchPasswordLength = 12
+)
+
+var (
+	errParticipantBatchBadCount   = fmt.Errorf("count must be between 1 and %d", participantBatchMax)
+	errParticipantBatchMaxReached = errors.New("the batch would go over the project's maximum participants")
+)
+
+// ParticipantBatchRequest asks for a number of participant code accounts for in-person studies
+type ParticipantBatchRequest struct {
+	Count              int64  `json:"count"`
+	PaperConsent       string `json:"paperConsent"`       // yes to record an accepted consent response for each, collected on paper
+	ResearcherComments string `json:"researcherComments"` // saved on the consent responses
+}
+
+// ParticipantBatchCredential is a generated login. The password is only available in the response that created it;
+// only its hash is stored
+type ParticipantBatchCredential struct {
+	UserID            int64  `json:"userId"`
+	ParticipantCode   string `json:"participantCode"`
+	Password          string `json:"password"`
+	ConsentResponseID int64  `json:"consentResponseId,omitempty"`
+}
+
+// CreateParticipantBatchForProject creates the participant code users, links them to the project, and optionally records
+// a paper consent for each. If anything fails, the users created so far are removed so no one is left with a login that
+// was never handed out
+func CreateParticipantBatchForProject(project *Project, input *ParticipantBatchRequest) ([]ParticipantBatchCredential, error) {
+	credentials := []ParticipantBatchCredential{}
+	if input.Count < 1 || input.Count > participantBatchMax {
+		return credentials, errParticipantBatchBadCount
+	}
+	if project.MaxParticipants > 0 && project.ParticipantCount+input.Count > project.MaxParticipants {
+		return credentials, errParticipantBatchMaxReached
+	}
+
+	for i := int64(0); i < input.Count; i++ {
+		credential, err := createParticipantForBatch(project, input)
+		if err != nil {
+			for _, created := range credentials {
+				if created.ConsentResponseID != 0 {
+					DeleteConsentesponse(created.ConsentResponseID)
+				}
+				RemoveUserFromProjectCompletely(created.UserID, project.ID)
+				DeleteUser(created.UserID)
+			}
+			return []ParticipantBatchCredential{}, err
+		}
+		credentials = append(credentials, credential)
+	}
+	return credentials, nil
+}
+
+func createParticipantForBatch(project *Project, input *ParticipantBatchRequest) (ParticipantBatchCredential, error) {
+	credential := ParticipantBatchCredential{}
+	code, err := generateParticipantBatchCode(project.SiteID, project.ID)
+	if err != nil {
+		return credential, err
+	}
+	password, err := randomParticipantBatchString(participantBatchPasswordLength)
+	if err != nil {
+		return credential, err
+	}
+	user := &User{
+		SiteID:          project.SiteID,
+		ParticipantCode: code,
+		Password:        password,
+		SystemRole:      UserSystemRoleParticipant,
+		Status:          UserStatusActive,
+	}
+	err = CreateUser(user)
+	if err != nil {
+		return credential, err
+	}
+	credential.UserID = user.ID
+	credential.ParticipantCode = code
+	credential.Password = password
+
+	err = LinkUserAndProject(user.ID, project.ID)
+	if err != nil {
+		DeleteUser(user.ID)
+		return credential, err
+	}
+
+	if input.PaperConsent == Yes {
+		response := &ConsentResponse{
+			ProjectID:          project.ID,
+			ConsentStatus:      ConsentResponseStatusAccepted,
+			ResearcherComments: strings.TrimSpace("Consent collected on paper. " + input.ResearcherComments),
+		}
+		if project.ConnectParticipantToConsentForm != No {
+			response.ParticipantID = user.ID
+		}
+		err = CreateConsentResponse(response)
+		if err != nil {
+			RemoveUserFromProjectCompletely(user.ID, project.ID)
+			DeleteUser(user.ID)
+			return credential, err
+		}
+		credential.ConsentResponseID = response.ID
+	}
+	return credential, nil
+}
+
+// generateParticipantBatchCode creates a code prefixed with the project that is not already in use
+func generateParticipantBatchCode(siteID, projectID int64) (string, error) {
+	for tries := 0; tries < 10; tries++ {
+		suffix, err := randomParticipantBatchString(participantBatchCodeLength)
+		if err != nil {
+			return "", err
+		}
+		code := fmt.Sprintf("%d-%s", projectID, suffix)
+		_, err = GetUserByParticipantCode(siteID, code)
+		if errors.Is(err, sql.ErrNoRows) {
+			return code, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", errors.New("could not generate a unique participant code")
+}
+
+func randomParticipantBatchString(length int) (string, error) {
+	max := big.NewInt(int64(len(participantBatchAlphabet)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = participantBatchAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// participantBatchSheetTemplate is a printable page with one slip per participant to cut apart and hand out
+var participantBatchSheetTemplate = htmltemplate.Must(htmltemplate.New("sheet").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Project.Name}} participant logins</title>
+<style>
+body { font-family: sans-serif; margin: 0.5in; }
+.slip { display: inline-block; width: 45%; margin: 0 2% 0.25in 0; padding: 0.2in; border: 1px dashed #666; box-sizing: border-box; page-break-inside: avoid; }
+.slip h2 { font-size: 1em; margin: 0 0 0.1in 0; }
+.slip code { font-size: 1.2em; }
+</style>
+</head>
+<body>
+{{range .Credentials}}<div class="slip">
+<h2>{{$.Project.Name}}</h2>
+<div>Participant code: <code>{{.ParticipantCode}}</code></div>
+<div>Password: <code>{{.Password}}</code></div>
+{{if $.LoginAddress}}<div>Log in at {{$.LoginAddress}}</div>{{end}}
+</div>
+{{end}}
+<p>Generated {{.GeneratedOn}}. These passwords are not stored and cannot be shown again.</p>
+</body>
+</html>`))
+
+// writeParticipantBatchSheet writes the printable sheet; browsers can print it or save it as a PDF. The login address
+// is left off if the site's client can't be found
+func writeParticipantBatchSheet(w io.Writer, site *Site, project *Project, credentials []ParticipantBatchCredential) error {
+	address, _ := getSiteClientAddress(site)
+	return participantBatchSheetTemplate.Execute(w, map[string]interface{}{
+		"Project":      project,
+		"Credentials":  credentials,
+		"LoginAddress": address,
+		"GeneratedOn":  time.Now().Format(timeFormatAPI),
+	})
+}
+
+// Bind binds the data for the HTTP
+func (data *ParticipantBatchRequest) Bind(r *http.Request) error {
+	return nil
+}
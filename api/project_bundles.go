@@ -0,0 +1,180 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const projectBundleFormatVersion = 1
+
+// ProjectBundle is a project's definition, with its consent form, modules, and blocks, so it can be copied to another
+// site or install. Participants and their responses are never included
+type ProjectBundle struct {
+	FormatVersion int                   `json:"formatVersion"`
+	ExportedOn    string                `json:"exportedOn"`
+	Project       Project               `json:"project"`
+	ConsentForm   *ConsentForm          `json:"consentForm,omitempty"`
+	Modules       []ProjectBundleModule `json:"modules"`
+}
+
+// ProjectBundleModule is a module in the bundle along with its blocks, in flow order
+type ProjectBundleModule struct {
+	Module Module  `json:"module"`
+	Blocks []Block `json:"blocks"`
+}
+
+// ExportProject builds the bundle for a project on the site
+func ExportProject(siteID, projectID int64) (*ProjectBundle, error) {
+	project, err := GetProjectByID(siteID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &ProjectBundle{
+		FormatVersion: projectBundleFormatVersion,
+		ExportedOn:    time.Now().Format(timeFormatAPI),
+		Project:       *project,
+		Modules:       []ProjectBundleModule{},
+	}
+	form, err := GetConsentFormForProject(projectID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err == nil {
+		bundle.ConsentForm = form
+	}
+	modules, err := GetModulesForProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, module := range modules {
+		blocks, err := GetBlocksForModule(module.ID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range blocks {
+			blocks[i].Content, err = handleBlockGet(blocks[i].BlockType, blocks[i].ID)
+			if err != nil {
+				return nil, fmt.Errorf("block %d: %w", blocks[i].ID, err)
+			}
+		}
+		bundle.Modules = append(bundle.Modules, ProjectBundleModule{
+			Module: module,
+			Blocks: blocks,
+		})
+	}
+	return bundle, nil
+}
+
+// ImportProject creates a new project on the site from the bundle, with new modules and blocks. The project starts as
+// pending so it can be reviewed before it is opened. Blocks that use a file are only imported if that file is already
+// on the site, since the files themselves are not in the bundle
+func ImportProject(siteID int64, bundle *ProjectBundle) (*Project, error) {
+	if bundle.FormatVersion != projectBundleFormatVersion {
+		return nil, fmt.Errorf("unsupported bundle format version %d", bundle.FormatVersion)
+	}
+	err := checkProjectBundleFiles(siteID, bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	project := bundle.Project
+	project.ID = 0
+	project.SiteID = siteID
+	project.Status = ProjectStatusPending
+	project.ParticipantCount = 0
+	err = CreateProject(&project)
+	if err != nil {
+		return nil, err
+	}
+	if bundle.ConsentForm != nil {
+		form := *bundle.ConsentForm
+		form.ProjectID = project.ID
+		err = SaveConsentFormForProject(&form)
+		if err != nil {
+			return &project, err
+		}
+	}
+	for i := range bundle.Modules {
+		module := bundle.Modules[i].Module
+		module.ID = 0
+		module.SiteID = siteID
+		err = CreateModule(&module)
+		if err != nil {
+			return &project, err
+		}
+		err = LinkModuleAndProject(project.ID, module.ID, int64(i+1))
+		if err != nil {
+			return &project, err
+		}
+		for j := range bundle.Modules[i].Blocks {
+			block := bundle.Modules[i].Blocks[j]
+			block.ID = 0
+			block.SiteID = siteID
+			err = CreateBlock(&block)
+			if err != nil {
+				return &project, err
+			}
+			content, err := newProjectBundleBlockContent(block.BlockType, block.Content)
+			if err != nil {
+				return &project, err
+			}
+			_, err = handleBlockSave(block.BlockType, block.ID, content)
+			if err != nil {
+				return &project, fmt.Errorf("block %s: %w", block.Name, err)
+			}
+			err = LinkBlockAndModule(module.ID, block.ID, int64(j+1))
+			if err != nil {
+				return &project, err
+			}
+		}
+	}
+	return &project, nil
+}
+
+// newProjectBundleBlockContent clears the ids in a form's questions and options, since they would otherwise update the
+// questions on the block the bundle came from
+func newProjectBundleBlockContent(blockType string, content interface{}) (interface{}, error) {
+	if blockType != BlockTypeForm {
+		return content, nil
+	}
+	str, _ := json.Marshal(content)
+	form := &BlockForm{}
+	err := json.Unmarshal(str, form)
+	if err != nil {
+		return content, err
+	}
+	for i := range form.Questions {
+		form.Questions[i].ID = 0
+		for j := range form.Questions[i].Options {
+			form.Questions[i].Options[j].ID = 0
+		}
+	}
+	return form, nil
+}
+
+// checkProjectBundleFiles makes sure every file a block uses is on the site before anything is created
+func checkProjectBundleFiles(siteID int64, bundle *ProjectBundle) error {
+	for i := range bundle.Modules {
+		for _, block := range bundle.Modules[i].Blocks {
+			if block.BlockType != BlockTypeFile && block.BlockType != BlockTypeEmbed {
+				continue
+			}
+			str, _ := json.Marshal(block.Content)
+			content := struct {
+				FileID int64 `json:"fileId"`
+			}{}
+			json.Unmarshal(str, &content)
+			if content.FileID == 0 {
+				continue
+			}
+			_, err := GetFileFromDB(siteID, content.FileID)
+			if err != nil {
+				return fmt.Errorf("block %s uses file %d, which is not on this site", block.Name, content.FileID)
+			}
+		}
+	}
+	return nil
+}
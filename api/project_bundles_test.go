@@ -0,0 +1,113 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectBundleExportAndImport(t *testing.T) {
+	setupTesting()
+	siteID := getTestSiteID()
+
+	project := &Project{
+		Status: ProjectStatusActive,
+	}
+	err := createTestProject(project)
+	require.Nil(t, err)
+	defer DeleteProject(project.ID)
+	err = SaveConsentFormForProject(&ConsentForm{
+		ProjectID:         project.ID,
+		ContentInMarkdown: "# Consent",
+	})
+	require.Nil(t, err)
+
+	module := &Module{}
+	err = createTestModule(module, project.ID, 1)
+	require.Nil(t, err)
+	defer DeleteModule(module.ID)
+
+	text := &Block{
+		SiteID:    siteID,
+		Name:      "Welcome",
+		BlockType: BlockTypeText,
+	}
+	err = CreateBlock(text)
+	require.Nil(t, err)
+	defer DeleteBlock(text.ID)
+	_, err = handleBlockSave(BlockTypeText, text.ID, &BlockText{Text: "Hello"})
+	require.Nil(t, err)
+	require.Nil(t, LinkBlockAndModule(module.ID, text.ID, 1))
+
+	form := &Block{
+		SiteID:    siteID,
+		Name:      "Survey",
+		BlockType: BlockTypeForm,
+	}
+	err = CreateBlock(form)
+	require.Nil(t, err)
+	defer DeleteBlock(form.ID)
+	_, err = handleBlockSave(BlockTypeForm, form.ID, &BlockForm{
+		FormType: BlockFormTypeSurvey,
+		Questions: []BlockFormQuestion{
+			{
+				QuestionType: BlockFormQuestionTypeSingle,
+				Question:     "Pick one",
+				Options: []BlockFormQuestionOption{
+					{OptionText: "A"},
+					{OptionText: "B"},
+				},
+			},
+		},
+	})
+	require.Nil(t, err)
+	require.Nil(t, LinkBlockAndModule(module.ID, form.ID, 2))
+
+	bundle, err := ExportProject(siteID, project.ID)
+	require.Nil(t, err)
+	assert.Equal(t, "# Consent", bundle.ConsentForm.ContentInMarkdown)
+	require.Equal(t, 1, len(bundle.Modules))
+	require.Equal(t, 2, len(bundle.Modules[0].Blocks))
+
+	imported, err := ImportProject(siteID, bundle)
+	require.Nil(t, err)
+	defer DeleteProject(imported.ID)
+	assert.NotEqual(t, project.ID, imported.ID)
+	assert.Equal(t, ProjectStatusPending, imported.Status)
+
+	importedForm, err := GetConsentFormForProject(imported.ID)
+	require.Nil(t, err)
+	assert.Equal(t, "# Consent", importedForm.ContentInMarkdown)
+	modules, err := GetModulesForProject(imported.ID)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(modules))
+	defer DeleteModule(modules[0].ID)
+	assert.NotEqual(t, module.ID, modules[0].ID)
+	blocks, err := GetBlocksForModule(modules[0].ID)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(blocks))
+	for i := range blocks {
+		defer DeleteBlock(blocks[i].ID)
+	}
+	assert.Equal(t, "Survey", blocks[1].Name)
+
+	// the original questions are left alone and the copy gets its own
+	original, err := GetBlockFormQuestionsForBlockID(form.ID)
+	require.Nil(t, err)
+	copied, err := GetBlockFormQuestionsForBlockID(blocks[1].ID)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(original))
+	require.Equal(t, 1, len(copied))
+	assert.NotEqual(t, original[0].ID, copied[0].ID)
+	assert.Equal(t, 2, len(copied[0].Options))
+
+	// files aren't in the bundle, so a block using a file that isn't on the site stops the import
+	bundle.Modules[0].Blocks = append(bundle.Modules[0].Blocks, Block{
+		Name:      "Handout",
+		BlockType: BlockTypeFile,
+		Content:   map[string]interface{}{"fileId": -1},
+	})
+	_, err = ImportProject(siteID, bundle)
+	assert.NotNil(t, err)
+}
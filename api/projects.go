@@ -65,10 +65,14 @@ type Project struct {
 	StartRule                       string `json:"startRule" db:"startRule"`
 	StartDate                       string `json:"startDate" db:"startDate"`
 	EndDate                         string `json:"endDate" db:"endDate"`
+	RequireChallenge                string `json:"requireChallenge" db:"requireChallenge"` // yes, no; whether signups must pass the site's challenge
 
 	// needed for the participant and admin views
 	ParticipantID     int64  `json:"participantId,omitempty" db:"participantId"`
 	ParticipantStatus string `json:"participantStatus,omitempty" db:"participantStatus"`
+
+	// needed for the researcher views
+	CollaboratorRole string `json:"collaboratorRole,omitempty" db:"collaboratorRole"`
 }
 
 // ProjectAPIReturnNonAdmin is a much-reduced project return struct for non-admins
@@ -82,6 +86,7 @@ type ProjectAPIReturnNonAdmin struct {
 	ParticipantMinimumAge int64  `json:"participantMinimumAge" db:"participantMinimumAge"`
 	ParticipantVisibility string `json:"participantVisibility" db:"participantVisibility"`
 	ParticipantStatus     string `json:"participantStatus,omitempty" db:"participantStatus"`
+	RequireChallenge      string `json:"requireChallenge" db:"requireChallenge"`
 }
 
 // ProjectUserLinkRequest holds extra request options for joining a project, such as if a code is needed
@@ -111,7 +116,8 @@ func CreateProject(input *Project) error {
 		flowRule = :flowRule,
 		startRule = :startRule,
 		startDate = :startDate,
-		endDate = :endDate
+		endDate = :endDate,
+		requireChallenge = :requireChallenge
 		`, input)
 	if err != nil {
 		return err
@@ -142,18 +148,19 @@ func UpdateProject(input *Project) error {
 		flowRule = :flowRule,
 		startRule = :startRule,
 		startDate = :startDate,
-		endDate = :endDate
+		endDate = :endDate,
+		requireChallenge = :requireChallenge
 		WHERE id = :id`, input)
 	return err
 }
 
-// GetProjectByID gets a single project by its id
-func GetProjectByID(projectID int64) (*Project, error) {
+// GetProjectByID gets a single project on the site by its id
+func GetProjectByID(siteID, projectID int64) (*Project, error) {
 	// TODO: cache, don't forget the updates to clear the cache
 	project := &Project{}
 	defer project.processForAPI()
 	err := config.DBConnection.Get(project, `SELECT p.*, (SELECT COUNT(*) FROM ProjectUserLinks l WHERE l.projectId = p.id) AS participantCount
-	FROM Projects p WHERE p.id = ?`, projectID)
+	FROM Projects p WHERE p.id = ? AND p.siteId = ?`, projectID, siteID)
 	return project, err
 }
 
@@ -211,6 +218,10 @@ func DeleteProject(projectID int64) error {
 	if err != nil {
 		return err
 	}
+	err = DeleteProjectCollaboratorsForProject(projectID)
+	if err != nil {
+		return err
+	}
 
 	// TODO: as more entities are built out, add the delete calls here
 	return nil
@@ -234,32 +245,13 @@ func UpdateUserAndProjectStatus(userID, projectID int64, status string) error {
 	return err
 }
 
+// RemoveUserFromProjectCompletely removes the participant and everything they contributed from a project without
+// saving an erasure receipt; routes acting on a request should use EraseUser. This should never be called on admin
+// users and instead the admin user's account should have the status changed. There is no logic to prevent re-joining,
+// but they will start over
 func RemoveUserFromProjectCompletely(userID, projectID int64) error {
-	// this will be the entry point for removing a participant from a research study and
-	// MUST be updated as new user-connected entries are made; this should never be called
-	// on admin users and instead the admin user's account should have the status changed;
-	// similarly, it may be better to make the participant's account inactive instead of removing
-	// their contributions, unless it's absolutely necessary to remove the participant's data
-	// this will also allow a user to re-join (as in, there's no current logic to prevent re-joining)
-	// but they will start over
-
-	// delete the consent form
-	err := DeleteConsentesponseForParticipant(userID, projectID)
-	if err != nil {
-		return err
-	}
-
-	// remove the project link
-	err = UnlinkUserAndProject(userID, projectID)
-	if err != nil {
-		return err
-	}
-
-	// TODO: remove the block status for the user
-
-	// TODO: remove any survey responses for the user
-
-	return nil
+	_, err := eraseUser(userID, projectID, 0, false, true)
+	return err
 }
 
 // createTestProject is used for tests to create a test project
@@ -279,6 +271,9 @@ func createTestProject(defaults *Project) error {
 	if defaults.ParticipantVisibility == "" {
 		defaults.ParticipantVisibility = ProjectParticipantVisibilityFull
 	}
+	if defaults.SiteID == 0 {
+		defaults.SiteID = getTestSiteID()
+	}
 	return CreateProject(defaults)
 }
 
@@ -293,6 +288,7 @@ func convertProjectToUserRet(input *Project) *ProjectAPIReturnNonAdmin {
 		ParticipantMinimumAge: input.ParticipantMinimumAge,
 		ParticipantVisibility: input.ParticipantVisibility,
 		ParticipantStatus:     input.ParticipantStatus,
+		RequireChallenge:      input.RequireChallenge,
 	}
 	// if signup is allowed BUT max participants is reached, signup is blocked
 	if input.MaxParticipants > 0 && input.ParticipantCount >= input.MaxParticipants {
@@ -329,6 +325,9 @@ func (input *Project) processForDB() {
 	if input.FlowRule == "" {
 		input.FlowRule = ProjectFlowRuleFree
 	}
+	if input.RequireChallenge != No {
+		input.RequireChallenge = Yes
+	}
 	if input.StartDate == "" {
 		input.StartDate = time.Now().Format(timeFormatDB)
 	} else {
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseTrustedProxies parses a list of CIDRs; a bare IP is treated as a single address
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	parsed := []*net.IPNet{}
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return parsed, fmt.Errorf("%s is not a valid IP or CIDR", proxy)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			proxy = fmt.Sprintf("%s/%d", proxy, bits)
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return parsed, fmt.Errorf("%s is not a valid IP or CIDR", proxy)
+		}
+		parsed = append(parsed, network)
+	}
+	return parsed, nil
+}
+
+// getTrustedProxiesForSite gets the proxies whose forwarded headers are trusted for the site. The environment
+// overrides the site's list if it is set. Entries that don't parse are skipped, since they are validated on save
+func getTrustedProxiesForSite(site *Site) []*net.IPNet {
+	if len(config.TrustedProxies) > 0 {
+		return config.TrustedProxies
+	}
+	if site == nil {
+		return []*net.IPNet{}
+	}
+	proxies := []*net.IPNet{}
+	for _, proxy := range site.TrustedProxies {
+		parsed, err := parseTrustedProxies([]string{proxy})
+		if err == nil {
+			proxies = append(proxies, parsed...)
+		}
+	}
+	return proxies
+}
+
+func isTrustedProxy(ip string, proxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// getForwardedIP gets the client IP from the forwarded headers, but only if the request came from a trusted proxy.
+// X-Forwarded-For is read from the right, skipping trusted proxies, so a client can't spoof its address by sending the
+// header itself. An empty string means the remote address should be used
+func getForwardedIP(r *http.Request, proxies []*net.IPNet) string {
+	if !isTrustedProxy(getIPFromRequest(r), proxies) {
+		return ""
+	}
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	found := ""
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(ip) == nil {
+			break
+		}
+		found = ip
+		if !isTrustedProxy(ip, proxies) {
+			return ip
+		}
+	}
+	if found != "" {
+		return found
+	}
+	realIP := strings.TrimSpace(r.Header.Get("X-Real-IP"))
+	if net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return ""
+}
+
+// trustedRealIP replaces the remote address with the client's address when the request came through one of the site's
+// trusted proxies. It needs the site to already be in the context
+func trustedRealIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site, _ := GetSiteFromContext(r.Context())
+		if ip := getForwardedIP(r, getTrustedProxiesForSite(site)); ip != "" {
+			r.RemoteAddr = ip
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8", " 192.168.1.5 ", "", "::1"})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(proxies))
+	assert.Equal(t, "192.168.1.5/32", proxies[1].String())
+	assert.Equal(t, "::1/128", proxies[2].String())
+	_, err = parseTrustedProxies([]string{"10.0.0.0/8", "not a proxy"})
+	assert.NotNil(t, err)
+
+	// untrusted remotes can't set their own address
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.9:5000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	assert.Equal(t, "", getForwardedIP(req, proxies))
+
+	// trusted proxies are skipped from the right, so a spoofed first entry is ignored
+	req.RemoteAddr = "10.1.1.1:5000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.9, 10.2.2.2")
+	assert.Equal(t, "203.0.113.9", getForwardedIP(req, proxies))
+
+	req.Header.Del("X-Forwarded-For")
+	req.Header.Set("X-Real-IP", "203.0.113.10")
+	assert.Equal(t, "203.0.113.10", getForwardedIP(req, proxies))
+	assert.Equal(t, "", getForwardedIP(req, nil))
+}
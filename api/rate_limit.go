@@ -0,0 +1,287 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	// route groups that share a limit
+	rateLimitGroupAuth      = "auth"      // logins, password resets, verification, and invitations
+	rateLimitGroupSetup     = "setup"     // configuring a site
+	rateLimitGroupConsent   = "consent"   // public consent responses, which can create participants
+	rateLimitGroupDownloads = "downloads" // file downloads
+	rateLimitGroupAPI       = "api"       // everything under /admin, /researcher, and /participant
+
+	// who a limit is counted against
+	rateLimitIdentityIP   = "ip"
+	rateLimitIdentityUser = "user" // the API key or user if the request is authenticated, otherwise the IP
+
+	// rateLimitMemoryMaxKeys is how many keys the in-memory limiter holds before it clears out the expired ones
+	rateLimitMemoryMaxKeys = 10000
+)
+
+// rateLimitRule allows Limit requests in any Window for each identity
+type rateLimitRule struct {
+	Limit    int64
+	Window   time.Duration
+	Identity string
+}
+
+// rateLimitResult is the outcome of counting a request
+type rateLimitResult struct {
+	Allowed   bool
+	Remaining int64
+	Reset     time.Duration // until the oldest request in the window expires and frees a slot
+}
+
+// rateLimitDefaults are used for any group not set in KESPLORA_API_RATE_LIMITS. The unauthenticated groups are
+// counted by IP; participants in a classroom may share one, so they are not too strict
+var rateLimitDefaults = map[string]rateLimitRule{
+	rateLimitGroupAuth:      {Limit: 30, Window: time.Minute, Identity: rateLimitIdentityIP},
+	rateLimitGroupSetup:     {Limit: 10, Window: time.Hour, Identity: rateLimitIdentityIP},
+	rateLimitGroupConsent:   {Limit: 60, Window: time.Minute, Identity: rateLimitIdentityIP},
+	rateLimitGroupDownloads: {Limit: 120, Window: time.Minute, Identity: rateLimitIdentityUser},
+	rateLimitGroupAPI:       {Limit: 600, Window: time.Minute, Identity: rateLimitIdentityUser},
+}
+
+// rateLimitScript is a sliding window log; each allowed request is added to a sorted set scored by its time in
+// milliseconds, and requests older than the window are dropped before counting. It returns whether the request was
+// allowed, the count in the window, and the milliseconds until the oldest request leaves it
+var rateLimitScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	count = count + 1
+	allowed = 1
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+local reset = 0
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, count, reset}
+`)
+
+// rateLimitMemory counts requests in the process when Redis can't be reached, so the limits still hold on a single
+// instance
+var rateLimitMemory = newMemoryRateLimiter()
+
+type memoryRateLimiter struct {
+	mu       sync.Mutex
+	requests map[string]*memoryRateLimitKey
+	maxKeys  int
+}
+
+// memoryRateLimitKey keeps the window with the requests, since keys for groups with different windows are swept
+// together
+type memoryRateLimitKey struct {
+	window   time.Duration
+	requests []time.Time
+}
+
+func newMemoryRateLimiter() *memoryRateLimiter {
+	return &memoryRateLimiter{
+		requests: map[string]*memoryRateLimitKey{},
+		maxKeys:  rateLimitMemoryMaxKeys,
+	}
+}
+
+// setupRateLimits reads the limits from a list such as auth=30/1m,downloads=200/1m/user. A limit of 0 turns the group
+// off. Groups that aren't listed keep their default
+func setupRateLimits(input string) (map[string]rateLimitRule, error) {
+	rules := map[string]rateLimitRule{}
+	for group, rule := range rateLimitDefaults {
+		rules[group] = rule
+	}
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return rules, nil
+	}
+	for _, entry := range strings.Split(input, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 {
+			return rules, fmt.Errorf("rate limit %s must be group=limit/window", entry)
+		}
+		group := strings.ToLower(strings.TrimSpace(parts[0]))
+		rule, ok := rules[group]
+		if !ok {
+			return rules, fmt.Errorf("unknown rate limit group %s", group)
+		}
+		values := strings.Split(strings.TrimSpace(parts[1]), "/")
+		if len(values) < 2 || len(values) > 3 {
+			return rules, fmt.Errorf("rate limit %s must be group=limit/window", entry)
+		}
+		limit, err := strconv.ParseInt(values[0], 10, 64)
+		if err != nil || limit < 0 {
+			return rules, fmt.Errorf("rate limit %s needs a limit of 0 or more", entry)
+		}
+		window, err := time.ParseDuration(values[1])
+		if err != nil || window < time.Second {
+			return rules, fmt.Errorf("rate limit %s needs a window of at least 1s, such as 1m", entry)
+		}
+		rule.Limit = limit
+		rule.Window = window
+		if len(values) == 3 {
+			rule.Identity = strings.ToLower(values[2])
+			if rule.Identity != rateLimitIdentityIP && rule.Identity != rateLimitIdentityUser {
+				return rules, fmt.Errorf("rate limit %s must count by ip or user", entry)
+			}
+		}
+		rules[group] = rule
+	}
+	return rules, nil
+}
+
+// rateLimitMiddleware limits the requests for the group. Every response has the RateLimit-Limit, RateLimit-Remaining,
+// and RateLimit-Reset headers, and a request over the limit gets a 429 with Retry-After
+func rateLimitMiddleware(group string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rule, ok := config.RateLimits[group]
+			if !ok || rule.Limit == 0 || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := getRateLimitCacheKey(group, getRateLimitIdentity(r, rule.Identity))
+			result := checkRateLimit(key, rule, time.Now())
+
+			reset := int64(math.Ceil(result.Reset.Seconds()))
+			w.Header().Set("RateLimit-Limit", strconv.FormatInt(rule.Limit, 10))
+			w.Header().Set("RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+			w.Header().Set("RateLimit-Reset", strconv.FormatInt(reset, 10))
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rule.Limit, int64(rule.Window.Seconds())))
+			if !result.Allowed {
+				metricRateLimited.Inc(group)
+				w.Header().Set("Retry-After", strconv.FormatInt(reset, 10))
+				sendAPIError(w, api_error_rate_limited, fmt.Errorf("rate limited for %s", group), map[string]interface{}{
+					"group":      group,
+					"retryAfter": reset,
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// getRateLimitIdentity gets who the request is counted against. API keys are counted apart from their user's logins,
+// so a nightly script doesn't use up the admin's requests
+func getRateLimitIdentity(r *http.Request, identity string) string {
+	if identity == rateLimitIdentityUser {
+		user, err := getUserFromHTTPContext(r)
+		if err == nil && user.APIKeyID != 0 {
+			return fmt.Sprintf("apikey_%d", user.APIKeyID)
+		}
+		if err == nil && user.ID != 0 {
+			return fmt.Sprintf("user_%d", user.ID)
+		}
+	}
+	return "ip_" + getIPFromRequest(r)
+}
+
+// checkRateLimit counts the request in Redis, falling back to counting in memory if the cache is not set up or
+// can't be reached
+func checkRateLimit(key string, rule rateLimitRule, now time.Time) rateLimitResult {
+	if config.CacheClient != nil {
+		result, err := checkRateLimitInCache(key, rule, now)
+		if err == nil {
+			return result
+		}
+		Log(LogLevelWarn, "rate_limit_cache_error", err.Error(), &LogOptions{
+			ExtraData: map[string]interface{}{
+				"key": key,
+			},
+		})
+	}
+	return rateLimitMemory.check(key, rule, now)
+}
+
+func checkRateLimitInCache(key string, rule rateLimitRule, now time.Time) (rateLimitResult, error) {
+	nowMS := now.UnixNano() / int64(time.Millisecond)
+	// the member only needs to be unique within the key
+	member := fmt.Sprintf("%d-%s", now.UnixNano(), randomString(8))
+	values, err := rateLimitScript.Run(config.CacheClient, []string{key}, nowMS, rule.Window.Milliseconds(), rule.Limit, member).Result()
+	if err != nil {
+		return rateLimitResult{}, err
+	}
+	returned, ok := values.([]interface{})
+	if !ok || len(returned) != 3 {
+		return rateLimitResult{}, errors.New("unexpected rate limit script result")
+	}
+	allowed, _ := returned[0].(int64)
+	count, _ := returned[1].(int64)
+	reset, _ := returned[2].(int64)
+	return newRateLimitResult(allowed == 1, count, rule, time.Duration(reset)*time.Millisecond), nil
+}
+
+// check is the same sliding window as the cache script, kept in the process
+func (limiter *memoryRateLimiter) check(key string, rule rateLimitRule, now time.Time) rateLimitResult {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if len(limiter.requests) > limiter.maxKeys {
+		for found, entry := range limiter.requests {
+			if len(entry.requests) == 0 || entry.requests[len(entry.requests)-1].Before(now.Add(-entry.window)) {
+				delete(limiter.requests, found)
+			}
+		}
+	}
+
+	start := now.Add(-rule.Window)
+	entry, ok := limiter.requests[key]
+	if !ok {
+		entry = &memoryRateLimitKey{}
+		limiter.requests[key] = entry
+	}
+	entry.window = rule.Window
+	kept := entry.requests[:0]
+	for _, requested := range entry.requests {
+		if requested.After(start) {
+			kept = append(kept, requested)
+		}
+	}
+	allowed := int64(len(kept)) < rule.Limit
+	if allowed {
+		kept = append(kept, now)
+	}
+	entry.requests = kept
+
+	reset := time.Duration(0)
+	if len(kept) > 0 {
+		reset = kept[0].Add(rule.Window).Sub(now)
+	}
+	return newRateLimitResult(allowed, int64(len(kept)), rule, reset)
+}
+
+func newRateLimitResult(allowed bool, count int64, rule rateLimitRule, reset time.Duration) rateLimitResult {
+	remaining := rule.Limit - count
+	if remaining < 0 {
+		remaining = 0
+	}
+	if reset < 0 {
+		reset = 0
+	}
+	return rateLimitResult{
+		Allowed:   allowed,
+		Remaining: remaining,
+		Reset:     reset,
+	}
+}
+
+func getRateLimitCacheKey(group, identity string) string {
+	return fmt.Sprintf("rate_limit_%s_%s", group, identity)
+}
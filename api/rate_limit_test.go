@@ -0,0 +1,128 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitConfig(t *testing.T) {
+	rules, err := setupRateLimits("")
+	require.Nil(t, err)
+	assert.Equal(t, rateLimitDefaults[rateLimitGroupAuth], rules[rateLimitGroupAuth])
+
+	rules, err = setupRateLimits(" auth=5/30s, downloads=200/1m/ip,api=0/1m")
+	require.Nil(t, err)
+	assert.Equal(t, rateLimitRule{Limit: 5, Window: 30 * time.Second, Identity: rateLimitIdentityIP}, rules[rateLimitGroupAuth])
+	assert.Equal(t, rateLimitRule{Limit: 200, Window: time.Minute, Identity: rateLimitIdentityIP}, rules[rateLimitGroupDownloads])
+	assert.Equal(t, int64(0), rules[rateLimitGroupAPI].Limit)
+	assert.Equal(t, rateLimitDefaults[rateLimitGroupSetup], rules[rateLimitGroupSetup])
+
+	for _, input := range []string{"auth", "auth=5", "auth=five/1m", "auth=-1/1m", "auth=5/soon", "auth=5/1ms", "auth=5/1m/site", "uploads=5/1m"} {
+		_, err = setupRateLimits(input)
+		assert.NotNil(t, err, input)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	previousConfig := config
+	previousMemory := rateLimitMemory
+	config = &apiConfig{
+		Logger: setupLogger(LogLevelError, &bytes.Buffer{}),
+		RateLimits: map[string]rateLimitRule{
+			rateLimitGroupAuth: {Limit: 2, Window: time.Minute, Identity: rateLimitIdentityIP},
+			rateLimitGroupAPI:  {Limit: 1, Window: time.Minute, Identity: rateLimitIdentityUser},
+		},
+	}
+	rateLimitMemory = newMemoryRateLimiter()
+	t.Cleanup(func() {
+		config = previousConfig
+		rateLimitMemory = previousMemory
+	})
+
+	send := func(group string, remoteAddr string, user *jwtUser) *httptest.ResponseRecorder {
+		handler := rateLimitMiddleware(group)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = remoteAddr
+		if user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), appContextKeyUser, *user))
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// without Redis the requests are counted in memory, and the headers count down
+	rr := send(rateLimitGroupAuth, "10.0.0.1:1000", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rr.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", rr.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", rr.Header().Get("RateLimit-Policy"))
+	rr = send(rateLimitGroupAuth, "10.0.0.1:1001", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+
+	rr = send(rateLimitGroupAuth, "10.0.0.1:1002", nil)
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.NotEqual(t, "", rr.Header().Get("Retry-After"))
+	res := map[string]interface{}{}
+	json.Unmarshal(rr.Body.Bytes(), &res)
+	assert.Equal(t, api_error_rate_limited, res["error"])
+	assert.Equal(t, rateLimitGroupAuth, res["data"].(map[string]interface{})["group"])
+
+	// another IP has its own count, and groups without a rule aren't limited
+	assert.Equal(t, http.StatusOK, send(rateLimitGroupAuth, "10.0.0.2:1000", nil).Code)
+	rr = send(rateLimitGroupSetup, "10.0.0.1:1003", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "", rr.Header().Get("RateLimit-Limit"))
+
+	// by user, a user and their API key are counted apart, even from the same IP
+	assert.Equal(t, http.StatusOK, send(rateLimitGroupAPI, "10.0.0.3:1000", &jwtUser{ID: 1}).Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(rateLimitGroupAPI, "10.0.0.3:1000", &jwtUser{ID: 1}).Code)
+	assert.Equal(t, http.StatusOK, send(rateLimitGroupAPI, "10.0.0.3:1000", &jwtUser{ID: 1, APIKeyID: 2}).Code)
+	assert.Equal(t, http.StatusOK, send(rateLimitGroupAPI, "10.0.0.3:1000", &jwtUser{}).Code)
+}
+
+func TestRateLimitSlidingWindow(t *testing.T) {
+	limiter := newMemoryRateLimiter()
+	rule := rateLimitRule{Limit: 2, Window: time.Minute}
+	start := time.Now()
+
+	assert.True(t, limiter.check("key", rule, start).Allowed)
+	assert.True(t, limiter.check("key", rule, start.Add(30*time.Second)).Allowed)
+	result := limiter.check("key", rule, start.Add(45*time.Second))
+	assert.False(t, result.Allowed)
+	assert.Equal(t, int64(0), result.Remaining)
+	assert.Equal(t, 15*time.Second, result.Reset)
+
+	// once the first request leaves the window there is room for one more, but not two
+	assert.True(t, limiter.check("key", rule, start.Add(61*time.Second)).Allowed)
+	assert.False(t, limiter.check("key", rule, start.Add(62*time.Second)).Allowed)
+	assert.True(t, limiter.check("other", rule, start.Add(62*time.Second)).Allowed)
+}
+
+func TestRateLimitMemorySweep(t *testing.T) {
+	limiter := newMemoryRateLimiter()
+	limiter.maxKeys = 1
+	hourly := rateLimitRule{Limit: 1, Window: time.Hour}
+	minutely := rateLimitRule{Limit: 1, Window: time.Minute}
+	start := time.Now()
+
+	// at the cap, a key is swept by its own window, not the window of the request that hit the cap
+	assert.True(t, limiter.check("hourly", hourly, start).Allowed)
+	assert.True(t, limiter.check("minutely", minutely, start).Allowed)
+	assert.True(t, limiter.check("other", minutely, start.Add(2*time.Minute)).Allowed)
+	assert.NotContains(t, limiter.requests, "minutely")
+	assert.Contains(t, limiter.requests, "hourly")
+	assert.False(t, limiter.check("hourly", hourly, start.Add(3*time.Minute)).Allowed)
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// routeAdminGetAuditEvents gets the site's audit log, newest first. It can be filtered by actorId, action, targetType,
+// targetId, route, and a from and to time, and paged with count and offset. With ?format=csv, it is sent as a CSV file
+func routeAdminGetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	// validity checked in middleware of router
+	filter, err := getAuditEventFilterFromQuery(r)
+	if err != nil {
+		sendAPIError(w, api_error_audit_bad_query, err, map[string]string{})
+		return
+	}
+	events, err := GetAuditEvents(getSiteIDFromHTTPContext(r), filter)
+	if err != nil {
+		sendAPIError(w, api_error_audit_fetch, err, map[string]string{})
+		return
+	}
+	if r.URL.Query().Get("format") != "csv" {
+		sendAPIJSONData(w, http.StatusOK, events)
+		return
+	}
+
+	rows := [][]string{
+		{"id", "occurredOn", "actorId", "apiKeyId", "action", "method", "route", "path", "targetType", "targetId", "status", "ip", "requestId", "changes", "previousHash", "eventHash"},
+	}
+	for _, event := range events {
+		changes, _ := json.Marshal(event.Changes)
+		rows = append(rows, []string{
+			strconv.FormatInt(event.ID, 10),
+			event.OccurredOn,
+			strconv.FormatInt(event.ActorID, 10),
+			strconv.FormatInt(event.APIKeyID, 10),
+			event.Action,
+			event.Method,
+			event.Route,
+			event.Path,
+			event.TargetType,
+			strconv.FormatInt(event.TargetID, 10),
+			strconv.Itoa(event.Status),
+			event.IP,
+			event.RequestID,
+			string(changes),
+			event.PreviousHash,
+			event.EventHash,
+		})
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment;filename=audit_%s.csv", time.Now().Format("20060102150405")))
+	w.WriteHeader(http.StatusOK)
+	wr := csv.NewWriter(w)
+	wr.WriteAll(rows)
+}
+
+// routeAdminVerifyAuditEvents checks the site's hash chain and reports the first event that was changed or follows a
+// removed event
+func routeAdminVerifyAuditEvents(w http.ResponseWriter, r *http.Request) {
+	// validity checked in middleware of router
+	result, err := VerifyAuditChain(getSiteIDFromHTTPContext(r))
+	if err != nil {
+		sendAPIError(w, api_error_audit_fetch, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, result)
+}
+
+// getAuditEventFilterFromQuery reads the filter from the query string
+func getAuditEventFilterFromQuery(r *http.Request) (*AuditEventFilter, error) {
+	query := r.URL.Query()
+	filter := &AuditEventFilter{
+		Action:     query.Get("action"),
+		TargetType: query.Get("targetType"),
+		Route:      query.Get("route"),
+		From:       query.Get("from"),
+		To:         query.Get("to"),
+	}
+	ints := map[string]*int64{
+		"actorId":  &filter.ActorID,
+		"targetId": &filter.TargetID,
+		"count":    &filter.Count,
+		"offset":   &filter.Offset,
+	}
+	for name, value := range ints {
+		if query.Get(name) == "" {
+			continue
+		}
+		parsed, err := strconv.ParseInt(query.Get(name), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a number", name)
+		}
+		*value = parsed
+	}
+	for _, value := range []string{filter.From, filter.To} {
+		if value == "" {
+			continue
+		}
+		_, err := parseTime(value)
+		if err != nil {
+			return nil, errors.New("from and to must be dates or timestamps")
+		}
+	}
+	if filter.Action != "" && filter.Action != AuditActionRead && filter.Action != AuditActionCreate &&
+		filter.Action != AuditActionUpdate && filter.Action != AuditActionDelete {
+		return nil, errors.New("action must be read, create, update, or delete")
+	}
+	return filter, nil
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditRoutes(t *testing.T) {
+	setupTesting()
+
+	admin := &User{
+		SystemRole: UserSystemRoleAdmin,
+	}
+	err := createTestUser(admin)
+	require.Nil(t, err)
+	defer DeleteUser(admin.ID)
+
+	participant := &User{
+		SystemRole: UserSystemRoleParticipant,
+	}
+	err = createTestUser(participant)
+	require.Nil(t, err)
+	defer DeleteUser(participant.ID)
+
+	project := &Project{}
+	err = createTestProject(project)
+	require.Nil(t, err)
+	defer DeleteProject(project.ID)
+
+	// linking is a change, so it's audited with the link state before and after
+	linkEndpoint := fmt.Sprintf("/admin/projects/%d/users/%d", project.ID, participant.ID)
+	code, res, err := testEndpoint(http.MethodPost, linkEndpoint, nil, routeAdminLinkUserAndProject, admin.Access)
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+
+	events, err := GetAuditEvents(1, &AuditEventFilter{
+		ActorID:    admin.ID,
+		TargetType: "user",
+		TargetID:   participant.ID,
+	})
+	require.Nil(t, err)
+	require.GreaterOrEqual(t, len(events), 1)
+	assert.Equal(t, AuditActionCreate, events[0].Action)
+	assert.Equal(t, "/admin/projects/{projectID}/users/{userID}", events[0].Route)
+	assert.Equal(t, http.StatusOK, events[0].Status)
+	assert.Equal(t, true, events[0].Changes["linked"].After)
+	assert.Equal(t, 64, len(events[0].EventHash))
+
+	// participants can't see the log
+	code, res, err = testEndpoint(http.MethodGet, "/admin/audit", nil, routeAdminGetAuditEvents, participant.Access)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, code, res)
+
+	code, res, err = testEndpoint(http.MethodGet, fmt.Sprintf("/admin/audit?actorId=%d&action=create", admin.ID), nil, routeAdminGetAuditEvents, admin.Access)
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+	found, err := testEndpointResultToSlice(res)
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, len(found), 1)
+
+	code, res, err = testEndpoint(http.MethodGet, "/admin/audit?actorId=someone", nil, routeAdminGetAuditEvents, admin.Access)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, code, res)
+	code, res, err = testEndpoint(http.MethodGet, "/admin/audit?action=remove", nil, routeAdminGetAuditEvents, admin.Access)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, code, res)
+
+	code, res, err = testEndpoint(http.MethodGet, fmt.Sprintf("/admin/audit?format=csv&actorId=%d", admin.ID), nil, routeAdminGetAuditEvents, admin.Access)
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+	assert.True(t, strings.HasPrefix(res.String(), "id,occurredOn,actorId"))
+
+	code, res, err = testEndpoint(http.MethodGet, "/admin/audit/verify", nil, routeAdminVerifyAuditEvents, admin.Access)
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+	verified, err := testEndpointResultToMap(res)
+	assert.Nil(t, err)
+	assert.Equal(t, Yes, verified["valid"])
+
+	// erasing the admin clears who made their events, but the chain still verifies
+	_, err = config.DBConnection.Exec(`UPDATE AuditEvents SET actorId = 0, apiKeyId = 0, ip = '' WHERE id = ?`, events[0].ID)
+	require.Nil(t, err)
+	defer config.DBConnection.Exec(`DELETE FROM AuditEvents WHERE siteId = 1`)
+	verification, err := VerifyAuditChain(1)
+	require.Nil(t, err)
+	assert.Equal(t, Yes, verification.Valid)
+
+	// changing a saved event breaks the chain at that event, including pinning it on someone else
+	_, err = config.DBConnection.Exec(`UPDATE AuditEvents SET actorId = ? WHERE id = ?`, admin.ID+1, events[0].ID)
+	require.Nil(t, err)
+	verification, err = VerifyAuditChain(1)
+	require.Nil(t, err)
+	assert.Equal(t, No, verification.Valid)
+	assert.Equal(t, events[0].ID, verification.FirstInvalidID)
+}
+
+func TestAuditEventHash(t *testing.T) {
+	previousConfig := config
+	config = &apiConfig{AuditKey: "a key"}
+	defer func() {
+		config = previousConfig
+	}()
+	event := &AuditEvent{
+		SiteID:       1,
+		ActorID:      2,
+		IP:           "10.0.0.1",
+		Action:       AuditActionDelete,
+		Method:       http.MethodDelete,
+		Route:        "/admin/projects/{projectID}/consent/responses/{responseID}",
+		TargetType:   "response",
+		TargetID:     3,
+		Status:       http.StatusOK,
+		OccurredOn:   "2026-10-16T10:30:00Z",
+		PreviousHash: strings.Repeat("a", 64),
+		Changes: map[string]AuditChange{
+			"consentStatus": {Before: "accepted"},
+		},
+	}
+	event.processForDB()
+	event.ActorRef = event.actorRef()
+	hashed := event.hash()
+	assert.Equal(t, 64, len(hashed))
+
+	// the hash survives the round trip to the API format
+	event.processForAPI()
+	event.processForDB()
+	assert.Equal(t, hashed, event.hash())
+
+	// any change to the fields, the actor, or the previous event changes the hash
+	actorRef := event.ActorRef
+	event.ActorID = 4
+	event.ActorRef = event.actorRef()
+	assert.NotEqual(t, actorRef, event.ActorRef)
+	assert.NotEqual(t, hashed, event.hash())
+	event.ActorID = 2
+	event.ActorRef = actorRef
+	event.PreviousHash = strings.Repeat("b", 64)
+	assert.NotEqual(t, hashed, event.hash())
+	event.PreviousHash = strings.Repeat("a", 64)
+
+	// the actor is checked against its ref until it is erased
+	assert.True(t, event.actorRefMatches())
+	event.ActorID = 4
+	assert.False(t, event.actorRefMatches())
+	event.ActorID = 0
+	assert.False(t, event.actorRefMatches())
+	event.IP = ""
+	assert.True(t, event.actorRefMatches())
+	event.ActorID = 2
+	event.IP = "10.0.0.1"
+
+	// the hash is keyed, so it can't be recomputed without the key
+	config.AuditKey = "another key"
+	assert.NotEqual(t, hashed, event.hash())
+}
+
+func TestAuditDiff(t *testing.T) {
+	before := &User{
+		ID:         1,
+		FirstName:  "Before",
+		Status:     UserStatusActive,
+		SystemRole: UserSystemRoleUser,
+	}
+	after := *before
+	after.FirstName = "After"
+	after.Status = UserStatusDisabled
+
+	// only what changed is kept, and personal information is redacted
+	changes := diffAuditValues(before, &after)
+	assert.Equal(t, 2, len(changes))
+	assert.Equal(t, UserStatusActive, changes["status"].Before)
+	assert.Equal(t, UserStatusDisabled, changes["status"].After)
+	assert.Equal(t, logRedacted, changes["firstName"].Before)
+	_, ok := changes["systemRole"]
+	assert.False(t, ok)
+
+	// a removal keeps everything as before
+	changes = diffAuditValues(map[string]interface{}{"consentStatus": "accepted"}, nil)
+	assert.Equal(t, "accepted", changes["consentStatus"].Before)
+	assert.Nil(t, changes["consentStatus"].After)
+
+	assert.Equal(t, 0, len(diffAuditValues(nil, nil)))
+	assert.Equal(t, true, diffAuditValues(nil, true)["value"].After)
+}
+
+func TestAuditMiddlewareEvent(t *testing.T) {
+	assert.True(t, shouldAuditRequest(http.MethodPatch, "/admin/site"))
+	assert.True(t, shouldAuditRequest(http.MethodGet, "/admin/users/1"))
+	assert.True(t, shouldAuditRequest(http.MethodGet, "/admin/projects/1/consent/responses"))
+	assert.False(t, shouldAuditRequest(http.MethodGet, "/admin/projects/1"))
+	assert.False(t, shouldAuditRequest(http.MethodOptions, "/admin/site"))
+
+	// the route's change wins over the request body, and the target is the last id in the route
+	var event *AuditEvent
+	r := chi.NewRouter()
+	r.Route("/admin", func(r chi.Router) {
+		// the same as auditMiddleware, keeping the event instead of saving it
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				record := &auditRecord{
+					After: readAuditRequestBody(r),
+				}
+				ctx := context.WithValue(r.Context(), appContextSite, &Site{ID: 1})
+				r = r.WithContext(context.WithValue(ctx, appContextAudit, record))
+				next.ServeHTTP(w, r)
+				event = newAuditEventForRequest(r, http.StatusOK, record)
+			})
+		})
+		r.Post("/projects/{projectID}/users/{userID}", func(w http.ResponseWriter, r *http.Request) {
+			body := map[string]interface{}{}
+			json.NewDecoder(r.Body).Decode(&body)
+			assert.Equal(t, "yes", body["override"])
+			setAuditChange(r, map[string]bool{"linked": false}, map[string]bool{"linked": true})
+		})
+		r.Post("/projects", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/projects/2/users/3", bytes.NewBufferString(`{"override":"yes"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	require.NotNil(t, event)
+	assert.Equal(t, "user", event.TargetType)
+	assert.Equal(t, int64(3), event.TargetID)
+	assert.Equal(t, AuditActionCreate, event.Action)
+	assert.Equal(t, "/admin/projects/{projectID}/users/{userID}", event.Route)
+	assert.Equal(t, true, event.Changes["linked"].After)
+	_, ok := event.Changes["override"]
+	assert.False(t, ok)
+
+	// without a change from the route, the redacted body is kept
+	req = httptest.NewRequest(http.MethodPost, "/admin/projects", bytes.NewBufferString(`{"name":"Study","password":"secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "projects", event.TargetType)
+	assert.Equal(t, int64(0), event.TargetID)
+	assert.Equal(t, "Study", event.Changes["name"].After)
+	assert.Equal(t, logRedacted, event.Changes["password"].After)
+}
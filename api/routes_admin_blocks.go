@@ -39,6 +39,7 @@ func routeAdminCreateBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	input.SiteID = getSiteIDFromHTTPContext(r)
 	err = CreateBlock(input)
 	if err != nil {
 		sendAPIError(w, api_error_block_save, err, map[string]interface{}{
@@ -61,7 +62,7 @@ func routeAdminCreateBlock(w http.ResponseWriter, r *http.Request) {
 
 // routeAdminGetBlocksOnSite gets the meta data about all modules on the platform
 func routeAdminGetBlocksOnSite(w http.ResponseWriter, r *http.Request) {
-	blocks, err := GetBlocksForSite()
+	blocks, err := GetBlocksForSite(getSiteIDFromHTTPContext(r))
 	if err != nil {
 		sendAPIError(w, api_error_block_not_found, err, map[string]interface{}{})
 		return
@@ -88,7 +89,7 @@ func routeAdminGetBlocksForModule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := GetModuleByID(moduleID)
+	_, err := GetModuleByID(getSiteIDFromHTTPContext(r), moduleID)
 	if err != nil {
 		sendAPIError(w, api_error_module_not_found, err, map[string]interface{}{})
 		return
@@ -110,7 +111,7 @@ func routeAdminUnlinkAllBlocksFromModule(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	_, err := GetModuleByID(moduleID)
+	_, err := GetModuleByID(getSiteIDFromHTTPContext(r), moduleID)
 	if err != nil {
 		sendAPIError(w, api_error_module_not_found, err, map[string]interface{}{})
 		return
@@ -134,7 +135,7 @@ func routeAdminGetBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	block, err := GetBlockByID(blockID)
+	block, err := GetBlockByID(getSiteIDFromHTTPContext(r), blockID)
 	if err != nil {
 		sendAPIError(w, api_error_block_not_found, err, map[string]interface{}{})
 		return
@@ -156,7 +157,7 @@ func routeAdminUpdateBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	block, err := GetBlockByID(blockID)
+	block, err := GetBlockByID(getSiteIDFromHTTPContext(r), blockID)
 	if err != nil {
 		sendAPIError(w, api_error_block_not_found, err, map[string]interface{}{})
 		return
@@ -199,7 +200,7 @@ func routeAdminDeleteBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	block, err := GetBlockByID(blockID)
+	block, err := GetBlockByID(getSiteIDFromHTTPContext(r), blockID)
 	if err != nil {
 		sendAPIError(w, api_error_block_not_found, err, map[string]interface{}{})
 		return
@@ -230,12 +231,12 @@ func routeAdminLinkBlockAndModule(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// make sure the module and block both exist
-	_, err := GetModuleByID(moduleID)
+	_, err := GetModuleByID(getSiteIDFromHTTPContext(r), moduleID)
 	if err != nil {
 		sendAPIError(w, api_error_module_not_found, err, map[string]interface{}{})
 		return
 	}
-	_, err = GetBlockByID(blockID)
+	_, err = GetBlockByID(getSiteIDFromHTTPContext(r), blockID)
 	if err != nil {
 		sendAPIError(w, api_error_block_not_found, err, map[string]interface{}{})
 		return
@@ -257,6 +258,9 @@ func routeAdminLinkBlockAndModule(w http.ResponseWriter, r *http.Request) {
 
 // routeAdminUnlinkBlockAndModule unlinks a module and a block
 func routeAdminUnlinkBlockAndModule(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	moduleID, moduleIDErr := strconv.ParseInt(chi.URLParam(r, "moduleID"), 10, 64)
 	blockID, blockIDErr := strconv.ParseInt(chi.URLParam(r, "blockID"), 10, 64)
 	if blockIDErr != nil || moduleIDErr != nil {
@@ -283,6 +287,9 @@ func routeAdminUnlinkBlockAndModule(w http.ResponseWriter, r *http.Request) {
 
 // routeAdminGetUserSubmissions gets a user's list of submissions for a form
 func routeAdminGetUserSubmissions(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
 	blockID, blockIDErr := strconv.ParseInt(chi.URLParam(r, "blockID"), 10, 64)
@@ -296,7 +303,7 @@ func routeAdminGetUserSubmissions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := GetBlockByID(blockID)
+	_, err := GetBlockByID(getSiteIDFromHTTPContext(r), blockID)
 	if err != nil {
 		sendAPIError(w, api_error_block_not_found, err, map[string]interface{}{})
 		return
@@ -315,6 +322,9 @@ func routeAdminGetUserSubmissions(w http.ResponseWriter, r *http.Request) {
 
 // routeAdminDeleteUserSubmissions deletes all submissions for a user
 func routeAdminDeleteUserSubmissions(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
 	moduleID, moduleIDErr := strconv.ParseInt(chi.URLParam(r, "moduleID"), 10, 64)
@@ -329,7 +339,7 @@ func routeAdminDeleteUserSubmissions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := GetBlockByID(blockID)
+	_, err := GetBlockByID(getSiteIDFromHTTPContext(r), blockID)
 	if err != nil {
 		sendAPIError(w, api_error_block_not_found, err, map[string]interface{}{})
 		return
@@ -343,6 +353,9 @@ func routeAdminDeleteUserSubmissions(w http.ResponseWriter, r *http.Request) {
 	for i := range submissions {
 		DeleteBlockFormSubmission(submissions[i].ID)
 	}
+	setAuditChange(r, map[string]interface{}{
+		"submissions": submissions,
+	}, nil)
 
 	status := &BlockUserStatus{
 		UserID:        userID,
@@ -364,6 +377,9 @@ func routeAdminDeleteUserSubmissions(w http.ResponseWriter, r *http.Request) {
 
 // routeAdminGetUserSubmission gets a submission for a user
 func routeAdminGetUserSubmission(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
 	_, moduleIDErr := strconv.ParseInt(chi.URLParam(r, "moduleID"), 10, 64)
@@ -379,7 +395,7 @@ func routeAdminGetUserSubmission(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := GetBlockByID(blockID)
+	_, err := GetBlockByID(getSiteIDFromHTTPContext(r), blockID)
 	if err != nil {
 		sendAPIError(w, api_error_block_not_found, err, map[string]interface{}{})
 		return
@@ -397,6 +413,9 @@ func routeAdminGetUserSubmission(w http.ResponseWriter, r *http.Request) {
 
 // routeAdminDeleteUserSubmission deletes a submission for a user
 func routeAdminDeleteUserSubmission(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
 	moduleID, moduleIDErr := strconv.ParseInt(chi.URLParam(r, "moduleID"), 10, 64)
@@ -412,7 +431,7 @@ func routeAdminDeleteUserSubmission(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := GetBlockByID(blockID)
+	_, err := GetBlockByID(getSiteIDFromHTTPContext(r), blockID)
 	if err != nil {
 		sendAPIError(w, api_error_block_not_found, err, map[string]interface{}{})
 		return
@@ -433,6 +452,7 @@ func routeAdminDeleteUserSubmission(w http.ResponseWriter, r *http.Request) {
 		sendAPIError(w, api_error_submission_delete, err, map[string]string{})
 		return
 	}
+	setAuditChange(r, sub, nil)
 
 	submissions, err := GetBlockFormSubmissionsForUser(userID, blockID)
 	if err != nil {
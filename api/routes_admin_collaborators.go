@@ -0,0 +1,105 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+// NOTE: these are shared by the /admin and /researcher routes; for researchers, the middleware ensures they are an owner
+
+// routeAdminGetProjectCollaborators gets the collaborators on a project
+func routeAdminGetProjectCollaborators(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
+	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
+	if projectIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, projectIDErr, map[string]string{})
+		return
+	}
+	collaborators, err := GetProjectCollaborators(projectID)
+	if err != nil {
+		sendAPIError(w, api_error_project_collaborator_not_found, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, collaborators)
+}
+
+// routeAdminSaveProjectCollaborator adds a researcher to a project or changes their role
+func routeAdminSaveProjectCollaborator(w http.ResponseWriter, r *http.Request) {
+	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
+	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if projectIDErr != nil || userIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
+		return
+	}
+	_, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
+	if err != nil {
+		sendAPIError(w, api_error_project_not_found, err, map[string]string{})
+		return
+	}
+
+	input := &ProjectCollaborator{}
+	render.Bind(r, input)
+	if !isValidProjectCollaboratorRole(input.Role) {
+		sendAPIError(w, api_error_project_collaborator_bad_data, errors.New("invalid role"), map[string]string{
+			"role": input.Role,
+		})
+		return
+	}
+
+	// only researchers can be collaborators; admins already see everything and participants never should
+	user, err := GetSiteUserByID(getSiteIDFromHTTPContext(r), userID)
+	if err != nil {
+		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
+		return
+	}
+	if user.SystemRole != UserSystemRoleUser {
+		sendAPIError(w, api_error_project_collaborator_bad_data, errors.New("user is not a researcher"), map[string]string{
+			"systemRole": user.SystemRole,
+		})
+		return
+	}
+
+	collaborator := &ProjectCollaborator{
+		ProjectID: projectID,
+		UserID:    userID,
+		Role:      input.Role,
+	}
+	err = SaveProjectCollaborator(collaborator)
+	if err != nil {
+		sendAPIError(w, api_error_project_collaborator_save, err, map[string]string{})
+		return
+	}
+	found, err := GetProjectCollaborator(projectID, userID)
+	if err != nil {
+		sendAPIError(w, api_error_project_collaborator_not_found, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, found)
+}
+
+// routeAdminDeleteProjectCollaborator removes a researcher from a project
+func routeAdminDeleteProjectCollaborator(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
+	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
+	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if projectIDErr != nil || userIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
+		return
+	}
+	err := DeleteProjectCollaborator(projectID, userID)
+	if err != nil {
+		sendAPIError(w, api_error_project_collaborator_save, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, map[string]bool{
+		"deleted": true,
+	})
+}
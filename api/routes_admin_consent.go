@@ -12,21 +12,13 @@ import (
 
 // routeAdminSaveConsentForm creates OR updates the consent form
 func routeAdminSaveConsentForm(w http.ResponseWriter, r *http.Request) {
-	results := checkRoutePermissions(w, r, &routePermissionsCheckOptions{
-		MustBeAdmin:     true,
-		ShouldSendError: true,
-	})
-	if !results.IsValid {
-		return
-	}
-
 	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
 	if projectIDErr != nil {
 		sendAPIError(w, api_error_invalid_path, projectIDErr, nil)
 		return
 	}
 
-	project, err := GetProjectByID(projectID)
+	project, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, nil)
 		return
@@ -62,7 +54,7 @@ func routeAdminDeleteConsentForm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	project, err := GetProjectByID(projectID)
+	project, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, nil)
 		return
@@ -97,7 +89,7 @@ func routeAdminGetConsentResponses(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := GetProjectByID(projectID)
+	_, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, nil)
 		return
@@ -120,7 +112,7 @@ func routeAdminGetConsentResponse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := GetProjectByID(projectID)
+	_, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, nil)
 		return
@@ -132,6 +124,10 @@ func routeAdminGetConsentResponse(w http.ResponseWriter, r *http.Request) {
 		sendAPIError(w, api_error_consent_response_get, err, nil)
 		return
 	}
+	if response.ProjectID != projectID {
+		sendAPIError(w, api_error_consent_response_get, errors.New("response not in project"), nil)
+		return
+	}
 
 	sendAPIJSONData(w, http.StatusOK, response)
 }
@@ -145,7 +141,7 @@ func routeAdminDeleteConsentResponse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := GetProjectByID(projectID)
+	_, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, nil)
 		return
@@ -156,11 +152,22 @@ func routeAdminDeleteConsentResponse(w http.ResponseWriter, r *http.Request) {
 		sendAPIError(w, api_error_consent_response_get, err, nil)
 		return
 	}
-	err = RemoveUserFromProjectCompletely(response.ParticipantID, projectID)
+	if response.ProjectID != projectID {
+		sendAPIError(w, api_error_consent_response_get, errors.New("response not in project"), nil)
+		return
+	}
+	requester, _ := getUserFromHTTPContext(r)
+	if response.ParticipantID == 0 {
+		// not connected to a participant, so only the response itself can be removed
+		err = DeleteConsentesponse(response.ID)
+	} else {
+		_, err = EraseUser(response.ParticipantID, projectID, requester.ID, false)
+	}
 	if err != nil {
-		sendAPIError(w, api_error_project_unlink, err, nil)
+		sendAPIError(w, api_error_user_erasure, err, nil)
 		return
 	}
+	setAuditChange(r, response, nil)
 	sendAPIJSONData(w, http.StatusOK, map[string]bool{
 		"removed": true,
 	})
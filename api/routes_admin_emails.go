@@ -0,0 +1,170 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+type projectReminderInput struct {
+	Message string `json:"message"`
+	Status  string `json:"status"` // optional; only remind participants with this project status
+}
+
+// routeAdminGetEmailTemplates gets all of the email templates for the site, including the defaults
+func routeAdminGetEmailTemplates(w http.ResponseWriter, r *http.Request) {
+	site, err := GetSiteFromContext(r.Context())
+	if site == nil || err != nil {
+		sendAPIError(w, api_error_site_get_error, err, nil)
+		return
+	}
+	templates, err := GetEmailTemplatesForSite(site.ID)
+	if err != nil {
+		sendAPIError(w, api_error_email_template_not_found, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, templates)
+}
+
+// routeAdminGetEmailTemplate gets a single email template for the site
+func routeAdminGetEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	site, err := GetSiteFromContext(r.Context())
+	if site == nil || err != nil {
+		sendAPIError(w, api_error_site_get_error, err, nil)
+		return
+	}
+	template, err := GetEmailTemplateForSite(site.ID, chi.URLParam(r, "templateName"))
+	if err != nil {
+		sendAPIError(w, api_error_email_template_not_found, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, template)
+}
+
+// routeAdminSaveEmailTemplate overrides an email template for the site; any field not sent keeps its current value
+func routeAdminSaveEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	site, err := GetSiteFromContext(r.Context())
+	if site == nil || err != nil {
+		sendAPIError(w, api_error_site_get_error, err, nil)
+		return
+	}
+	found, err := GetEmailTemplateForSite(site.ID, chi.URLParam(r, "templateName"))
+	if err != nil {
+		sendAPIError(w, api_error_email_template_not_found, err, map[string]string{})
+		return
+	}
+
+	input := &EmailTemplate{}
+	render.Bind(r, input)
+	if input.Subject != "" {
+		found.Subject = input.Subject
+	}
+	if input.TextBody != "" {
+		found.TextBody = input.TextBody
+	}
+	if input.HTMLBody != "" {
+		found.HTMLBody = input.HTMLBody
+	}
+
+	err = SaveEmailTemplateForSite(found)
+	if err != nil {
+		sendAPIError(w, api_error_email_template_invalid, err, map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, found)
+}
+
+// routeAdminDeleteEmailTemplate removes the site's override and returns the default
+func routeAdminDeleteEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	site, err := GetSiteFromContext(r.Context())
+	if site == nil || err != nil {
+		sendAPIError(w, api_error_site_get_error, err, nil)
+		return
+	}
+	templateName := chi.URLParam(r, "templateName")
+	if _, found := defaultEmailTemplates[templateName]; !found {
+		sendAPIError(w, api_error_email_template_not_found, fmt.Errorf("unknown template %s", templateName), map[string]string{})
+		return
+	}
+	err = DeleteEmailTemplateForSite(site.ID, templateName)
+	if err != nil {
+		sendAPIError(w, api_error_email_template_delete, err, map[string]string{})
+		return
+	}
+	template, err := GetEmailTemplateForSite(site.ID, templateName)
+	if err != nil {
+		sendAPIError(w, api_error_email_template_not_found, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, template)
+}
+
+// routeAdminSendProjectReminders sends the reminder template to every participant in the project that has an email
+func routeAdminSendProjectReminders(w http.ResponseWriter, r *http.Request) {
+	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
+	if projectIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, projectIDErr, map[string]string{})
+		return
+	}
+	site, err := GetSiteFromContext(r.Context())
+	if site == nil || err != nil {
+		sendAPIError(w, api_error_site_get_error, err, nil)
+		return
+	}
+	project, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
+	if err != nil {
+		sendAPIError(w, api_error_project_not_found, err, map[string]string{})
+		return
+	}
+
+	input := &projectReminderInput{}
+	render.Bind(r, input)
+	address, err := getSiteClientAddress(site)
+	if err != nil {
+		sendAPIError(w, api_error_site_get_error, err, nil)
+		return
+	}
+
+	users, err := GetAllUsersInProject(projectID)
+	if err != nil {
+		sendAPIError(w, api_error_users_project, err, map[string]string{})
+		return
+	}
+
+	sent := 0
+	failed := 0
+	for i := range users {
+		if users[i].Email == "" || users[i].Status != UserStatusActive {
+			continue
+		}
+		if input.Status != "" && users[i].ProjectStatus != input.Status {
+			continue
+		}
+		err = sendTemplatedMail(users[i].Email, EmailTemplateReminder, &EmailTemplateData{
+			Site:    site,
+			User:    &users[i],
+			Project: project,
+			Link:    fmt.Sprintf("%s/projects/%d", address, project.ID),
+			Message: input.Message,
+		})
+		if err != nil {
+			failed++
+			continue
+		}
+		sent++
+	}
+	sendAPIJSONData(w, http.StatusOK, map[string]int{
+		"sent":   sent,
+		"failed": failed,
+	})
+}
+
+// Bind binds the data for the HTTP
+func (data *projectReminderInput) Bind(r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/stretchr/testify/suite"
+)
+
+type SuiteTestsEmailRoutes struct {
+	suite.Suite
+}
+
+func TestSuiteTestsEmailRoutes(t *testing.T) {
+	suite.Run(t, new(SuiteTestsEmailRoutes))
+}
+
+func (suite *SuiteTestsEmailRoutes) SetupSuite() {
+	setupTesting()
+}
+
+func (suite *SuiteTestsEmailRoutes) TestEmailTemplateRoutes() {
+	require := suite.Require()
+	b := new(bytes.Buffer)
+	encoder := json.NewEncoder(b)
+
+	admin := &User{
+		SystemRole: UserSystemRoleAdmin,
+	}
+	err := createTestUser(admin)
+	require.Nil(err)
+	defer DeleteUser(admin.ID)
+	user := &User{
+		SystemRole: UserSystemRoleUser,
+	}
+	err = createTestUser(user)
+	require.Nil(err)
+	defer DeleteUser(user.ID)
+
+	site, err := GetSite()
+	require.Nil(err)
+	defer DeleteEmailTemplateForSite(site.ID, EmailTemplateReminder)
+
+	code, res, err := testEndpoint(http.MethodGet, "/admin/site/emails", b, routeAdminGetEmailTemplates, user.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	code, res, err = testEndpoint(http.MethodGet, "/admin/site/emails", b, routeAdminGetEmailTemplates, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	s, err := testEndpointResultToSlice(res)
+	suite.Nil(err)
+	suite.Equal(len(defaultEmailTemplates), len(s))
+
+	code, res, err = testEndpoint(http.MethodGet, "/admin/site/emails/not_real", b, routeAdminGetEmailTemplate, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusNotFound, code, res)
+
+	// bad templates are rejected
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"subject": "{{.NotAField}}",
+	})
+	code, res, err = testEndpoint(http.MethodPut, "/admin/site/emails/"+EmailTemplateReminder, b, routeAdminSaveEmailTemplate, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusBadRequest, code, res)
+
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"subject":  "Don't forget {{.Project.Name}}!",
+		"textBody": "Custom reminder for {{.User.FirstName}}: {{.Message}}",
+	})
+	code, res, err = testEndpoint(http.MethodPut, "/admin/site/emails/"+EmailTemplateReminder, b, routeAdminSaveEmailTemplate, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	m, err := testEndpointResultToMap(res)
+	suite.Nil(err)
+	saved := &EmailTemplate{}
+	mapstructure.Decode(m, saved)
+	suite.Equal(Yes, saved.Customized)
+	suite.Equal(defaultEmailTemplates[EmailTemplateReminder].HTMLBody, saved.HTMLBody)
+
+	// send a reminder to the project participants
+	mailer := &mailerOutbox{
+		Directory: suite.T().TempDir(),
+	}
+	originalMailer := config.Mailer
+	config.Mailer = mailer
+	defer func() {
+		config.Mailer = originalMailer
+	}()
+	project := &Project{}
+	err = createTestProject(project)
+	require.Nil(err)
+	defer DeleteProject(project.ID)
+	participant := &User{
+		SystemRole: UserSystemRoleParticipant,
+	}
+	err = createTestUser(participant)
+	require.Nil(err)
+	defer DeleteUser(participant.ID)
+	err = LinkUserAndProject(participant.ID, project.ID)
+	require.Nil(err)
+	defer UnlinkUserAndProject(participant.ID, project.ID)
+
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"message": "Almost done!",
+	})
+	code, res, err = testEndpoint(http.MethodPost, fmt.Sprintf("/admin/projects/%d/reminders", project.ID), b, routeAdminSendProjectReminders, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	messages := testOutboxMessages(mailer)
+	require.Equal(1, len(messages))
+	suite.Equal(participant.Email, messages[0].To)
+	suite.Equal(fmt.Sprintf("Don't forget %s!", project.Name), messages[0].Subject)
+	suite.True(strings.Contains(messages[0].Text, "Almost done!"))
+
+	// reset it
+	code, res, err = testEndpoint(http.MethodDelete, "/admin/site/emails/"+EmailTemplateReminder, b, routeAdminDeleteEmailTemplate, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	m, err = testEndpointResultToMap(res)
+	suite.Nil(err)
+	reset := &EmailTemplate{}
+	mapstructure.Decode(m, reset)
+	suite.Equal(No, reset.Customized)
+	suite.Equal(defaultEmailTemplates[EmailTemplateReminder].Subject, reset.Subject)
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+// routeAdminEraseUser removes the user's account and everything connected to it. With ?dryRun=yes, nothing is removed
+// and the counts that would be are returned
+func routeAdminEraseUser(w http.ResponseWriter, r *http.Request) {
+	// validity checked in middleware of router
+	requester, _ := getUserFromHTTPContext(r)
+	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if userIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
+		return
+	}
+	_, err := GetSiteUserByID(getSiteIDFromHTTPContext(r), userID)
+	if err != nil {
+		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
+		return
+	}
+
+	receipt, err := EraseUser(userID, 0, requester.ID, isErasureDryRun(r))
+	if errors.Is(err, errUserLastAdmin) {
+		sendAPIError(w, api_error_user_last_admin, err, map[string]string{})
+		return
+	}
+	if err != nil {
+		sendAPIError(w, api_error_user_erasure, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, receipt)
+}
+
+// routeAdminEraseUserFromProject removes the participant's data in the project, keeping their account. With
+// ?dryRun=yes, nothing is removed and the counts that would be are returned
+func routeAdminEraseUserFromProject(w http.ResponseWriter, r *http.Request) {
+	requester, _ := getUserFromHTTPContext(r)
+	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
+	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if projectIDErr != nil || userIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
+		return
+	}
+	_, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
+	if err != nil {
+		sendAPIError(w, api_error_project_not_found, err, map[string]string{})
+		return
+	}
+	_, err = GetSiteUserByID(getSiteIDFromHTTPContext(r), userID)
+	if err != nil {
+		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
+		return
+	}
+
+	receipt, err := EraseUser(userID, projectID, requester.ID, isErasureDryRun(r))
+	if err != nil {
+		sendAPIError(w, api_error_user_erasure, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, receipt)
+}
+
+// routeAdminGetErasureReceipts gets the receipts for every erasure
+func routeAdminGetErasureReceipts(w http.ResponseWriter, r *http.Request) {
+	// validity checked in middleware of router
+	receipts, err := GetErasureReceipts(getSiteIDFromHTTPContext(r))
+	if err != nil {
+		sendAPIError(w, api_error_user_erasure_not_found, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, receipts)
+}
+
+// routeAdminGetErasureReceipt gets a single receipt
+func routeAdminGetErasureReceipt(w http.ResponseWriter, r *http.Request) {
+	// validity checked in middleware of router
+	receiptID, receiptIDErr := strconv.ParseInt(chi.URLParam(r, "receiptID"), 10, 64)
+	if receiptIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
+		return
+	}
+	receipt, err := GetErasureReceiptByID(getSiteIDFromHTTPContext(r), receiptID)
+	if err != nil {
+		sendAPIError(w, api_error_user_erasure_not_found, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, receipt)
+}
+
+// isErasureDryRun checks if the request only wants the counts
+func isErasureDryRun(r *http.Request) bool {
+	return r.URL.Query().Get("dryRun") == Yes
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserErasureRoutes(t *testing.T) {
+	setupTesting()
+
+	admin := &User{
+		SystemRole: UserSystemRoleAdmin,
+	}
+	err := createTestUser(admin)
+	require.Nil(t, err)
+	defer DeleteUser(admin.ID)
+
+	participant := &User{
+		SystemRole: UserSystemRoleParticipant,
+	}
+	err = createTestUser(participant)
+	require.Nil(t, err)
+	defer DeleteUser(participant.ID)
+
+	project := &Project{}
+	err = createTestProject(project)
+	require.Nil(t, err)
+	defer DeleteProject(project.ID)
+
+	// give the participant something in every project table, plus a journal entry outside of it
+	err = LinkUserAndProject(participant.ID, project.ID)
+	require.Nil(t, err)
+	err = CreateConsentResponse(&ConsentResponse{
+		ProjectID:     project.ID,
+		ParticipantID: participant.ID,
+		ConsentStatus: ConsentResponseStatusAccepted,
+	})
+	require.Nil(t, err)
+	err = CreateNote(&Note{
+		UserID:    participant.ID,
+		NoteType:  NoteTypeProject,
+		ProjectID: project.ID,
+		Title:     "Project Note",
+	})
+	require.Nil(t, err)
+	err = CreateNote(&Note{
+		UserID:   participant.ID,
+		NoteType: NoteTypeJournal,
+		Title:    "Journal Note",
+	})
+	require.Nil(t, err)
+	err = SaveBlockUserStatusForParticipant(&BlockUserStatus{
+		UserID:     participant.ID,
+		ProjectID:  project.ID,
+		ModuleID:   1,
+		BlockID:    1,
+		UserStatus: BlockUserStatusStarted,
+	})
+	require.Nil(t, err)
+
+	projectEndpoint := fmt.Sprintf("/admin/projects/%d/users/%d/data", project.ID, participant.ID)
+	code, res, err := testEndpoint(http.MethodDelete, projectEndpoint+"?dryRun=yes", nil, routeAdminEraseUserFromProject, participant.Access)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, code, res)
+
+	// a dry run counts without removing anything
+	code, res, err = testEndpoint(http.MethodDelete, projectEndpoint+"?dryRun=yes", nil, routeAdminEraseUserFromProject, admin.Access)
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+	receipt := testEndpointResultToErasureReceipt(t, res)
+	assert.Equal(t, Yes, receipt.DryRun)
+	assert.Equal(t, int64(0), receipt.ID)
+	assert.Equal(t, ErasureScopeProject, receipt.Scope)
+	assert.Equal(t, int64(1), receipt.Counts["ProjectUserLinks"])
+	assert.Equal(t, int64(1), receipt.Counts["ConsentResponses"])
+	assert.Equal(t, int64(1), receipt.Counts["Notes"])
+	assert.Equal(t, int64(1), receipt.Counts["BlockUserStatus"])
+	assert.True(t, IsUserInProject(participant.ID, project.ID))
+
+	code, res, err = testEndpoint(http.MethodDelete, projectEndpoint, nil, routeAdminEraseUserFromProject, admin.Access)
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+	receipt = testEndpointResultToErasureReceipt(t, res)
+	assert.Equal(t, No, receipt.DryRun)
+	require.NotEqual(t, int64(0), receipt.ID)
+	assert.Equal(t, admin.ID, receipt.RequestedBy)
+	assert.False(t, IsUserInProject(participant.ID, project.ID))
+	responses, err := GetConsentResponsesForProject(project.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(responses))
+
+	// the receipt is kept for the paperwork and the hash still matches
+	code, res, err = testEndpoint(http.MethodGet, fmt.Sprintf("/admin/erasures/%d", receipt.ID), nil, routeAdminGetErasureReceipt, admin.Access)
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+	saved := testEndpointResultToErasureReceipt(t, res)
+	assert.Equal(t, receipt.ReceiptHash, saved.ReceiptHash)
+	assert.Equal(t, receipt.Counts, saved.Counts)
+	found, err := GetErasureReceiptByID(receipt.SiteID, receipt.ID)
+	require.Nil(t, err)
+	assert.Equal(t, found.ReceiptHash, found.hash())
+
+	// the account is still there with the journal, until the participant erases it themselves
+	code, res, err = testEndpoint(http.MethodDelete, "/participant/account?dryRun=yes", nil, routeParticipantEraseAccount, participant.Access)
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+	receipt = testEndpointResultToErasureReceipt(t, res)
+	assert.Equal(t, ErasureScopeAccount, receipt.Scope)
+	assert.Equal(t, int64(1), receipt.Counts["Users"])
+	assert.Equal(t, int64(1), receipt.Counts["Notes"])
+	assert.Equal(t, int64(0), receipt.Counts["ConsentResponses"])
+	assert.NotEqual(t, int64(0), receipt.Counts["Sessions"])
+
+	code, res, err = testEndpoint(http.MethodDelete, "/participant/account", nil, routeParticipantEraseAccount, participant.Access)
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+	receipt = testEndpointResultToErasureReceipt(t, res)
+	assert.Equal(t, participant.ID, receipt.RequestedBy)
+	_, err = GetUserByID(participant.ID)
+	assert.NotNil(t, err)
+	notes, err := GetAllNotesForUser(participant.ID, NoteTypeJournal, &NoteSelectOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(notes))
+
+	// the access token stops working with the session
+	code, res, err = testEndpoint(http.MethodGet, "/me", nil, routeAllGetUserProfile, participant.Access)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, code, res)
+
+	code, res, err = testEndpoint(http.MethodDelete, fmt.Sprintf("/admin/users/%d", participant.ID), nil, routeAdminEraseUser, admin.Access)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, code, res)
+
+	code, res, err = testEndpoint(http.MethodGet, "/admin/erasures", nil, routeAdminGetErasureReceipts, admin.Access)
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+	receipts, err := testEndpointResultToSlice(res)
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, len(receipts), 2)
+}
+
+func TestErasureReceiptHash(t *testing.T) {
+	receipt := &ErasureReceipt{
+		UserID:      1,
+		ProjectID:   2,
+		Scope:       ErasureScopeProject,
+		RequestedBy: 3,
+		Counts: map[string]int64{
+			"Notes":            2,
+			"ProjectUserLinks": 1,
+		},
+	}
+	receipt.processForDB()
+	hashed := receipt.ReceiptHash
+	assert.Equal(t, 64, len(hashed))
+
+	// the hash survives the round trip to the API format
+	receipt.processForAPI()
+	assert.Equal(t, hashed, receipt.hash())
+
+	receipt.Counts["Notes"] = 1
+	receipt.processForDB()
+	assert.NotEqual(t, hashed, receipt.ReceiptHash)
+
+	// moving the receipt to another site breaks it
+	receipt.Counts["Notes"] = 2
+	receipt.SiteID = 2
+	receipt.processForDB()
+	assert.NotEqual(t, hashed, receipt.ReceiptHash)
+
+	// the account steps end with the user so nothing is left pointing at a missing account mid-erasure
+	steps := getErasureSteps(1, 0)
+	assert.Equal(t, "Users", steps[len(steps)-1].Table)
+	for _, step := range getErasureSteps(1, 2) {
+		assert.NotEqual(t, "Users", step.Table)
+	}
+}
+
+func testEndpointResultToErasureReceipt(t *testing.T, res *bytes.Buffer) *ErasureReceipt {
+	m, err := testEndpointResultToMap(res)
+	require.Nil(t, err)
+	receipt := &ErasureReceipt{}
+	err = mapstructure.Decode(m, receipt)
+	require.Nil(t, err)
+	return receipt
+}
@@ -46,6 +46,7 @@ func routeAdminUploadFile(w http.ResponseWriter, r *http.Request) {
 
 	// now save the data in the DB
 	fileInput := &File{
+		SiteID:         getSiteIDFromHTTPContext(r),
 		RemoteKey:      headers.Filename,
 		Display:        headers.Filename,
 		UploadedBy:     admin.ID,
@@ -62,6 +63,7 @@ func routeAdminUploadFile(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	metricFileUploads.Inc()
 	sendAPIJSONData(w, http.StatusCreated, fileInput)
 }
 
@@ -76,7 +78,7 @@ func routeAdminGetFiles(w http.ResponseWriter, r *http.Request) {
 	params := processQuery(r)
 
 	// find the file in the DB to prevent a jump to AWS
-	files, err := GetFilesFromDB(params.SortField, params.SortDir, params.Count, params.Offset)
+	files, err := GetFilesFromDB(getSiteIDFromHTTPContext(r), params.SortField, params.SortDir, params.Count, params.Offset)
 	if err != nil {
 		sendAPIError(w, api_error_file_no_exist, err, nil)
 		return
@@ -101,7 +103,7 @@ func routeAdminReplaceFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// find the file in the DB to prevent a jump to AWS
-	existingFile, err := GetFileFromDB(fileID)
+	existingFile, err := GetFileFromDB(getSiteIDFromHTTPContext(r), fileID)
 	if err != nil {
 		sendAPIError(w, api_error_file_no_exist, err, nil)
 		return
@@ -149,6 +151,7 @@ func routeAdminReplaceFile(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	metricFileUploads.Inc()
 	sendAPIJSONData(w, http.StatusCreated, fileInput)
 }
 
@@ -166,7 +169,7 @@ func routeAdminGetFileMetaData(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// find the file in the DB to prevent a jump to AWS
-	file, err := GetFileFromDB(fileID)
+	file, err := GetFileFromDB(getSiteIDFromHTTPContext(r), fileID)
 	if err != nil {
 		sendAPIError(w, api_error_file_no_exist, err, nil)
 		return
@@ -188,7 +191,7 @@ func routeAdminDeleteFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	file, err := GetFileFromDB(fileID)
+	file, err := GetFileFromDB(getSiteIDFromHTTPContext(r), fileID)
 	if err != nil {
 		sendAPIError(w, api_error_file_no_exist, err, nil)
 		return
@@ -228,7 +231,7 @@ func routeUpdateFileMetadata(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	file, err := GetFileFromDB(fileID)
+	file, err := GetFileFromDB(getSiteIDFromHTTPContext(r), fileID)
 	if err != nil {
 		sendAPIError(w, api_error_file_no_exist, err, nil)
 		return
@@ -269,7 +272,7 @@ func routeAdminDownloadFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// find the file in the DB to prevent a jump to AWS
-	file, err := GetFileFromDB(fileID)
+	file, err := GetFileFromDB(getSiteIDFromHTTPContext(r), fileID)
 	if err != nil {
 		sendAPIError(w, api_error_file_no_exist, fileIDErr, nil)
 		return
@@ -281,5 +284,6 @@ func routeAdminDownloadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// TODO: get the content type from the extension
+	metricFileDownloads.Inc()
 	sendAPIFileData(w, http.StatusOK, "octet/binary", data)
 }
@@ -20,6 +20,7 @@ func routeAdminCreateModule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	input.SiteID = getSiteIDFromHTTPContext(r)
 	err := CreateModule(input)
 	if err != nil {
 		sendAPIError(w, api_error_module_save, err, map[string]interface{}{
@@ -33,7 +34,7 @@ func routeAdminCreateModule(w http.ResponseWriter, r *http.Request) {
 
 // routeAdminGetAllSiteModules gets all of the modules created on a site
 func routeAdminGetAllSiteModules(w http.ResponseWriter, r *http.Request) {
-	mods, err := GetAllModulesForSite()
+	mods, err := GetAllModulesForSite(getSiteIDFromHTTPContext(r))
 	if err != nil {
 		sendAPIError(w, api_error_module_not_found, err, map[string]interface{}{
 			"error": err.Error(),
@@ -51,7 +52,7 @@ func routeAdminGetModuleByID(w http.ResponseWriter, r *http.Request) {
 		sendAPIError(w, api_error_invalid_path, moduleErr, map[string]string{})
 		return
 	}
-	found, err := GetModuleByID(moduleID)
+	found, err := GetModuleByID(getSiteIDFromHTTPContext(r), moduleID)
 	if err != nil {
 		sendAPIError(w, api_error_module_not_found, err, map[string]interface{}{
 			"moduleID": moduleID,
@@ -70,7 +71,7 @@ func routeAdminUpdateModule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	found, err := GetModuleByID(moduleID)
+	found, err := GetModuleByID(getSiteIDFromHTTPContext(r), moduleID)
 	if err != nil {
 		sendAPIError(w, api_error_module_not_found, err, map[string]interface{}{
 			"moduleID": moduleID,
@@ -104,6 +105,9 @@ func routeAdminUpdateModule(w http.ResponseWriter, r *http.Request) {
 
 // routeAdminDeleteModule deletes a module and removes it from all flows
 func routeAdminDeleteModule(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	moduleID, moduleErr := strconv.ParseInt(chi.URLParam(r, "moduleID"), 10, 64)
 	if moduleErr != nil {
 		sendAPIError(w, api_error_invalid_path, moduleErr, map[string]string{})
@@ -124,6 +128,9 @@ func routeAdminDeleteModule(w http.ResponseWriter, r *http.Request) {
 
 // routeAdminGetModulesOnProject gets all the modules on the platform
 func routeAdminGetModulesOnProject(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
 	if projectIDErr != nil {
 		sendAPIError(w, api_error_invalid_path, projectIDErr, map[string]string{})
@@ -152,7 +159,7 @@ func routeAdminLinkModuleAndProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := GetProjectByID(projectID)
+	_, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, map[string]interface{}{
 			"projectID": projectID,
@@ -160,7 +167,7 @@ func routeAdminLinkModuleAndProject(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	_, err = GetModuleByID(moduleID)
+	_, err = GetModuleByID(getSiteIDFromHTTPContext(r), moduleID)
 	if err != nil {
 		sendAPIError(w, api_error_module_not_found, err, map[string]interface{}{
 			"projectID": projectID,
@@ -191,7 +198,7 @@ func routeAdminUnlinkModuleAndProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := GetProjectByID(projectID)
+	_, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, map[string]interface{}{
 			"projectID": projectID,
@@ -199,7 +206,7 @@ func routeAdminUnlinkModuleAndProject(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	_, err = GetModuleByID(moduleID)
+	_, err = GetModuleByID(getSiteIDFromHTTPContext(r), moduleID)
 	if err != nil {
 		sendAPIError(w, api_error_module_not_found, err, map[string]interface{}{
 			"projectID": projectID,
@@ -229,7 +236,7 @@ func routeAdminUnlinkAllModulesFromProject(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	_, err := GetProjectByID(projectID)
+	_, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, map[string]interface{}{
 			"projectID": projectID,
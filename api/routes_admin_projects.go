@@ -1,7 +1,9 @@
 package api
 
 import (
+	"encoding/csv"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -63,12 +65,13 @@ func routeAdminUpdateProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	found, err := GetProjectByID(projectID)
+	found, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, map[string]string{})
 		return
 	}
 
+	before := *found
 	input := &Project{}
 	render.Bind(r, input)
 
@@ -125,12 +128,16 @@ func routeAdminUpdateProject(w http.ResponseWriter, r *http.Request) {
 	if input.EndDate != found.EndDate {
 		found.EndDate = input.EndDate
 	}
+	if input.RequireChallenge != "" && input.RequireChallenge != found.RequireChallenge {
+		found.RequireChallenge = input.RequireChallenge
+	}
 
 	err = UpdateProject(found)
 	if err != nil {
 		sendAPIError(w, api_error_project_save, err, map[string]string{})
 		return
 	}
+	setAuditChange(r, before, found)
 	sendAPIJSONData(w, http.StatusOK, found)
 }
 
@@ -142,7 +149,7 @@ func routeAdminGetProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	found, err := GetProjectByID(projectID)
+	found, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, map[string]string{})
 		return
@@ -175,7 +182,7 @@ func routeAdminGetUsersOnProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := GetProjectByID(projectID)
+	_, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, map[string]string{})
 		return
@@ -190,6 +197,9 @@ func routeAdminGetUsersOnProject(w http.ResponseWriter, r *http.Request) {
 
 // routeAdminGetProjectsForUser gets the projects for a user
 func routeAdminGetProjectsForUser(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	if userIDErr != nil {
 		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
@@ -206,6 +216,9 @@ func routeAdminGetProjectsForUser(w http.ResponseWriter, r *http.Request) {
 
 // routeAdminLinkUserAndProject links a user to a project
 func routeAdminGetProjectForUser(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
 	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	if projectIDErr != nil || userIDErr != nil {
@@ -213,7 +226,7 @@ func routeAdminGetProjectForUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := GetProjectByID(projectID)
+	_, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, map[string]string{})
 		return
@@ -235,6 +248,9 @@ func routeAdminGetProjectForUser(w http.ResponseWriter, r *http.Request) {
 
 // routeAdminLinkUserAndProject links a user to a project
 func routeAdminLinkUserAndProject(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
 	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	if projectIDErr != nil || userIDErr != nil {
@@ -242,18 +258,20 @@ func routeAdminLinkUserAndProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := GetProjectByID(projectID)
+	_, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, map[string]string{})
 		return
 	}
 
 	// if they are an admin, they can do everything, so ignore pre-reqs
+	wasLinked := IsUserInProject(userID, projectID)
 	err = LinkUserAndProject(userID, projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_link, err, map[string]string{})
 		return
 	}
+	setAuditChange(r, map[string]bool{"linked": wasLinked}, map[string]bool{"linked": true})
 	sendAPIJSONData(w, http.StatusOK, map[string]bool{
 		"linked": true,
 	})
@@ -261,6 +279,9 @@ func routeAdminLinkUserAndProject(w http.ResponseWriter, r *http.Request) {
 
 // routeAdminUnlinkUserAndProject unlinks a user to a project
 func routeAdminUnlinkUserAndProject(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
 	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	if projectIDErr != nil || userIDErr != nil {
@@ -270,25 +291,99 @@ func routeAdminUnlinkUserAndProject(w http.ResponseWriter, r *http.Request) {
 
 	removeProgress := r.URL.Query().Get("remove") // if it's anything other than blank, we remove it
 
-	_, err := GetProjectByID(projectID)
+	_, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, map[string]string{})
 		return
 	}
 
 	// if they are an admin, they can do everything
-	err = UnlinkUserAndProject(userID, projectID)
-	if err != nil {
-		sendAPIError(w, api_error_project_link, err, map[string]string{})
-		return
+	setAuditChange(r, map[string]bool{"linked": IsUserInProject(userID, projectID)}, map[string]interface{}{
+		"linked":          false,
+		"removedProgress": removeProgress != "",
+	})
+	if removeProgress != "" {
+		requester, _ := getUserFromHTTPContext(r)
+		_, err = EraseUser(userID, projectID, requester.ID, false)
+		if err != nil {
+			sendAPIError(w, api_error_user_erasure, err, map[string]string{})
+			return
+		}
+	} else {
+		err = UnlinkUserAndProject(userID, projectID)
+		if err != nil {
+			sendAPIError(w, api_error_project_link, err, map[string]string{})
+			return
+		}
 	}
 	sendAPIJSONData(w, http.StatusOK, map[string]bool{
 		"linked": false,
 	})
+}
 
-	if removeProgress != "" {
-		// TODO: remove the progress after the HTTP call is returned to the client
-		// implement when participant progress is built
+// routeAdminCreateParticipantBatch pre-generates participant code logins for the project, such as for handing out on
+// paper during a lab session. The passwords are only in this response; format can be json (default), csv, or html for a
+// printable sheet
+func routeAdminCreateParticipantBatch(w http.ResponseWriter, r *http.Request) {
+	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
+	if projectIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
+		return
+	}
+	project, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
+	if err != nil {
+		sendAPIError(w, api_error_project_not_found, err, map[string]string{})
+		return
+	}
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = ParticipantBatchFormatJSON
+	}
+	if format != ParticipantBatchFormatJSON && format != ParticipantBatchFormatCSV && format != ParticipantBatchFormatHTML {
+		sendAPIError(w, api_error_project_batch_bad_data, nil, map[string]string{
+			"format": "must be one of json, csv, html",
+		})
+		return
+	}
+
+	input := &ParticipantBatchRequest{}
+	render.Bind(r, input)
+
+	credentials, err := CreateParticipantBatchForProject(project, input)
+	if errors.Is(err, errParticipantBatchBadCount) {
+		sendAPIError(w, api_error_project_batch_bad_data, err, map[string]string{})
+		return
+	}
+	if errors.Is(err, errParticipantBatchMaxReached) {
+		sendAPIError(w, api_error_project_batch_max_reached, err, map[string]int64{
+			"max":     project.MaxParticipants,
+			"current": project.ParticipantCount,
+		})
+		return
+	}
+	if err != nil {
+		sendAPIError(w, api_error_project_batch_save, err, map[string]string{})
+		return
 	}
 
+	// the passwords are in the body, so nothing along the way should keep a copy
+	w.Header().Set("Cache-Control", "no-store")
+	switch format {
+	case ParticipantBatchFormatCSV:
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment;filename=participants_%d.csv", projectID))
+		w.WriteHeader(http.StatusCreated)
+		wr := csv.NewWriter(w)
+		wr.Write([]string{"participantCode", "password", "userId", "consentResponseId"})
+		for _, credential := range credentials {
+			wr.Write([]string{credential.ParticipantCode, credential.Password, strconv.FormatInt(credential.UserID, 10), strconv.FormatInt(credential.ConsentResponseID, 10)})
+		}
+		wr.Flush()
+	case ParticipantBatchFormatHTML:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		writeParticipantBatchSheet(w, getSiteFromHTTPContext(r), project, credentials)
+	default:
+		sendAPIJSONData(w, http.StatusCreated, credentials)
+	}
 }
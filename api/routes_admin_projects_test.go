@@ -4,9 +4,12 @@ package api
 
 import (
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/mitchellh/mapstructure"
@@ -173,3 +176,105 @@ func (suite SuiteTestsProjectRoutes) TestProjectRoutesCRUD() {
 	suite.Equal("", found.ShowStatus)
 
 }
+
+func (suite *SuiteTestsProjectRoutes) TestProjectParticipantBatch() {
+	require := suite.Require()
+	admin := &User{
+		SystemRole: UserSystemRoleAdmin,
+	}
+	err := createTestUser(admin)
+	require.Nil(err)
+	defer DeleteUser(admin.ID)
+
+	project := &Project{
+		ParticipantVisibility:           ProjectParticipantVisibilityCode,
+		ConnectParticipantToConsentForm: Yes,
+		MaxParticipants:                 5,
+	}
+	err = createTestProject(project)
+	require.Nil(err)
+	defer DeleteProject(project.ID)
+
+	b := new(bytes.Buffer)
+	encoder := json.NewEncoder(b)
+
+	// bad counts and formats
+	encoder.Encode(map[string]interface{}{
+		"count": 0,
+	})
+	code, res, err := testEndpoint(http.MethodPost, fmt.Sprintf("/admin/projects/%d/participants/batch", project.ID), b, routeAdminCreateParticipantBatch, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusBadRequest, code, res)
+
+	b.Reset()
+	encoder.Encode(map[string]interface{}{
+		"count": 6,
+	})
+	code, res, err = testEndpoint(http.MethodPost, fmt.Sprintf("/admin/projects/%d/participants/batch", project.ID), b, routeAdminCreateParticipantBatch, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusBadRequest, code, res)
+
+	b.Reset()
+	encoder.Encode(map[string]interface{}{
+		"count":        2,
+		"paperConsent": Yes,
+	})
+	code, res, err = testEndpoint(http.MethodPost, fmt.Sprintf("/admin/projects/%d/participants/batch?format=pdf", project.ID), bytes.NewBuffer(b.Bytes()), routeAdminCreateParticipantBatch, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusBadRequest, code, res)
+
+	// json
+	code, res, err = testEndpoint(http.MethodPost, fmt.Sprintf("/admin/projects/%d/participants/batch", project.ID), bytes.NewBuffer(b.Bytes()), routeAdminCreateParticipantBatch, admin.Access)
+	suite.Nil(err)
+	require.Equal(http.StatusCreated, code, res)
+	list, err := testEndpointResultToSlice(res)
+	suite.Nil(err)
+	require.Equal(2, len(list))
+	credential := &ParticipantBatchCredential{}
+	err = mapstructure.Decode(list[0], credential)
+	suite.Nil(err)
+	defer DeleteUser(credential.UserID)
+	second := &ParticipantBatchCredential{}
+	mapstructure.Decode(list[1], second)
+	defer DeleteUser(second.UserID)
+	suite.NotEqual(credential.ParticipantCode, second.ParticipantCode)
+	suite.NotEqual(int64(0), credential.ConsentResponseID)
+	suite.True(IsUserInProject(credential.UserID, project.ID))
+
+	// only the hash is stored, and the login works
+	found, err := GetUserByParticipantCode(project.SiteID, credential.ParticipantCode)
+	require.Nil(err)
+	suite.Equal(UserSystemRoleParticipant, found.SystemRole)
+	_, err = AttemptLoginForUser(project.SiteID, credential.ParticipantCode, credential.Password)
+	suite.Nil(err)
+
+	response, err := GetConsentResponseByID(credential.ConsentResponseID)
+	require.Nil(err)
+	suite.Equal(credential.UserID, response.ParticipantID)
+	suite.Equal(ConsentResponseStatusAccepted, response.ConsentStatus)
+
+	// csv and the printable sheet
+	b.Reset()
+	encoder.Encode(map[string]interface{}{
+		"count": 1,
+	})
+	code, res, err = testEndpoint(http.MethodPost, fmt.Sprintf("/admin/projects/%d/participants/batch?format=csv", project.ID), bytes.NewBuffer(b.Bytes()), routeAdminCreateParticipantBatch, admin.Access)
+	suite.Nil(err)
+	require.Equal(http.StatusCreated, code, res)
+	rows, err := csv.NewReader(res).ReadAll()
+	suite.Nil(err)
+	require.Equal(2, len(rows))
+	suite.Equal("participantCode", rows[0][0])
+	csvUserID, _ := strconv.ParseInt(rows[1][2], 10, 64)
+	defer DeleteUser(csvUserID)
+
+	code, res, err = testEndpoint(http.MethodPost, fmt.Sprintf("/admin/projects/%d/participants/batch?format=html", project.ID), bytes.NewBuffer(b.Bytes()), routeAdminCreateParticipantBatch, admin.Access)
+	suite.Nil(err)
+	require.Equal(http.StatusCreated, code, res)
+	suite.Contains(res.String(), "Participant code")
+	sheetUser, err := getUserByLogin(project.SiteID, strings.SplitN(strings.SplitN(res.String(), "Participant code: <code>", 2)[1], "<", 2)[0])
+	if err == nil {
+		defer DeleteUser(sheetUser.ID)
+	}
+	suite.Nil(err)
+}
@@ -13,6 +13,9 @@ import (
 
 // ReportGetCountOfUsersOnProjectByStatus gets a report of users on project by their status
 func routeAdminReportGetCountOfUsersOnProjectByStatus(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
 	if projectIDErr != nil {
 		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
@@ -28,6 +31,9 @@ func routeAdminReportGetCountOfUsersOnProjectByStatus(w http.ResponseWriter, r *
 
 // routeAdminReportGetCountOfLastUpdatedForProject gets count of users on project by last updated time
 func routeAdminReportGetCountOfLastUpdatedForProject(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
 	if projectIDErr != nil {
 		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
@@ -63,6 +69,9 @@ func routeAdminReportGetCountOfLastUpdatedForProject(w http.ResponseWriter, r *h
 
 // routeAdminReportGetCountOfStatusForProject gets all of the flows and the count of users with each status for that block
 func routeAdminReportGetCountOfStatusForProject(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
 	if projectIDErr != nil {
 		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
@@ -78,6 +87,9 @@ func routeAdminReportGetCountOfStatusForProject(w http.ResponseWriter, r *http.R
 
 // routeAdminReportGetSubmissionCountForProject gets a report of all forms in the project and the count of their submissions for comparison
 func routeAdminReportGetSubmissionCountForProject(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
 	if projectIDErr != nil {
 		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
@@ -93,6 +105,9 @@ func routeAdminReportGetSubmissionCountForProject(w http.ResponseWriter, r *http
 
 // routeAdminReportGetProjectSubmissionResponses gets the submissions responses report
 func routeAdminReportGetProjectSubmissionResponses(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
 	moduleID, moduleIDErr := strconv.ParseInt(chi.URLParam(r, "moduleID"), 10, 64)
 	blockID, blockIDErr := strconv.ParseInt(chi.URLParam(r, "blockID"), 10, 64)
@@ -111,7 +126,7 @@ func routeAdminReportGetProjectSubmissionResponses(w http.ResponseWriter, r *htt
 		return
 	}
 
-	block, err := GetBlockByID(blockID)
+	block, err := GetBlockByID(getSiteIDFromHTTPContext(r), blockID)
 	if err != nil {
 		sendAPIError(w, api_error_block_not_found, err, map[string]string{})
 		return
@@ -182,6 +197,9 @@ func routeAdminReportGetProjectSubmissionResponses(w http.ResponseWriter, r *htt
 
 // routeAdminReportExportProjectSubmissionResponses exports the submissions responses report
 func routeAdminReportExportProjectSubmissionResponses(w http.ResponseWriter, r *http.Request) {
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
 	projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
 	moduleID, moduleIDErr := strconv.ParseInt(chi.URLParam(r, "moduleID"), 10, 64)
 	blockID, blockIDErr := strconv.ParseInt(chi.URLParam(r, "blockID"), 10, 64)
@@ -2,6 +2,7 @@ package api
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -12,12 +13,13 @@ import (
 // routeAdminUpdateSite updates the site
 func routeAdminUpdateSite(w http.ResponseWriter, r *http.Request) {
 	// validity checked in middleware of router
-	site, err := GetSite()
+	site, err := GetSiteFromContext(r.Context())
 	if err != nil {
 		sendAPIError(w, api_error_site_get_error, err, map[string]string{})
 		return
 	}
 
+	before := *site
 	input := &Site{}
 	render.Bind(r, input)
 
@@ -25,6 +27,14 @@ func routeAdminUpdateSite(w http.ResponseWriter, r *http.Request) {
 		site.Description = input.Description
 	}
 	if input.Domain != "" {
+		// each domain can only serve one site
+		existing, err := GetSiteByDomain(input.Domain)
+		if err == nil && existing.ID != site.ID {
+			sendAPIError(w, api_error_site_domain_taken, errors.New("domain taken"), map[string]string{
+				"domain": input.Domain,
+			})
+			return
+		}
 		site.Domain = input.Domain
 	}
 	if input.Name != "" {
@@ -42,11 +52,44 @@ func routeAdminUpdateSite(w http.ResponseWriter, r *http.Request) {
 	if input.Status != "" {
 		site.Status = input.Status
 	}
+	if input.AllowUnverifiedLogin != "" {
+		site.AllowUnverifiedLogin = input.AllowUnverifiedLogin
+	}
+	if input.RequireAdminMFA != "" {
+		site.RequireAdminMFA = input.RequireAdminMFA
+	}
+	if input.ChallengeProvider != "" {
+		if !isValidChallengeProvider(input.ChallengeProvider) {
+			sendAPIError(w, api_error_site_invalid_challenge, errors.New("invalid challenge provider"), map[string]string{
+				"challengeProvider": input.ChallengeProvider,
+			})
+			return
+		}
+		site.ChallengeProvider = input.ChallengeProvider
+	}
+	if input.ChallengeSiteKey != "" {
+		site.ChallengeSiteKey = input.ChallengeSiteKey
+	}
+	// the lists are replaced if sent, so an empty list clears them
+	if input.AllowedOrigins != nil {
+		site.AllowedOrigins = input.AllowedOrigins
+	}
+	if input.TrustedProxies != nil {
+		_, err = parseTrustedProxies(input.TrustedProxies)
+		if err != nil {
+			sendAPIError(w, api_error_site_invalid_proxies, err, map[string]interface{}{
+				"trustedProxies": input.TrustedProxies,
+			})
+			return
+		}
+		site.TrustedProxies = input.TrustedProxies
+	}
 	err = UpdateSite(site)
 	if err != nil {
 		sendAPIError(w, api_error_site_save, err, map[string]string{})
 		return
 	}
+	setAuditChange(r, before, site)
 	sendAPIJSONData(w, http.StatusOK, site)
 }
 
@@ -54,7 +97,7 @@ func routeAdminUpdateSite(w http.ResponseWriter, r *http.Request) {
 func routeAdminGetUsersOnPlatform(w http.ResponseWriter, r *http.Request) {
 	// validity checked in middleware of router
 
-	users, err := GetAllUsersOnPlatform()
+	users, err := GetAllUsersOnPlatform(getSiteIDFromHTTPContext(r))
 	if err != nil {
 		sendAPIError(w, api_error_users_site, err, map[string]string{})
 		return
@@ -71,10 +114,370 @@ func routeAdminGetUserOnPlatform(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	users, err := GetUserByID(userID)
+	users, err := GetSiteUserByID(getSiteIDFromHTTPContext(r), userID)
 	if err != nil {
 		sendAPIError(w, api_error_users_site, err, map[string]string{})
 		return
 	}
 	sendAPIJSONData(w, http.StatusOK, users)
 }
+
+// routeAdminGetUserSessions gets the active sessions for a user
+func routeAdminGetUserSessions(w http.ResponseWriter, r *http.Request) {
+	// validity checked in middleware of router
+	if !checkPathIsOnSite(w, r) {
+		return
+	}
+	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if userIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
+		return
+	}
+
+	sessions, err := GetSessionsForUser(userID)
+	if err != nil {
+		sendAPIError(w, api_error_user_sessions, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, sessions)
+}
+
+// routeAdminRevokeUserSessions revokes every session for a user, logging them out on all devices
+func routeAdminRevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	// validity checked in middleware of router
+	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if userIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
+		return
+	}
+
+	_, err := GetSiteUserByID(getSiteIDFromHTTPContext(r), userID)
+	if err != nil {
+		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
+		return
+	}
+	err = RevokeAllSessionsForUser(userID)
+	if err != nil {
+		sendAPIError(w, api_error_user_session_revoke, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, map[string]bool{
+		"revoked": true,
+	})
+}
+
+// routeAdminResetUserMFA turns off two-factor authentication for a user that lost their device and recovery codes
+func routeAdminResetUserMFA(w http.ResponseWriter, r *http.Request) {
+	// validity checked in middleware of router
+	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if userIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
+		return
+	}
+
+	_, err := GetSiteUserByID(getSiteIDFromHTTPContext(r), userID)
+	if err != nil {
+		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
+		return
+	}
+	err = DisableMFAForUser(userID)
+	if err != nil {
+		sendAPIError(w, api_error_user_mfa_save, err, map[string]string{})
+		return
+	}
+	// whoever had the device should not stay logged in
+	err = RevokeAllSessionsForUser(userID)
+	if err != nil {
+		sendAPIError(w, api_error_user_session_revoke, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, map[string]string{
+		"mfaEnabled": No,
+	})
+}
+
+// routeAdminUnlockUser unlocks a user that was locked after too many failed logins
+func routeAdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	// validity checked in middleware of router
+	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if userIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
+		return
+	}
+
+	user, err := GetSiteUserByID(getSiteIDFromHTTPContext(r), userID)
+	if err != nil {
+		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
+		return
+	}
+	err = UnlockUser(user)
+	if err != nil {
+		sendAPIError(w, api_error_user_unlock, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, user)
+}
+
+type adminInviteUserInput struct {
+	Email      string `json:"email"`
+	Title      string `json:"title"`
+	FirstName  string `json:"firstName"`
+	LastName   string `json:"lastName"`
+	Pronouns   string `json:"pronouns"`
+	SystemRole string `json:"systemRole"`
+	Message    string `json:"message"` // optional, included in the invitation email
+}
+
+// routeAdminInviteUser creates a pending researcher or admin account and emails them a link to choose a password
+func routeAdminInviteUser(w http.ResponseWriter, r *http.Request) {
+	// validity checked in middleware of router
+	input := &adminInviteUserInput{}
+	render.Bind(r, input)
+
+	user := &User{
+		Email:      input.Email,
+		Title:      input.Title,
+		FirstName:  input.FirstName,
+		LastName:   input.LastName,
+		Pronouns:   input.Pronouns,
+		SystemRole: input.SystemRole,
+	}
+	err := InviteUser(getSiteFromHTTPContext(r), user, input.Message)
+	if errors.Is(err, errInvitationBadData) {
+		sendAPIError(w, api_error_user_bad_data, err, map[string]string{})
+		return
+	}
+	if errors.Is(err, errInvitationEmailTaken) {
+		sendAPIError(w, api_error_user_email_taken, err, map[string]string{})
+		return
+	}
+	if err != nil {
+		sendAPIError(w, api_error_user_invitation, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusCreated, user)
+}
+
+// routeAdminResendUserInvitation sends a new invitation link to a user that has not accepted yet
+func routeAdminResendUserInvitation(w http.ResponseWriter, r *http.Request) {
+	// validity checked in middleware of router
+	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if userIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
+		return
+	}
+	user, err := GetSiteUserByID(getSiteIDFromHTTPContext(r), userID)
+	if err != nil {
+		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
+		return
+	}
+	input := &adminInviteUserInput{}
+	render.Bind(r, input)
+
+	err = SendInvitationForUser(getSiteFromHTTPContext(r), user, input.Message)
+	if errors.Is(err, errInvitationNotPending) {
+		sendAPIError(w, api_error_user_invitation_accepted, err, map[string]string{})
+		return
+	}
+	if err != nil {
+		sendAPIError(w, api_error_user_invitation, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, map[string]bool{
+		"sent": true,
+	})
+}
+
+// routeAdminUpdateUser updates a user's profile, system role, and status. The last active admin cannot be demoted
+// or disabled. Changing the role or status logs the user out everywhere so their tokens pick up the change
+func routeAdminUpdateUser(w http.ResponseWriter, r *http.Request) {
+	// validity checked in middleware of router
+	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if userIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
+		return
+	}
+	user, err := GetSiteUserByID(getSiteIDFromHTTPContext(r), userID)
+	if err != nil {
+		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
+		return
+	}
+
+	before := *user
+	input := &User{}
+	render.Bind(r, input)
+
+	if input.SystemRole != "" && input.SystemRole != UserSystemRoleUser && input.SystemRole != UserSystemRoleAdmin && input.SystemRole != UserSystemRoleParticipant {
+		sendAPIError(w, api_error_user_bad_data, nil, map[string]string{
+			"systemRole": "must be one of user, admin, participant",
+		})
+		return
+	}
+	// locked is only set by failed logins, since a password reset undoes it; an admin disables the user instead
+	if input.Status != "" && input.Status != UserStatusActive && input.Status != UserStatusPending && input.Status != UserStatusDisabled && (input.Status != UserStatusLocked || user.Status != UserStatusLocked) {
+		sendAPIError(w, api_error_user_bad_data, nil, map[string]string{
+			"status": "must be one of active, pending, disabled",
+		})
+		return
+	}
+	newSystemRole := user.SystemRole
+	if input.SystemRole != "" {
+		newSystemRole = input.SystemRole
+	}
+	newStatus := user.Status
+	if input.Status != "" {
+		newStatus = input.Status
+	}
+	err = checkUserIsNotLastAdmin(user, newSystemRole, newStatus)
+	if errors.Is(err, errUserLastAdmin) {
+		sendAPIError(w, api_error_user_last_admin, err, map[string]string{})
+		return
+	}
+	if err != nil {
+		sendAPIError(w, api_error_user_general, err, map[string]string{})
+		return
+	}
+	accessChanged := newSystemRole != user.SystemRole || newStatus != user.Status
+	user.SystemRole = newSystemRole
+	user.Status = newStatus
+
+	if input.Title != "" {
+		user.Title = input.Title
+	}
+	if input.FirstName != "" {
+		user.FirstName = input.FirstName
+	}
+	if input.LastName != "" {
+		user.LastName = input.LastName
+	}
+	if input.Pronouns != "" {
+		user.Pronouns = input.Pronouns
+	}
+	if input.DateOfBirth != "" {
+		user.DateOfBirth = input.DateOfBirth
+	}
+	emailChanged := false
+	if input.Email != "" && input.Email != user.Email {
+		taken, err := isUserEmailTaken(user.SiteID, input.Email)
+		if err != nil {
+			sendAPIError(w, api_error_user_general, err, map[string]string{})
+			return
+		}
+		if taken {
+			sendAPIError(w, api_error_user_bad_data, errors.New("email already used on the site"), map[string]string{
+				"email": "is already used by another user",
+			})
+			return
+		}
+		user.Email = input.Email
+		user.EmailVerified = No
+		emailChanged = true
+	}
+	if input.ParticipantCode != "" && input.ParticipantCode != user.ParticipantCode {
+		taken, err := isUserParticipantCodeTaken(user.SiteID, input.ParticipantCode)
+		if err != nil {
+			sendAPIError(w, api_error_user_general, err, map[string]string{})
+			return
+		}
+		if taken {
+			sendAPIError(w, api_error_user_bad_data, errors.New("participant code already used on the site"), map[string]string{
+				"participantCode": "is already used by another user",
+			})
+			return
+		}
+		user.ParticipantCode = input.ParticipantCode
+	}
+	err = UpdateUser(user)
+	if err != nil {
+		sendAPIError(w, api_error_user_general, err, map[string]string{})
+		return
+	}
+	setAuditChange(r, before, user)
+	if accessChanged {
+		err = RevokeAllSessionsForUser(user.ID)
+		if err != nil {
+			sendAPIError(w, api_error_user_session_revoke, err, map[string]string{})
+			return
+		}
+	}
+	if emailChanged {
+		err = SendEmailVerificationForUser(getSiteFromHTTPContext(r), user)
+		if err != nil {
+			Log(LogLevelWarn, "email_verification_not_sent", err.Error(), &LogOptions{
+				Context: r.Context(),
+				ExtraData: map[string]interface{}{
+					"userId": user.ID,
+				},
+			})
+		}
+	}
+	sendAPIJSONData(w, http.StatusOK, user)
+}
+
+// routeAdminForceUserPasswordReset makes the user choose a new password; their current password stops working, they
+// are logged out, and a reset link is sent to their email
+func routeAdminForceUserPasswordReset(w http.ResponseWriter, r *http.Request) {
+	// validity checked in middleware of router
+	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if userIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
+		return
+	}
+	user, err := GetSiteUserByID(getSiteIDFromHTTPContext(r), userID)
+	if err != nil {
+		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
+		return
+	}
+	err = ForcePasswordResetForUser(getSiteFromHTTPContext(r), user)
+	if errors.Is(err, errUserNoEmail) {
+		sendAPIError(w, api_error_user_no_email, err, map[string]string{})
+		return
+	}
+	if err != nil {
+		sendAPIError(w, api_error_user_force_reset, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, map[string]bool{
+		"requested": true,
+	})
+}
+
+// Bind binds the data for the HTTP
+func (data *adminInviteUserInput) Bind(r *http.Request) error {
+	return nil
+}
+
+// routeAdminExportUser downloads a zip of everything stored for the user, such as when a participant asks for a copy
+// of their data through the research team
+func routeAdminExportUser(w http.ResponseWriter, r *http.Request) {
+	// validity checked in middleware of router
+	userID, userIDErr := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if userIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
+		return
+	}
+	_, err := GetSiteUserByID(getSiteIDFromHTTPContext(r), userID)
+	if err != nil {
+		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
+		return
+	}
+	sendParticipantExport(w, userID)
+}
+
+// sendParticipantExport loads the export and streams the zip; once the zip starts, an error can only be logged
+func sendParticipantExport(w http.ResponseWriter, userID int64) {
+	export, err := GetParticipantExport(userID)
+	if err != nil {
+		sendAPIError(w, api_error_user_export, err, map[string]string{})
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"kesplora_export_%d.zip\"", userID))
+	w.Header().Set("Cache-Control", "no-store")
+	err = WriteParticipantExport(w, export)
+	if err != nil {
+		Log(LogLevelError, "user_export_error", err.Error(), &LogOptions{
+			Context: getLogContextFromWriter(w),
+		})
+	}
+}
@@ -229,3 +229,207 @@ func TestUpdateSiteRoute(t *testing.T) {
 	assert.Equal(t, updateInfo.ProjectListOptions, foundSite.ProjectListOptions)
 	assert.Equal(t, updateInfo.SiteTechnicalContact, foundSite.SiteTechnicalContact)
 }
+
+func TestAdminUserManagementRoutes(t *testing.T) {
+	setupTesting()
+	mailer := &mailerOutbox{
+		Directory: t.TempDir(),
+	}
+	originalMailer := config.Mailer
+	config.Mailer = mailer
+	defer func() {
+		config.Mailer = originalMailer
+	}()
+
+	admin := &User{
+		SystemRole: UserSystemRoleAdmin,
+	}
+	err := createTestUser(admin)
+	require.Nil(t, err)
+	defer DeleteUser(admin.ID)
+
+	nonAdmin := &User{}
+	err = createTestUser(nonAdmin)
+	require.Nil(t, err)
+	defer DeleteUser(nonAdmin.ID)
+
+	b := new(bytes.Buffer)
+	encoder := json.NewEncoder(b)
+
+	// invite a new admin
+	email := fmt.Sprintf("test_invite_%d@kesplora.com", rand.Int63n(99999999999))
+	encoder.Encode(map[string]string{
+		"email":      email,
+		"firstName":  "Invited",
+		"lastName":   "Admin",
+		"systemRole": UserSystemRoleAdmin,
+		"message":    "Welcome to the team",
+	})
+	code, res, err := testEndpoint(http.MethodPost, "/admin/users", bytes.NewBuffer(b.Bytes()), routeAdminInviteUser, nonAdmin.Access)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, code, res)
+
+	code, res, err = testEndpoint(http.MethodPost, "/admin/users", bytes.NewBuffer(b.Bytes()), routeAdminInviteUser, admin.Access)
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusCreated, code, res)
+	m, err := testEndpointResultToMap(res)
+	assert.Nil(t, err)
+	invited := &User{}
+	err = mapstructure.Decode(m, invited)
+	assert.Nil(t, err)
+	require.NotEqual(t, int64(0), invited.ID)
+	defer DeleteUser(invited.ID)
+	assert.Equal(t, UserStatusPending, invited.Status)
+	assert.Equal(t, UserSystemRoleAdmin, invited.SystemRole)
+	require.Equal(t, 1, len(testOutboxMessages(mailer)))
+	assert.Equal(t, email, testOutboxMessages(mailer)[0].To)
+	assert.Contains(t, testOutboxMessages(mailer)[0].Text, "Welcome to the team")
+
+	// the same email cannot be invited twice
+	code, res, err = testEndpoint(http.MethodPost, "/admin/users", bytes.NewBuffer(b.Bytes()), routeAdminInviteUser, admin.Access)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusConflict, code, res)
+
+	// resending replaces the token
+	code, res, err = testEndpoint(http.MethodPost, fmt.Sprintf("/admin/users/%d/invitation", invited.ID), nil, routeAdminResendUserInvitation, admin.Access)
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+	require.Equal(t, 2, len(testOutboxMessages(mailer)))
+	token, err := getTokenForUser(invited.ID, tokenTypeInvitation)
+	require.Nil(t, err)
+	assert.Contains(t, testOutboxMessages(mailer)[1].Text, token.Token)
+
+	// accept it and log in with the new password
+	password := "test_Inv1te_P@ssword!"
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"token":    "not_a_token",
+		"password": password,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/invitation/accept", b, routeAllAcceptInvitation, "")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, code, res)
+
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"token":    token.Token,
+		"password": password,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/invitation/accept", bytes.NewBuffer(b.Bytes()), routeAllAcceptInvitation, "")
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+	m, err = testEndpointResultToMap(res)
+	assert.Nil(t, err)
+	assert.Equal(t, UserStatusActive, m["status"])
+	assert.Equal(t, Yes, m["emailVerified"])
+
+	// the token only works once
+	code, res, err = testEndpoint(http.MethodPost, "/invitation/accept", b, routeAllAcceptInvitation, "")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, code, res)
+	code, res, err = testEndpoint(http.MethodPost, fmt.Sprintf("/admin/users/%d/invitation", invited.ID), nil, routeAdminResendUserInvitation, admin.Access)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusConflict, code, res)
+
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"login":    email,
+		"password": password,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/login", bytes.NewBuffer(b.Bytes()), routeAllUserLogin, "")
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+
+	// edit the user; changing the role logs them out
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"title":      "Dr.",
+		"systemRole": UserSystemRoleUser,
+	})
+	code, res, err = testEndpoint(http.MethodPatch, fmt.Sprintf("/admin/users/%d", invited.ID), b, routeAdminUpdateUser, admin.Access)
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+	found, err := GetUserByID(invited.ID)
+	require.Nil(t, err)
+	assert.Equal(t, "Dr.", found.Title)
+	assert.Equal(t, UserSystemRoleUser, found.SystemRole)
+	sessions, err := GetSessionsForUser(invited.ID)
+	require.Nil(t, err)
+	assert.Equal(t, 0, len(sessions))
+
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"status": "sleeping",
+	})
+	code, res, err = testEndpoint(http.MethodPatch, fmt.Sprintf("/admin/users/%d", invited.ID), b, routeAdminUpdateUser, admin.Access)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, code, res)
+
+	// emails can't be shared on the site
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"email": admin.Email,
+	})
+	code, res, err = testEndpoint(http.MethodPatch, fmt.Sprintf("/admin/users/%d", invited.ID), b, routeAdminUpdateUser, admin.Access)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, code, res)
+	found, err = GetUserByID(invited.ID)
+	require.Nil(t, err)
+	assert.Equal(t, email, found.Email)
+
+	// nor can participant codes
+	participant := &User{
+		SystemRole:      UserSystemRoleParticipant,
+		ParticipantCode: fmt.Sprintf("test_code_%d", rand.Int63n(99999999999)),
+	}
+	err = createTestUser(participant)
+	require.Nil(t, err)
+	defer DeleteUser(participant.ID)
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"participantCode": participant.ParticipantCode,
+	})
+	code, res, err = testEndpoint(http.MethodPatch, fmt.Sprintf("/admin/users/%d", invited.ID), b, routeAdminUpdateUser, admin.Access)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, code, res)
+	found, err = GetUserByID(invited.ID)
+	require.Nil(t, err)
+	assert.NotEqual(t, participant.ParticipantCode, found.ParticipantCode)
+
+	// a reset undoes a lock, so admins disable users instead of locking them
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"status": UserStatusLocked,
+	})
+	code, res, err = testEndpoint(http.MethodPatch, fmt.Sprintf("/admin/users/%d", invited.ID), b, routeAdminUpdateUser, admin.Access)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, code, res)
+
+	// the last active admin cannot be demoted or disabled
+	otherAdmins := 0
+	err = config.DBConnection.Get(&otherAdmins, `SELECT COUNT(*) FROM Users WHERE systemRole = ? AND status = ? AND id != ?`, UserSystemRoleAdmin, UserStatusActive, admin.ID)
+	require.Nil(t, err)
+	err = checkUserIsNotLastAdmin(admin, UserSystemRoleAdmin, UserStatusDisabled)
+	if otherAdmins == 0 {
+		assert.ErrorIs(t, err, errUserLastAdmin)
+	} else {
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, checkUserIsNotLastAdmin(nonAdmin, UserSystemRoleParticipant, UserStatusDisabled))
+
+	// forcing a reset stops the current password from working
+	code, res, err = testEndpoint(http.MethodPost, fmt.Sprintf("/admin/users/%d/password/reset", invited.ID), nil, routeAdminForceUserPasswordReset, admin.Access)
+	assert.Nil(t, err)
+	require.Equal(t, http.StatusOK, code, res)
+	require.Equal(t, 3, len(testOutboxMessages(mailer)))
+	_, err = getTokenForUser(invited.ID, tokenTypePasswordReset)
+	assert.Nil(t, err)
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"login":    email,
+		"password": password,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/login", b, routeAllUserLogin, "")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, code, res)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+// routeAllGetAPIKeys gets the user's API keys; the keys themselves are never returned after creation
+func routeAllGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	results := checkRoutePermissions(w, r, &routePermissionsCheckOptions{
+		ShouldSendError: true,
+	})
+	if !results.IsValid {
+		return
+	}
+
+	keys, err := GetAPIKeysForUser(results.User.ID)
+	if err != nil {
+		sendAPIError(w, api_error_api_key_not_found, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, keys)
+}
+
+// routeAllCreateAPIKey creates a new key for an admin. The response has the only copy of the key
+func routeAllCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	results := checkRoutePermissions(w, r, &routePermissionsCheckOptions{
+		ShouldSendError: true,
+		MustBeAdmin:     true,
+	})
+	if !results.IsValid {
+		return
+	}
+
+	input := &APIKey{}
+	render.Bind(r, input)
+	apiKey := &APIKey{
+		UserID: results.User.ID,
+		Name:   input.Name,
+		Scopes: input.Scopes,
+	}
+	err := CreateAPIKey(apiKey)
+	if errors.Is(err, errAPIKeyBadData) {
+		sendAPIError(w, api_error_api_key_bad_data, err, map[string]string{})
+		return
+	}
+	if err != nil {
+		sendAPIError(w, api_error_api_key_save, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusCreated, apiKey)
+}
+
+// routeAllDeleteAPIKey revokes one of the user's keys
+func routeAllDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	results := checkRoutePermissions(w, r, &routePermissionsCheckOptions{
+		ShouldSendError: true,
+	})
+	if !results.IsValid {
+		return
+	}
+	apiKeyID, apiKeyIDErr := strconv.ParseInt(chi.URLParam(r, "apiKeyID"), 10, 64)
+	if apiKeyIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
+		return
+	}
+
+	apiKey, err := GetAPIKeyForUser(results.User.ID, apiKeyID)
+	if err != nil {
+		sendAPIError(w, api_error_api_key_not_found, err, map[string]string{})
+		return
+	}
+	err = DeleteAPIKey(apiKey.ID)
+	if err != nil {
+		sendAPIError(w, api_error_api_key_delete, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, map[string]bool{
+		"deleted": true,
+	})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/stretchr/testify/suite"
+)
+
+type SuiteTestsAPIKeyRoutes struct {
+	suite.Suite
+}
+
+func TestSuiteTestsAPIKeyRoutes(t *testing.T) {
+	suite.Run(t, new(SuiteTestsAPIKeyRoutes))
+}
+
+func (suite *SuiteTestsAPIKeyRoutes) SetupSuite() {
+	setupTesting()
+}
+
+func (suite *SuiteTestsAPIKeyRoutes) TestAPIKeyRoutes() {
+	require := suite.Require()
+	admin := &User{
+		SystemRole: UserSystemRoleAdmin,
+	}
+	err := createTestUser(admin)
+	require.Nil(err)
+	defer DeleteUser(admin.ID)
+
+	user := &User{}
+	err = createTestUser(user)
+	require.Nil(err)
+	defer DeleteUser(user.ID)
+
+	b := new(bytes.Buffer)
+	encoder := json.NewEncoder(b)
+
+	// only admins can create keys
+	encoder.Encode(map[string]interface{}{
+		"name":   "nightly export",
+		"scopes": []string{APIKeyScopeReportsRead},
+	})
+	code, res, err := testEndpoint(http.MethodPost, "/me/apikeys", bytes.NewBuffer(b.Bytes()), routeAllCreateAPIKey, user.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	// scopes must be valid
+	code, res, err = testEndpoint(http.MethodPost, "/me/apikeys", bytes.NewBufferString(`{"name":"bad","scopes":["everything"]}`), routeAllCreateAPIKey, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusBadRequest, code, res)
+
+	code, res, err = testEndpoint(http.MethodPost, "/me/apikeys", b, routeAllCreateAPIKey, admin.Access)
+	suite.Nil(err)
+	require.Equal(http.StatusCreated, code, res)
+	m, err := testEndpointResultToMap(res)
+	suite.Nil(err)
+	apiKey := &APIKey{}
+	err = mapstructure.Decode(m, apiKey)
+	suite.Nil(err)
+	require.NotEqual("", apiKey.Key)
+	suite.Equal([]string{APIKeyScopeReportsRead}, apiKey.Scopes)
+
+	// the key is never shown again
+	code, res, err = testEndpoint(http.MethodGet, "/me/apikeys", nil, routeAllGetAPIKeys, admin.Access)
+	suite.Nil(err)
+	require.Equal(http.StatusOK, code, res)
+	list, err := testEndpointResultToSlice(res)
+	suite.Nil(err)
+	require.Equal(1, len(list))
+	suite.Nil(list[0].(map[string]interface{})["key"])
+	suite.Equal(apiKey.Prefix, list[0].(map[string]interface{})["prefix"])
+
+	// the key works within its scopes
+	project := &Project{}
+	err = createTestProject(project)
+	require.Nil(err)
+	defer DeleteProject(project.ID)
+	code, res, err = testEndpointWithAPIKey(http.MethodGet, fmt.Sprintf("/admin/reports/projects/%d/status", project.ID), nil, apiKey.Key)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	code, res, err = testEndpointWithAPIKey(http.MethodGet, "/admin/users", nil, apiKey.Key)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+	code, res, err = testEndpointWithAPIKey(http.MethodGet, "/me/apikeys", nil, apiKey.Key)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+	code, res, err = testEndpointWithAPIKey(http.MethodGet, "/admin/users", nil, "kak_not_a_real_key")
+	suite.Nil(err)
+	suite.Equal(http.StatusUnauthorized, code, res)
+
+	// other users cannot revoke it
+	code, res, err = testEndpoint(http.MethodDelete, fmt.Sprintf("/me/apikeys/%d", apiKey.ID), nil, routeAllDeleteAPIKey, user.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusNotFound, code, res)
+
+	code, res, err = testEndpoint(http.MethodDelete, fmt.Sprintf("/me/apikeys/%d", apiKey.ID), nil, routeAllDeleteAPIKey, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	code, res, err = testEndpointWithAPIKey(http.MethodGet, fmt.Sprintf("/admin/reports/projects/%d/status", project.ID), nil, apiKey.Key)
+	suite.Nil(err)
+	suite.Equal(http.StatusUnauthorized, code, res)
+}
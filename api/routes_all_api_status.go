@@ -2,11 +2,45 @@ package api
 
 import "net/http"
 
+// apiVersion is reported by the status route and the OpenAPI spec
+const apiVersion = "0.0.1"
+
 // routeApiStatusReady is a simple API end point that just returns that the server is listening; it does NOT do any checks
 // on connectivity or configuration
 func routeApiStatusReady(w http.ResponseWriter, r *http.Request) {
 	sendAPIJSONData(w, http.StatusOK, map[string]interface{}{
 		"listening": "yes",
-		"version":   "0.0.1",
+		"version":   apiVersion,
+	})
+}
+
+// routeApiStatusLive reports that the process is up and serving requests; it does not check any dependencies, so a
+// restart is only triggered if the process itself is stuck
+func routeApiStatusLive(w http.ResponseWriter, r *http.Request) {
+	sendAPIJSONData(w, http.StatusOK, map[string]interface{}{
+		"live": Yes,
+	})
+}
+
+// routeApiStatusHealthReady checks the DB, cache, file storage, and site, and returns a 503 if any of them fail or the
+// server is shutting down, so load balancers stop sending it traffic
+func routeApiStatusHealthReady(w http.ResponseWriter, r *http.Request) {
+	if shuttingDown.Load() {
+		sendAPIJSONData(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"ready":  No,
+			"reason": "shutting down",
+		})
+		return
+	}
+	ready, checks := runHealthChecks(r)
+	code := http.StatusOK
+	status := Yes
+	if !ready {
+		code = http.StatusServiceUnavailable
+		status = No
+	}
+	sendAPIJSONData(w, code, map[string]interface{}{
+		"ready":  status,
+		"checks": checks,
 	})
 }
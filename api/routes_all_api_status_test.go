@@ -2,11 +2,16 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAPIStatusCallRoute(t *testing.T) {
@@ -19,3 +24,91 @@ func TestAPIStatusCallRoute(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, http.StatusOK, code)
 }
+
+func TestAPIHealthRoutes(t *testing.T) {
+	setupTesting()
+
+	code, _, err := testEndpoint(http.MethodGet, "/health/live", nil, routeApiStatusLive, "")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, res, err := testEndpoint(http.MethodGet, "/health/ready", nil, routeApiStatusHealthReady, "")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, code, res)
+	m, err := testEndpointResultToMap(res)
+	require.Nil(t, err)
+	assert.Equal(t, Yes, m["ready"])
+	assert.Equal(t, len(healthCheckers), len(m["checks"].([]interface{})))
+
+	// once shutting down, the instance should drop out of the load balancer
+	shuttingDown.Store(true)
+	defer shuttingDown.Store(false)
+	code, _, err = testEndpoint(http.MethodGet, "/health/ready", nil, routeApiStatusHealthReady, "")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestRunHealthCheck(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "/health/ready", nil)
+	require.Nil(t, err)
+
+	result := runHealthCheck(r, "good", func(ctx context.Context, r *http.Request) error {
+		return nil
+	})
+	assert.Equal(t, HealthCheckStatusOK, result.Status)
+	assert.Equal(t, "", result.Error)
+
+	result = runHealthCheck(r, "bad", func(ctx context.Context, r *http.Request) error {
+		return errors.New("down")
+	})
+	assert.Equal(t, HealthCheckStatusFailed, result.Status)
+	assert.Equal(t, "down", result.Error)
+
+	result = runHealthCheck(r, "missing", func(ctx context.Context, r *http.Request) error {
+		return errHealthCheckSkipped
+	})
+	assert.Equal(t, HealthCheckStatusSkipped, result.Status)
+
+	// a check that ignores the context still gives up at the timeout
+	result = runHealthCheck(r, "stuck", func(ctx context.Context, r *http.Request) error {
+		time.Sleep(healthCheckTimeout + time.Second)
+		return nil
+	})
+	assert.Equal(t, HealthCheckStatusFailed, result.Status)
+	assert.Less(t, result.DurationMS, (healthCheckTimeout + time.Second).Milliseconds())
+}
+
+func TestShutdownDrain(t *testing.T) {
+	previousConfig := config
+	config = &apiConfig{}
+	t.Cleanup(func() {
+		config = previousConfig
+		shuttingDown.Store(false)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	server := &http.Server{
+		Handler: http.HandlerFunc(routeApiStatusHealthReady),
+	}
+	go server.Serve(listener)
+	address := "http://" + listener.Addr().String() + "/health/ready"
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Shutdown(time.Second, time.Second, server)
+	}()
+
+	// during the drain the server still answers, but reports as not ready so the load balancer can take it out
+	require.Eventually(t, func() bool {
+		return shuttingDown.Load()
+	}, time.Second, 10*time.Millisecond)
+	res, err := http.Get(address)
+	require.Nil(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	require.Nil(t, <-done)
+	_, err = http.Get(address)
+	assert.NotNil(t, err)
+}
@@ -411,6 +411,7 @@ func (suite SuiteTestsFullSetup) TestBasicFlow() {
 	err = json.Unmarshal(unmB, createdModule3FormBlockForm)
 	suite.Nil(err)
 	suite.Equal(4, len(createdModule3FormBlockForm.Questions))
+	suite.Equal(Yes, createdModule3FormBlockForm.AllowResubmit)
 	defer DeleteBlock(createdModule3FormBlock.ID)
 	// don't forget to link it
 	code, res, err = testEndpoint(http.MethodPut, fmt.Sprintf("/admin/modules/%d/blocks/%d/order/%d", createdModule3.ID, createdModule3FormBlock.ID, 1), b, routeAdminLinkBlockAndModule, admin.Access)
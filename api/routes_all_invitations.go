@@ -0,0 +1,42 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type invitationAcceptInput struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// routeAllAcceptInvitation takes the invitation token and the user's chosen password and activates the account
+func routeAllAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	input := &invitationAcceptInput{}
+	render.Bind(r, input)
+	if input.Token == "" || input.Password == "" {
+		sendAPIError(w, api_error_user_bad_data, nil, map[string]string{
+			"token":    "required",
+			"password": "required",
+		})
+		return
+	}
+
+	user, err := AcceptInvitation(input.Token, input.Password)
+	if errors.Is(err, errInvitationInvalidToken) {
+		sendAPIError(w, api_error_user_bad_invitation, err, map[string]string{})
+		return
+	}
+	if err != nil {
+		sendAPIError(w, api_error_user_general, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, user)
+}
+
+// Bind binds the data for the HTTP
+func (data *invitationAcceptInput) Bind(r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// routeAllGetJWKS serves the public keys used to verify access tokens. Unlike our other routes, the set is not wrapped
+// in data so standard JWT libraries can read it directly
+func routeAllGetJWKS(w http.ResponseWriter, r *http.Request) {
+	response, _ := json.Marshal(config.JWTKeys.getJWKS())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SuiteTestsLoginThrottleRoutes struct {
+	suite.Suite
+}
+
+func TestSuiteTestsLoginThrottleRoutes(t *testing.T) {
+	suite.Run(t, new(SuiteTestsLoginThrottleRoutes))
+}
+
+func (suite *SuiteTestsLoginThrottleRoutes) SetupSuite() {
+	setupTesting()
+}
+
+func (suite *SuiteTestsLoginThrottleRoutes) TestLoginThrottleAndLockout() {
+	require := suite.Require()
+	originalThreshold := config.LoginLockoutThreshold
+	config.LoginLockoutThreshold = 6
+	defer func() {
+		config.LoginLockoutThreshold = originalThreshold
+	}()
+
+	admin := &User{
+		SystemRole: UserSystemRoleAdmin,
+	}
+	err := createTestUser(admin)
+	require.Nil(err)
+	defer DeleteUser(admin.ID)
+
+	plainPassword := "test_L0ckout_P@ssword!"
+	user := &User{
+		Password: plainPassword,
+	}
+	err = createTestUser(user)
+	require.Nil(err)
+	defer DeleteUser(user.ID)
+	defer clearFailedLoginAttempts(user.SiteID, user.Email)
+
+	b := new(bytes.Buffer)
+	encoder := json.NewEncoder(b)
+	attempt := func(password string) (int, map[string]interface{}) {
+		b.Reset()
+		encoder.Encode(map[string]string{
+			"login":    user.Email,
+			"password": password,
+		})
+		code, res, err := testEndpoint(http.MethodPost, "/login", b, routeAllUserLogin, "")
+		suite.Nil(err)
+		m, _ := testEndpointResultToMap(res)
+		return code, m
+	}
+
+	// the free attempts just fail
+	for i := 0; i < loginFreeAttemptsPerLogin; i++ {
+		code, _ := attempt("wrong")
+		suite.Equal(http.StatusForbidden, code)
+	}
+	// then it backs off, even with the right password
+	code, m := attempt("wrong")
+	suite.Equal(http.StatusTooManyRequests, code, m)
+	code, m = attempt(plainPassword)
+	suite.Equal(http.StatusTooManyRequests, code, m)
+
+	// a success clears the failures
+	clearFailedLoginAttempts(user.SiteID, user.Email)
+	code, m = attempt(plainPassword)
+	suite.Equal(http.StatusOK, code, m)
+	code, _ = attempt("wrong")
+	suite.Equal(http.StatusForbidden, code)
+
+	// reaching the threshold locks the account
+	clearFailedLoginAttempts(user.SiteID, user.Email)
+	for i := 0; i < config.LoginLockoutThreshold; i++ {
+		recordFailedLoginAttempt(user.SiteID, user.Email, "")
+	}
+	found, err := GetUserByID(user.ID)
+	require.Nil(err)
+	suite.Equal(UserStatusLocked, found.Status)
+
+	// the right password doesn't help until unlocked
+	clearFailedLoginAttempts(user.SiteID, user.Email)
+	code, m = attempt(plainPassword)
+	suite.Equal(http.StatusForbidden, code, m)
+
+	code, res, err := testEndpoint(http.MethodPost, fmt.Sprintf("/admin/users/%d/unlock", user.ID), nil, routeAdminUnlockUser, user.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+	code, res, err = testEndpoint(http.MethodPost, fmt.Sprintf("/admin/users/%d/unlock", user.ID), nil, routeAdminUnlockUser, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+
+	found, err = GetUserByID(user.ID)
+	require.Nil(err)
+	suite.Equal(UserStatusActive, found.Status)
+	code, m = attempt(plainPassword)
+	suite.Equal(http.StatusOK, code, m)
+}
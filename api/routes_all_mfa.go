@@ -0,0 +1,157 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type mfaCodeInput struct {
+	Code string `json:"code"`
+}
+
+// routeAllStartMFAEnrollment generates a new two-factor secret for the user; it is not enforced until confirmed
+func routeAllStartMFAEnrollment(w http.ResponseWriter, r *http.Request) {
+	results := checkRoutePermissions(w, r, &routePermissionsCheckOptions{
+		ShouldSendError: true,
+	})
+	if !results.IsValid {
+		return
+	}
+	user, err := GetUserByID(results.User.ID)
+	if err != nil {
+		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
+		return
+	}
+
+	enrollment, err := StartMFAEnrollmentForUser(user)
+	if errors.Is(err, errMFAAlreadyEnabled) {
+		sendAPIError(w, api_error_user_mfa_already_enabled, err, map[string]string{})
+		return
+	}
+	if err != nil {
+		sendAPIError(w, api_error_user_mfa_save, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, enrollment)
+}
+
+// routeAllConfirmMFAEnrollment confirms the enrollment with a code from the authenticator and returns the recovery codes
+func routeAllConfirmMFAEnrollment(w http.ResponseWriter, r *http.Request) {
+	results := checkRoutePermissions(w, r, &routePermissionsCheckOptions{
+		ShouldSendError: true,
+	})
+	if !results.IsValid {
+		return
+	}
+	user, err := GetUserByID(results.User.ID)
+	if err != nil {
+		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
+		return
+	}
+	input := &mfaCodeInput{}
+	render.Bind(r, input)
+	if input.Code == "" {
+		sendAPIError(w, api_error_user_bad_data, nil, map[string]string{})
+		return
+	}
+
+	codes, err := ConfirmMFAEnrollmentForUser(user, input.Code)
+	if errors.Is(err, errMFAAlreadyEnabled) {
+		sendAPIError(w, api_error_user_mfa_already_enabled, err, map[string]string{})
+		return
+	}
+	if errors.Is(err, errMFANotStarted) || errors.Is(err, errMFABadCode) {
+		sendAPIError(w, api_error_user_mfa_bad_code, err, map[string]string{})
+		return
+	}
+	if err != nil {
+		sendAPIError(w, api_error_user_mfa_save, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, map[string]interface{}{
+		"mfaEnabled":    Yes,
+		"recoveryCodes": codes,
+	})
+}
+
+// routeAllRegenerateMFARecoveryCodes replaces the recovery codes; a current code is required
+func routeAllRegenerateMFARecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	results := checkRoutePermissions(w, r, &routePermissionsCheckOptions{
+		ShouldSendError: true,
+	})
+	if !results.IsValid {
+		return
+	}
+	user, err := GetUserByID(results.User.ID)
+	if err != nil {
+		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
+		return
+	}
+	input := &mfaCodeInput{}
+	render.Bind(r, input)
+
+	err = ValidateMFACodeForUser(user, input.Code)
+	if errors.Is(err, errMFANotEnabled) {
+		sendAPIError(w, api_error_user_mfa_not_enabled, err, map[string]string{})
+		return
+	}
+	if err != nil {
+		sendAPIError(w, api_error_user_mfa_bad_code, err, map[string]string{})
+		return
+	}
+	codes, err := GenerateMFARecoveryCodesForUser(user.ID)
+	if err != nil {
+		sendAPIError(w, api_error_user_mfa_save, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, map[string]interface{}{
+		"recoveryCodes": codes,
+	})
+}
+
+// routeAllDisableMFA turns off two-factor authentication; a current code is required, and admins cannot turn it off
+// if the site requires it
+func routeAllDisableMFA(w http.ResponseWriter, r *http.Request) {
+	results := checkRoutePermissions(w, r, &routePermissionsCheckOptions{
+		ShouldSendError: true,
+	})
+	if !results.IsValid {
+		return
+	}
+	user, err := GetUserByID(results.User.ID)
+	if err != nil {
+		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
+		return
+	}
+	if user.SystemRole == UserSystemRoleAdmin && results.Site != nil && results.Site.RequireAdminMFA == Yes {
+		sendAPIError(w, api_error_user_mfa_cannot_disable, nil, map[string]string{})
+		return
+	}
+	input := &mfaCodeInput{}
+	render.Bind(r, input)
+
+	err = ValidateMFACodeForUser(user, input.Code)
+	if errors.Is(err, errMFANotEnabled) {
+		sendAPIError(w, api_error_user_mfa_not_enabled, err, map[string]string{})
+		return
+	}
+	if err != nil {
+		sendAPIError(w, api_error_user_mfa_bad_code, err, map[string]string{})
+		return
+	}
+	err = DisableMFAForUser(user.ID)
+	if err != nil {
+		sendAPIError(w, api_error_user_mfa_save, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, map[string]string{
+		"mfaEnabled": No,
+	})
+}
+
+// Bind binds the data for the HTTP
+func (data *mfaCodeInput) Bind(r *http.Request) error {
+	return nil
+}
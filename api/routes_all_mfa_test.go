@@ -0,0 +1,258 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/stretchr/testify/suite"
+)
+
+type SuiteTestsMFARoutes struct {
+	suite.Suite
+}
+
+func TestSuiteTestsMFARoutes(t *testing.T) {
+	suite.Run(t, new(SuiteTestsMFARoutes))
+}
+
+func (suite *SuiteTestsMFARoutes) SetupSuite() {
+	setupTesting()
+}
+
+func (suite *SuiteTestsMFARoutes) TestMFAEnrollmentAndLogin() {
+	require := suite.Require()
+	plainPassword := "test_Mf@_P@ssword!"
+	admin := &User{
+		SystemRole: UserSystemRoleAdmin,
+		Password:   plainPassword,
+	}
+	err := createTestUser(admin)
+	require.Nil(err)
+	defer DeleteUser(admin.ID)
+
+	b := new(bytes.Buffer)
+	encoder := json.NewEncoder(b)
+
+	// start enrolling
+	code, res, err := testEndpoint(http.MethodPost, "/me/mfa", nil, routeAllStartMFAEnrollment, admin.Access)
+	suite.Nil(err)
+	require.Equal(http.StatusOK, code, res)
+	m, err := testEndpointResultToMap(res)
+	suite.Nil(err)
+	enrollment := &MFAEnrollment{}
+	err = mapstructure.Decode(m, enrollment)
+	suite.Nil(err)
+	require.NotEqual("", enrollment.Secret)
+	suite.Contains(enrollment.URI, "otpauth://totp/")
+
+	// nothing is enforced until confirmed
+	found, err := GetUserByID(admin.ID)
+	require.Nil(err)
+	suite.Equal(No, found.MFAEnabled)
+
+	encoder.Encode(map[string]string{
+		"code": "000000x",
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/me/mfa/confirm", b, routeAllConfirmMFAEnrollment, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	counter := uint64(time.Now().Unix() / mfaTOTPPeriodSeconds)
+	totp, err := generateTOTPCode(enrollment.Secret, counter)
+	require.Nil(err)
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"code": totp,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/me/mfa/confirm", b, routeAllConfirmMFAEnrollment, admin.Access)
+	suite.Nil(err)
+	require.Equal(http.StatusOK, code, res)
+	m, err = testEndpointResultToMap(res)
+	suite.Nil(err)
+	recoveryCodes := m["recoveryCodes"].([]interface{})
+	require.Equal(mfaRecoveryCodeCount, len(recoveryCodes))
+
+	found, err = GetUserByID(admin.ID)
+	require.Nil(err)
+	suite.Equal(Yes, found.MFAEnabled)
+	suite.Equal("", found.MFASecret)
+
+	// logging in now gives a challenge instead of tokens
+	login := func() *MFAChallenge {
+		b.Reset()
+		encoder.Encode(map[string]string{
+			"login":    admin.Email,
+			"password": plainPassword,
+		})
+		code, res, err := testEndpoint(http.MethodPost, "/login", b, routeAllUserLogin, "")
+		suite.Nil(err)
+		require.Equal(http.StatusOK, code, res)
+		m, err := testEndpointResultToMap(res)
+		suite.Nil(err)
+		suite.Nil(m["access"])
+		challenge := &MFAChallenge{}
+		err = mapstructure.Decode(m, challenge)
+		suite.Nil(err)
+		suite.True(challenge.MFARequired)
+		require.NotEqual("", challenge.MFAToken)
+		return challenge
+	}
+	challenge := login()
+
+	// the code used to confirm cannot be replayed
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"mfaToken": challenge.MFAToken,
+		"code":     totp,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/login/mfa", b, routeAllUserLoginMFA, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	totp, err = generateTOTPCode(enrollment.Secret, counter+1)
+	require.Nil(err)
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"mfaToken": challenge.MFAToken,
+		"code":     totp,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/login/mfa", b, routeAllUserLoginMFA, "")
+	suite.Nil(err)
+	require.Equal(http.StatusOK, code, res)
+	m, err = testEndpointResultToMap(res)
+	suite.Nil(err)
+	suite.NotEqual("", m["access"])
+	suite.NotEqual("", m["refresh"])
+
+	// the challenge is consumed
+	code, res, err = testEndpoint(http.MethodPost, "/login/mfa", b, routeAllUserLoginMFA, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	// recovery codes work once
+	challenge = login()
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"mfaToken": challenge.MFAToken,
+		"code":     recoveryCodes[0].(string),
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/login/mfa", b, routeAllUserLoginMFA, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+
+	challenge = login()
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"mfaToken": challenge.MFAToken,
+		"code":     recoveryCodes[0].(string),
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/login/mfa", b, routeAllUserLoginMFA, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	// too many bad codes removes the challenge
+	for i := 1; i < mfaChallengeAttempts; i++ {
+		code, res, err = testEndpoint(http.MethodPost, "/login/mfa", bytes.NewBuffer(b.Bytes()), routeAllUserLoginMFA, "")
+		suite.Nil(err)
+		suite.Equal(http.StatusForbidden, code, res)
+	}
+	_, err = getTokenForUser(admin.ID, tokenTypeMFA)
+	suite.NotNil(err)
+
+	// the bad codes count as failed logins, so the password has to wait
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"login":    admin.Email,
+		"password": plainPassword,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/login", b, routeAllUserLogin, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusTooManyRequests, code, res)
+
+	// and a new challenge doesn't give more guesses, even with a good code
+	clearFailedLoginAttempts(admin.SiteID, admin.Email)
+	challenge = login()
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"mfaToken": challenge.MFAToken,
+		"code":     recoveryCodes[2].(string),
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/login/mfa", b, routeAllUserLoginMFA, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+	config.CacheClient.Del(getMFAChallengeAttemptsCacheKey(admin.ID))
+
+	// disabling needs a code
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"code": "nope",
+	})
+	code, res, err = testEndpoint(http.MethodDelete, "/me/mfa", b, routeAllDisableMFA, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"code": recoveryCodes[1].(string),
+	})
+	code, res, err = testEndpoint(http.MethodDelete, "/me/mfa", b, routeAllDisableMFA, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	found, err = GetUserByID(admin.ID)
+	require.Nil(err)
+	suite.Equal(No, found.MFAEnabled)
+}
+
+func (suite *SuiteTestsMFARoutes) TestMFARequiredForAdmins() {
+	require := suite.Require()
+	site, err := GetSite()
+	require.Nil(err)
+	originalRequire := site.RequireAdminMFA
+	defer func() {
+		site.RequireAdminMFA = originalRequire
+		UpdateSite(site)
+	}()
+
+	admin := &User{
+		SystemRole: UserSystemRoleAdmin,
+	}
+	err = createTestUser(admin)
+	require.Nil(err)
+	defer DeleteUser(admin.ID)
+
+	code, res, err := testEndpoint(http.MethodGet, "/admin/users", nil, routeAdminGetUsersOnPlatform, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+
+	site.RequireAdminMFA = Yes
+	err = UpdateSite(site)
+	require.Nil(err)
+
+	code, res, err = testEndpoint(http.MethodGet, "/admin/users", nil, routeAdminGetUsersOnPlatform, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	// they can still reach their profile to enroll
+	code, res, err = testEndpoint(http.MethodGet, "/me", nil, routeAllGetUserProfile, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+
+	enrollment, err := StartMFAEnrollmentForUser(admin)
+	require.Nil(err)
+	totp, err := generateTOTPCode(enrollment.Secret, uint64(time.Now().Unix()/mfaTOTPPeriodSeconds))
+	require.Nil(err)
+	_, err = ConfirmMFAEnrollmentForUser(admin, totp)
+	require.Nil(err)
+
+	code, res, err = testEndpoint(http.MethodGet, "/admin/users", nil, routeAdminGetUsersOnPlatform, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+
+	// and they cannot turn it off while it is required
+	code, res, err = testEndpoint(http.MethodDelete, "/me/mfa", nil, routeAllDisableMFA, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+}
@@ -82,6 +82,7 @@ func routeAllCreateNote(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	input.SiteID = getSiteIDFromHTTPContext(r)
 	err = CreateNote(input)
 	if err != nil {
 		sendAPIError(w, api_error_notes_save, err, map[string]interface{}{
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type oidcCallbackInput struct {
+	State string `json:"state"`
+	Code  string `json:"code"`
+}
+
+// routeAllStartOIDCLogin starts a single sign-on login and returns the URL at the identity provider to send the user to
+func routeAllStartOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if config.OIDC == nil {
+		sendAPIError(w, api_error_user_oidc_not_configured, errOIDCNotConfigured, map[string]string{})
+		return
+	}
+	if !canSignJWT() {
+		sendAPIError(w, api_error_auth_cannot_sign, errJWTCannotSign, map[string]string{})
+		return
+	}
+	start, err := StartOIDCLogin(getSiteFromHTTPContext(r))
+	if err != nil {
+		sendAPIError(w, api_error_user_oidc_failed, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, start)
+}
+
+// routeAllCompleteOIDCLogin finishes a single sign-on login with the state and code the provider sent to the client's
+// redirect URL. The response is the same as /login
+func routeAllCompleteOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if config.OIDC == nil {
+		sendAPIError(w, api_error_user_oidc_not_configured, errOIDCNotConfigured, map[string]string{})
+		return
+	}
+	if !canSignJWT() {
+		sendAPIError(w, api_error_auth_cannot_sign, errJWTCannotSign, map[string]string{})
+		return
+	}
+	input := &oidcCallbackInput{}
+	render.Bind(r, input)
+	if input.State == "" || input.Code == "" {
+		sendAPIError(w, api_error_user_bad_data, nil, map[string]string{})
+		return
+	}
+
+	user, err := CompleteOIDCLogin(getSiteIDFromHTTPContext(r), input.State, input.Code)
+	if errors.Is(err, errOIDCBadState) {
+		sendAPIError(w, api_error_user_oidc_bad_state, err, map[string]string{})
+		return
+	}
+	if errors.Is(err, errOIDCNoAccount) {
+		sendAPIError(w, api_error_user_oidc_no_account, err, map[string]string{})
+		return
+	}
+	if errors.Is(err, errUserNotActive) {
+		sendAPIError(w, api_error_user_bad_login, err, map[string]string{})
+		return
+	}
+	if err != nil {
+		sendAPIError(w, api_error_user_oidc_failed, err, map[string]string{})
+		return
+	}
+
+	// two-factor authentication set up on this site is still required
+	if user.MFAEnabled == Yes {
+		challenge, err := CreateMFAChallengeForUser(user)
+		if err != nil {
+			sendAPIError(w, api_error_user_bad_login, err, map[string]string{})
+			return
+		}
+		sendAPIJSONData(w, http.StatusOK, challenge)
+		return
+	}
+
+	sendLoginTokensForUser(w, r, user)
+}
+
+// Bind binds the data for the HTTP
+func (data *oidcCallbackInput) Bind(r *http.Request) error {
+	return nil
+}
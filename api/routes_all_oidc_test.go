@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/stretchr/testify/suite"
+)
+
+type SuiteTestsOIDCRoutes struct {
+	suite.Suite
+}
+
+func TestSuiteTestsOIDCRoutes(t *testing.T) {
+	suite.Run(t, new(SuiteTestsOIDCRoutes))
+}
+
+func (suite *SuiteTestsOIDCRoutes) SetupSuite() {
+	setupTesting()
+}
+
+// loginWithMockOIDC runs the whole flow against the mock provider and returns the callback response
+func (suite *SuiteTestsOIDCRoutes) loginWithMockOIDC(mock *mockOIDCServer) (int, *bytes.Buffer) {
+	require := suite.Require()
+	code, res, err := testEndpoint(http.MethodGet, "/login/oidc", nil, routeAllStartOIDCLogin, "")
+	require.Nil(err)
+	require.Equal(http.StatusOK, code, res)
+	m, err := testEndpointResultToMap(res)
+	require.Nil(err)
+	start := &OIDCLoginStart{}
+	err = mapstructure.Decode(m, start)
+	require.Nil(err)
+
+	authCode, state := mock.Authorize(suite.T(), start.URL)
+	suite.Equal(start.State, state)
+
+	b := new(bytes.Buffer)
+	json.NewEncoder(b).Encode(map[string]string{
+		"state": state,
+		"code":  authCode,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/login/oidc/callback", b, routeAllCompleteOIDCLogin, "")
+	require.Nil(err)
+	return code, res
+}
+
+func (suite *SuiteTestsOIDCRoutes) TestOIDCLogin() {
+	require := suite.Require()
+	originalOIDC := config.OIDC
+	defer func() {
+		config.OIDC = originalOIDC
+	}()
+
+	// not configured
+	config.OIDC = nil
+	code, res, err := testEndpoint(http.MethodGet, "/login/oidc", nil, routeAllStartOIDCLogin, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusNotFound, code, res)
+
+	mock := newMockOIDCServer(suite.T())
+
+	// without provisioning, only existing users can sign in
+	config.OIDC = mock.Provider("")
+	code, res = suite.loginWithMockOIDC(mock)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	// with provisioning, the user is created with the role and logged in
+	config.OIDC = mock.Provider(UserSystemRoleUser)
+	code, res = suite.loginWithMockOIDC(mock)
+	require.Equal(http.StatusOK, code, res)
+	m, err := testEndpointResultToMap(res)
+	suite.Nil(err)
+	user := &User{}
+	err = mapstructure.Decode(m, user)
+	suite.Nil(err)
+	require.NotEqual(int64(0), user.ID)
+	defer DeleteUser(user.ID)
+	suite.Equal(mock.Email, user.Email)
+	suite.Equal(UserSystemRoleUser, user.SystemRole)
+	suite.Equal(UserStatusActive, user.Status)
+	suite.Equal(Yes, user.EmailVerified)
+	suite.NotEqual("", user.Access)
+	suite.NotEqual("", user.Refresh)
+
+	code, res, err = testEndpoint(http.MethodGet, "/me", nil, routeAllGetUserProfile, user.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+
+	// an existing pending user is matched by email, verified, and activated
+	pending := &User{
+		Status:        UserStatusPending,
+		EmailVerified: No,
+	}
+	err = createTestUser(pending)
+	require.Nil(err)
+	defer DeleteUser(pending.ID)
+	mock.Email = pending.Email
+	code, res = suite.loginWithMockOIDC(mock)
+	require.Equal(http.StatusOK, code, res)
+	m, err = testEndpointResultToMap(res)
+	suite.Nil(err)
+	suite.Equal(float64(pending.ID), m["id"])
+	found, err := GetUserByID(pending.ID)
+	require.Nil(err)
+	suite.Equal(UserStatusActive, found.Status)
+	suite.Equal(Yes, found.EmailVerified)
+
+	// disabled users cannot get in through the provider either
+	found.Status = UserStatusDisabled
+	err = UpdateUser(found)
+	require.Nil(err)
+	code, res = suite.loginWithMockOIDC(mock)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	// the state can only be used once and must exist
+	b := new(bytes.Buffer)
+	json.NewEncoder(b).Encode(map[string]string{
+		"state": "not_a_state",
+		"code":  "not_a_code",
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/login/oidc/callback", b, routeAllCompleteOIDCLogin, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusBadRequest, code, res)
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// routeOpenAPISpec sends the OpenAPI 3 spec for the routes this install serves. It is sent as is, without the data
+// wrapper, so tools can load it directly
+func routeOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	doc, err := getOpenAPISpec()
+	if err != nil {
+		sendAPIError(w, api_error_openapi_unavailable, err, map[string]string{})
+		return
+	}
+	response, _ := json.Marshal(doc)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
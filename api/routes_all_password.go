@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type passwordResetInput struct {
+	Login    string `json:"login"`
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// routeAllRequestPasswordReset requests a password reset link for an email or participant code. To avoid
+// leaking which accounts exist, this always succeeds if the input is well formed
+func routeAllRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	input := &passwordResetInput{}
+	render.Bind(r, input)
+	if input.Login == "" {
+		sendAPIError(w, api_error_user_bad_data, nil, map[string]string{
+			"login": "required",
+		})
+		return
+	}
+
+	err := RequestPasswordResetForUser(getSiteFromHTTPContext(r), input.Login)
+	if err != nil {
+		Log(LogLevelInfo, "password_reset_not_sent", err.Error(), &LogOptions{
+			Context: r.Context(),
+			ExtraData: map[string]interface{}{
+				"login": input.Login,
+			},
+		})
+	}
+	sendAPIJSONData(w, http.StatusOK, map[string]bool{
+		"requested": true,
+	})
+}
+
+// routeAllConfirmPasswordReset takes a reset token and a new password and updates the user
+func routeAllConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	input := &passwordResetInput{}
+	render.Bind(r, input)
+	if input.Token == "" || input.Password == "" {
+		sendAPIError(w, api_error_user_bad_data, nil, map[string]string{
+			"token":    "required",
+			"password": "required",
+		})
+		return
+	}
+
+	_, err := ResetPasswordForUser(input.Token, input.Password)
+	if err != nil {
+		sendAPIError(w, api_error_user_bad_reset, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, map[string]bool{
+		"reset": true,
+	})
+}
+
+// Bind binds the data for the HTTP
+func (data *passwordResetInput) Bind(r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SuiteTestsPasswordRoutes struct {
+	suite.Suite
+}
+
+func TestSuiteTestsPasswordRoutes(t *testing.T) {
+	suite.Run(t, new(SuiteTestsPasswordRoutes))
+}
+
+func (suite *SuiteTestsPasswordRoutes) SetupSuite() {
+	setupTesting()
+}
+
+func (suite *SuiteTestsPasswordRoutes) TestPasswordResetRoutes() {
+	require := suite.Require()
+	mailer := &mailerOutbox{
+		Directory: suite.T().TempDir(),
+	}
+	originalMailer := config.Mailer
+	config.Mailer = mailer
+	defer func() {
+		config.Mailer = originalMailer
+	}()
+
+	user := &User{}
+	err := createTestUser(user)
+	require.Nil(err)
+	defer DeleteUser(user.ID)
+
+	b := new(bytes.Buffer)
+	encoder := json.NewEncoder(b)
+
+	// bad input
+	encoder.Encode(map[string]string{})
+	code, res, err := testEndpoint(http.MethodPost, "/password/reset", b, routeAllRequestPasswordReset, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusBadRequest, code, res)
+
+	// unknown accounts still succeed, but nothing is sent
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"login": "nope_not_real@kesplora.com",
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/password/reset", b, routeAllRequestPasswordReset, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	suite.Equal(0, len(testOutboxMessages(mailer)))
+
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"login": user.Email,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/password/reset", b, routeAllRequestPasswordReset, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	require.Equal(1, len(testOutboxMessages(mailer)))
+	suite.Equal(user.Email, testOutboxMessages(mailer)[0].To)
+
+	token, err := getTokenForUser(user.ID, tokenTypePasswordReset)
+	require.Nil(err)
+	suite.True(strings.Contains(testOutboxMessages(mailer)[0].Text, token.Token))
+
+	// bad token
+	newPassword := "test_R3set_P@ssword!"
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"token":    "not_a_token",
+		"password": newPassword,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/password/reset/confirm", b, routeAllConfirmPasswordReset, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"token":    token.Token,
+		"password": newPassword,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/password/reset/confirm", b, routeAllConfirmPasswordReset, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+
+	// the token is consumed and every session is gone
+	_, err = getTokenForUser(user.ID, tokenTypePasswordReset)
+	suite.NotNil(err)
+	sessions, err := GetSessionsForUser(user.ID)
+	suite.Nil(err)
+	suite.Equal(0, len(sessions))
+
+	loggedIn, err := AttemptLoginForUser(user.SiteID, user.Email, newPassword)
+	suite.Nil(err)
+	suite.Equal(user.ID, loggedIn.ID)
+
+	// the same token cannot be used twice
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"token":    token.Token,
+		"password": newPassword,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/password/reset/confirm", b, routeAllConfirmPasswordReset, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	// expired tokens are rejected
+	expired := &Token{
+		UserID:    user.ID,
+		TokenType: tokenTypePasswordReset,
+		Token:     "expired_reset_token",
+		ExpiresOn: time.Now().Add(-1 * time.Minute).Format(timeFormatDB),
+	}
+	err = saveTokenForUser(expired)
+	require.Nil(err)
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"token":    expired.Token,
+		"password": newPassword,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/password/reset/confirm", b, routeAllConfirmPasswordReset, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+}
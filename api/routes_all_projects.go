@@ -49,7 +49,7 @@ func routeAllGetProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	found, err := GetProjectByID(projectID)
+	found, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, map[string]string{})
 		return
@@ -73,7 +73,7 @@ func routeAllGetConsentForm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := GetProjectByID(projectID)
+	_, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, nil)
 		return
@@ -101,7 +101,7 @@ func routeAllCreateConsentResponse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	project, err := GetProjectByID(projectID)
+	project, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, nil)
 		return
@@ -191,7 +191,19 @@ func routeAllCreateConsentResponse(w http.ResponseWriter, r *http.Request) {
 
 	// Step 1
 	if results.User == nil {
-		// the user isn't logged in, so we will create a new account
+		// the user isn't logged in, so we will create a new account; the site's challenge guards against scripted signups
+		if project.RequireChallenge == Yes {
+			site, err := GetSiteFromContext(r.Context())
+			if err != nil {
+				sendAPIError(w, api_error_site_get_error, err, nil)
+				return
+			}
+			err = verifyChallenge(site.ChallengeProvider, input.ChallengeToken, getIPFromRequest(r))
+			if err != nil {
+				sendAPIError(w, api_error_challenge_failed, err, nil)
+				return
+			}
+		}
 		if input.User == nil {
 			sendAPIError(w, api_error_consent_response_participant_save, errors.New("user information must be provided; if this is a project that is anonymous, just pass in a password for the user"), map[string]interface{}{
 				"input": input,
@@ -206,6 +218,10 @@ func routeAllCreateConsentResponse(w http.ResponseWriter, r *http.Request) {
 				sendAPIError(w, api_error_consent_response_participant_save, errors.New("all fields required"), map[string]interface{}{})
 				return
 			}
+			// the client cannot choose the account's role or status; the account stays pending until the email is verified
+			input.User.SystemRole = UserSystemRoleParticipant
+			input.User.Status = UserStatusPending
+			input.User.EmailVerified = No
 
 		} else {
 			// create a new account with just the code
@@ -228,19 +244,13 @@ func routeAllCreateConsentResponse(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// create the actual user
+		input.User.SiteID = project.SiteID
 		err = CreateUser(input.User)
 		if err != nil {
 			sendAPIError(w, api_error_consent_response_participant_save, err, map[string]interface{}{})
 			return
 		}
-		token, _, err := generateJWT(input.User)
-		if err != nil {
-			sendAPIError(w, api_error_consent_response_participant_save, err, map[string]interface{}{
-				"error": err,
-			})
-			return
-		}
-		jwtUser, _ := parseJWT(token)
+		jwtUser := newJWTUser(input.User, 0)
 		participant = &jwtUser
 		results.User = participant
 	}
@@ -272,19 +282,13 @@ func routeAllCreateConsentResponse(w http.ResponseWriter, r *http.Request) {
 			input.User.SystemRole = UserSystemRoleParticipant
 			input.User.ParticipantCode = code
 			input.User.Status = UserStatusActive
+			input.User.SiteID = project.SiteID
 			err = CreateUser(input.User)
 			if err != nil {
 				sendAPIError(w, api_error_consent_response_participant_save, err, map[string]interface{}{})
 				return
 			}
-			token, _, err := generateJWT(input.User)
-			if err != nil {
-				sendAPIError(w, api_error_consent_response_participant_save, err, map[string]interface{}{
-					"error": err,
-				})
-				return
-			}
-			jwtUser, _ := parseJWT(token)
+			jwtUser := newJWTUser(input.User, 0)
 			participant = &jwtUser
 			results.User = participant
 		}
@@ -315,7 +319,17 @@ func routeAllCreateConsentResponse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: if the new user status is pending, we need to send the email validation
-	// email and send them through the "confirm account" process
+	// if a full account was created, it needs to verify the email
+	if input.User != nil && input.User.ID != 0 && input.User.Email != "" && input.User.EmailVerified != Yes {
+		err = SendEmailVerificationForUser(getSiteFromHTTPContext(r), input.User)
+		if err != nil {
+			Log(LogLevelWarn, "email_verification_not_sent", err.Error(), &LogOptions{
+				Context: r.Context(),
+				ExtraData: map[string]interface{}{
+					"userId": input.User.ID,
+				},
+			})
+		}
+	}
 	sendAPIJSONData(w, http.StatusOK, input)
 }
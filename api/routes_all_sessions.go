@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+// routeAllGetUserSessions gets the active sessions for the user, marking the one making the request
+func routeAllGetUserSessions(w http.ResponseWriter, r *http.Request) {
+	results := checkRoutePermissions(w, r, &routePermissionsCheckOptions{
+		ShouldSendError: true,
+	})
+	if !results.IsValid {
+		return
+	}
+
+	sessions, err := GetSessionsForUser(results.User.ID)
+	if err != nil {
+		sendAPIError(w, api_error_user_sessions, err, map[string]string{})
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == results.User.SessionID
+	}
+	sendAPIJSONData(w, http.StatusOK, sessions)
+}
+
+// routeAllDeleteUserSession revokes one of the user's sessions, such as a lost device
+func routeAllDeleteUserSession(w http.ResponseWriter, r *http.Request) {
+	results := checkRoutePermissions(w, r, &routePermissionsCheckOptions{
+		ShouldSendError: true,
+	})
+	if !results.IsValid {
+		return
+	}
+	sessionID, sessionIDErr := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
+	if sessionIDErr != nil {
+		sendAPIError(w, api_error_invalid_path, errors.New("invalid path"), map[string]string{})
+		return
+	}
+
+	// we don't leak whether the session exists for someone else
+	session, err := GetSessionByID(sessionID)
+	if err != nil || session.UserID != results.User.ID {
+		sendAPIError(w, api_error_user_session_not_found, errSessionNotFound, map[string]string{})
+		return
+	}
+	err = RevokeSession(session)
+	if err != nil {
+		sendAPIError(w, api_error_user_session_revoke, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, map[string]bool{
+		"revoked": true,
+	})
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SuiteTestsSessionRoutes struct {
+	suite.Suite
+}
+
+func TestSuiteTestsSessionRoutes(t *testing.T) {
+	suite.Run(t, new(SuiteTestsSessionRoutes))
+}
+
+func (suite *SuiteTestsSessionRoutes) SetupSuite() {
+	setupTesting()
+}
+
+func (suite *SuiteTestsSessionRoutes) TestSessionRoutes() {
+	require := suite.Require()
+
+	admin := &User{
+		SystemRole: UserSystemRoleAdmin,
+	}
+	err := createTestUser(admin)
+	require.Nil(err)
+	defer DeleteUser(admin.ID)
+
+	// the test user already has one session, so add a second "device"
+	user := &User{}
+	err = createTestUser(user)
+	require.Nil(err)
+	defer DeleteUser(user.ID)
+	second, err := CreateSessionForUser(user.ID, nil)
+	require.Nil(err)
+	secondAccess, _, _, err := userGenerateTokens(user, second)
+	require.Nil(err)
+
+	code, res, err := testEndpoint(http.MethodGet, "/me/sessions", nil, routeAllGetUserSessions, user.Access)
+	suite.Nil(err)
+	require.Equal(http.StatusOK, code, res)
+	m, err := testEndpointResultToSlice(res)
+	suite.Nil(err)
+	require.Equal(2, len(m))
+	current := 0
+	for i := range m {
+		if m[i].(map[string]interface{})["current"].(bool) {
+			current++
+		}
+	}
+	suite.Equal(1, current)
+
+	// a user cannot revoke someone else's session
+	code, res, err = testEndpoint(http.MethodDelete, fmt.Sprintf("/me/sessions/%d", second.ID), nil, routeAllDeleteUserSession, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusNotFound, code, res)
+
+	// revoke the second device; its access token stops working but the first still does
+	code, res, err = testEndpoint(http.MethodDelete, fmt.Sprintf("/me/sessions/%d", second.ID), nil, routeAllDeleteUserSession, user.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	code, res, err = testEndpoint(http.MethodGet, "/me", nil, routeAllGetUserProfile, secondAccess.Token)
+	suite.Nil(err)
+	suite.Equal(http.StatusUnauthorized, code, res)
+	code, res, err = testEndpoint(http.MethodGet, "/me", nil, routeAllGetUserProfile, user.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+
+	// admins can see and revoke all of them
+	code, res, err = testEndpoint(http.MethodGet, fmt.Sprintf("/admin/users/%d/sessions", user.ID), nil, routeAdminGetUserSessions, user.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+	code, res, err = testEndpoint(http.MethodGet, fmt.Sprintf("/admin/users/%d/sessions", user.ID), nil, routeAdminGetUserSessions, admin.Access)
+	suite.Nil(err)
+	require.Equal(http.StatusOK, code, res)
+	m, err = testEndpointResultToSlice(res)
+	suite.Nil(err)
+	suite.Equal(1, len(m))
+
+	code, res, err = testEndpoint(http.MethodDelete, fmt.Sprintf("/admin/users/%d/sessions", user.ID), nil, routeAdminRevokeUserSessions, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	sessions, err := GetSessionsForUser(user.ID)
+	suite.Nil(err)
+	suite.Equal(0, len(sessions))
+	code, res, err = testEndpoint(http.MethodGet, "/me", nil, routeAllGetUserProfile, user.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusUnauthorized, code, res)
+}
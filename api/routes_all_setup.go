@@ -7,36 +7,46 @@ import (
 )
 
 type siteConfigurationInput struct {
-	Site      Site   `json:"site"`
-	Code      string `json:"code"`
-	AdminUser User   `json:"user"`
+	Site           Site   `json:"site"`
+	Code           string `json:"code"`
+	AdminUser      User   `json:"user"`
+	ChallengeToken string `json:"challengeToken"`
 }
 
-// routeAllGetSiteConfiguration gets whether the site is configured or not
+// routeAllGetSiteConfiguration gets whether the site for the host is configured or not
 func routeAllGetSiteConfiguration(w http.ResponseWriter, r *http.Request) {
 	// this route is unauthenticated
-	site, err := GetSite()
-	sendAPIJSONData(w, http.StatusOK, map[string]bool{
-		"configured": err == nil && site.Status == SiteStatusActive,
+	site, err := GetSiteFromContext(r.Context())
+	sendAPIJSONData(w, http.StatusOK, map[string]interface{}{
+		"configured":        err == nil && site.Status == SiteStatusActive,
+		"challengeProvider": config.ChallengeSetupProvider,
+		"challengeSiteKey":  config.ChallengeSetupSiteKey,
 	})
 }
 
-// routeAllConfigureSite configures the site
+// routeAllConfigureSite configures the site for the host. If the host's site is already active and the input is for
+// a domain no site uses yet, a new site is created so another portal can be served from the same install. The
+// install's code only sets up the first site; any other needs a code issued for its domain, which is used up once
+// the site is set up, so seeing a code once isn't enough to keep adding sites
 func routeAllConfigureSite(w http.ResponseWriter, r *http.Request) {
 	// this route is unauthenticated
-	site, err := GetSite()
+	input := &siteConfigurationInput{}
+	render.Bind(r, input)
+
+	site, err := GetSiteFromContext(r.Context())
+	if err == nil && site.Status == SiteStatusActive && input.Site.Domain != "" && normalizeSiteDomain(input.Site.Domain) != site.Domain {
+		site, err = GetSiteByDomain(input.Site.Domain)
+	}
 	exists := false
 	if err == nil && site.Status == SiteStatusActive {
 		sendAPIJSONData(w, http.StatusOK, map[string]bool{
 			"configured": true,
 		})
+		return
 	} else if err == nil {
 		exists = true
 	}
 
-	input := &siteConfigurationInput{}
-	render.Bind(r, input)
-
 	// most things are required, so we have a massive check up front so all required fields are
 	// sent if there is an error
 	if input.Code == "" ||
@@ -54,11 +64,39 @@ func routeAllConfigureSite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if input.Code != config.SiteCode {
-		sendAPIError(w, api_error_config_invalid_code, nil, map[string]string{})
+	// the challenge is checked before the code so the code can't be guessed by a script
+	err = verifyChallenge(config.ChallengeSetupProvider, input.ChallengeToken, getIPFromRequest(r))
+	if err != nil {
+		sendAPIError(w, api_error_challenge_failed, err, map[string]string{})
+		return
+	}
+
+	if input.Site.ChallengeProvider != "" && !isValidChallengeProvider(input.Site.ChallengeProvider) {
+		sendAPIError(w, api_error_site_invalid_challenge, nil, map[string]string{
+			"challengeProvider": input.Site.ChallengeProvider,
+		})
 		return
 	}
 
+	defaultSite, defaultErr := GetSite()
+	if defaultErr != nil || defaultSite.Status != SiteStatusActive {
+		setupCode := getSiteSetupCode()
+		if setupCode == "" || input.Code != setupCode {
+			sendAPIError(w, api_error_config_invalid_code, nil, map[string]string{})
+			return
+		}
+	} else {
+		domain := input.Site.Domain
+		if exists {
+			domain = site.Domain
+		}
+		used, err := useSiteDomainSetupCode(domain, input.Code)
+		if err != nil || !used {
+			sendAPIError(w, api_error_config_invalid_code, err, map[string]string{})
+			return
+		}
+	}
+
 	// set up the site
 	createdSite := &Site{
 		Name:                 input.Site.Name,
@@ -67,6 +105,10 @@ func routeAllConfigureSite(w http.ResponseWriter, r *http.Request) {
 		ProjectListOptions:   input.Site.ProjectListOptions,
 		Domain:               input.Site.Domain,
 		SiteTechnicalContact: input.Site.SiteTechnicalContact,
+		AllowUnverifiedLogin: input.Site.AllowUnverifiedLogin,
+		RequireAdminMFA:      input.Site.RequireAdminMFA,
+		ChallengeProvider:    input.Site.ChallengeProvider,
+		ChallengeSiteKey:     input.Site.ChallengeSiteKey,
 		Status:               SiteStatusActive,
 	}
 	if exists {
@@ -83,19 +125,24 @@ func routeAllConfigureSite(w http.ResponseWriter, r *http.Request) {
 
 	// create the user
 	user := &User{
-		Title:      input.AdminUser.Title,
-		Email:      input.AdminUser.Email,
-		FirstName:  input.AdminUser.FirstName,
-		LastName:   input.AdminUser.LastName,
-		Password:   input.AdminUser.Password,
-		Status:     UserStatusActive,
-		SystemRole: UserSystemRoleAdmin,
+		SiteID:        createdSite.ID,
+		Title:         input.AdminUser.Title,
+		Email:         input.AdminUser.Email,
+		FirstName:     input.AdminUser.FirstName,
+		LastName:      input.AdminUser.LastName,
+		Password:      input.AdminUser.Password,
+		Status:        UserStatusActive,
+		SystemRole:    UserSystemRoleAdmin,
+		EmailVerified: Yes, // the setup code is proof enough
 	}
 	err = CreateUser(user)
 	if err != nil {
 		sendAPIError(w, api_error_user_cannot_save, err, map[string]string{})
 		return
 	}
+	if defaultErr != nil || defaultSite.Status != SiteStatusActive {
+		clearSiteSetupCode()
+	}
 
 	sendAPIJSONData(w, http.StatusOK, map[string]interface{}{
 		"configured": true,
@@ -5,7 +5,7 @@ import "net/http"
 // routeAllGetSite gets the site
 func routeAllGetSite(w http.ResponseWriter, r *http.Request) {
 	// this route is unauthenticated
-	site, err := GetSite()
+	site, err := GetSiteFromContext(r.Context())
 	if err != nil {
 		sendAPIError(w, api_error_site_get_error, err, map[string]string{})
 		return
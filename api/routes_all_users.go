@@ -2,10 +2,9 @@ package api
 
 import (
 	"errors"
-	"fmt"
+	"math"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/go-chi/render"
@@ -16,12 +15,22 @@ type loginInput struct {
 	Password string `json:"password"`
 }
 
+type mfaLoginInput struct {
+	MFAToken string `json:"mfaToken"`
+	Code     string `json:"code"`
+}
+
 type refreshTokenInput struct {
 	Refresh string `json:"refresh"`
 }
 
 // routeAllUserLogin attempts to login a user
 func routeAllUserLogin(w http.ResponseWriter, r *http.Request) {
+	// hosts that only verify tokens send logins elsewhere
+	if !canSignJWT() {
+		sendAPIError(w, api_error_auth_cannot_sign, errJWTCannotSign, map[string]string{})
+		return
+	}
 	input := loginInput{}
 	render.Bind(r, &input)
 	if input.Login == "" || input.Password == "" {
@@ -31,15 +40,117 @@ func routeAllUserLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// repeated failures for the login or from the same address have to wait before trying again
+	siteID := getSiteIDFromHTTPContext(r)
+	ip := getIPFromRequest(r)
+	retryAfter := getLoginRetryAfter(siteID, input.Login, ip)
+	if retryAfter > 0 {
+		metricLogins.Inc(metricLoginResultThrottled)
+		sendLoginThrottledError(w, retryAfter)
+		return
+	}
+
 	// we break this here in case we want to separate it later
-	user, err := AttemptLoginForUser(input.Login, input.Password)
+	user, err := AttemptLoginForUser(siteID, input.Login, input.Password)
+	if errors.Is(err, errUserBadCredentials) {
+		metricLogins.Inc(metricLoginResultFailure)
+		retryAfter = recordFailedLoginAttempt(siteID, input.Login, ip)
+		if retryAfter > 0 {
+			sendLoginThrottledError(w, retryAfter)
+			return
+		}
+		sendAPIError(w, api_error_user_bad_login, nil, map[string]string{})
+		return
+	}
+	if errors.Is(err, errUserEmailNotVerified) {
+		metricLogins.Inc(metricLoginResultFailure)
+		sendAPIError(w, api_error_user_not_verified, err, map[string]string{})
+		return
+	}
 	if err != nil || user == nil || user.ID == 0 {
+		metricLogins.Inc(metricLoginResultFailure)
 		sendAPIError(w, api_error_user_bad_login, nil, map[string]string{})
 		return
 	}
 
+	// users with two-factor authentication get a challenge instead of tokens; the login is finished at /login/mfa. Their
+	// failures are only cleared once the code is right, so bad codes keep counting toward the backoff and lockout
+	if user.MFAEnabled == Yes {
+		challenge, err := CreateMFAChallengeForUser(user)
+		if err != nil {
+			sendAPIError(w, api_error_user_bad_login, err, map[string]string{})
+			return
+		}
+		metricLogins.Inc(metricLoginResultMFARequired)
+		sendAPIJSONData(w, http.StatusOK, challenge)
+		return
+	}
+	clearFailedLoginAttempts(siteID, input.Login)
+
+	sendLoginTokensForUser(w, r, user)
+}
+
+// sendLoginThrottledError tells the client how long to wait, both in the header and the body
+func sendLoginThrottledError(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	sendAPIError(w, api_error_user_login_throttled, nil, map[string]interface{}{
+		"retryAfter": seconds,
+	})
+}
+
+// routeAllUserLoginMFA finishes a login for a user with two-factor authentication
+func routeAllUserLoginMFA(w http.ResponseWriter, r *http.Request) {
+	if !canSignJWT() {
+		sendAPIError(w, api_error_auth_cannot_sign, errJWTCannotSign, map[string]string{})
+		return
+	}
+	input := mfaLoginInput{}
+	render.Bind(r, &input)
+	if input.MFAToken == "" || input.Code == "" {
+		sendAPIError(w, api_error_user_bad_data, nil, map[string]string{})
+		return
+	}
+
+	user, err := CompleteMFAChallenge(input.MFAToken, input.Code)
+	if errors.Is(err, errMFAChallenge) {
+		sendAPIError(w, api_error_user_bad_login, err, map[string]string{})
+		return
+	}
+	if errors.Is(err, errMFABadCode) {
+		// a bad code is a failed login, so it backs off the next password attempt and counts toward the lockout
+		metricLogins.Inc(metricLoginResultFailure)
+		recordFailedLoginAttempt(user.SiteID, getUserLogin(user), getIPFromRequest(r))
+		sendAPIError(w, api_error_user_mfa_bad_code, err, map[string]string{})
+		return
+	}
+	if err != nil {
+		metricLogins.Inc(metricLoginResultFailure)
+		sendAPIError(w, api_error_user_mfa_bad_code, err, map[string]string{})
+		return
+	}
+	clearFailedLoginAttempts(user.SiteID, getUserLogin(user))
+	// the account may have changed since the password was checked
+	err = userCanAuthenticate(user)
+	if err != nil {
+		sendAPIError(w, api_error_user_bad_login, err, map[string]string{})
+		return
+	}
+
+	sendLoginTokensForUser(w, r, user)
+}
+
+// sendLoginTokensForUser creates a new session for the user and sends the tokens in the cookies and the body
+func sendLoginTokensForUser(w http.ResponseWriter, r *http.Request, user *User) {
+	// each login is a new session, so other devices stay logged in
+	session, err := CreateSessionForUser(user.ID, r)
+	if err != nil {
+		sendAPIError(w, api_error_user_bad_login, err, map[string]string{})
+		return
+	}
+
 	// generate the tokens
-	accessToken, accessExpires, refreshToken, err := userGenerateTokens(user, true)
+	accessToken, accessExpires, refreshToken, err := userGenerateTokens(user, session)
 	if err != nil {
 		sendAPIError(w, api_error_user_bad_login, err, map[string]string{})
 		return
@@ -55,6 +166,7 @@ func routeAllUserLogin(w http.ResponseWriter, r *http.Request) {
 	user.Expires = accessExpires
 	user.Refresh = refreshToken.Token
 
+	metricLogins.Inc(metricLoginResultSuccess)
 	sendAPIJSONData(w, http.StatusOK, user)
 }
 
@@ -101,8 +213,22 @@ func routeAllUpdateUserProfile(w http.ResponseWriter, r *http.Request) {
 	if input.LastName != "" {
 		user.LastName = input.LastName
 	}
-	if input.Email != "" {
+	emailChanged := false
+	if input.Email != "" && input.Email != user.Email {
+		taken, err := isUserEmailTaken(user.SiteID, input.Email)
+		if err != nil {
+			sendAPIError(w, api_error_user_general, err, map[string]string{})
+			return
+		}
+		if taken {
+			sendAPIError(w, api_error_user_bad_data, errors.New("email already used on the site"), map[string]string{
+				"email": "is already used by another user",
+			})
+			return
+		}
 		user.Email = input.Email
+		user.EmailVerified = No
+		emailChanged = true
 	}
 	if input.Pronouns != "" {
 		user.Pronouns = input.Pronouns
@@ -118,11 +244,26 @@ func routeAllUpdateUserProfile(w http.ResponseWriter, r *http.Request) {
 		sendAPIError(w, api_error_user_general, err, map[string]string{})
 		return
 	}
+	if emailChanged {
+		err = SendEmailVerificationForUser(getSiteFromHTTPContext(r), user)
+		if err != nil {
+			Log(LogLevelWarn, "email_verification_not_sent", err.Error(), &LogOptions{
+				Context: r.Context(),
+				ExtraData: map[string]interface{}{
+					"userId": user.ID,
+				},
+			})
+		}
+	}
 	sendAPIJSONData(w, http.StatusOK, user)
 }
 
 // routeAllUserRefreshAccess is a bit of a bear, but handles refreshing the access token for the user
 func routeAllUserRefreshAccess(w http.ResponseWriter, r *http.Request) {
+	if !canSignJWT() {
+		sendAPIError(w, api_error_auth_cannot_sign, errJWTCannotSign, map[string]string{})
+		return
+	}
 	refreshToken := ""
 	refreshCookie, err := r.Cookie(tokenTypeRefresh)
 	if err == nil && refreshCookie != nil {
@@ -140,77 +281,58 @@ func routeAllUserRefreshAccess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// split; the pattern is ker_id^rand1_rand2, so we split on ^, then on _ in the first
-	parts := strings.Split(refreshToken, "^")
-	if len(parts) < 2 {
-		sendAPIError(w, api_error_auth_malformed, errors.New("auth malformed"), map[string]string{})
+	// find the session; the refresh token is rotated on every use, so if an old one is presented the
+	// session is revoked entirely since the token was likely stolen
+	session, err := GetSessionForRefreshToken(refreshToken)
+	if errors.Is(err, errSessionReused) {
+		sendAPIError(w, api_error_auth_reused, err, map[string]string{})
 		return
 	}
-	subParts := strings.Split(parts[0], "_")
-	if len(subParts) != 2 || subParts[0] != "ker" {
-		sendAPIError(w, api_error_auth_malformed, errors.New("auth malformed"), map[string]string{})
+	if errors.Is(err, errSessionExpired) {
+		sendAPIError(w, api_error_auth_expired, err, map[string]string{})
 		return
 	}
-	userID, err := strconv.ParseInt(subParts[1], 10, 64)
-	if err != nil {
-		sendAPIError(w, api_error_auth_malformed, err, map[string]string{})
-		return
-	}
-
-	// get the token in the DB and make sure they match
-	foundToken, err := getTokenForUser(userID, tokenTypeRefresh)
-	if err != nil {
+	if errors.Is(err, errSessionNotFound) {
 		sendAPIError(w, api_error_auth_missing, err, map[string]string{})
 		return
 	}
-	if foundToken.Token != refreshToken {
-		sendAPIError(w, api_error_auth_missing, errors.New("missing refresh"), map[string]string{})
-		return
-	}
-	parsedExpires, err := parseTime(foundToken.ExpiresOn)
 	if err != nil {
 		sendAPIError(w, api_error_auth_malformed, err, map[string]string{})
 		return
 	}
-	if parsedExpires.Before(time.Now()) {
-		sendAPIError(w, api_error_auth_expired, fmt.Errorf("expired at %s", parsedExpires.Format(timeFormatAPI)), map[string]string{})
-		return
-	}
 
 	// get the user, make sure their account is still valid
-	foundUser, err := GetUserByID(userID)
+	foundUser, err := GetUserByID(session.UserID)
 	if err != nil {
 		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
 		return
 	}
-	if foundUser.Status != UserStatusActive {
-		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
+	err = userCanAuthenticate(foundUser)
+	if errors.Is(err, errUserEmailNotVerified) {
+		sendAPIError(w, api_error_user_not_verified, err, map[string]string{})
 		return
 	}
-
-	// generate new access tokens and extend the refresh token expires
-	foundToken.ExpiresOn = time.Now().Add(tokenExpiresMinutesRefresh * time.Minute).Format(timeFormatDB)
-	err = saveTokenForUser(foundToken)
 	if err != nil {
-		sendAPIError(w, api_error_auth_save, err, map[string]string{})
+		sendAPIError(w, api_error_user_not_found, err, map[string]string{})
 		return
 	}
 
-	accessToken, accessExpires, _, err := userGenerateTokens(foundUser, false)
+	// generate new access tokens and rotate the refresh token
+	accessToken, accessExpires, newRefreshToken, err := userGenerateTokens(foundUser, session)
 	if err != nil {
-		sendAPIError(w, api_error_user_bad_login, err, map[string]string{})
+		sendAPIError(w, api_error_auth_save, err, map[string]string{})
 		return
 	}
 
 	// now generate the cookies
-	accessCookie, refreshCookie := generateCookies(accessToken.Token, foundToken.Token)
+	accessCookie, refreshCookie := generateCookies(accessToken.Token, newRefreshToken.Token)
 	if err == nil {
 		http.SetCookie(w, accessCookie)
 		http.SetCookie(w, refreshCookie)
 	}
 	foundUser.Access = accessToken.Token
 	foundUser.Expires = accessExpires
-	foundUser.Refresh = refreshToken
+	foundUser.Refresh = newRefreshToken.Token
 	sendAPIJSONData(w, http.StatusOK, foundUser)
 }
 
@@ -222,7 +344,13 @@ func routeAllUserLogout(w http.ResponseWriter, r *http.Request) {
 	if !results.IsValid {
 		return
 	}
-	err := deleteTokenForUser(results.User.ID, tokenTypeRefresh)
+	// only this session is logged out; older tokens without a session log out everywhere
+	var err error
+	if results.User.SessionID != 0 {
+		err = RevokeSession(&Session{ID: results.User.SessionID})
+	} else {
+		err = LogOutUser(results.User.ID)
+	}
 	if err != nil {
 		sendAPIError(w, api_error_user_bad_logout, err, map[string]string{})
 		return
@@ -241,3 +369,8 @@ func (data *loginInput) Bind(r *http.Request) error {
 func (data *refreshTokenInput) Bind(r *http.Request) error {
 	return nil
 }
+
+// Bind binds the data for the HTTP
+func (data *mfaLoginInput) Bind(r *http.Request) error {
+	return nil
+}
@@ -36,6 +36,7 @@ func (suite SuiteTestsUserRoutes) TestUserAuthRoutes() {
 	plainPassword := "test_P@ssword!"
 	updatedPlainPassword := "test_updateP@$$W0Rd!"
 	user := &User{
+		SiteID:     getTestSiteID(),
 		FirstName:  "Admin",
 		LastName:   "Admin",
 		Status:     "active",
@@ -140,6 +141,7 @@ func (suite SuiteTestsUserRoutes) TestUserAuthRefresh() {
 
 	plainPassword := "test_P@ssword!"
 	user := &User{
+		SiteID:     getTestSiteID(),
 		FirstName:  "Admin",
 		LastName:   "Admin",
 		Status:     "active",
@@ -168,18 +170,17 @@ func (suite SuiteTestsUserRoutes) TestUserAuthRefresh() {
 	suite.NotEqual("", found.Refresh)
 	suite.NotEqual("", found.Expires)
 
-	// check the db for the refresh token
-	foundToken, err := getTokenForUser(found.ID, tokenTypeRefresh)
+	// the login created a session for the refresh token
+	sessions, err := GetSessionsForUser(found.ID)
 	suite.Nil(err)
-	require.NotNil(foundToken)
-	require.NotEqual("", foundToken.Token)
+	require.Equal(1, len(sessions))
 
 	// we need to sleep 1 second to allow the expires to change
 	time.Sleep(1 * time.Second)
 
 	// since we don't have cookies in our test suite, we just send up the body
 	refreshInput := &refreshTokenInput{
-		Refresh: foundToken.Token,
+		Refresh: found.Refresh,
 	}
 	b.Reset()
 	encoder.Encode(refreshInput)
@@ -193,14 +194,58 @@ func (suite SuiteTestsUserRoutes) TestUserAuthRefresh() {
 	err = mapstructure.Decode(m, found2)
 	suite.Nil(err)
 	suite.NotEqual(found.Access, found2.Access)
-	suite.Equal(found.Refresh, found2.Refresh)
+	suite.NotEqual(found.Refresh, found2.Refresh)
 	suite.NotEqual(found.Expires, found2.Expires)
 
-	// logout; that should delete the refresh token so refresh should fail
-	code, res, err = testEndpoint(http.MethodPost, "/logout", b, routeAllUserRefreshAccess, found.Access)
+	// the new refresh token works once
+	refreshInput.Refresh = found2.Refresh
+	b.Reset()
+	encoder.Encode(refreshInput)
+	code, res, err = testEndpoint(http.MethodPost, "/me/refresh", b, routeAllUserRefreshAccess, "")
+	suite.Nil(err)
+	require.Equal(http.StatusOK, code, res)
+	found3 := &User{}
+	m, err = testEndpointResultToMap(res)
+	suite.Nil(err)
+	err = mapstructure.Decode(m, found3)
+	suite.Nil(err)
+
+	// replaying the rotated token revokes the whole session, including the newest refresh and access tokens
+	b.Reset()
+	encoder.Encode(refreshInput)
+	code, res, err = testEndpoint(http.MethodPost, "/me/refresh", b, routeAllUserRefreshAccess, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusUnauthorized, code, res)
+	refreshInput.Refresh = found3.Refresh
+	b.Reset()
+	encoder.Encode(refreshInput)
+	code, res, err = testEndpoint(http.MethodPost, "/me/refresh", b, routeAllUserRefreshAccess, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusUnauthorized, code, res)
+	code, res, err = testEndpoint(http.MethodGet, "/me", nil, routeAllGetUserProfile, found3.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusUnauthorized, code, res)
+
+	// log in again, then logout; that should revoke the session so refresh should fail
+	b.Reset()
+	encoder.Encode(&map[string]string{
+		"login":    user.Email,
+		"password": plainPassword,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/login", b, routeAllUserLogin, "")
+	suite.Nil(err)
+	require.Equal(http.StatusOK, code, res)
+	found4 := &User{}
+	m, err = testEndpointResultToMap(res)
+	suite.Nil(err)
+	err = mapstructure.Decode(m, found4)
+	suite.Nil(err)
+
+	code, res, err = testEndpoint(http.MethodPost, "/logout", nil, routeAllUserLogout, found4.Access)
 	suite.Nil(err)
 	require.Equal(http.StatusOK, code, res)
 
+	refreshInput.Refresh = found4.Refresh
 	b.Reset()
 	encoder.Encode(refreshInput)
 	code, res, err = testEndpoint(http.MethodPost, "/me/refresh", b, routeAllUserRefreshAccess, "")
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+type emailVerificationInput struct {
+	Login string `json:"login"`
+	Token string `json:"token"`
+}
+
+// routeAllConfirmEmailVerification takes an email token and verifies the user's email
+func routeAllConfirmEmailVerification(w http.ResponseWriter, r *http.Request) {
+	input := &emailVerificationInput{}
+	render.Bind(r, input)
+	if input.Token == "" {
+		sendAPIError(w, api_error_user_bad_data, nil, map[string]string{
+			"token": "required",
+		})
+		return
+	}
+
+	user, err := VerifyEmailForUser(input.Token)
+	if err != nil {
+		sendAPIError(w, api_error_user_bad_verify, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, user)
+}
+
+// routeAllResendEmailVerification sends a new verification link. If the user is logged in, the JWT is used, otherwise
+// the login is used. Since unverified users may not be able to log in, this is not restricted to authenticated users.
+// Unknown accounts still succeed to avoid leaking which accounts exist
+func routeAllResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	results := checkRoutePermissions(w, r, &routePermissionsCheckOptions{
+		ShouldSendError: false,
+	})
+
+	var user *User
+	var err error
+	if results.IsValid && results.User != nil {
+		user, err = GetUserByID(results.User.ID)
+	} else {
+		input := &emailVerificationInput{}
+		render.Bind(r, input)
+		if input.Login == "" {
+			sendAPIError(w, api_error_user_bad_data, nil, map[string]string{
+				"login": "required",
+			})
+			return
+		}
+		user, err = getUserByLogin(getSiteIDFromHTTPContext(r), input.Login)
+	}
+	if err == nil {
+		err = ResendEmailVerificationForUser(getSiteFromHTTPContext(r), user)
+	}
+	if errors.Is(err, errVerificationThrottled) {
+		sendAPIError(w, api_error_user_verify_throttled, err, map[string]int{
+			"retryAfter": emailVerificationResendSeconds,
+		})
+		return
+	}
+	if err != nil {
+		Log(LogLevelInfo, "email_verification_not_sent", err.Error(), &LogOptions{
+			Context: r.Context(),
+		})
+	}
+	sendAPIJSONData(w, http.StatusOK, map[string]bool{
+		"requested": true,
+	})
+}
+
+// Bind binds the data for the HTTP
+func (data *emailVerificationInput) Bind(r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SuiteTestsVerifyRoutes struct {
+	suite.Suite
+}
+
+func TestSuiteTestsVerifyRoutes(t *testing.T) {
+	suite.Run(t, new(SuiteTestsVerifyRoutes))
+}
+
+func (suite *SuiteTestsVerifyRoutes) SetupSuite() {
+	setupTesting()
+}
+
+func (suite *SuiteTestsVerifyRoutes) TestEmailVerificationRoutes() {
+	require := suite.Require()
+	mailer := &mailerOutbox{
+		Directory: suite.T().TempDir(),
+	}
+	originalMailer := config.Mailer
+	config.Mailer = mailer
+	defer func() {
+		config.Mailer = originalMailer
+	}()
+
+	site, err := GetSite()
+	require.Nil(err)
+	originalAllow := site.AllowUnverifiedLogin
+	defer func() {
+		site.AllowUnverifiedLogin = originalAllow
+		UpdateSite(site)
+	}()
+	site.AllowUnverifiedLogin = No
+	err = UpdateSite(site)
+	require.Nil(err)
+
+	plainPassword := "test_V3rify_P@ssword!"
+	user := &User{
+		Password:      plainPassword,
+		Status:        UserStatusPending,
+		EmailVerified: No,
+	}
+	err = createTestUser(user)
+	require.Nil(err)
+	defer DeleteUser(user.ID)
+
+	// cannot log in yet
+	_, err = AttemptLoginForUser(user.SiteID, user.Email, plainPassword)
+	suite.ErrorIs(err, errUserEmailNotVerified)
+
+	b := new(bytes.Buffer)
+	encoder := json.NewEncoder(b)
+	encoder.Encode(map[string]string{
+		"login": user.Email,
+	})
+	code, res, err := testEndpoint(http.MethodPost, "/verify/resend", b, routeAllResendEmailVerification, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	require.Equal(1, len(testOutboxMessages(mailer)))
+
+	// a second request right away is throttled
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"login": user.Email,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/verify/resend", b, routeAllResendEmailVerification, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusTooManyRequests, code, res)
+	suite.Equal(1, len(testOutboxMessages(mailer)))
+
+	token, err := getTokenForUser(user.ID, tokenTypeEmail)
+	require.Nil(err)
+	suite.True(strings.Contains(testOutboxMessages(mailer)[0].Text, token.Token))
+
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"token": "not_a_token",
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/verify/confirm", b, routeAllConfirmEmailVerification, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"token": token.Token,
+	})
+	code, res, err = testEndpoint(http.MethodPost, "/verify/confirm", b, routeAllConfirmEmailVerification, "")
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+
+	found, err := GetUserByID(user.ID)
+	require.Nil(err)
+	suite.Equal(Yes, found.EmailVerified)
+	suite.Equal(UserStatusActive, found.Status)
+
+	loggedIn, err := AttemptLoginForUser(user.SiteID, user.Email, plainPassword)
+	suite.Nil(err)
+	suite.Equal(user.ID, loggedIn.ID)
+
+	// changing the email requires verifying it again
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"email": "changed_" + user.Email,
+	})
+	code, res, err = testEndpoint(http.MethodPatch, "/me", b, routeAllUpdateUserProfile, user.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	suite.Equal(2, len(testOutboxMessages(mailer)))
+
+	found, err = GetUserByID(user.ID)
+	require.Nil(err)
+	suite.Equal(No, found.EmailVerified)
+	suite.Equal(UserStatusActive, found.Status)
+	_, err = AttemptLoginForUser(found.SiteID, found.Email, plainPassword)
+	suite.ErrorIs(err, errUserEmailNotVerified)
+
+	// the site can allow unverified logins
+	site.AllowUnverifiedLogin = Yes
+	err = UpdateSite(site)
+	require.Nil(err)
+	_, err = AttemptLoginForUser(found.SiteID, found.Email, plainPassword)
+	suite.Nil(err)
+}
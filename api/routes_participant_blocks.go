@@ -122,7 +122,7 @@ func routeParticipantSaveBlockStatus(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			if projectStatus == BlockUserStatusCompleted {
 				// set the complete message
-				project, _ := GetProjectByID(projectID)
+				project, _ := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 				input.ProjectUserStatus = projectStatus
 				input.ProjectCompleteMessage = project.CompleteMessage
 			}
@@ -282,6 +282,7 @@ func routeParticipantSaveFormResponse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	metricFormSubmissions.Inc()
 	sendAPIJSONData(w, http.StatusOK, submission)
 }
 
@@ -23,7 +23,7 @@ func routeParticipantGetConsentResponse(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	_, err := GetProjectByID(projectID)
+	_, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, nil)
 		return
@@ -58,7 +58,7 @@ func routeParticipantDeleteConsentResponse(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	_, err := GetProjectByID(projectID)
+	_, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, nil)
 		return
@@ -77,9 +77,14 @@ func routeParticipantDeleteConsentResponse(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = RemoveUserFromProjectCompletely(response.ParticipantID, projectID)
+	if response.ParticipantID == 0 {
+		// not connected to a participant, so only the response itself can be removed
+		err = DeleteConsentesponse(response.ID)
+	} else {
+		_, err = EraseUser(response.ParticipantID, projectID, results.User.ID, false)
+	}
 	if err != nil {
-		sendAPIError(w, api_error_project_unlink, err, nil)
+		sendAPIError(w, api_error_user_erasure, err, nil)
 		return
 	}
 	sendAPIJSONData(w, http.StatusOK, map[string]bool{
@@ -0,0 +1,18 @@
+package api
+
+import (
+	"net/http"
+)
+
+// routeParticipantEraseAccount lets a participant remove their account and everything they contributed to every
+// project. With ?dryRun=yes, nothing is removed and the counts that would be are returned
+func routeParticipantEraseAccount(w http.ResponseWriter, r *http.Request) {
+	user, _ := getUserFromHTTPContext(r) // can't get here without a user
+
+	receipt, err := EraseUser(user.ID, 0, user.ID, isErasureDryRun(r))
+	if err != nil {
+		sendAPIError(w, api_error_user_erasure, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, receipt)
+}
@@ -0,0 +1,11 @@
+package api
+
+import (
+	"net/http"
+)
+
+// routeParticipantExport downloads a zip of everything stored for the participant
+func routeParticipantExport(w http.ResponseWriter, r *http.Request) {
+	user, _ := getUserFromHTTPContext(r) // can't get here without a user
+	sendParticipantExport(w, user.ID)
+}
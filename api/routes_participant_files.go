@@ -24,7 +24,7 @@ func routeParticipantGetFileMetaData(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// find the file in the DB to prevent a jump to AWS
-	file, err := GetFileFromDB(fileID)
+	file, err := GetFileFromDB(getSiteIDFromHTTPContext(r), fileID)
 	if err != nil {
 		sendAPIError(w, api_error_file_no_exist, err, nil)
 		return
@@ -55,7 +55,7 @@ func routeParticipantDownloadFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// find the file in the DB to prevent a jump to AWS
-	file, err := GetFileFromDB(fileID)
+	file, err := GetFileFromDB(getSiteIDFromHTTPContext(r), fileID)
 	if err != nil {
 		sendAPIError(w, api_error_file_no_exist, fileIDErr, nil)
 		return
@@ -76,6 +76,7 @@ func routeParticipantDownloadFile(w http.ResponseWriter, r *http.Request) {
 		sendAPIError(w, api_error_file_download, fileIDErr, nil)
 		return
 	}
+	metricFileDownloads.Inc()
 	// TODO: get the content type from the extension
 	format := r.URL.Query().Get("format")
 	if format == "base64" {
@@ -62,7 +62,7 @@ func routeParticipantGetProjectFlow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := GetProjectByID(projectID)
+	_, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, map[string]string{})
 		return
@@ -94,7 +94,7 @@ func routeParticipantUnlinkUserAndProject(w http.ResponseWriter, r *http.Request
 
 	removeProgress := r.URL.Query().Get("remove") // if it's anything other than blank, we remove it
 
-	found, err := GetProjectByID(projectID)
+	found, err := GetProjectByID(getSiteIDFromHTTPContext(r), projectID)
 	if err != nil {
 		sendAPIError(w, api_error_project_not_found, err, map[string]string{})
 		return
@@ -109,14 +109,14 @@ func routeParticipantUnlinkUserAndProject(w http.ResponseWriter, r *http.Request
 
 	// at this point, they are good; we don't care if they don't actually belong
 	// to the project, since it wouldn't matter
-	err = UnlinkUserAndProject(user.ID, projectID)
-	if err != nil {
-		sendAPIError(w, api_error_project_unlink, err, map[string]string{})
-		return
-	}
-
 	if removeProgress != "" {
-		err = RemoveAllProgressForParticipantAndFlow(user.ID, projectID)
+		_, err = EraseUser(user.ID, projectID, user.ID, false)
+		if err != nil {
+			sendAPIError(w, api_error_user_erasure, err, map[string]string{})
+			return
+		}
+	} else {
+		err = UnlinkUserAndProject(user.ID, projectID)
 		if err != nil {
 			sendAPIError(w, api_error_project_unlink, err, map[string]string{})
 			return
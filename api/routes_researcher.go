@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+// routeResearcherGetProjects gets the projects the researcher collaborates on; admins get every project on the site
+func routeResearcherGetProjects(w http.ResponseWriter, r *http.Request) {
+	results := checkRoutePermissions(w, r, &routePermissionsCheckOptions{
+		ShouldSendError: true,
+	})
+	if !results.IsValid {
+		return
+	}
+
+	var projects []Project
+	var err error
+	if results.IsAdmin {
+		projects, err = GetProjectsForSite(results.Site.ID, "all")
+		for i := range projects {
+			projects[i].CollaboratorRole = ProjectCollaboratorRoleOwner
+		}
+	} else {
+		projects, err = GetProjectsForCollaborator(results.User.ID)
+	}
+	if err != nil {
+		sendAPIError(w, api_error_project_not_found, err, map[string]string{})
+		return
+	}
+	sendAPIJSONData(w, http.StatusOK, projects)
+}
+
+// researcherProjectAccess is a middleware for the /researcher project routes. It must be attached with `With` so that
+// all of the path parameters have been resolved. The user must have at least the minimum role on the project and, if
+// checkPath is true, any module or block in the path must belong to the project, so a researcher can't reach into another
+// project's data. The only time checkPath should be false is when linking a new module to the project
+func researcherProjectAccess(minimumRole string, checkPath bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			projectID, projectIDErr := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
+			if projectIDErr != nil {
+				sendAPIError(w, api_error_invalid_path, projectIDErr, map[string]string{})
+				return
+			}
+			results := checkRoutePermissions(w, r, &routePermissionsCheckOptions{
+				ShouldSendError:    true,
+				MinimumProjectRole: minimumRole,
+				ProjectID:          projectID,
+			})
+			if !results.IsValid || !checkPathIsOnSite(w, r) {
+				return
+			}
+
+			if checkPath && chi.URLParam(r, "moduleID") != "" {
+				moduleID, moduleIDErr := strconv.ParseInt(chi.URLParam(r, "moduleID"), 10, 64)
+				if moduleIDErr != nil || !IsModuleInProject(projectID, moduleID) {
+					sendAPIError(w, api_error_module_not_found, errors.New("module not in project"), map[string]string{})
+					return
+				}
+				if chi.URLParam(r, "blockID") != "" {
+					blockID, blockIDErr := strconv.ParseInt(chi.URLParam(r, "blockID"), 10, 64)
+					if blockIDErr != nil || !IsBlockInModule(moduleID, blockID) {
+						sendAPIError(w, api_error_block_not_found, errors.New("block not in module"), map[string]string{})
+						return
+					}
+				}
+			}
+
+			ctx := r.Context()
+			if results.Site != nil {
+				ctx = context.WithValue(r.Context(), appContextSite, results.Site)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
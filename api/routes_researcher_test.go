@@ -0,0 +1,245 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/stretchr/testify/suite"
+)
+
+type SuiteTestsResearcherRoutes struct {
+	suite.Suite
+}
+
+func TestSuiteTestsResearcherRoutes(t *testing.T) {
+	suite.Run(t, new(SuiteTestsResearcherRoutes))
+}
+
+func (suite *SuiteTestsResearcherRoutes) SetupSuite() {
+	setupTesting()
+}
+
+func (suite *SuiteTestsResearcherRoutes) TestResearcherCollaboratorRoutes() {
+	require := suite.Require()
+	b := new(bytes.Buffer)
+	encoder := json.NewEncoder(b)
+
+	admin := &User{
+		SystemRole: UserSystemRoleAdmin,
+	}
+	err := createTestUser(admin)
+	require.Nil(err)
+	defer DeleteUser(admin.ID)
+	researcher := &User{
+		SystemRole: UserSystemRoleUser,
+	}
+	err = createTestUser(researcher)
+	require.Nil(err)
+	defer DeleteUser(researcher.ID)
+	assistant := &User{
+		SystemRole: UserSystemRoleUser,
+	}
+	err = createTestUser(assistant)
+	require.Nil(err)
+	defer DeleteUser(assistant.ID)
+	participant := &User{
+		SystemRole: UserSystemRoleParticipant,
+	}
+	err = createTestUser(participant)
+	require.Nil(err)
+	defer DeleteUser(participant.ID)
+
+	project := &Project{}
+	err = createTestProject(project)
+	require.Nil(err)
+	defer DeleteProject(project.ID)
+	otherProject := &Project{}
+	err = createTestProject(otherProject)
+	require.Nil(err)
+	defer DeleteProject(otherProject.ID)
+
+	// participants can't use the researcher routes at all
+	code, res, err := testEndpoint(http.MethodGet, "/researcher/projects", b, routeResearcherGetProjects, participant.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	code, res, err = testEndpoint(http.MethodGet, "/researcher/projects", b, routeResearcherGetProjects, researcher.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	s, err := testEndpointResultToSlice(res)
+	suite.Nil(err)
+	suite.Equal(0, len(s))
+
+	code, res, err = testEndpoint(http.MethodGet, fmt.Sprintf("/researcher/projects/%d", project.ID), b, routeAdminGetProject, researcher.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	// participants and bad roles can't be collaborators
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"role": ProjectCollaboratorRoleOwner,
+	})
+	code, res, err = testEndpoint(http.MethodPut, fmt.Sprintf("/admin/projects/%d/collaborators/%d", project.ID, participant.ID), b, routeAdminSaveProjectCollaborator, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusBadRequest, code, res)
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"role": "boss",
+	})
+	code, res, err = testEndpoint(http.MethodPut, fmt.Sprintf("/admin/projects/%d/collaborators/%d", project.ID, researcher.ID), b, routeAdminSaveProjectCollaborator, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusBadRequest, code, res)
+
+	// make the researcher an analyst
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"role": ProjectCollaboratorRoleAnalyst,
+	})
+	code, res, err = testEndpoint(http.MethodPut, fmt.Sprintf("/admin/projects/%d/collaborators/%d", project.ID, researcher.ID), b, routeAdminSaveProjectCollaborator, admin.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	m, err := testEndpointResultToMap(res)
+	suite.Nil(err)
+	collaborator := &ProjectCollaborator{}
+	mapstructure.Decode(m, collaborator)
+	suite.Equal(researcher.ID, collaborator.UserID)
+	suite.Equal(ProjectCollaboratorRoleAnalyst, collaborator.Role)
+	suite.Equal(researcher.Email, collaborator.Email)
+
+	code, res, err = testEndpoint(http.MethodGet, "/researcher/projects", b, routeResearcherGetProjects, researcher.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	s, err = testEndpointResultToSlice(res)
+	suite.Nil(err)
+	require.Equal(1, len(s))
+	found := &Project{}
+	mapstructure.Decode(s[0], found)
+	suite.Equal(project.ID, found.ID)
+	suite.Equal(ProjectCollaboratorRoleAnalyst, found.CollaboratorRole)
+
+	code, res, err = testEndpoint(http.MethodGet, fmt.Sprintf("/researcher/projects/%d", project.ID), b, routeAdminGetProject, researcher.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	code, res, err = testEndpoint(http.MethodGet, fmt.Sprintf("/researcher/projects/%d/users", project.ID), b, routeAdminGetUsersOnProject, researcher.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	code, res, err = testEndpoint(http.MethodGet, fmt.Sprintf("/researcher/projects/%d", otherProject.ID), b, routeAdminGetProject, researcher.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	// analysts can't edit or manage collaborators
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"name": "Changed",
+	})
+	code, res, err = testEndpoint(http.MethodPatch, fmt.Sprintf("/researcher/projects/%d", project.ID), b, routeAdminUpdateProject, researcher.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"role": ProjectCollaboratorRoleViewer,
+	})
+	code, res, err = testEndpoint(http.MethodPut, fmt.Sprintf("/researcher/projects/%d/collaborators/%d", project.ID, assistant.ID), b, routeAdminSaveProjectCollaborator, researcher.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	// modules from other projects can't be reached through this project
+	code, res, err = testEndpoint(http.MethodGet, fmt.Sprintf("/researcher/projects/%d/modules/999999999/blocks/1/users/%d/submissions", project.ID, participant.ID), b, routeAdminGetUserSubmissions, researcher.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusNotFound, code, res)
+
+	// promote to owner, then they can add the assistant
+	err = SaveProjectCollaborator(&ProjectCollaborator{
+		ProjectID: project.ID,
+		UserID:    researcher.ID,
+		Role:      ProjectCollaboratorRoleOwner,
+	})
+	require.Nil(err)
+	code, res, err = testEndpoint(http.MethodPut, fmt.Sprintf("/researcher/projects/%d/collaborators/%d", project.ID, assistant.ID), b, routeAdminSaveProjectCollaborator, researcher.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+
+	code, res, err = testEndpoint(http.MethodGet, fmt.Sprintf("/researcher/projects/%d/collaborators", project.ID), b, routeAdminGetProjectCollaborators, assistant.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	s, err = testEndpointResultToSlice(res)
+	suite.Nil(err)
+	suite.Equal(2, len(s))
+
+	code, res, err = testEndpoint(http.MethodDelete, fmt.Sprintf("/researcher/projects/%d/collaborators/%d", project.ID, assistant.ID), b, routeAdminDeleteProjectCollaborator, researcher.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	code, res, err = testEndpoint(http.MethodGet, fmt.Sprintf("/researcher/projects/%d", project.ID), b, routeAdminGetProject, assistant.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+}
+
+func (suite *SuiteTestsResearcherRoutes) TestResearcherConsentFormRoutes() {
+	require := suite.Require()
+	b := new(bytes.Buffer)
+	encoder := json.NewEncoder(b)
+
+	editor := &User{
+		SystemRole: UserSystemRoleUser,
+	}
+	err := createTestUser(editor)
+	require.Nil(err)
+	defer DeleteUser(editor.ID)
+	analyst := &User{
+		SystemRole: UserSystemRoleUser,
+	}
+	err = createTestUser(analyst)
+	require.Nil(err)
+	defer DeleteUser(analyst.ID)
+
+	project := &Project{}
+	err = createTestProject(project)
+	require.Nil(err)
+	defer DeleteProject(project.ID)
+	err = SaveProjectCollaborator(&ProjectCollaborator{
+		ProjectID: project.ID,
+		UserID:    editor.ID,
+		Role:      ProjectCollaboratorRoleEditor,
+	})
+	require.Nil(err)
+	err = SaveProjectCollaborator(&ProjectCollaborator{
+		ProjectID: project.ID,
+		UserID:    analyst.ID,
+		Role:      ProjectCollaboratorRoleAnalyst,
+	})
+	require.Nil(err)
+
+	// editors can save and delete the consent form without being admins
+	endpoint := fmt.Sprintf("/researcher/projects/%d/consent", project.ID)
+	encoder.Encode(map[string]string{
+		"contentInMarkdown": "# Consent",
+	})
+	code, res, err := testEndpoint(http.MethodPost, endpoint, b, routeAdminSaveConsentForm, editor.Access)
+	suite.Nil(err)
+	require.Equal(http.StatusOK, code, res)
+	form, err := GetConsentFormForProject(project.ID)
+	require.Nil(err)
+	suite.Equal("# Consent", form.ContentInMarkdown)
+
+	// analysts can't change it
+	b.Reset()
+	encoder.Encode(map[string]string{
+		"contentInMarkdown": "# Changed",
+	})
+	code, res, err = testEndpoint(http.MethodPost, endpoint, b, routeAdminSaveConsentForm, analyst.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+	code, res, err = testEndpoint(http.MethodDelete, endpoint, nil, routeAdminDeleteConsentForm, analyst.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusForbidden, code, res)
+
+	code, res, err = testEndpoint(http.MethodDelete, endpoint, nil, routeAdminDeleteConsentForm, editor.Access)
+	suite.Nil(err)
+	suite.Equal(http.StatusOK, code, res)
+	_, err = GetConsentFormForProject(project.ID)
+	suite.NotNil(err)
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sessionUserAgentMaxLength = 512
+	sessionActiveCacheMinutes = 5 // how long a session is remembered as active before checking the DB again
+)
+
+var (
+	errSessionNotFound = errors.New("session not found")
+	errSessionExpired  = errors.New("session expired")
+	errSessionReused   = errors.New("refresh token was already used; the session has been revoked")
+)
+
+// Session is a single login on a device. Each session has its own refresh token, which is rotated every time it is
+// used. Only hashes of the refresh tokens are stored. The previous hash is kept so that if an old refresh token is
+// presented again, we know it was stolen or replayed and can revoke the session
+type Session struct {
+	ID           int64  `json:"id" db:"id"`
+	UserID       int64  `json:"userId" db:"userId"`
+	RefreshHash  string `json:"-" db:"refreshHash"`
+	PreviousHash string `json:"-" db:"previousHash"`
+	UserAgent    string `json:"userAgent" db:"userAgent"`
+	IPAddress    string `json:"ipAddress" db:"ipAddress"`
+	CreatedOn    string `json:"createdOn" db:"createdOn"`
+	LastUsedOn   string `json:"lastUsedOn" db:"lastUsedOn"`
+	ExpiresOn    string `json:"expiresOn" db:"expiresOn"`
+	Current      bool   `json:"current"` // whether this is the session making the request
+}
+
+// CreateSessionForUser creates a new session for the user from the request, which may be nil in tests. The session has no
+// refresh token until it is rotated, which userGenerateTokens handles
+func CreateSessionForUser(userID int64, r *http.Request) (*Session, error) {
+	input := &Session{
+		UserID: userID,
+	}
+	if r != nil {
+		input.UserAgent = r.UserAgent()
+		input.IPAddress = getIPFromRequest(r)
+	}
+	input.processForDB()
+	defer input.processForAPI()
+	res, err := config.DBConnection.NamedExec(`INSERT INTO Sessions (userId, refreshHash, previousHash, userAgent, ipAddress, createdOn, lastUsedOn, expiresOn)
+	VALUES
+	(:userId, :refreshHash, :previousHash, :userAgent, :ipAddress, :createdOn, :lastUsedOn, :expiresOn)`, input)
+	if err != nil {
+		return input, err
+	}
+	input.ID, _ = res.LastInsertId()
+	return input, nil
+}
+
+// GetSessionByID gets a single session
+func GetSessionByID(sessionID int64) (*Session, error) {
+	session := &Session{}
+	defer session.processForAPI()
+	err := config.DBConnection.Get(session, `SELECT * FROM Sessions WHERE id = ?`, sessionID)
+	return session, err
+}
+
+// GetSessionsForUser gets all of the unexpired sessions for a user, most recently used first
+func GetSessionsForUser(userID int64) ([]Session, error) {
+	sessions := []Session{}
+	err := config.DBConnection.Select(&sessions, `SELECT * FROM Sessions WHERE userId = ? AND expiresOn > ? ORDER BY lastUsedOn DESC`,
+		userID, time.Now().Format(timeFormatDB))
+	for i := range sessions {
+		sessions[i].processForAPI()
+	}
+	return sessions, err
+}
+
+// rotateSession generates a new refresh token for the session and extends it. The returned token is the only time the
+// plain token is available
+func rotateSession(session *Session) (string, error) {
+	refreshToken, err := generateRefreshToken(session.ID)
+	if err != nil {
+		return "", err
+	}
+	session.PreviousHash = session.RefreshHash
+	session.RefreshHash = hashRefreshToken(refreshToken)
+	session.LastUsedOn = time.Now().Format(timeFormatDB)
+	session.ExpiresOn = time.Now().Add(tokenExpiresMinutesRefresh * time.Minute).Format(timeFormatDB)
+	session.processForDB()
+	defer session.processForAPI()
+	_, err = config.DBConnection.NamedExec(`UPDATE Sessions SET
+	refreshHash = :refreshHash,
+	previousHash = :previousHash,
+	lastUsedOn = :lastUsedOn,
+	expiresOn = :expiresOn
+	WHERE id = :id`, session)
+	return refreshToken, err
+}
+
+// GetSessionForRefreshToken finds the session that owns the refresh token. If the token was already rotated out, the session
+// is revoked and errSessionReused is returned
+func GetSessionForRefreshToken(refreshToken string) (*Session, error) {
+	sessionID, err := parseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	session, err := GetSessionByID(sessionID)
+	if err != nil {
+		return nil, errSessionNotFound
+	}
+	hashed := hashRefreshToken(refreshToken)
+	if session.PreviousHash != "" && session.PreviousHash == hashed {
+		RevokeSession(session)
+		return nil, errSessionReused
+	}
+	if session.RefreshHash == "" || session.RefreshHash != hashed {
+		return nil, errSessionNotFound
+	}
+	expires, err := parseTime(session.ExpiresOn)
+	if err != nil {
+		return nil, err
+	}
+	if expires.Before(time.Now()) {
+		return nil, errSessionExpired
+	}
+	return session, nil
+}
+
+// RevokeSession deletes the session and marks it as revoked in the cache so any access tokens issued for it stop
+// working without waiting for the cached active state to expire
+func RevokeSession(session *Session) error {
+	_, err := config.DBConnection.Exec(`DELETE FROM Sessions WHERE id = ?`, session.ID)
+	if err != nil {
+		return err
+	}
+	_, err = config.CacheClient.Set(getSessionRevokedCacheKey(session.ID), Yes, tokenExpiresMinutesAccess*time.Minute).Result()
+	return err
+}
+
+// deleteSessionsThatExpireBefore deletes the sessions that can no longer be refreshed; their access tokens will have
+// already expired, so they don't need to be marked as revoked
+func deleteSessionsThatExpireBefore(expiresBefore string) error {
+	_, err := config.DBConnection.Exec(`DELETE FROM Sessions WHERE expiresOn < ?`, expiresBefore)
+	return err
+}
+
+// RevokeAllSessionsForUser revokes every session for a user, logging them out everywhere
+func RevokeAllSessionsForUser(userID int64) error {
+	sessions := []Session{}
+	err := config.DBConnection.Select(&sessions, `SELECT * FROM Sessions WHERE userId = ?`, userID)
+	if err != nil {
+		return err
+	}
+	for i := range sessions {
+		err = RevokeSession(&sessions[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isSessionRevoked checks if the session has been revoked before its access tokens expired. Revoking deletes the
+// session, so a session that is no longer in the DB is revoked; the cache sits in front of the DB so most requests
+// don't need the lookup, and losing the cache only costs a query
+func isSessionRevoked(sessionID int64) bool {
+	if sessionID == 0 {
+		return false
+	}
+	key := getSessionRevokedCacheKey(sessionID)
+	cached, err := config.CacheClient.Get(key).Result()
+	if err == nil {
+		return cached == Yes
+	}
+
+	found := 0
+	err = config.DBConnection.Get(&found, `SELECT COUNT(*) FROM Sessions WHERE id = ?`, sessionID)
+	if err != nil {
+		// if we can't tell, the token isn't honored
+		return true
+	}
+	if found == 0 {
+		config.CacheClient.Set(key, Yes, tokenExpiresMinutesAccess*time.Minute)
+		return true
+	}
+	config.CacheClient.Set(key, No, sessionActiveCacheMinutes*time.Minute)
+	return false
+}
+
+// generateRefreshToken creates a new refresh token for a session; the pattern is ker_sessionID^random
+func generateRefreshToken(sessionID int64) (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("ker_%d^%s", sessionID, hex.EncodeToString(b)), nil
+}
+
+// parseRefreshToken gets the session id out of the refresh token
+func parseRefreshToken(refreshToken string) (int64, error) {
+	parts := strings.Split(refreshToken, "^")
+	if len(parts) != 2 || parts[1] == "" {
+		return 0, errors.New("auth malformed")
+	}
+	subParts := strings.Split(parts[0], "_")
+	if len(subParts) != 2 || subParts[0] != "ker" {
+		return 0, errors.New("auth malformed")
+	}
+	return strconv.ParseInt(subParts[1], 10, 64)
+}
+
+// hashRefreshToken hashes the refresh token for storage; since the tokens are long and random, a plain sha256 is enough
+func hashRefreshToken(refreshToken string) string {
+	hashed := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(hashed[:])
+}
+
+// getIPFromRequest gets the IP without the port. The RealIP middleware will have already replaced the RemoteAddr if
+// the request came through a proxy
+func getIPFromRequest(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func getSessionRevokedCacheKey(sessionID int64) string {
+	return fmt.Sprintf("session_revoked_%d", sessionID)
+}
+
+//
+// processors
+//
+
+func (input *Session) processForDB() {
+	now := time.Now().Format(timeFormatDB)
+	if input.CreatedOn == "" {
+		input.CreatedOn = now
+	} else {
+		input.CreatedOn, _ = parseTimeToTimeFormat(input.CreatedOn, timeFormatDB)
+	}
+	if input.LastUsedOn == "" {
+		input.LastUsedOn = now
+	} else {
+		input.LastUsedOn, _ = parseTimeToTimeFormat(input.LastUsedOn, timeFormatDB)
+	}
+	if input.ExpiresOn == "" {
+		input.ExpiresOn = time.Now().Add(tokenExpiresMinutesRefresh * time.Minute).Format(timeFormatDB)
+	} else {
+		input.ExpiresOn, _ = parseTimeToTimeFormat(input.ExpiresOn, timeFormatDB)
+	}
+	if len(input.UserAgent) > sessionUserAgentMaxLength {
+		input.UserAgent = input.UserAgent[0:sessionUserAgentMaxLength]
+	}
+}
+
+func (input *Session) processForAPI() {
+	input.CreatedOn, _ = parseTimeToTimeFormat(input.CreatedOn, timeFormatAPI)
+	input.LastUsedOn, _ = parseTimeToTimeFormat(input.LastUsedOn, timeFormatAPI)
+	input.ExpiresOn, _ = parseTimeToTimeFormat(input.ExpiresOn, timeFormatAPI)
+}
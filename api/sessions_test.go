@@ -0,0 +1,50 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshTokenParsing(t *testing.T) {
+	token, err := generateRefreshToken(42)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(token, "ker_42^"))
+
+	sessionID, err := parseRefreshToken(token)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), sessionID)
+
+	other, err := generateRefreshToken(42)
+	assert.Nil(t, err)
+	assert.NotEqual(t, token, other)
+	assert.NotEqual(t, hashRefreshToken(token), hashRefreshToken(other))
+	assert.Equal(t, hashRefreshToken(token), hashRefreshToken(token))
+	assert.Equal(t, 64, len(hashRefreshToken(token)))
+
+	for _, bad := range []string{"", "ker_42", "ker_42^", "kes_42^abc", "ker_a^abc", "ker_1_2^abc"} {
+		_, err = parseRefreshToken(bad)
+		assert.NotNil(t, err, bad)
+	}
+}
+
+func TestSessionRevokedWithoutCache(t *testing.T) {
+	setupTesting()
+	user := &User{}
+	err := createTestUser(user)
+	assert.Nil(t, err)
+	defer DeleteUser(user.ID)
+
+	session, err := CreateSessionForUser(user.ID, nil)
+	assert.Nil(t, err)
+	assert.False(t, isSessionRevoked(session.ID))
+
+	// losing the cache, such as on a restart, must not bring a revoked session back
+	err = RevokeSession(session)
+	assert.Nil(t, err)
+	assert.True(t, isSessionRevoked(session.ID))
+	config.CacheClient.Del(getSessionRevokedCacheKey(session.ID))
+	assert.True(t, isSessionRevoked(session.ID))
+	assert.False(t, isSessionRevoked(0))
+}
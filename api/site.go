@@ -2,10 +2,16 @@ package api
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/go-redis/redis"
 )
 
 const (
@@ -17,43 +23,55 @@ const (
 	SiteProjectListOptionsActive = "show_active"
 	SiteProjectListOptionsNone   = "show_none"
 
-	siteCacheMinutes = 60 * 24
+	siteCacheMinutes        = 60 * 24
+	siteMissingCacheMinutes = 5
+
+	// siteDomainSetupCodeHours is how long a code for setting up another site can wait to be used
+	siteDomainSetupCodeHours = 24
+)
+
+var (
+	errSiteNotFound = errors.New("no site is served from this host")
 )
 
 // Site is an available location or installation
 type Site struct {
-	ID                   int64  `json:"id" db:"id"` // in the current set up, there should only be one site
-	CreatedOn            string `json:"createdOn" db:"createdOn"`
-	ShortName            string `json:"shortName" db:"shortName"`
-	Name                 string `json:"name" db:"name"`
-	Description          string `json:"description" db:"description"`
-	Domain               string `json:"domain" db:"domain"`
-	Status               string `json:"status" db:"status"`                         // pending, active, disabled
-	ProjectListOptions   string `json:"projectListOptions" db:"projectListOptions"` // show_all, show_active, show_none
-	SiteTechnicalContact string `json:"siteTechnicalContact" db:"siteTechnicalContact"`
-}
-
-// GetSite gets the site from the DB
+	ID                   int64    `json:"id" db:"id"`
+	CreatedOn            string   `json:"createdOn" db:"createdOn"`
+	ShortName            string   `json:"shortName" db:"shortName"`
+	Name                 string   `json:"name" db:"name"`
+	Description          string   `json:"description" db:"description"`
+	Domain               string   `json:"domain" db:"domain"`                         // the host the site is served from; requests are matched to a site by it
+	Status               string   `json:"status" db:"status"`                         // pending, active, disabled
+	ProjectListOptions   string   `json:"projectListOptions" db:"projectListOptions"` // show_all, show_active, show_none
+	SiteTechnicalContact string   `json:"siteTechnicalContact" db:"siteTechnicalContact"`
+	AllowUnverifiedLogin string   `json:"allowUnverifiedLogin" db:"allowUnverifiedLogin"` // yes, no; whether users can log in before verifying their email
+	RequireAdminMFA      string   `json:"requireAdminMfa" db:"requireAdminMfa"`           // yes, no; whether admins must use two-factor authentication
+	AllowedOriginsDB     string   `json:"-" db:"allowedOrigins"`
+	AllowedOrigins       []string `json:"allowedOrigins" db:"-"` // origins that may make credentialed cross-origin requests
+	TrustedProxiesDB     string   `json:"-" db:"trustedProxies"`
+	TrustedProxies       []string `json:"trustedProxies" db:"-"`                    // CIDRs of proxies whose forwarded-for headers are trusted
+	ChallengeProvider    string   `json:"challengeProvider" db:"challengeProvider"` // none, hcaptcha, turnstile; checked on public signups
+	ChallengeSiteKey     string   `json:"challengeSiteKey" db:"challengeSiteKey"`   // the public key the client needs to show the challenge
+}
+
+// GetSite gets the default site, which is the first one created. Requests from a host that does not match any
+// site's domain are served by it unless strict hosts are configured
 func GetSite() (*Site, error) {
-	site := &Site{}
-	cacheHit, err := config.CacheClient.Get(getSiteCacheKey()).Result()
-	if err == nil && len(cacheHit) > 0 {
-		err = json.Unmarshal([]byte(cacheHit), site)
-		if err == nil {
-			return site, nil
-		}
+	siteID, err := config.CacheClient.Get(getSiteDefaultCacheKey()).Int64()
+	if err == nil && siteID != 0 {
+		return GetSiteByID(siteID)
 	}
-	defer site.processForAPI()
-	err = config.DBConnection.Get(site, `SELECT * FROM Site LIMIT 1`)
-	if err == nil {
-		cacheData, _ := json.Marshal(site)
-		_, err = config.CacheClient.Set(getSiteCacheKey(), string(cacheData), siteCacheMinutes*time.Minute).Result()
+	err = config.DBConnection.Get(&siteID, `SELECT id FROM Site ORDER BY id LIMIT 1`)
+	if err != nil {
+		return &Site{}, err
 	}
-	return site, err
+	config.CacheClient.Set(getSiteDefaultCacheKey(), siteID, siteCacheMinutes*time.Minute)
+	return GetSiteByID(siteID)
 }
 
 // GetSiteFromContext is a helper to try to get the site from the context and, if it's not there,
-// get it from the Cache or DB
+// get the default site from the Cache or DB. If the request's host did not resolve to a site, an error is returned
 func GetSiteFromContext(ctx context.Context) (*Site, error) {
 	if ctx == nil {
 		return nil, errors.New("nil context")
@@ -62,6 +80,8 @@ func GetSiteFromContext(ctx context.Context) (*Site, error) {
 	site, siteOK := ctx.Value(appContextSite).(*Site)
 	if !siteOK {
 		site, err = GetSite()
+	} else if site == nil {
+		err = errSiteNotFound
 	}
 	return site, err
 }
@@ -69,11 +89,62 @@ func GetSiteFromContext(ctx context.Context) (*Site, error) {
 // GetSiteByID gets the site by the id
 func GetSiteByID(id int64) (*Site, error) {
 	site := &Site{}
-	defer site.processForAPI()
-	err := config.DBConnection.Get(site, `SELECT * FROM Site WHERE id = ? LIMIT 1`, id)
+	cacheHit, err := config.CacheClient.Get(getSiteCacheKey(id)).Result()
+	if err == nil && len(cacheHit) > 0 {
+		err = json.Unmarshal([]byte(cacheHit), site)
+		if err == nil {
+			return site, nil
+		}
+	}
+	err = config.DBConnection.Get(site, `SELECT * FROM Site WHERE id = ? LIMIT 1`, id)
+	site.processForAPI()
+	if err == nil {
+		// the site is cached after processing, since the lists are only sent in the JSON
+		cacheData, _ := json.Marshal(site)
+		config.CacheClient.Set(getSiteCacheKey(id), string(cacheData), siteCacheMinutes*time.Minute)
+	}
 	return site, err
 }
 
+// GetSiteByDomain gets the site served from the domain. The domain is normalized first, so a full URL or a host
+// with a port can be passed in
+func GetSiteByDomain(domain string) (*Site, error) {
+	domain = normalizeSiteDomain(domain)
+	if domain == "" {
+		return &Site{}, errSiteNotFound
+	}
+	siteID, err := config.CacheClient.Get(getSiteDomainCacheKey(domain)).Int64()
+	if err != nil {
+		err = config.DBConnection.Get(&siteID, `SELECT id FROM Site WHERE domain = ? ORDER BY id LIMIT 1`, domain)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return &Site{}, err
+		}
+		// hosts without a site are cached too, but not for as long, since every request looks up its host
+		expires := siteCacheMinutes * time.Minute
+		if siteID == 0 {
+			expires = siteMissingCacheMinutes * time.Minute
+		}
+		config.CacheClient.Set(getSiteDomainCacheKey(domain), siteID, expires)
+	}
+	if siteID == 0 {
+		return &Site{}, errSiteNotFound
+	}
+	return GetSiteByID(siteID)
+}
+
+// getSiteForRequest resolves the site from the request's host, falling back to the default site unless strict
+// hosts are configured
+func getSiteForRequest(r *http.Request) (*Site, error) {
+	site, err := GetSiteByDomain(r.Host)
+	if err == nil {
+		return site, nil
+	}
+	if config.SiteStrictHosts {
+		return nil, errSiteNotFound
+	}
+	return GetSite()
+}
+
 // CreateSite creates a site; this should be called relatively infrequently
 func CreateSite(input *Site) error {
 	input.processForDB()
@@ -86,17 +157,19 @@ func CreateSite(input *Site) error {
 	domain = :domain,
 	status = :status,
 	projectListOptions = :projectListOptions,
-	siteTechnicalContact = :siteTechnicalContact`, input)
+	siteTechnicalContact = :siteTechnicalContact,
+	allowUnverifiedLogin = :allowUnverifiedLogin,
+	requireAdminMfa = :requireAdminMfa,
+	allowedOrigins = :allowedOrigins,
+	trustedProxies = :trustedProxies,
+	challengeProvider = :challengeProvider,
+	challengeSiteKey = :challengeSiteKey`, input)
 	if err != nil {
 		return err
 	}
 	input.ID, _ = res.LastInsertId()
 	// flush the cache
-	if err == nil {
-		cacheData, _ := json.Marshal(input)
-		_, err = config.CacheClient.Set(getSiteCacheKey(), string(cacheData), siteCacheMinutes*time.Minute).Result()
-	}
-	return err
+	return clearSiteCache(input.ID, input.Domain)
 }
 
 func createTestSite(defaults *Site) error {
@@ -106,11 +179,24 @@ func createTestSite(defaults *Site) error {
 	return CreateSite(defaults)
 }
 
+// getTestSiteID gets the id of the default site, which is what requests in tests resolve to since they have no host
+func getTestSiteID() int64 {
+	site, err := GetSite()
+	if err != nil {
+		return 0
+	}
+	return site.ID
+}
+
 // UpdateSite updates a site
 func UpdateSite(input *Site) error {
+	existing, err := GetSiteByID(input.ID)
+	if err != nil {
+		return err
+	}
 	input.processForDB()
 	defer input.processForAPI()
-	_, err := config.DBConnection.NamedExec(`UPDATE Site SET
+	_, err = config.DBConnection.NamedExec(`UPDATE Site SET
 	createdOn = :createdOn,
 	shortName = :shortName,
 	name = :name,
@@ -118,14 +204,23 @@ func UpdateSite(input *Site) error {
 	domain = :domain,
 	status = :status,
 	projectListOptions = :projectListOptions,
-	siteTechnicalContact = :siteTechnicalContact
+	siteTechnicalContact = :siteTechnicalContact,
+	allowUnverifiedLogin = :allowUnverifiedLogin,
+	requireAdminMfa = :requireAdminMfa,
+	allowedOrigins = :allowedOrigins,
+	trustedProxies = :trustedProxies,
+	challengeProvider = :challengeProvider,
+	challengeSiteKey = :challengeSiteKey
 	WHERE id = :id`, input)
-	// flush the cache
-	if err == nil {
-		cacheData, _ := json.Marshal(input)
-		_, err = config.CacheClient.Set(getSiteCacheKey(), string(cacheData), siteCacheMinutes*time.Minute).Result()
+	if err != nil {
+		return err
 	}
-	return err
+	// flush the cache, including the old domain if it changed
+	err = clearSiteCache(input.ID, existing.Domain)
+	if err != nil {
+		return err
+	}
+	return clearSiteCache(input.ID, input.Domain)
 }
 
 // DeleteSiteByID deletes a site. WARNING: Think REALLY HARD before calling this, as the ramifications could be...
@@ -134,19 +229,164 @@ func UpdateSite(input *Site) error {
 func DeleteSiteByID(siteID int64) error {
 	// this is incredibly dangerous and should only be used in tests
 	// especially since we don't clean up any modules or anything
-	_, err := config.DBConnection.Exec("DELETE FROM Site WHERE id = ?", siteID)
+	site, err := GetSiteByID(siteID)
+	if err != nil {
+		return err
+	}
+	_, err = config.DBConnection.Exec("DELETE FROM Site WHERE id = ?", siteID)
 	if err != nil {
 		return err
 	}
-	_, err = config.CacheClient.Del(getSiteCacheKey()).Result()
+	return clearSiteCache(siteID, site.Domain)
+}
+
+// clearSiteCache removes the cached site along with the domain lookup and the default site, which may change
+// when a site is created or deleted
+func clearSiteCache(siteID int64, domain string) error {
+	keys := []string{getSiteCacheKey(siteID), getSiteDefaultCacheKey()}
+	domain = normalizeSiteDomain(domain)
+	if domain != "" {
+		keys = append(keys, getSiteDomainCacheKey(domain))
+	}
+	_, err := config.CacheClient.Del(keys...).Result()
 	return err
 }
 
-func getSiteCacheKey() string {
-	return "site" // putting this as a func in case we want to cache on the id for separation in the future
+// clearAllSiteCaches removes every cached site and domain lookup, so a site changed in the DB while the server was
+// stopped, such as by a migration or the admin commands, is read fresh
+func clearAllSiteCaches() error {
+	keys := []string{getSiteDefaultCacheKey()}
+	for _, pattern := range []string{"site_[0-9]*", getSiteDomainCacheKey("*")} {
+		cursor := uint64(0)
+		for {
+			found, next, err := config.CacheClient.Scan(cursor, pattern, 100).Result()
+			if err != nil {
+				return err
+			}
+			keys = append(keys, found...)
+			cursor = next
+			if cursor == 0 {
+				break
+			}
+		}
+	}
+	_, err := config.CacheClient.Del(keys...).Result()
+	return err
+}
+
+// getSiteSetupCode gets the code needed to set up a site. A code from the environment is used over a generated one
+func getSiteSetupCode() string {
+	if config.SiteCode != "" {
+		return config.SiteCode
+	}
+	code, err := config.CacheClient.Get(getSiteSetupCodeCacheKey()).Result()
+	if err != nil {
+		return ""
+	}
+	return code
+}
+
+// ReissueSiteSetupCode generates a new code for setting up a site, replacing the old one. The code is kept in the
+// cache so every host, and the admin commands, see the same one
+func ReissueSiteSetupCode() (string, error) {
+	code := randomString(32)
+	_, err := config.CacheClient.Set(getSiteSetupCodeCacheKey(), code, 0).Result()
+	return code, err
+}
+
+// getSiteClientAddress gets the root address of the site's client app, for links sent to its users. The default site
+// uses KESPLORA_CLIENT_ADDRESS and any other site's client is served over https from its domain, so a link never sends
+// a user to another site's client
+func getSiteClientAddress(site *Site) (string, error) {
+	if site == nil || site.ID == 0 {
+		return "", errSiteNotFound
+	}
+	defaultSite, err := GetSite()
+	if err != nil {
+		return "", err
+	}
+	if site.ID == defaultSite.ID {
+		return config.ClientAddress, nil
+	}
+	if site.Domain == "" {
+		return "", fmt.Errorf("site %d has no domain to link to", site.ID)
+	}
+	return "https://" + site.Domain, nil
+}
+
+// clearSiteSetupCode removes the generated code once the first site is set up, so it can't be used again. A code
+// from the environment can't be removed, but it only sets up the first site
+func clearSiteSetupCode() error {
+	return config.CacheClient.Del(getSiteSetupCodeCacheKey()).Err()
+}
+
+// IssueSiteDomainSetupCode generates a code for setting up another site on the domain, replacing any earlier one. It
+// can be used once, within a day
+func IssueSiteDomainSetupCode(domain string) (string, error) {
+	domain = normalizeSiteDomain(domain)
+	if domain == "" {
+		return "", errors.New("a domain is required")
+	}
+	code := randomString(32)
+	_, err := config.CacheClient.Set(getSiteDomainSetupCodeCacheKey(domain), code, siteDomainSetupCodeHours*time.Hour).Result()
+	return code, err
+}
+
+// useSiteDomainSetupCode checks the code for the domain and removes it. Only one request can remove it, so two
+// requests with the same code can't both set up a site
+func useSiteDomainSetupCode(domain, code string) (bool, error) {
+	key := getSiteDomainSetupCodeCacheKey(normalizeSiteDomain(domain))
+	found, err := config.CacheClient.Get(key).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if code == "" || found != code {
+		return false, nil
+	}
+	removed, err := config.CacheClient.Del(key).Result()
+	return removed == 1, err
+}
+
+func getSiteCacheKey(siteID int64) string {
+	return fmt.Sprintf("site_%d", siteID)
+}
+
+func getSiteDomainCacheKey(domain string) string {
+	return fmt.Sprintf("site_domain_%s", domain)
+}
+
+func getSiteDefaultCacheKey() string {
+	return "site_default"
+}
+
+func getSiteSetupCodeCacheKey() string {
+	return "site_setup_code"
+}
+
+func getSiteDomainSetupCodeCacheKey(domain string) string {
+	return fmt.Sprintf("site_setup_code_%s", domain)
+}
+
+// normalizeSiteDomain reduces a domain, host, or URL to the lower case host name without a scheme, path, or port
+func normalizeSiteDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if i := strings.Index(domain, "://"); i != -1 {
+		domain = domain[i+3:]
+	}
+	if i := strings.IndexAny(domain, "/?#"); i != -1 {
+		domain = domain[:i]
+	}
+	if host, _, err := net.SplitHostPort(domain); err == nil {
+		domain = host
+	}
+	return strings.Trim(domain, "[].")
 }
 
 func (input *Site) processForDB() {
+	input.Domain = normalizeSiteDomain(input.Domain)
 	if input.Status == "" {
 		input.Status = SiteStatusPending
 	}
@@ -158,13 +398,48 @@ func (input *Site) processForDB() {
 	if input.ProjectListOptions == "" {
 		input.ProjectListOptions = SiteProjectListOptionsActive
 	}
+	if input.AllowUnverifiedLogin != No {
+		input.AllowUnverifiedLogin = Yes
+	}
+	if input.RequireAdminMFA != Yes {
+		input.RequireAdminMFA = No
+	}
+	if input.ChallengeProvider == "" {
+		input.ChallengeProvider = ChallengeProviderNone
+	}
 	if input.Status == "" {
 		input.Status = SiteStatusPending
 	}
+	origins := []string{}
+	for _, origin := range input.AllowedOrigins {
+		origin = normalizeOrigin(origin)
+		if origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	input.AllowedOrigins = origins
+	input.AllowedOriginsDB = strings.Join(origins, ",")
+	proxies := []string{}
+	for _, proxy := range input.TrustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	input.TrustedProxies = proxies
+	input.TrustedProxiesDB = strings.Join(proxies, ",")
 }
 
 func (input *Site) processForAPI() {
 	input.CreatedOn, _ = parseTimeToTimeFormat(input.CreatedOn, timeFormatAPI)
+	input.AllowedOrigins = []string{}
+	if input.AllowedOriginsDB != "" {
+		input.AllowedOrigins = strings.Split(input.AllowedOriginsDB, ",")
+	}
+	input.TrustedProxies = []string{}
+	if input.TrustedProxiesDB != "" {
+		input.TrustedProxies = strings.Split(input.TrustedProxiesDB, ",")
+	}
 }
 
 // Bind binds the data for the HTTP
@@ -1,8 +1,15 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -72,3 +79,193 @@ func (suite SuiteTestsSiteDB) TestSiteDBCalls() {
 	suite.Nil(err)
 	suite.Equal(originalSite.ID, foundSiteAfterDelete.ID)
 }
+
+func (suite SuiteTestsSiteDB) TestSiteResolvedFromHost() {
+	require := suite.Require()
+	defaultSite, err := GetSite()
+	require.Nil(err)
+
+	portal := &Site{
+		ShortName:   "portal",
+		Name:        "Portal",
+		Description: "Another department",
+		Domain:      "https://Portal.Kesplora.com/",
+		Status:      SiteStatusActive,
+	}
+	err = CreateSite(portal)
+	require.Nil(err)
+	defer DeleteSiteByID(portal.ID)
+	suite.Equal("portal.kesplora.com", portal.Domain)
+
+	found, err := GetSiteByDomain("portal.kesplora.com:8443")
+	require.Nil(err)
+	suite.Equal(portal.ID, found.ID)
+
+	defaultUser := &User{}
+	err = createTestUser(defaultUser)
+	require.Nil(err)
+	defer DeleteUser(defaultUser.ID)
+	portalUser := &User{
+		SiteID: portal.ID,
+	}
+	err = createTestUser(portalUser)
+	require.Nil(err)
+	defer DeleteUser(portalUser.ID)
+
+	request := func(host, endpoint, access string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, endpoint, nil)
+		req.Host = host
+		if access != "" {
+			req.Header.Add("Authorization", "Bearer "+access)
+		}
+		rr := httptest.NewRecorder()
+		SetupAPI().ServeHTTP(rr, req)
+		return rr
+	}
+
+	// known hosts get their own site and unknown hosts get the default site
+	res := request("portal.kesplora.com", "/site", "")
+	suite.Equal(http.StatusOK, res.Code, res.Body.String())
+	suite.Contains(res.Body.String(), "Another department")
+	res = request("unknown.kesplora.com", "/site", "")
+	suite.Equal(http.StatusOK, res.Code, res.Body.String())
+	suite.Contains(res.Body.String(), defaultSite.Name)
+
+	// users can only use their tokens on their own site
+	res = request("portal.kesplora.com", "/me", portalUser.Access)
+	suite.Equal(http.StatusOK, res.Code, res.Body.String())
+	res = request("portal.kesplora.com", "/me", defaultUser.Access)
+	suite.Equal(http.StatusUnauthorized, res.Code, res.Body.String())
+
+	// and the same login can be used on both sites
+	_, err = GetUserByEmail(portal.ID, defaultUser.Email)
+	suite.NotNil(err)
+	_, err = GetUserByEmail(defaultSite.ID, defaultUser.Email)
+	suite.Nil(err)
+
+	originalStrict := config.SiteStrictHosts
+	config.SiteStrictHosts = true
+	defer func() {
+		config.SiteStrictHosts = originalStrict
+	}()
+	res = request("unknown.kesplora.com", "/site", "")
+	suite.NotEqual(http.StatusOK, res.Code, res.Body.String())
+}
+
+func (suite SuiteTestsSiteDB) TestSiteClientAddress() {
+	require := suite.Require()
+	defaultSite, err := GetSite()
+	require.Nil(err)
+	address, err := getSiteClientAddress(defaultSite)
+	require.Nil(err)
+	suite.Equal(config.ClientAddress, address)
+	_, err = getSiteClientAddress(&Site{})
+	suite.NotNil(err)
+
+	portal := &Site{
+		ShortName:   "portal",
+		Name:        "Portal",
+		Description: "Another department",
+		Domain:      fmt.Sprintf("portal%d.kesplora.com", rand.Int63n(99999999)),
+		Status:      SiteStatusActive,
+	}
+	err = CreateSite(portal)
+	require.Nil(err)
+	defer DeleteSiteByID(portal.ID)
+	address, err = getSiteClientAddress(portal)
+	require.Nil(err)
+	suite.Equal("https://"+portal.Domain, address)
+
+	// links sent to the portal's users go to the portal's client
+	mailer := &mailerOutbox{
+		Directory: suite.T().TempDir(),
+	}
+	originalMailer := config.Mailer
+	config.Mailer = mailer
+	defer func() {
+		config.Mailer = originalMailer
+	}()
+	portalUser := &User{
+		SiteID: portal.ID,
+	}
+	err = createTestUser(portalUser)
+	require.Nil(err)
+	defer DeleteUser(portalUser.ID)
+	err = RequestPasswordResetForUser(portal, portalUser.Email)
+	require.Nil(err)
+	messages := testOutboxMessages(mailer)
+	require.Equal(1, len(messages))
+	suite.Contains(messages[0].Text, "https://"+portal.Domain+"/password/reset?token=")
+}
+
+func (suite SuiteTestsSiteDB) TestSiteSetupAnotherDomain() {
+	require := suite.Require()
+	defaultSite, err := GetSite()
+	require.Nil(err)
+	require.Equal(SiteStatusActive, defaultSite.Status)
+	originalCode := config.SiteCode
+	config.SiteCode = "test_install_code"
+	defer func() {
+		config.SiteCode = originalCode
+	}()
+
+	domain := fmt.Sprintf("portal%d.kesplora.com", rand.Int63n(99999999))
+	input := &siteConfigurationInput{
+		Code: config.SiteCode,
+		Site: Site{
+			Name:                 "Portal",
+			ShortName:            "portal",
+			Description:          "Another department",
+			Domain:               domain,
+			SiteTechnicalContact: "portal@kesplora.com",
+		},
+		AdminUser: User{
+			FirstName: "Portal",
+			LastName:  "Admin",
+			Email:     fmt.Sprintf("test_portal_%d@kesplora.com", rand.Int63n(99999999)),
+			Password:  "this IS @ simple P@ssw0rd!!",
+		},
+	}
+	configure := func() int {
+		body, _ := json.Marshal(input)
+		code, _, err := testEndpoint(http.MethodPost, "/setup", bytes.NewBuffer(body), routeAllConfigureSite, "")
+		require.Nil(err)
+		return code
+	}
+
+	// once the first site is active, the install's code can't add more
+	suite.Equal(http.StatusBadRequest, configure())
+	_, err = GetSiteByDomain(domain)
+	suite.NotNil(err)
+
+	// a code issued for another domain doesn't work either
+	input.Code, err = IssueSiteDomainSetupCode("other." + domain)
+	require.Nil(err)
+	suite.Equal(http.StatusBadRequest, configure())
+
+	input.Code, err = IssueSiteDomainSetupCode(domain)
+	require.Nil(err)
+	suite.Equal(http.StatusOK, configure())
+	created, err := GetSiteByDomain(domain)
+	require.Nil(err)
+	suite.Equal(SiteStatusActive, created.Status)
+	admin, err := GetUserByEmail(created.ID, input.AdminUser.Email)
+	require.Nil(err)
+	defer DeleteUser(admin.ID)
+
+	// the code is used up, so it can't set up the domain again even if the site goes away
+	err = DeleteSiteByID(created.ID)
+	require.Nil(err)
+	suite.Equal(http.StatusBadRequest, configure())
+	_, err = GetSiteByDomain(domain)
+	suite.NotNil(err)
+}
+
+func TestNormalizeSiteDomain(t *testing.T) {
+	assert.Equal(t, "kesplora.com", normalizeSiteDomain("kesplora.com"))
+	assert.Equal(t, "kesplora.com", normalizeSiteDomain(" Kesplora.com "))
+	assert.Equal(t, "kesplora.com", normalizeSiteDomain("kesplora.com:8080"))
+	assert.Equal(t, "study.kesplora.com", normalizeSiteDomain("https://study.kesplora.com/portal?x=1"))
+	assert.Equal(t, "::1", normalizeSiteDomain("[::1]:8080"))
+	assert.Equal(t, "", normalizeSiteDomain(""))
+}
@@ -1,11 +1,11 @@
 package api
 
 import (
-	"crypto/md5"
-	"encoding/hex"
+	cryptorand "crypto/rand"
+	"encoding/base64"
 	"errors"
 	"fmt"
-	"math/rand"
+	"math/big"
 	"net/http"
 	"time"
 )
@@ -13,6 +13,8 @@ import (
 const (
 	tokenExpiresMinutesEmail         = 30
 	tokenExpiresMinutesPasswordReset = 30
+	tokenExpiresMinutesMFA           = 5
+	tokenExpiresMinutesInvitation    = 60 * 24 * 7
 	tokenExpiresMinutesRefresh       = 60 * 24 * 7
 	tokenExpiresMinutesAccess        = 60 * 12 // for testing purposes, we will make this really long; once we go for release, shorten
 
@@ -20,9 +22,11 @@ const (
 	tokenTypePasswordReset = "password_reset"
 	tokenTypeRefresh       = "refresh"
 	tokenTypeAccess        = "access"
+	tokenTypeMFA           = "mfa"
+	tokenTypeInvitation    = "invitation"
 )
 
-// Token is a token struct that holds information about various token needs, including password reset, email verification, and refresh
+// Token is a token struct that holds information about various token needs, including password reset, email verification, invitations, and two-factor challenges
 type Token struct {
 	UserID    int64  `json:"userId" db:"userId"`
 	TokenType string `json:"tokenType" db:"tokenType"`
@@ -53,6 +57,14 @@ func getTokenForUser(userID int64, tokenType string) (*Token, error) {
 	return token, err
 }
 
+// getTokenByValue gets a token by its type and value, for when the user is not known, such as a password reset
+func getTokenByValue(tokenType, tokenValue string) (*Token, error) {
+	token := &Token{}
+	defer token.processForAPI()
+	err := config.DBConnection.Get(token, `SELECT * FROM Tokens WHERE tokenType = ? AND token = ?`, tokenType, tokenValue)
+	return token, err
+}
+
 // deleteTokenForUser deletes the token for a user
 func deleteTokenForUser(userID int64, tokenType string) error {
 	_, err := config.DBConnection.Exec(`DELETE FROM Tokens WHERE userId = ? AND tokenType = ?`, userID, tokenType)
@@ -72,6 +84,10 @@ func getExpiresTimeForTokenType(tokenType string) (time.Time, error) {
 		return time.Now().Add(tokenExpiresMinutesEmail * time.Minute), nil
 	case tokenTypePasswordReset:
 		return time.Now().Add(tokenExpiresMinutesPasswordReset * time.Minute), nil
+	case tokenTypeMFA:
+		return time.Now().Add(tokenExpiresMinutesMFA * time.Minute), nil
+	case tokenTypeInvitation:
+		return time.Now().Add(tokenExpiresMinutesInvitation * time.Minute), nil
 	case tokenTypeRefresh:
 		return time.Now().Add(tokenExpiresMinutesRefresh * time.Minute), nil
 	case tokenTypeAccess:
@@ -81,23 +97,11 @@ func getExpiresTimeForTokenType(tokenType string) (time.Time, error) {
 }
 
 func generateToken(user *User, tokenType string) (*Token, error) {
-	// for email and password, it's pretty straight forward
-	// for refresh, there's a bit more
-	tokenSize := 8
-	if tokenType == tokenTypeRefresh {
-		tokenSize = 32
-	}
-
-	rand.Seed(time.Now().UnixNano())
-	r := rand.Int63n(999999999999)
-	str := fmt.Sprintf("%d%s-%d %s", user.ID, randomString(20), r, tokenType)
-	hasher := md5.New()
-	hasher.Write([]byte(str))
-	hash := hex.EncodeToString(hasher.Sum(nil))
-	tokenString := hash[0:tokenSize]
-
-	if tokenType == tokenTypeRefresh {
-		tokenString = fmt.Sprintf("ker_%d^%s_%s", user.ID, randomString(12), tokenString)
+	// email, password reset, invitation, and MFA tokens are looked up by value alone, so they come from crypto/rand;
+	// 24 bytes encode to 32 characters. Refresh tokens belong to sessions and are generated there
+	tokenString, err := randomSecureString(24)
+	if err != nil {
+		return nil, err
 	}
 
 	token := &Token{
@@ -135,18 +139,34 @@ func generateCookies(accessToken, refreshToken string) (accessCookie, refreshCoo
 	return
 }
 
-// randomString takes a length and returns a randomized string of that length with letters, numbers, hyphens, and underscores
+// randomString takes a length and returns a randomized string of that length with letters, numbers, and symbols. The
+// characters are picked with crypto/rand, since it is used for generated passwords and setup codes
 func randomString(n int) string {
-	rand.Seed(time.Now().UnixNano())
 	var letter = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*()-+=[]{}")
 
 	b := make([]rune, n)
+	max := big.NewInt(int64(len(letter)))
 	for i := range b {
-		b[i] = letter[rand.Intn(len(letter))]
+		index, err := cryptorand.Int(cryptorand.Reader, max)
+		if err != nil {
+			panic(fmt.Sprintf("could not read random bytes: %v", err))
+		}
+		b[i] = letter[index.Int64()]
 	}
 	return string(b)
 }
 
+// randomSecureString returns n random bytes, URL safe encoded, for values that must not be guessed such as one-time
+// states or passwords no one is meant to know
+func randomSecureString(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := cryptorand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 //
 // processors
 //
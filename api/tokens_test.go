@@ -48,3 +48,16 @@ func TestTokenCRD(t *testing.T) {
 	assert.NotNil(t, err)
 
 }
+
+func TestTokenGeneration(t *testing.T) {
+	// tokens are found by value alone, so they must not repeat even for the same user and type at the same time
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		token, err := generateToken(&User{ID: 1}, tokenTypePasswordReset)
+		assert.Nil(t, err)
+		assert.Equal(t, 32, len(token.Token))
+		assert.False(t, seen[token.Token])
+		seen[token.Token] = true
+	}
+	assert.NotEqual(t, randomString(32), randomString(32))
+}
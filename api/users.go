@@ -1,6 +1,7 @@
 package api
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -24,15 +25,27 @@ const (
 	UserSystemRoleParticipant = "participant"
 )
 
+var (
+	errUserBadCredentials   = errors.New("login or password did not match")
+	errUserNotActive        = errors.New("user is not active")
+	errUserEmailNotVerified = errors.New("user email has not been verified")
+	errUserLastAdmin        = errors.New("the site must keep at least one active admin")
+	errUserNoEmail          = errors.New("user does not have an email address")
+)
+
 // User is a person with a login that has permission to "do stuff". This is for researchers, site admins, and participants
 type User struct {
 	ID              int64  `json:"id" db:"id"`
+	SiteID          int64  `json:"siteId" db:"siteId"`
 	Title           string `json:"title" db:"title"`
 	FirstName       string `json:"firstName" db:"firstName"`
 	LastName        string `json:"lastName" db:"lastName"`
 	Pronouns        string `json:"pronouns" db:"pronouns"`
 	Email           string `json:"email" db:"email"`
+	EmailVerified   string `json:"emailVerified" db:"emailVerified"`
 	Password        string `json:"password,omitempty" db:"password"`
+	MFAEnabled      string `json:"mfaEnabled" db:"mfaEnabled"`
+	MFASecret       string `json:"-" db:"mfaSecret"` // only set while enrolling or validating; see getMFASecretForUser
 	DateOfBirth     string `json:"dateOfBirth" db:"dateOfBirth"`
 	ParticipantCode string `json:"participantCode" db:"participantCode"`
 	Status          string `json:"status" db:"status"`
@@ -53,9 +66,9 @@ type User struct {
 func CreateUser(input *User) error {
 	input.processForDB()
 	defer input.processForAPI()
-	res, err := config.DBConnection.NamedExec(`INSERT INTO Users (title, firstName, lastName, pronouns, email, password, dateOfBirth, participantCode, status, systemRole, createdOn, lastLoginOn)
+	res, err := config.DBConnection.NamedExec(`INSERT INTO Users (siteId, title, firstName, lastName, pronouns, email, emailVerified, password, dateOfBirth, participantCode, status, systemRole, createdOn, lastLoginOn)
 	VALUES
-	(:title, :firstName, :lastName, :pronouns, :email, :password, :dateOfBirth, :participantCode, :status, :systemRole, :createdOn, :lastLoginOn)`, input)
+	(:siteId, :title, :firstName, :lastName, :pronouns, :email, :emailVerified, :password, :dateOfBirth, :participantCode, :status, :systemRole, :createdOn, :lastLoginOn)`, input)
 	if err != nil {
 		return err
 	}
@@ -63,7 +76,7 @@ func CreateUser(input *User) error {
 	return nil
 }
 
-// UpdateUser updates a user
+// UpdateUser updates a user; if the password is blank, as it is after processForAPI, the existing password is kept
 func UpdateUser(input *User) error {
 	input.processForDB()
 	defer input.processForAPI()
@@ -73,7 +86,8 @@ func UpdateUser(input *User) error {
 	lastName = :lastName,
 	pronouns = :pronouns,
 	email = :email,
-	password = :password,
+	emailVerified = :emailVerified,
+	password = IF(:password = '', password, :password),
 	dateOfBirth = :dateOfBirth,
 	participantCode = :participantCode,
 	status = :status,
@@ -84,14 +98,10 @@ func UpdateUser(input *User) error {
 	return err
 }
 
-// DeleteUser completely deletes a user, and should really only be used in tests
+// DeleteUser completely deletes a user and everything connected to them without saving an erasure receipt, and
+// should really only be used in tests; use EraseUser for real requests
 func DeleteUser(userID int64) error {
-	// TODO: as we add other user entries, we should delete them here (things like progress, etc)
-	_, err := config.DBConnection.Exec("DELETE FROM Users WHERE id = ?", userID)
-	if err != nil {
-		return err
-	}
-	_, err = config.DBConnection.Exec("DELETE FROM Tokens WHERE userId = ?", userID)
+	_, err := eraseUser(userID, 0, 0, false, true)
 	return err
 }
 
@@ -103,29 +113,64 @@ func GetUserByID(userID int64) (*User, error) {
 	return user, err
 }
 
-// GetUserByEmail gets a user by an email
-func GetUserByEmail(email string) (*User, error) {
+// GetSiteUserByID gets a user by the id, but only if they belong to the site; use this when the id comes from the request
+func GetSiteUserByID(siteID, userID int64) (*User, error) {
 	user := &User{}
 	defer user.processForAPI()
-	err := config.DBConnection.Get(user, `SELECT * FROM Users WHERE email = ?`, email)
+	err := config.DBConnection.Get(user, `SELECT * FROM Users WHERE id = ? AND siteId = ?`, userID, siteID)
 	return user, err
 }
 
-// GetUserByParticipantCode gets a user by the participant code
-func GetUserByParticipantCode(participantCode string) (*User, error) {
+// GetUserByEmail gets a user on the site by an email
+func GetUserByEmail(siteID int64, email string) (*User, error) {
 	user := &User{}
 	defer user.processForAPI()
-	err := config.DBConnection.Get(user, `SELECT * FROM Users WHERE participantCode = ?`, participantCode)
+	err := config.DBConnection.Get(user, `SELECT * FROM Users WHERE email = ? AND siteId = ?`, email, siteID)
 	return user, err
 }
 
-// GetAllUsersOnPlatform gets all the users on the platform
-func GetAllUsersOnPlatform() ([]User, error) {
+// isUserEmailTaken checks if another user on the site already has the email, since logins and lookups by email
+// expect a single match
+func isUserEmailTaken(siteID int64, email string) (bool, error) {
+	_, err := GetUserByEmail(siteID, strings.TrimSpace(email))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return false, err
+}
+
+// isUserParticipantCodeTaken checks if another user on the site already has the participant code, since logins and
+// resets by code expect a single match
+func isUserParticipantCodeTaken(siteID int64, participantCode string) (bool, error) {
+	_, err := GetUserByParticipantCode(siteID, strings.TrimSpace(participantCode))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return false, err
+}
+
+// GetUserByParticipantCode gets a user on the site by the participant code
+func GetUserByParticipantCode(siteID int64, participantCode string) (*User, error) {
+	user := &User{}
+	defer user.processForAPI()
+	err := config.DBConnection.Get(user, `SELECT * FROM Users WHERE participantCode = ? AND siteId = ?`, participantCode, siteID)
+	return user, err
+}
+
+// GetAllUsersOnPlatform gets all the users on the site
+func GetAllUsersOnPlatform(siteID int64) ([]User, error) {
 	users := []User{}
 	err := config.DBConnection.Select(&users, `SELECT u.*,
 	(SELECT COUNT(*) FROM ProjectUserLinks p WHERE p.userId = u.id) AS projectCount
 	FROM Users u
-	ORDER BY u.lastName, u.firstName, u.participantCode`)
+	WHERE u.siteId = ?
+	ORDER BY u.lastName, u.firstName, u.participantCode`, siteID)
 	for i := range users {
 		users[i].processForAPI()
 	}
@@ -146,35 +191,192 @@ func GetAllUsersInProject(projectID int64) ([]User, error) {
 	return users, err
 }
 
-func AttemptLoginForUser(emailOrCode, password string) (*User, error) {
-	// if the user value contains an @ we assume and email, otherwise, we assume it's
-	// a participant
+// getUserByLogin gets a user on the site by the value they would use to login; if the value contains an @ we
+// assume an email, otherwise, we assume it's a participant code. The user is NOT processed for the API
+func getUserByLogin(siteID int64, emailOrCode string) (*User, error) {
 	user := &User{}
 	var err error
 	if strings.Contains(emailOrCode, "@") {
-		err = config.DBConnection.Get(user, `SELECT * FROM Users WHERE email = ?`, emailOrCode)
+		err = config.DBConnection.Get(user, `SELECT * FROM Users WHERE email = ? AND siteId = ?`, emailOrCode, siteID)
 	} else {
-		err = config.DBConnection.Get(user, `SELECT * FROM Users WHERE participantCode = ?`, emailOrCode)
+		err = config.DBConnection.Get(user, `SELECT * FROM Users WHERE participantCode = ? AND siteId = ?`, emailOrCode, siteID)
+	}
+	return user, err
+}
+
+// AttemptLoginForUser checks the login and password. errUserBadCredentials is returned if either is wrong; any other
+// error means the password matched but the user cannot log in right now
+func AttemptLoginForUser(siteID int64, emailOrCode, password string) (*User, error) {
+	user, err := getUserByLogin(siteID, emailOrCode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, errUserBadCredentials
 	}
 	if err != nil {
 		return user, err
 	}
 	isValid := checkEncryptedPassword(password, user.Password)
 	if !isValid {
-		return user, errors.New("password did not match")
+		return user, errUserBadCredentials
 	}
 	user.processForAPI()
-	return user, nil
+	err = userCanAuthenticate(user)
+	return user, err
 }
 
+// userCanAuthenticate checks whether the user is in a state that allows logging in or refreshing access. Pending
+// users and users with an unverified email are only allowed if the site allows unverified logins. Participants
+// created with only a participant code have no email to verify
+func userCanAuthenticate(user *User) error {
+	if user.Status != UserStatusActive && user.Status != UserStatusPending {
+		return errUserNotActive
+	}
+	if user.Status == UserStatusActive && (user.Email == "" || user.EmailVerified == Yes) {
+		return nil
+	}
+	site, err := GetSiteByID(user.SiteID)
+	if err != nil {
+		return err
+	}
+	if site.AllowUnverifiedLogin != Yes {
+		return errUserEmailNotVerified
+	}
+	return nil
+}
+
+// LogOutUser logs the user out of every session on every device
 func LogOutUser(userID int64) error {
-	// delete the refresh token so that when the access expires, it won't work
-	// for now, that's it
-	return deleteTokenForUser(userID, tokenTypeRefresh)
+	return RevokeAllSessionsForUser(userID)
+}
+
+// RequestPasswordResetForUser generates a password reset token for the user on the site with the login and sends
+// the reset link to the site's client. Users without an email on file cannot receive the link and will need to contact
+// the site administrator
+func RequestPasswordResetForUser(site *Site, emailOrCode string) error {
+	address, err := getSiteClientAddress(site)
+	if err != nil {
+		return err
+	}
+	user, err := getUserByLogin(site.ID, emailOrCode)
+	if err != nil {
+		return err
+	}
+	if user.Email == "" {
+		return errors.New("user does not have an email address")
+	}
+	if user.Status == UserStatusDisabled {
+		return errors.New("user is disabled")
+	}
+
+	token, err := generateToken(user, tokenTypePasswordReset)
+	if err != nil {
+		return err
+	}
+	err = saveTokenForUser(token)
+	if err != nil {
+		return err
+	}
+
+	return sendTemplatedMail(user.Email, EmailTemplatePasswordReset, &EmailTemplateData{
+		Site:             site,
+		User:             user,
+		Link:             fmt.Sprintf("%s/password/reset?token=%s", address, token.Token),
+		ExpiresInMinutes: tokenExpiresMinutesPasswordReset,
+	})
 }
 
-func userGenerateTokens(user *User, generateRefreshToken bool) (accessToken *Token, accessExpires string, refreshToken *Token, err error) {
-	accessTokenString, accessExpires, err := generateJWT(user)
+// ForcePasswordResetForUser replaces the user's password with one no one knows, logs them out everywhere, and sends
+// them a reset link, so they must choose a new password before logging in again
+func ForcePasswordResetForUser(site *Site, user *User) error {
+	if user.Email == "" {
+		return errUserNoEmail
+	}
+	if user.Status == UserStatusDisabled {
+		return errUserNotActive
+	}
+	password, err := randomSecureString(32)
+	if err != nil {
+		return err
+	}
+	user.Password = password
+	err = UpdateUser(user)
+	user.Password = ""
+	if err != nil {
+		return err
+	}
+	err = LogOutUser(user.ID)
+	if err != nil {
+		return err
+	}
+	return RequestPasswordResetForUser(site, user.Email)
+}
+
+// checkUserIsNotLastAdmin makes sure a change to the user's role or status would not leave the site without an active
+// admin on their site, since that could only be fixed in the database
+func checkUserIsNotLastAdmin(user *User, newSystemRole, newStatus string) error {
+	if user.SystemRole != UserSystemRoleAdmin || user.Status != UserStatusActive {
+		return nil
+	}
+	if newSystemRole == UserSystemRoleAdmin && newStatus == UserStatusActive {
+		return nil
+	}
+	count := 0
+	err := config.DBConnection.Get(&count, `SELECT COUNT(*) FROM Users WHERE systemRole = ? AND status = ? AND id != ? AND siteId = ?`, UserSystemRoleAdmin, UserStatusActive, user.ID, user.SiteID)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errUserLastAdmin
+	}
+	return nil
+}
+
+// ResetPasswordForUser consumes a password reset token and sets the new password. On success, every
+// session is revoked so all existing logins must re-authenticate, and a locked account is unlocked
+func ResetPasswordForUser(tokenValue, newPassword string) (*User, error) {
+	token, err := getTokenByValue(tokenTypePasswordReset, tokenValue)
+	if err != nil {
+		return nil, err
+	}
+	expires, err := parseTime(token.ExpiresOn)
+	if err != nil {
+		return nil, err
+	}
+	if expires.Before(time.Now()) {
+		deleteTokenForUser(token.UserID, tokenTypePasswordReset)
+		return nil, fmt.Errorf("expired at %s", expires.Format(timeFormatAPI))
+	}
+
+	user, err := GetUserByID(token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = newPassword
+	// proving access to the email is enough to undo a lockout from failed logins
+	if user.Status == UserStatusLocked {
+		user.Status = UserStatusActive
+	}
+	err = UpdateUser(user)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = ""
+
+	err = deleteTokenForUser(user.ID, tokenTypePasswordReset)
+	if err != nil {
+		return user, err
+	}
+	err = LogOutUser(user.ID)
+	return user, err
+}
+
+// userGenerateTokens generates the access token for the user. If a session is passed in, it is rotated and the new
+// refresh token is returned as well
+func userGenerateTokens(user *User, session *Session) (accessToken *Token, accessExpires string, refreshToken *Token, err error) {
+	sessionID := int64(0)
+	if session != nil {
+		sessionID = session.ID
+	}
+	accessTokenString, accessExpires, err := generateJWT(user, sessionID)
 	if err != nil {
 		return
 	}
@@ -185,14 +387,18 @@ func userGenerateTokens(user *User, generateRefreshToken bool) (accessToken *Tok
 	accessToken.UserID = user.ID
 	accessToken.Token = accessTokenString
 
-	if generateRefreshToken {
-		refreshToken, err = generateToken(user, tokenTypeRefresh)
+	if session != nil {
+		refreshTokenString := ""
+		refreshTokenString, err = rotateSession(session)
 		if err != nil {
 			return
 		}
-		err = saveTokenForUser(refreshToken)
-		if err != nil {
-			return
+		refreshToken = &Token{
+			UserID:    user.ID,
+			TokenType: tokenTypeRefresh,
+			CreatedOn: time.Now().Format(timeFormatAPI),
+			ExpiresOn: session.ExpiresOn,
+			Token:     refreshTokenString,
 		}
 	}
 	return
@@ -217,15 +423,21 @@ func createTestUser(defaults *User) error {
 	if defaults.SystemRole == "" {
 		defaults.SystemRole = UserSystemRoleUser
 	}
+	if defaults.EmailVerified == "" {
+		defaults.EmailVerified = Yes
+	}
+	if defaults.SiteID == 0 {
+		defaults.SiteID = getTestSiteID()
+	}
 	err := CreateUser(defaults)
 	if err != nil {
 		return err
 	}
-	access, expires, refresh, err := userGenerateTokens(defaults, true)
+	session, err := CreateSessionForUser(defaults.ID, nil)
 	if err != nil {
 		return err
 	}
-	err = saveTokenForUser(refresh)
+	access, expires, refresh, err := userGenerateTokens(defaults, session)
 	if err != nil {
 		return err
 	}
@@ -237,17 +449,21 @@ func createTestUser(defaults *User) error {
 
 // jwtUser is a stripped down user for encoding into a jwt
 type jwtUser struct {
-	ID              int64  `json:"id" `
-	Title           string `json:"title" `
-	FirstName       string `json:"firstName" `
-	LastName        string `json:"lastName"`
-	Pronouns        string `json:"pronouns" `
-	Email           string `json:"email" `
-	DateOfBirth     string `json:"dateOfBirth" `
-	ParticipantCode string `json:"participantCode" `
-	Status          string `json:"status" `
-	SystemRole      string `json:"systemRole"`
-	Expires         string `json:"expires"`
+	ID              int64    `json:"id" `
+	SiteID          int64    `json:"siteId"`
+	Title           string   `json:"title" `
+	FirstName       string   `json:"firstName" `
+	LastName        string   `json:"lastName"`
+	Pronouns        string   `json:"pronouns" `
+	Email           string   `json:"email" `
+	DateOfBirth     string   `json:"dateOfBirth" `
+	ParticipantCode string   `json:"participantCode" `
+	Status          string   `json:"status" `
+	SystemRole      string   `json:"systemRole"`
+	Expires         string   `json:"expires"`
+	SessionID       int64    `json:"sessionId"`
+	APIKeyID        int64    `json:"apiKeyId,omitempty"` // set instead of the session when authenticated with an API key
+	Scopes          []string `json:"scopes,omitempty"`
 }
 
 type jwtClaims struct {
@@ -256,10 +472,11 @@ type jwtClaims struct {
 	jwt.StandardClaims
 }
 
-func generateJWT(input *User) (string, string, error) {
-	expires := time.Now().Add(tokenExpiresMinutesAccess * time.Minute).Format(timeFormatAPI)
-	user := jwtUser{
+// newJWTUser builds the user that is stored in the access token, which expires after the access token lifetime
+func newJWTUser(input *User, sessionID int64) jwtUser {
+	return jwtUser{
 		ID:              input.ID,
+		SiteID:          input.SiteID,
 		Title:           input.Title,
 		FirstName:       input.FirstName,
 		LastName:        input.LastName,
@@ -269,12 +486,30 @@ func generateJWT(input *User) (string, string, error) {
 		ParticipantCode: input.ParticipantCode,
 		Status:          input.Status,
 		SystemRole:      input.SystemRole,
-		Expires:         expires,
+		Expires:         time.Now().Add(tokenExpiresMinutesAccess * time.Minute).Format(timeFormatAPI),
+		SessionID:       sessionID,
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+}
+
+func generateJWT(input *User, sessionID int64) (string, string, error) {
+	user := newJWTUser(input, sessionID)
+	expires := user.Expires
+	claims := jwt.MapClaims{
 		"user": user,
 		"exp":  expires,
-	})
+	}
+
+	// prefer the asymmetric key so that hosts that only verify don't need a secret that can sign
+	if config.JWTKeys != nil && config.JWTKeys.Signing != nil {
+		token := jwt.NewWithClaims(config.JWTKeys.Signing.Method, claims)
+		token.Header["kid"] = config.JWTKeys.Signing.ID
+		tokenString, err := token.SignedString(config.JWTKeys.Signing.Private)
+		return tokenString, expires, err
+	}
+	if config.JWTSigningString == "" {
+		return "", expires, errJWTCannotSign
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString([]byte(config.JWTSigningString))
 
 	return tokenString, expires, err
@@ -282,10 +517,14 @@ func generateJWT(input *User) (string, string, error) {
 
 func parseJWT(input string) (jwtUser, error) {
 	token, err := jwt.ParseWithClaims(input, &jwtClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, nil
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			// the shared secret is only accepted if this host has it
+			if token.Method.Alg() != jwt.SigningMethodHS256.Alg() || config.JWTSigningString == "" {
+				return nil, errJWTUnknownKey
+			}
+			return []byte(config.JWTSigningString), nil
 		}
-		return []byte(config.JWTSigningString), nil
+		return config.JWTKeys.getVerificationKey(token)
 	})
 	if err != nil {
 		return jwtUser{}, errors.New("could not parse jwt")
@@ -315,6 +554,12 @@ func (input *User) processForDB() {
 	if input.SystemRole == "" {
 		input.SystemRole = UserSystemRoleUser
 	}
+	if input.EmailVerified != Yes {
+		input.EmailVerified = No
+	}
+	if input.MFAEnabled != Yes {
+		input.MFAEnabled = No
+	}
 	if input.DateOfBirth == "" {
 		input.DateOfBirth = "1970-01-01"
 	} else {
@@ -344,6 +589,7 @@ func (input *User) processForAPI() {
 	input.CreatedOn, _ = parseTimeToTimeFormat(input.CreatedOn, timeFormatAPI)
 	input.LastLoginOn, _ = parseTimeToTimeFormat(input.LastLoginOn, timeFormatAPI)
 	input.Password = ""
+	input.MFASecret = ""
 }
 
 // Bind binds the data for the HTTP
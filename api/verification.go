@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	emailVerificationResendSeconds = 60
+)
+
+var (
+	errVerificationThrottled = errors.New("verification recently sent")
+	errVerificationNotNeeded = errors.New("email already verified")
+)
+
+// SendEmailVerificationForUser issues a new email token for the user and sends the verification link for the site's
+// client to their current email. Any previously issued email token is replaced
+func SendEmailVerificationForUser(site *Site, user *User) error {
+	if user.Email == "" {
+		return errors.New("user does not have an email address")
+	}
+	if user.EmailVerified == Yes {
+		return errVerificationNotNeeded
+	}
+	address, err := getSiteClientAddress(site)
+	if err != nil {
+		return err
+	}
+
+	token, err := generateToken(user, tokenTypeEmail)
+	if err != nil {
+		return err
+	}
+	err = saveTokenForUser(token)
+	if err != nil {
+		return err
+	}
+
+	return sendTemplatedMail(user.Email, EmailTemplateEmailVerification, &EmailTemplateData{
+		Site:             site,
+		User:             user,
+		Link:             fmt.Sprintf("%s/verify?token=%s", address, token.Token),
+		ExpiresInMinutes: tokenExpiresMinutesEmail,
+	})
+}
+
+// ResendEmailVerificationForUser sends a new verification link, but only if one has not been sent too recently
+func ResendEmailVerificationForUser(site *Site, user *User) error {
+	if user.EmailVerified == Yes {
+		return errVerificationNotNeeded
+	}
+	set, err := config.CacheClient.SetNX(getVerificationResendCacheKey(user.ID), "1", emailVerificationResendSeconds*time.Second).Result()
+	if err != nil {
+		return err
+	}
+	if !set {
+		return errVerificationThrottled
+	}
+	return SendEmailVerificationForUser(site, user)
+}
+
+// VerifyEmailForUser consumes an email token, marks the email as verified, and activates pending users
+func VerifyEmailForUser(tokenValue string) (*User, error) {
+	token, err := getTokenByValue(tokenTypeEmail, tokenValue)
+	if err != nil {
+		return nil, err
+	}
+	expires, err := parseTime(token.ExpiresOn)
+	if err != nil {
+		return nil, err
+	}
+	if expires.Before(time.Now()) {
+		deleteTokenForUser(token.UserID, tokenTypeEmail)
+		return nil, fmt.Errorf("expired at %s", expires.Format(timeFormatAPI))
+	}
+
+	// we only update the flags so we don't accidentally touch anything else on the account
+	_, err = config.DBConnection.Exec(`UPDATE Users SET
+	emailVerified = ?,
+	status = IF(status = ?, ?, status)
+	WHERE id = ?`, Yes, UserStatusPending, UserStatusActive, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	err = deleteTokenForUser(token.UserID, tokenTypeEmail)
+	if err != nil {
+		return nil, err
+	}
+	return GetUserByID(token.UserID)
+}
+
+func getVerificationResendCacheKey(userID int64) string {
+	return fmt.Sprintf("verify_resend_%d", userID)
+}
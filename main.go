@@ -1,23 +1,85 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/kevineaton/kesplora-api/api"
 )
 
-// main effectively sets up the API listener and then calls into the routes
+// main runs the subcommand, which is serve if none is given
 func main() {
+	command := "serve"
+	args := []string{}
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+		args = os.Args[2:]
+	}
+
+	switch command {
+	case "serve":
+		serve()
+	case "help", "-h", "--help":
+		fmt.Println(api.CommandUsage())
+	default:
+		api.SetupConfig()
+		err := api.RunCommand(command, args, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// serve effectively sets up the API listener and then calls into the routes
+func serve() {
 	// TODO: better logging
 	fmt.Printf("\nStarting...\n")
 	conf := api.SetupConfig()
+	err := api.CheckSchema()
+	if err != nil {
+		fmt.Printf("\nError: %v\n", err)
+		os.Exit(1)
+	}
 	r := api.SetupAPI()
 	fmt.Printf("\tListening on %s", conf.APIPort)
 	api.CheckConfiguration() // determine if we need to set up a new site install
 
-	err := http.ListenAndServe(fmt.Sprintf(":%s", conf.APIPort), r)
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%s", conf.APIPort),
+		Handler: r,
+	}
+	servers := []*http.Server{server}
+	if conf.MetricsPort != "" {
+		// metrics can be kept off the public port, such as for a scraper inside the VPC
+		servers = append(servers, &http.Server{
+			Addr:    fmt.Sprintf(":%s", conf.MetricsPort),
+			Handler: api.SetupMetricsAPI(),
+		})
+		fmt.Printf("\tMetrics on %s", conf.MetricsPort)
+	}
+	for i := range servers {
+		go func(server *http.Server) {
+			err := server.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fmt.Printf("Error: %+v\n", err)
+				os.Exit(1)
+			}
+		}(servers[i])
+	}
+
+	// deploys send a SIGTERM, so let in-flight requests such as uploads finish before exiting
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	<-stop
+	fmt.Printf("\nShutting down...\n")
+	err = api.Shutdown(conf.ShutdownDrain, conf.ShutdownTimeout, servers...)
 	if err != nil {
 		fmt.Printf("Error: %+v\n", err)
+		os.Exit(1)
 	}
 }
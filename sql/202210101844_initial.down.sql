@@ -0,0 +1,24 @@
+-- removes everything, so only run this on an install whose data is no longer needed
+DROP TABLE IF EXISTS `Notes`;
+DROP TABLE IF EXISTS `BlockFile`;
+DROP TABLE IF EXISTS `Files`;
+DROP TABLE IF EXISTS `BlockEmbed`;
+DROP TABLE IF EXISTS `BlockExternal`;
+DROP TABLE IF EXISTS `BlockText`;
+DROP TABLE IF EXISTS `Tokens`;
+DROP TABLE IF EXISTS `ConsentResponses`;
+DROP TABLE IF EXISTS `ConsentForms`;
+DROP TABLE IF EXISTS `Users`;
+DROP TABLE IF EXISTS `BlockUserStatus`;
+DROP TABLE IF EXISTS `BlockFormSubmissionResponses`;
+DROP TABLE IF EXISTS `BlockFormSubmissions`;
+DROP TABLE IF EXISTS `BlockFormQuestionOptions`;
+DROP TABLE IF EXISTS `BlockFormQuestions`;
+DROP TABLE IF EXISTS `BlockForm`;
+DROP TABLE IF EXISTS `BlockModuleFlows`;
+DROP TABLE IF EXISTS `Blocks`;
+DROP TABLE IF EXISTS `Modules`;
+DROP TABLE IF EXISTS `Flows`;
+DROP TABLE IF EXISTS `ProjectUserLinks`;
+DROP TABLE IF EXISTS `Projects`;
+DROP TABLE IF EXISTS `Site`;
@@ -1,4 +1,3 @@
-DROP TABLE IF EXISTS `Site`;
 CREATE TABLE `Site` (
   `id` int(11) NOT NULL AUTO_INCREMENT,
   `createdOn` datetime not null,
@@ -12,7 +11,6 @@ CREATE TABLE `Site` (
   PRIMARY KEY (`id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `Projects`;
 CREATE TABLE `Projects` (
   `id` int(11) NOT NULL AUTO_INCREMENT,
   `siteId` int(11) NOT NULL,
@@ -39,7 +37,6 @@ CREATE TABLE `Projects` (
 ) ENGINE=InnoDB AUTO_INCREMENT=5 DEFAULT CHARSET=utf8mb4;
 
 
-DROP TABLE IF EXISTS `ProjectUserLinks`;
 CREATE TABLE `ProjectUserLinks` (
   `projectId` int(11) NOT NULL,
   `userId` int(11) NOT NULL,
@@ -47,7 +44,6 @@ CREATE TABLE `ProjectUserLinks` (
   PRIMARY KEY (`projectId`, `userId`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `Flows`;
 CREATE TABLE `Flows` (
   `projectId` int(11) NOT NULL,
   `moduleId` int(11) NOT NULL,
@@ -56,7 +52,6 @@ CREATE TABLE `Flows` (
   KEY `projectId` (`projectId`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `Modules`;
 CREATE TABLE `Modules` (
   `id` int(11) NOT NULL AUTO_INCREMENT,
   `name` varchar(128) NOT NULL,
@@ -65,7 +60,6 @@ CREATE TABLE `Modules` (
   PRIMARY KEY (`id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `Blocks`;
 CREATE TABLE `Blocks` (
   `id` int(11) NOT NULL AUTO_INCREMENT,
   `name` varchar(128) NOT NULL,
@@ -76,7 +70,6 @@ CREATE TABLE `Blocks` (
   KEY `blockType` (`blockType`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `BlockModuleFlows`;
 CREATE TABLE `BlockModuleFlows` (
   `blockId` int(11) NOT NULL,
   `moduleId` int(11) NOT NULL,
@@ -85,14 +78,12 @@ CREATE TABLE `BlockModuleFlows` (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
 
-DROP TABLE IF EXISTS `BlockForm`;
 CREATE TABLE `BlockForm` (
   `blockId` int(11) NOT NULL,
   `formType` ENUM('survey', 'quiz') NOT NULL DEFAULT 'survey',
   PRIMARY KEY (`blockId`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `BlockFormQuestions`;
 CREATE TABLE `BlockFormQuestions` (
   `id` int(11) NOT NULL AUTO_INCREMENT,
   `blockId` int(11) NOT NULL,
@@ -104,7 +95,6 @@ CREATE TABLE `BlockFormQuestions` (
   KEY (`formOrder`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `BlockFormQuestionOptions`;
 CREATE TABLE `BlockFormQuestionOptions` (
   `id` int(11) NOT NULL AUTO_INCREMENT,
   `questionId` int(11) NOT NULL,
@@ -115,7 +105,6 @@ CREATE TABLE `BlockFormQuestionOptions` (
   KEY (`questionId`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `BlockFormSubmissions`;
 CREATE TABLE `BlockFormSubmissions` (
   `id` int(11) NOT NULL AUTO_INCREMENT,
   `blockId` int(11) NOT NULL,
@@ -127,7 +116,6 @@ CREATE TABLE `BlockFormSubmissions` (
   KEY (`userId`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `BlockFormSubmissionResponses`;
 CREATE TABLE `BlockFormSubmissionResponses` (
   `id` int(11) NOT NULL AUTO_INCREMENT,
   `submissionId` int(11) NOT NULL,
@@ -142,7 +130,6 @@ CREATE TABLE `BlockFormSubmissionResponses` (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
 
-DROP TABLE IF EXISTS `BlockUserStatus`;
 CREATE TABLE `BlockUserStatus` (
   `userId` int(11) NOT NULL,
   `blockId` int(11) NOT NULL,
@@ -153,7 +140,6 @@ CREATE TABLE `BlockUserStatus` (
   PRIMARY KEY (`userId`, `blockId`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `Users`;
 CREATE TABLE `Users` (
   `id` int(11) NOT NULL AUTO_INCREMENT,
   `title` varchar(32) NOT NULL DEFAULT '',
@@ -173,7 +159,6 @@ CREATE TABLE `Users` (
   KEY `participantCode` (`participantCode`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 ;
 
-DROP TABLE IF EXISTS `ConsentForms`;
 CREATE TABLE `ConsentForms` (
   `projectId` int(11) NOT NULL,
   `contentInMarkdown` text NOT NULL,
@@ -182,7 +167,6 @@ CREATE TABLE `ConsentForms` (
   PRIMARY KEY (`projectId`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `ConsentResponses`;
 CREATE TABLE `ConsentResponses` (
   `id` int(11) NOT NULL AUTO_INCREMENT,
   `projectId` int(11) NOT NULL,
@@ -199,7 +183,6 @@ CREATE TABLE `ConsentResponses` (
   KEY `participantId` (`participantId`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `Tokens`;
 CREATE TABLE `Tokens` (
   `userId` int(11) NOT NULL,
   `tokenType` enum('email','password_reset','refresh') NOT NULL DEFAULT 'email',
@@ -209,21 +192,18 @@ CREATE TABLE `Tokens` (
   UNIQUE KEY `userId` (`userId`,`tokenType`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `BlockText`;
 CREATE TABLE `BlockText` (
   `blockId` int(11) NOT NULL,
   `text` text NOT NULL,
   PRIMARY KEY (`blockId`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `BlockExternal`;
 CREATE TABLE `BlockExternal` (
   `blockId` int(11) NOT NULL,
   `externalLink` varchar(2048) NOT NULL,
   PRIMARY KEY (`blockId`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `BlockEmbed`;
 CREATE TABLE `BlockEmbed` (
   `blockId` int(11) NOT NULL,
   `embedType` enum('youtube','external_pdf', 'internal_pdf') NOT NULL DEFAULT 'external_pdf',
@@ -232,7 +212,6 @@ CREATE TABLE `BlockEmbed` (
   PRIMARY KEY (`blockId`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `Files`;
 CREATE TABLE `Files` (
   `id` int(11) NOT NULL AUTO_INCREMENT,
   `remoteKey` varchar(512) NOT NULL DEFAULT '',
@@ -248,7 +227,6 @@ CREATE TABLE `Files` (
   KEY `visibility` (`visibility`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
-DROP TABLE IF EXISTS `BlockFile`;
 CREATE TABLE `BlockFile` (
   `blockId` int(11) NOT NULL,
   `fileId` int(11) NOT NULL,
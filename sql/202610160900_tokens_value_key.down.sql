@@ -0,0 +1 @@
+ALTER TABLE `Tokens` DROP KEY `token`;
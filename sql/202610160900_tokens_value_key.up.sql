@@ -0,0 +1,2 @@
+-- password reset tokens are looked up by value
+ALTER TABLE `Tokens` ADD KEY `token` (`token`);
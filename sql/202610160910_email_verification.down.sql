@@ -0,0 +1,2 @@
+ALTER TABLE `Site` DROP COLUMN `allowUnverifiedLogin`;
+ALTER TABLE `Users` DROP COLUMN `emailVerified`;
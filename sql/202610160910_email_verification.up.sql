@@ -0,0 +1,5 @@
+ALTER TABLE `Users` ADD COLUMN `emailVerified` enum('yes','no') NOT NULL DEFAULT 'no' AFTER `email`;
+-- existing accounts were created before verification existed, so we trust them
+UPDATE `Users` SET `emailVerified` = 'yes';
+
+ALTER TABLE `Site` ADD COLUMN `allowUnverifiedLogin` enum('yes','no') NOT NULL DEFAULT 'yes';
@@ -0,0 +1,9 @@
+CREATE TABLE `SiteEmailTemplates` (
+  `siteId` int(11) NOT NULL,
+  `templateName` varchar(64) NOT NULL,
+  `subject` varchar(512) NOT NULL DEFAULT '',
+  `textBody` text NOT NULL,
+  `htmlBody` text NOT NULL,
+  `updatedOn` datetime NOT NULL,
+  PRIMARY KEY (`siteId`, `templateName`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
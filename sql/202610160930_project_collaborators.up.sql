@@ -0,0 +1,8 @@
+CREATE TABLE `ProjectCollaborators` (
+  `projectId` int(11) NOT NULL,
+  `userId` int(11) NOT NULL,
+  `role` enum('owner','editor','analyst','viewer') NOT NULL DEFAULT 'viewer',
+  `createdOn` datetime NOT NULL,
+  PRIMARY KEY (`projectId`, `userId`),
+  KEY `userId` (`userId`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
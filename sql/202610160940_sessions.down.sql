@@ -0,0 +1,2 @@
+-- the refresh tokens that were on sessions can't be moved back, so everyone has to log in again
+DROP TABLE IF EXISTS `Sessions`;
@@ -0,0 +1,18 @@
+CREATE TABLE `Sessions` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `userId` int(11) NOT NULL,
+  `refreshHash` varchar(64) NOT NULL DEFAULT '',
+  `previousHash` varchar(64) NOT NULL DEFAULT '',
+  `userAgent` varchar(512) NOT NULL DEFAULT '',
+  `ipAddress` varchar(64) NOT NULL DEFAULT '',
+  `createdOn` datetime NOT NULL,
+  `lastUsedOn` datetime NOT NULL,
+  `expiresOn` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `userId` (`userId`),
+  KEY `refreshHash` (`refreshHash`),
+  KEY `previousHash` (`previousHash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- refresh tokens now live on sessions, so the old ones can no longer be used
+DELETE FROM `Tokens` WHERE `tokenType` = 'refresh';
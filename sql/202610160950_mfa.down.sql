@@ -0,0 +1,9 @@
+ALTER TABLE `Site` DROP COLUMN `requireAdminMfa`;
+
+DELETE FROM `Tokens` WHERE `tokenType` = 'mfa';
+ALTER TABLE `Tokens` MODIFY COLUMN `tokenType` enum('email','password_reset','refresh') NOT NULL DEFAULT 'email';
+
+DROP TABLE IF EXISTS `UserRecoveryCodes`;
+
+ALTER TABLE `Users` DROP COLUMN `mfaSecret`;
+ALTER TABLE `Users` DROP COLUMN `mfaEnabled`;
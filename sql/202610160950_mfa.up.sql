@@ -0,0 +1,13 @@
+ALTER TABLE `Users` ADD COLUMN `mfaEnabled` enum('yes','no') NOT NULL DEFAULT 'no' AFTER `password`;
+ALTER TABLE `Users` ADD COLUMN `mfaSecret` varchar(64) NOT NULL DEFAULT '' AFTER `mfaEnabled`;
+
+CREATE TABLE `UserRecoveryCodes` (
+  `userId` int(11) NOT NULL,
+  `codeHash` varchar(64) NOT NULL,
+  `createdOn` datetime NOT NULL,
+  PRIMARY KEY (`userId`, `codeHash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+ALTER TABLE `Tokens` MODIFY COLUMN `tokenType` enum('email','password_reset','refresh','mfa') NOT NULL DEFAULT 'email';
+
+ALTER TABLE `Site` ADD COLUMN `requireAdminMfa` enum('yes','no') NOT NULL DEFAULT 'no';
@@ -0,0 +1,13 @@
+CREATE TABLE `ApiKeys` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `userId` int(11) NOT NULL,
+  `name` varchar(128) NOT NULL,
+  `prefix` varchar(16) NOT NULL,
+  `keyHash` varchar(64) NOT NULL,
+  `scopes` varchar(1024) NOT NULL DEFAULT '',
+  `createdOn` datetime NOT NULL,
+  `lastUsedOn` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `keyHash` (`keyHash`),
+  KEY `userId` (`userId`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,2 @@
+DELETE FROM `Tokens` WHERE `tokenType` = 'invitation';
+ALTER TABLE `Tokens` MODIFY COLUMN `tokenType` enum('email','password_reset','refresh','mfa') NOT NULL DEFAULT 'email';
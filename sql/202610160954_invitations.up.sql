@@ -0,0 +1 @@
+ALTER TABLE `Tokens` MODIFY COLUMN `tokenType` enum('email','password_reset','refresh','mfa','invitation') NOT NULL DEFAULT 'email';
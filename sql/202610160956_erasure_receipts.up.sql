@@ -0,0 +1,13 @@
+CREATE TABLE `ErasureReceipts` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `userId` int(11) NOT NULL,
+  `projectId` int(11) NOT NULL DEFAULT 0,
+  `scope` enum('account','project') NOT NULL DEFAULT 'account',
+  `requestedBy` int(11) NOT NULL DEFAULT 0,
+  `performedOn` datetime NOT NULL,
+  `counts` varchar(2048) NOT NULL DEFAULT '',
+  `receiptHash` varchar(64) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  KEY `userId` (`userId`),
+  KEY `projectId` (`projectId`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,9 @@
+-- everything is left on the site it was on; this only works if there is a single site
+ALTER TABLE `ErasureReceipts` DROP KEY `siteId`, DROP COLUMN `siteId`;
+ALTER TABLE `Notes` DROP KEY `siteId`, DROP COLUMN `siteId`;
+ALTER TABLE `Users` DROP KEY `siteId`, DROP COLUMN `siteId`;
+ALTER TABLE `Files` DROP KEY `siteId`, DROP COLUMN `siteId`;
+ALTER TABLE `Blocks` DROP KEY `siteId`, DROP COLUMN `siteId`;
+ALTER TABLE `Modules` DROP KEY `siteId`, DROP COLUMN `siteId`;
+
+ALTER TABLE `Site` DROP KEY `domain`;
@@ -0,0 +1,17 @@
+-- each site is resolved from the request host, so the domain is looked up on every request
+ALTER TABLE `Site` ADD KEY `domain` (`domain`(191));
+
+ALTER TABLE `Modules` ADD COLUMN `siteId` int(11) NOT NULL DEFAULT 0 AFTER `id`, ADD KEY `siteId` (`siteId`);
+ALTER TABLE `Blocks` ADD COLUMN `siteId` int(11) NOT NULL DEFAULT 0 AFTER `id`, ADD KEY `siteId` (`siteId`);
+ALTER TABLE `Files` ADD COLUMN `siteId` int(11) NOT NULL DEFAULT 0 AFTER `id`, ADD KEY `siteId` (`siteId`);
+ALTER TABLE `Users` ADD COLUMN `siteId` int(11) NOT NULL DEFAULT 0 AFTER `id`, ADD KEY `siteId` (`siteId`);
+ALTER TABLE `Notes` ADD COLUMN `siteId` int(11) NOT NULL DEFAULT 0 AFTER `id`, ADD KEY `siteId` (`siteId`);
+ALTER TABLE `ErasureReceipts` ADD COLUMN `siteId` int(11) NOT NULL DEFAULT 0 AFTER `id`, ADD KEY `siteId` (`siteId`);
+
+-- everything that exists belonged to the only site
+UPDATE `Modules` SET `siteId` = IFNULL((SELECT MIN(`id`) FROM `Site`), 0);
+UPDATE `Blocks` SET `siteId` = IFNULL((SELECT MIN(`id`) FROM `Site`), 0);
+UPDATE `Files` SET `siteId` = IFNULL((SELECT MIN(`id`) FROM `Site`), 0);
+UPDATE `Users` SET `siteId` = IFNULL((SELECT MIN(`id`) FROM `Site`), 0);
+UPDATE `Notes` SET `siteId` = IFNULL((SELECT MIN(`id`) FROM `Site`), 0);
+UPDATE `ErasureReceipts` SET `siteId` = IFNULL((SELECT MIN(`id`) FROM `Site`), 0);
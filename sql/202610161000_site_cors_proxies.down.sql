@@ -0,0 +1,2 @@
+ALTER TABLE `Site` DROP COLUMN `trustedProxies`;
+ALTER TABLE `Site` DROP COLUMN `allowedOrigins`;
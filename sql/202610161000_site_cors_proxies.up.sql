@@ -0,0 +1,3 @@
+-- comma separated lists; empty means only the client app may send credentials and no proxies are trusted
+ALTER TABLE `Site` ADD COLUMN `allowedOrigins` varchar(2048) NOT NULL DEFAULT '';
+ALTER TABLE `Site` ADD COLUMN `trustedProxies` varchar(2048) NOT NULL DEFAULT '';
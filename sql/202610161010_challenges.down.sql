@@ -0,0 +1,4 @@
+ALTER TABLE `Projects` DROP COLUMN `requireChallenge`;
+
+ALTER TABLE `Site` DROP COLUMN `challengeSiteKey`;
+ALTER TABLE `Site` DROP COLUMN `challengeProvider`;
@@ -0,0 +1,5 @@
+ALTER TABLE `Site` ADD COLUMN `challengeProvider` varchar(32) NOT NULL DEFAULT 'none';
+ALTER TABLE `Site` ADD COLUMN `challengeSiteKey` varchar(256) NOT NULL DEFAULT '';
+
+-- projects check the site's challenge on public signups unless turned off, such as for in-person studies
+ALTER TABLE `Projects` ADD COLUMN `requireChallenge` enum('yes','no') NOT NULL DEFAULT 'yes';
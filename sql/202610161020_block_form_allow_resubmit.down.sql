@@ -0,0 +1 @@
+ALTER TABLE `BlockForm` DROP COLUMN `allowResubmit`;
@@ -0,0 +1 @@
+ALTER TABLE `BlockForm` ADD COLUMN `allowResubmit` enum('yes','no') NOT NULL DEFAULT 'no';
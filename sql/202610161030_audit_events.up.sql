@@ -0,0 +1,26 @@
+-- each event's hash covers its fields and the previous event's hash on the site, so edits and removals can be detected;
+-- the actor, API key, and IP are covered through actorRef so erasing them doesn't break the chain
+CREATE TABLE `AuditEvents` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `siteId` int(11) NOT NULL DEFAULT 0,
+  `actorId` int(11) NOT NULL DEFAULT 0,
+  `apiKeyId` int(11) NOT NULL DEFAULT 0,
+  `actorRef` varchar(64) NOT NULL DEFAULT '',
+  `action` enum('read','create','update','delete') NOT NULL,
+  `method` varchar(8) NOT NULL DEFAULT '',
+  `route` varchar(256) NOT NULL DEFAULT '',
+  `path` varchar(512) NOT NULL DEFAULT '',
+  `targetType` varchar(64) NOT NULL DEFAULT '',
+  `targetId` int(11) NOT NULL DEFAULT 0,
+  `changes` mediumtext NOT NULL,
+  `ip` varchar(64) NOT NULL DEFAULT '',
+  `requestId` varchar(128) NOT NULL DEFAULT '',
+  `status` int(11) NOT NULL DEFAULT 0,
+  `occurredOn` datetime NOT NULL,
+  `previousHash` varchar(64) NOT NULL DEFAULT '',
+  `eventHash` varchar(64) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  KEY `siteId_occurredOn` (`siteId`, `occurredOn`),
+  KEY `actorId` (`actorId`),
+  KEY `target` (`targetType`, `targetId`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
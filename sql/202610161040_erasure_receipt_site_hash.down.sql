@@ -0,0 +1 @@
+UPDATE `ErasureReceipts` SET `receiptHash` = SHA2(CONCAT_WS('|', `userId`, `projectId`, `scope`, `requestedBy`, `performedOn`, `counts`), 256);
@@ -0,0 +1,2 @@
+-- the receipt hash now covers the site, so a receipt can't be moved to another site without breaking it
+UPDATE `ErasureReceipts` SET `receiptHash` = SHA2(CONCAT_WS('|', `siteId`, `userId`, `projectId`, `scope`, `requestedBy`, `performedOn`, `counts`), 256);
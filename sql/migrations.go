@@ -0,0 +1,9 @@
+// Package sql holds the schema migrations so they can be built into the binary
+package sql
+
+import "embed"
+
+// Migrations are the {version}_{name}.up.sql and .down.sql files in this directory
+//
+//go:embed *.sql
+var Migrations embed.FS